@@ -33,6 +33,32 @@ var frontendContent embed.FS
 // all routes and start the HTTP server. If the server fails to start an error
 // will be returned.
 func Start(s *state.State, a *jwtauth.Config) error {
+	router := newRouter(s, a)
+
+	// Start frame queue handler
+	go websocket.HandleQueue(s)
+	go websocket.PruneStatus(s)
+
+	// Start ingestion listener accepting client certificates
+	go startIngestion(s)
+
+	server := &http.Server{
+		Addr:         s.Config.ListenAddr,
+		Handler:      harden(s, router),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+	if s.Config.TLSEnabled() && !s.Settings.HTTPSEnabled {
+		s.Log.Warn("[main] TLS enabled, enable the HTTPS_ENABLED setting to secure cookies")
+	}
+
+	return listen(s, server)
+}
+
+// newRouter returns the main request router with the middleware and every
+// route registered.
+func newRouter(s *state.State, a *jwtauth.Config) *mux.Router {
 	// create main request router
 	router := mux.NewRouter()
 	router.StrictSlash(true)
@@ -40,42 +66,24 @@ func Start(s *state.State, a *jwtauth.Config) error {
 	// register performance profiling
 	router.PathPrefix("/debug/pprof/").Handler(http.DefaultServeMux)
 
-	// log all working requests on debug level
-	router.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// provide context to every request
-			ctx := context.Background()
-
-			// if real ip is available, use it
-			realIP := r.Header.Get("X-Real-IP")
-			addr := r.RemoteAddr
-			if realIP != "" {
-				addr = realIP
-			}
-			// update context with fields
-			fields := s.Log.WithFields(log.Fields{
-				"request": uuid.Generate(),
-				"addr":    addr,
-				"method":  r.Method,
-				"uri":     r.Host + r.RequestURI,
-			})
-			ctx = ctxlog.WithFields(ctx, fields)
-
-			// inject context into request
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	})
+	// log all working requests on debug level, record their latency
+	router.Use(requestContext(s))
+	router.Use(instrument())
 
-	// create /api router with access to middleware
+	// create /api router with access to middleware, cookie authenticated
+	// requests must carry the CSRF token
 	secureRouter := router.PathPrefix("/api/").Subrouter()
 	secureRouter.Use(func(next http.Handler) http.Handler {
-		return auth.Middleware(s, a, next)
+		return auth.CSRF(s, auth.Middleware(s, a, next))
 	})
 
 	// register status, 404 handler
 	router.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		statusHandler(s, w, r)
 	})
+	router.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		metricsHandler(s, w, r)
+	})
 
 	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
@@ -105,17 +113,58 @@ func Start(s *state.State, a *jwtauth.Config) error {
 	// register all routes
 	registerRoutes(s, a, router, secureRouter)
 
-	// Start frame queue handler
-	go websocket.HandleQueue(s)
+	return router
+}
+
+// requestContext returns the middleware providing every request with a logging
+// context.
+func requestContext(s *state.State) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// provide context to every request
+			ctx := context.Background()
+
+			// if real ip is available from a trusted proxy, use it
+			realIP := r.Header.Get("X-Real-IP")
+			addr := r.RemoteAddr
+			if realIP != "" && s.Config.TrustedProxy(r.RemoteAddr) {
+				addr = realIP
+			}
+			// update context with fields
+			fields := s.Log.WithFields(log.Fields{
+				"request": uuid.Generate(),
+				"addr":    addr,
+				"method":  r.Method,
+				"uri":     r.Host + r.RequestURI,
+			})
+			ctx = ctxlog.WithFields(ctx, fields)
+
+			// inject context into request
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// startIngestion serves the ingestion websocket over TLS on :6443, with server
+// certificates issued by the ingestion certificate authority. Ingestion clients
+// present the client certificate issued on approval, binding the connection to
+// their asset ID.
+func startIngestion(s *state.State) {
+	router := mux.NewRouter()
+	router.StrictSlash(true)
+	router.Use(requestContext(s))
+	router.Use(instrument())
+	websocket.RegisterWS(s, router.PathPrefix("/websocket/").Subrouter())
 
 	server := &http.Server{
-		Addr:         ":6060",
-		Handler:      router,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		Addr:        ":6443",
+		Handler:     harden(s, router),
+		TLSConfig:   auth.IngestionTLSConfig(),
+		ReadTimeout: 5 * time.Second,
+		IdleTimeout: 120 * time.Second,
 	}
 
-	s.Log.Info("[main] backend now listening on :6060")
-	return server.ListenAndServe()
+	s.Log.Info("[main] ingestion now listening on :6443")
+	err := server.ListenAndServeTLS("", "")
+	s.Log.Error("[main] ingestion listener stopped ", err)
 }
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+	log "github.com/sirupsen/logrus"
+)
+
+// exportWriteTimeout is the server write timeout of the test, exceeded by the
+// export.
+const exportWriteTimeout = 200 * time.Millisecond
+
+// fakeElastic serves the point in time and search requests of an export. The
+// search returns two documents only after the server write timeout.
+func fakeElastic(t *testing.T) *httptest.Server {
+	t.Helper()
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_pit") && r.Method == http.MethodPost:
+			io.WriteString(w, `{"id":"pit"}`)
+		case r.URL.Path == "/_pit" && r.Method == http.MethodDelete:
+			io.WriteString(w, `{"succeeded":true,"num_freed":1}`)
+		case r.URL.Path == "/_search":
+			time.Sleep(2 * exportWriteTimeout)
+			io.WriteString(w, `{"took":1,"timed_out":false,"_shards":{"total":1,"successful":1,"skipped":0,"failed":0},"hits":{"hits":[`+
+				`{"_index":"data-conn-a-1","_id":"1","_source":{"uid":"a"},"sort":[1,1]},`+
+				`{"_index":"data-conn-a-1","_id":"2","_source":{"uid":"b"},"sort":[2,2]}]}}`)
+		default:
+			// the audit log is not under test
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"type":"index_not_found_exception","reason":"not found"},"status":404}`)
+		}
+	}))
+	t.Cleanup(es.Close)
+	return es
+}
+
+func TestExportWriteDeadline(t *testing.T) {
+	es := fakeElastic(t)
+	client, err := elasticsearch.NewTypedClient(elasticsearch.Config{Addresses: []string{es.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New()
+	logger.SetOutput(io.Discard)
+	s := &state.State{
+		Log:        logger,
+		Config:     &state.Config{},
+		Settings:   &state.Settings{},
+		Elastic:    client,
+		ElasticCtx: context.Background(),
+	}
+	a, err := jwtauth.Init([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := a.CreateToken(&jwtauth.Payload{
+		UUID:      "admin@example.com",
+		Class:     jwtauth.UserAdmin,
+		Activated: true,
+		StandardClaims: jwt.StandardClaims{
+			Id:       "session",
+			IssuedAt: time.Now().Unix(),
+		},
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the export runs through the middleware of the server
+	server := httptest.NewUnstartedServer(harden(s, newRouter(s, a)))
+	server.Config.WriteTimeout = exportWriteTimeout
+	server.Start()
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/data/export?index=conn&format=ndjson"+
+		"&start=2020-01-01T00:00:00Z&end=2020-01-02T00:00:00Z", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: "X-State", Value: token})
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("export cut off by the write timeout: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", res.StatusCode, body)
+	}
+	expected := "{\"uid\":\"a\"}\n{\"uid\":\"b\"}\n"
+	if string(body) != expected {
+		t.Fatalf("expected %q, got %q", expected, body)
+	}
+}
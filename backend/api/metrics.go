@@ -0,0 +1,114 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package api provides the API service for the backend.
+package api
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/metrics"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+var (
+	// requestDuration is the latency of requests by route template
+	requestDuration = metrics.NewHistogram("canids_http_request_duration_seconds",
+		"Time to serve HTTP requests by route.", nil, "route", "method", "code")
+	// elasticUp is 1 if Elasticsearch answered the last ping
+	elasticUp = metrics.NewGauge("canids_elasticsearch_up",
+		"Whether Elasticsearch answered the ping of the last metrics scrape.")
+)
+
+// statusRecorder records the status code written by a handler. It supports
+// hijacking for websocket upgrades.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int // code is the written status code
+}
+
+// WriteHeader records the status code.
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Hijack hands over the connection of a websocket upgrade.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("api: response writer does not support hijacking")
+	}
+	r.code = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// Flush sends buffered data to the client.
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the response writer, so that http.ResponseController can
+// reach it to extend write deadlines.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// instrument returns the middleware recording the latency of every matched
+// route. Routes are labelled by their template so that identifiers in the path
+// do not create new series.
+func instrument() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			route := "unknown"
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					route = template
+				}
+			}
+			requestDuration.Observe(time.Since(start).Seconds(), route, r.Method, strconv.Itoa(recorder.code))
+		})
+	}
+}
+
+// metricsHandler is "/metrics". It returns the metrics in the Prometheus text
+// exposition format to requests with the METRICS_TOKEN bearer token. The
+// endpoint is disabled while no token is configured.
+func metricsHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+	token := s.Settings.MetricsToken
+	if token == "" {
+		notFoundHandler(s, w, r)
+		return
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// ping elasticsearch
+	up := 1.0
+	_, err := s.Elastic.Ping().Do(s.ElasticCtx)
+	if err != nil {
+		up = 0
+	}
+	elasticUp.Set(up)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.Write(w)
+}
@@ -8,12 +8,14 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/alarm"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/assets"
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/audit"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/blacklist"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/configuration"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/dashboard"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/data"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/fields"
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/role"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/user"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/view"
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/websocket"
@@ -35,6 +37,12 @@ func registerRoutes(s *state.State, a *jwtauth.Config, unsecure *mux.Router, sec
 	// register user service, require authentication: /api/user
 	user.RegisterRoutes(s, a, secure.PathPrefix("/user/").Subrouter())
 
+	// register role service, require authentication: /api/role
+	role.RegisterRoutes(s, a, secure.PathPrefix("/role/").Subrouter())
+
+	// register audit service, require authentication: /api/audit
+	audit.RegisterRoutes(s, a, secure.PathPrefix("/audit/").Subrouter())
+
 	// register view service, require authentication: /api/view
 	view.RegisterRoutes(s, a, secure.PathPrefix("/view/").Subrouter())
 
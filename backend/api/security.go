@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package api provides the API service for the backend.
+package api
+
+import (
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// contentSecurityPolicy allows the dashboard resources and Google Fonts,
+	// the exported frontend uses inline scripts and styles
+	contentSecurityPolicy = "default-src 'self'; " +
+		"script-src 'self' 'unsafe-inline'; " +
+		"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; " +
+		"font-src 'self' https://fonts.gstatic.com; " +
+		"img-src 'self' data:; " +
+		"connect-src 'self'; " +
+		"object-src 'none'; " +
+		"base-uri 'self'; " +
+		"frame-ancestors 'none'"
+	// strictTransportSecurity is one year, sent when the backend is accessed
+	// over HTTPS
+	strictTransportSecurity = "max-age=31536000"
+)
+
+// harden wraps the handler of a server, including requests not matched by the
+// router. The "X-Real-IP" header is removed unless the request is from a
+// trusted proxy, and the security headers are added to every response.
+func harden(s *state.State, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// only reverse proxies may provide the client address
+		if !s.Config.TrustedProxy(r.RemoteAddr) {
+			r.Header.Del("X-Real-IP")
+		}
+
+		header := w.Header()
+		header.Set("Content-Security-Policy", contentSecurityPolicy)
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "same-origin")
+		if r.TLS != nil || s.Settings.HTTPSEnabled {
+			header.Set("Strict-Transport-Security", strictTransportSecurity)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -7,6 +7,7 @@ package alarm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -19,6 +20,9 @@ import (
 
 type dataRequest struct {
 	Index    []string `json:"index"`    // Index is the list of indices to search
+	Assets   []string `json:"assets"`   // Assets is the list of asset IDs to search, empty for all permitted assets
+	Groups   []string `json:"groups"`   // Groups restricts the search to the assets in the asset groups, empty for all
+	Tags     []string `json:"tags"`     // Tags restricts the search to the assets with the tags, empty for all
 	Source   []string `json:"source"`   // Source is the list of sources to search
 	Dest     []string `json:"dest"`     // Dest is the list of destination alarms to search
 	Start    string   `json:"start"`    // Start is the start time of the search
@@ -40,7 +44,7 @@ const maxCards = 20
 func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 
 	// get user making current request + logging context
-	_, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
 	// attempt to parse request
@@ -99,8 +103,45 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		return
 	}
 
+	// restrict the search to the assets in the asset groups or with the tags
+	groupAssets, err := elasticsearch.AssetsMatching(s, request.Groups, request.Tags)
+	if err != nil && !errors.Is(err, elasticsearch.ErrNoAssets) {
+		l.Error("error resolving asset groups: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	if err != nil {
+		// no asset in the groups or with the tags, as for data views
+		l.Warn("no assets in asset groups or tags")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "No access to the requested assets.",
+		})
+		return
+	}
+
 	// get data for the specified fields in the specified time range, sorted by timestamp
-	data, availableRows, err := elasticsearch.GetAlarms(s, request.Index, request.Source, request.Dest, start, end, request.MaxSize, request.From, request.SourceIp, request.DestIp)
+	data, availableRows, err := elasticsearch.GetAlarms(s, request.Index, current.AssetScope(request.Assets, groupAssets), request.Source, request.Dest, start, end, request.MaxSize, request.From, request.SourceIp, request.DestIp)
+	if errors.Is(err, elasticsearch.ErrNoAssets) {
+		l.Warn("no permitted assets for alarms")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "No access to the requested assets.",
+		})
+		return
+	}
+	if errors.Is(err, elasticsearch.ErrInvalidScope) {
+		l.Warn("invalid alarm index or asset: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Invalid index or asset provided.",
+		})
+		return
+	}
 	if err != nil {
 		l.Error("error querying data conn: ", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -108,6 +149,26 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		return
 	}
 
+	// describe the asset of each alarm, returning the alarms without metadata if
+	// the ingestion clients cannot be queried
+	if len(data) > 0 {
+		clients, err := elasticsearch.AllIngest(s)
+		if err != nil {
+			l.Warn("error querying asset metadata: ", err)
+		}
+		byUUID := make(map[string]elasticsearch.DocumentIngestion, len(clients))
+		for _, c := range clients {
+			byUUID[c.UUID] = c
+		}
+		for i := range data {
+			if c, ok := byUUID[data[i].Asset]; ok {
+				metadata := c.AssetMetadata
+				data[i].AssetName = c.Name
+				data[i].Metadata = &metadata
+			}
+		}
+	}
+
 	// success
 	l.Info("successfully queried data for asset")
 	json.NewEncoder(w).Encode(dataResponse{
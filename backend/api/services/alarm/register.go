@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -32,4 +33,8 @@ func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 	r.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
 		dataHandler(r.Context(), s, a, w, r)
 	})
+	// triage an alarm /api/alarm/triage
+	r.HandleFunc("/triage", auth.Authorize(s, jwtauth.PermAlarmTriage, func(w http.ResponseWriter, r *http.Request) {
+		triageHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
 }
@@ -0,0 +1,117 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package alarm provides the alarms API service for the backend.
+package alarm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// triageStatuses are the valid alarm triage statuses.
+var triageStatuses = map[string]bool{
+	"open":           true,
+	"acknowledged":   true,
+	"resolved":       true,
+	"false_positive": true,
+}
+
+type triageRequest struct {
+	Index  string `json:"index"`  // Index is the Elasticsearch index of the alarm
+	ID     string `json:"id"`     // ID is the Elasticsearch document ID of the alarm
+	Status string `json:"status"` // Status is "open", "acknowledged", "resolved" or "false_positive"
+	Note   string `json:"note"`   // Note is an optional comment
+}
+
+// triageHandler is "/api/alarm/triage". It is responsible for setting the
+// triage status of an alarm of a permitted asset. It requires the
+// "alarm.triage" permission.
+func triageHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request triageRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		})
+		return
+	}
+	if !triageStatuses[request.Status] {
+		l.Warn("invalid triage status ", request.Status)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Invalid status, must be open, acknowledged, resolved or false_positive.",
+		})
+		return
+	}
+
+	// only alarms of permitted assets may be triaged
+	asset, ok := elasticsearch.AlarmAsset(request.Index)
+	if !ok || request.ID == "" {
+		l.Warnf("invalid alarm '%s' in '%s'", request.ID, request.Index)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Invalid alarm provided.",
+		})
+		return
+	}
+	if !elasticsearch.AssetPermitted(asset, current.AssetScope()) {
+		l.Warn("no access to the alarm asset ", asset)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "No access to the requested assets.",
+		})
+		return
+	}
+
+	triage := elasticsearch.AlarmTriage{
+		Status: request.Status,
+		User:   current.UUID,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Note:   request.Note,
+	}
+	err = elasticsearch.TriageAlarm(s, request.Index, request.ID, triage)
+	if errors.Is(err, elasticsearch.ErrAlarmNotFound) {
+		l.Warnf("alarm '%s' not found in '%s'", request.ID, request.Index)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Invalid alarm provided.",
+		})
+		return
+	}
+	if err != nil {
+		l.Error("failed to triage alarm ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	// success
+	auth.AuditDiff(s, r, "alarm.triage", request.Index+"/"+request.ID, "alarm triaged as "+request.Status, nil, triage)
+	l.Infof("successfully triaged alarm '%s' as %s", request.ID, request.Status)
+	json.NewEncoder(w).Encode(GeneralResponse{
+		Success: true,
+		Message: "The alarm has been successfully triaged.",
+	})
+}
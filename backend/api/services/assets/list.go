@@ -22,13 +22,13 @@ type listResponse struct {
 // listHandler is "/api/assets/list"
 func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 	// get user making current request + logging context
-	_, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
 	assetNameSet := make(map[string]bool)
 
-	// get all data-conn indices in the database and add them to the set
-	dataConns, err := elasticsearch.ListDataAssets(s)
+	// get all data-conn indices of the permitted assets and add them to the set
+	dataConns, err := elasticsearch.ListDataAssets(s, current.AssetScope())
 	if err != nil {
 		l.Error("error querying asset names: ", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,79 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package audit provides the audit log API service for the backend.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// defaultSize is the number of entries returned without "size" parameter
+	defaultSize = 100
+	// maxSize is the maximum number of entries returned
+	maxSize = 1000
+)
+
+// listResponse is the format of the list audit response.
+type listResponse struct {
+	Success bool                          `json:"success"` // Success indicates if the request was successful
+	Total   int64                         `json:"total"`   // Total is the number of entries matching the filter
+	Entries []elasticsearch.DocumentAudit `json:"entries"` // Entries are the matching entries, most recent first
+}
+
+// listHandler is "/api/audit/list". It will return the most recent audit
+// entries, optionally filtered by the "actor", "action" and "target" query
+// parameters and the RFC 3339 time range "from" and "to". Up to "size" entries
+// are returned. It requires the "audit.read" permission.
+func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	filter := elasticsearch.AuditFilter{
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+		Target: query.Get("target"),
+		From:   query.Get("from"),
+		To:     query.Get("to"),
+		Size:   defaultSize,
+	}
+	if size := query.Get("size"); size != "" {
+		parsed, err := strconv.Atoi(size)
+		if err != nil || parsed < 1 || parsed > maxSize {
+			l.Warn("invalid size ", size)
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Size must be between 1 and " + strconv.Itoa(maxSize) + ".",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+		filter.Size = parsed
+	}
+
+	entries, total, err := elasticsearch.QueryAudit(s, filter)
+	if err != nil {
+		l.Error("error getting audit entries ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	out := listResponse{
+		Success: true,
+		Total:   total,
+		Entries: entries,
+	}
+	json.NewEncoder(w).Encode(out)
+}
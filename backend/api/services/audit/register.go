@@ -0,0 +1,40 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package audit provides the audit log API service for the backend.
+package audit
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// GeneralResponse is the structure of a general response.
+type GeneralResponse struct {
+	Success bool   `json:"success"` // Success indicates if the request was successful
+	Message string `json:"message"` // Message describes the request response
+}
+
+var (
+	// InternalServerError is the a JSON error message.
+	InternalServerError = GeneralResponse{
+		Success: false,
+		Message: "500 Internal Server Error",
+	}
+)
+
+// RegisterRoutes registers routes to read the audit log.
+func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
+	// list audit entries /api/audit/list
+	r.HandleFunc("/list", auth.Authorize(s, jwtauth.PermAuditRead, func(w http.ResponseWriter, r *http.Request) {
+		listHandler(r.Context(), s, a, w, r)
+	}))
+	// verify audit hash chain /api/audit/verify
+	r.HandleFunc("/verify", auth.Authorize(s, jwtauth.PermAuditRead, func(w http.ResponseWriter, r *http.Request) {
+		verifyHandler(r.Context(), s, a, w, r)
+	}))
+}
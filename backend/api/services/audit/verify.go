@@ -0,0 +1,51 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package audit provides the audit log API service for the backend.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// verifyResponse is the format of the verify audit response.
+type verifyResponse struct {
+	Success  bool             `json:"success"`  // Success indicates if the request was successful
+	Valid    bool             `json:"valid"`    // Valid indicates if the hash chain is intact
+	Verified int64            `json:"verified"` // Verified is the number of entries verified before a break
+	Break    *auth.AuditBreak `json:"break"`    // Break is the first entry that does not verify, if any
+}
+
+// verifyHandler is "/api/audit/verify". It will walk the audit log and check
+// the hash chain, reporting the first modified or missing entry. It requires the
+// "audit.read" permission.
+func verifyHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	verified, broken, err := auth.VerifyAudit(s)
+	if err != nil {
+		l.Error("error verifying audit log ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	if broken != nil {
+		l.Warn("audit log hash chain broken at ", broken.Sequence, ": ", broken.Reason)
+	}
+	out := verifyResponse{
+		Success:  true,
+		Valid:    broken == nil,
+		Verified: verified,
+		Break:    broken,
+	}
+	json.NewEncoder(w).Encode(out)
+}
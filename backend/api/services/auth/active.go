@@ -9,7 +9,9 @@ import (
 )
 
 type IsActiveResponse struct {
-	Active bool `json:"active"`
+	Active     bool `json:"active"`     // Active indicates if an account has been set up
+	OIDC       bool `json:"oidc"`       // OIDC indicates if single sign-on is offered at /api/auth/oidc/login
+	LocalLogin bool `json:"localLogin"` // LocalLogin indicates if password login is enabled
 }
 
 func IsActiveHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
@@ -18,7 +20,9 @@ func IsActiveHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
 	isActive := elasticsearch.AuthIsActive(s)
 	w.WriteHeader(http.StatusOK)
 	resp := IsActiveResponse{
-		Active: isActive,
+		Active:     isActive,
+		OIDC:       s.Settings.OIDCEnabled,
+		LocalLogin: !s.Settings.LocalLoginDisable,
 	}
 
 	json.NewEncoder(w).Encode(resp)
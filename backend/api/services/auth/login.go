@@ -3,7 +3,6 @@ package auth
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
 	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
@@ -54,15 +53,67 @@ func loginHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *h
 		return
 	}
 
+	// local passwords disabled in favour of single sign-on
+	if s.Settings.LocalLoginDisable {
+		l.Info("[login] local login disabled")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Password login is disabled, please use single sign-on",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	if r.Method == "POST" {
 		uuid := request.UUID
 		password := request.Password
 
-		success, user := validateLogin(s, l, uuid, password)
+		// delay repeated failures from the client or for the account
+		if wait := auth.Throttle(r, uuid); wait > 0 {
+			l.Warn("[login] throttled login attempt for ", uuid)
+			auth.TooManyRequests(w, wait)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Too many failed attempts, please try again later",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+
+		success, user, enrolled := validateLogin(s, l, uuid, password)
+		if success && (enrolled || auth.MFARequired(s, user.Class)) {
+			// second step: TOTP code, or enrollment if enforced; failed logins
+			// are only cleared once the code is accepted
+			mfaToken, err := auth.NewMFAToken(a, user)
+			if err != nil {
+				l.Error("[login] failed to create MFA token ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				out := GeneralResponse{
+					Success: false,
+					Message: "Please contact the system administrator.",
+				}
+				json.NewEncoder(w).Encode(out)
+				return
+			}
+			l.Info("[login] password accepted, MFA step required")
+			out := mfaResponse{
+				Success:     true,
+				Message:     "Multi-factor authentication required",
+				MFAToken:    mfaToken,
+				MFARequired: enrolled,
+				MFAEnroll:   !enrolled,
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
 		if success {
+			err = auth.LoginSucceeded(s, user.UUID)
+			if err != nil {
+				l.Error("[login] failed to clear failed logins ", err)
+			}
 			// generate + send cookie
-			user.IssuedAt = time.Now().Unix()
-			token, err := a.CreateToken(user, auth.ExpireAge)
+			token, err := auth.NewSession(s, a, user, r)
 			if err != nil {
 				// can't issue new token, return login page with error
 				l.Error("[login] failed to create authentication token ", err)
@@ -95,6 +146,7 @@ func loginHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *h
 				cookie.Secure = true
 			}
 			http.SetCookie(w, &cookie)
+			auth.SetCSRFCookie(s, w)
 
 			l.Info("[login] token issued, X-State and X-Class cookies set")
 			w.WriteHeader(http.StatusOK)
@@ -106,6 +158,10 @@ func loginHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *h
 			return
 		}
 
+		err = auth.LoginFailed(s, r, uuid)
+		if err != nil {
+			l.Error("[login] failed to record failed login ", err)
+		}
 		w.WriteHeader(http.StatusBadRequest)
 		out := GeneralResponse{
 			Success: false,
@@ -117,7 +173,9 @@ func loginHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *h
 
 }
 
-func validateLogin(s *state.State, l *logrus.Entry, uuid string, pass string) (bool, *jwtauth.Payload) {
+// validateLogin checks the password of the user, returning if it is valid, the
+// user payload and if the user is enrolled in MFA.
+func validateLogin(s *state.State, l *logrus.Entry, uuid string, pass string) (bool, *jwtauth.Payload, bool) {
 
 	payload := &jwtauth.Payload{}
 
@@ -126,12 +184,17 @@ func validateLogin(s *state.State, l *logrus.Entry, uuid string, pass string) (b
 	if err != nil {
 		// error querying
 		l.Error("[login] failed to find uuid in database ", err)
-		return false, payload
+		return false, payload, false
 	}
 	// ensure user is activated
 	if !db.Activated {
 		l.Warn("[login] user is not activated ", db.UUID)
-		return false, payload
+		return false, payload, false
+	}
+	// ensure user is not locked out, failures are not counted while locked
+	if auth.AccountLocked(db) {
+		l.Warn("[login] user is locked out ", db.UUID)
+		return false, payload, false
 	}
 	// validate user
 	if uuid == db.UUID && jwtauth.HashCompare(db.Password, pass) {
@@ -140,9 +203,10 @@ func validateLogin(s *state.State, l *logrus.Entry, uuid string, pass string) (b
 		payload.Class = db.Class
 		payload.Name = db.Name
 		payload.Activated = db.Activated
-		return true, payload
+		payload.Assets = db.Assets
+		return true, payload, db.TOTPEnabled
 	}
 	// login not successful
 	l.Info("Username and password do not match")
-	return false, payload
+	return false, payload, false
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
@@ -27,6 +28,16 @@ func logoutHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *
 		return
 	}
 
+	// revoke the session of the X-State cookie
+	if stateCookie, err := r.Cookie("X-State"); err == nil {
+		if user, err := a.ParseToken(stateCookie.Value); err == nil && user.Id != "" {
+			err = auth.RevokeSession(s, user.Id)
+			if err != nil {
+				l.Error("[logout] failed to revoke session ", err)
+			}
+		}
+	}
+
 	// delete the X-State cookie
 	cookie := http.Cookie{
 		Name:     "X-State",
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// mfaRequest is the format of the MFA login step requests.
+type mfaRequest struct {
+	MFAToken string `json:"mfaToken"` // MFAToken is the intermediate token returned by login
+	Code     string `json:"code"`     // Code is a TOTP code or recovery code
+}
+
+// mfaResponse is the login response when a second step is required.
+type mfaResponse struct {
+	Success     bool   `json:"success"`     // Success indicates if the password was accepted
+	Message     string `json:"message"`     // Message describes the request response
+	MFAToken    string `json:"mfaToken"`    // MFAToken is the intermediate token for the second step
+	MFARequired bool   `json:"mfaRequired"` // MFARequired indicates a code must be sent to /api/auth/mfa/verify
+	MFAEnroll   bool   `json:"mfaEnroll"`   // MFAEnroll indicates MFA is enforced and the user must enroll first
+}
+
+// mfaEnrollResponse is the format of the MFA enrollment response.
+type mfaEnrollResponse struct {
+	Success bool   `json:"success"` // Success indicates if the request was successful
+	Secret  string `json:"secret"`  // Secret is the base32 TOTP secret for manual entry
+	URI     string `json:"uri"`     // URI is the otpauth:// provisioning URI to show as a QR code
+}
+
+// mfaActivateResponse is the format of the MFA activation response.
+type mfaActivateResponse struct {
+	Success       bool     `json:"success"`       // Success indicates if the request was successful
+	Message       string   `json:"message"`       // Message describes the request response
+	RecoveryCodes []string `json:"recoveryCodes"` // RecoveryCodes are shown once
+}
+
+// parseMFARequest decodes the request and its intermediate token. If either is
+// not valid, the error response is written and false is returned.
+func parseMFARequest(a *jwtauth.Config, w http.ResponseWriter, r *http.Request) (mfaRequest, *jwtauth.Payload, bool) {
+	l := ctxlog.Log(r.Context())
+	var request mfaRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Info("[mfa] failed to decode json")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return request, nil, false
+	}
+	user, err := auth.ParseMFAToken(a, request.MFAToken)
+	if err != nil {
+		l.Info("[mfa] invalid MFA token ", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Login expired, please sign in again",
+		}
+		json.NewEncoder(w).Encode(out)
+		return request, nil, false
+	}
+	return request, user, true
+}
+
+// mfaVerifyHandler is "/api/auth/mfa/verify". It completes a login with the
+// intermediate token and a TOTP code or recovery code.
+func mfaVerifyHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	request, user, ok := parseMFARequest(a, w, r)
+	if !ok {
+		return
+	}
+	if !checkMFAThrottle(w, r, user.UUID) {
+		return
+	}
+	err := auth.VerifyMFA(s, user.UUID, request.Code)
+	if err != nil {
+		l.Info("[mfa] invalid code for ", user.UUID, ": ", err)
+		err = auth.LoginFailed(s, r, user.UUID)
+		if err != nil {
+			l.Error("[mfa] failed to record failed login ", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid authentication code",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	err = auth.LoginSucceeded(s, user.UUID)
+	if err != nil {
+		l.Error("[mfa] failed to clear failed logins ", err)
+	}
+	if !startSession(s, a, w, r, user) {
+		return
+	}
+	l.Info("[mfa] token issued, X-State and X-Class cookies set")
+	out := GeneralResponse{
+		Success: true,
+		Message: "Successfully logged in",
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// mfaEnrollHandler is "/api/auth/mfa/enroll". It starts the enrollment of a
+// user that must use MFA but has not enrolled, with the intermediate token.
+func mfaEnrollHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	_, user, ok := parseMFARequest(a, w, r)
+	if !ok {
+		return
+	}
+	secret, uri, err := auth.BeginMFAEnrollment(s, user.UUID)
+	if err != nil {
+		l.Warn("[mfa] failed to begin enrollment ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Unable to enroll, please sign in again",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	out := mfaEnrollResponse{
+		Success: true,
+		Secret:  secret,
+		URI:     uri,
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// mfaActivateHandler is "/api/auth/mfa/activate". It confirms the enrollment
+// with a TOTP code and completes the login, returning the recovery codes.
+func mfaActivateHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	request, user, ok := parseMFARequest(a, w, r)
+	if !ok {
+		return
+	}
+	if !checkMFAThrottle(w, r, user.UUID) {
+		return
+	}
+	codes, err := auth.ActivateMFAEnrollment(s, user.UUID, request.Code)
+	if err != nil {
+		l.Info("[mfa] failed to activate enrollment for ", user.UUID, ": ", err)
+		err = auth.LoginFailed(s, r, user.UUID)
+		if err != nil {
+			l.Error("[mfa] failed to record failed login ", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid authentication code",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	err = auth.LoginSucceeded(s, user.UUID)
+	if err != nil {
+		l.Error("[mfa] failed to clear failed logins ", err)
+	}
+	if !startSession(s, a, w, r, user) {
+		return
+	}
+	l.Info("[mfa] enrolled, X-State and X-Class cookies set")
+	out := mfaActivateResponse{
+		Success:       true,
+		Message:       "Successfully enrolled and logged in",
+		RecoveryCodes: codes,
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// checkMFAThrottle delays repeated invalid codes for the user. If the request is
+// throttled, the error response is written and false is returned.
+func checkMFAThrottle(w http.ResponseWriter, r *http.Request, uuid string) bool {
+	wait := auth.Throttle(r, uuid)
+	if wait == 0 {
+		return true
+	}
+	ctxlog.Log(r.Context()).Warn("[mfa] throttled code for ", uuid)
+	auth.TooManyRequests(w, wait)
+	out := GeneralResponse{
+		Success: false,
+		Message: "Too many failed attempts, please try again later",
+	}
+	json.NewEncoder(w).Encode(out)
+	return false
+}
+
+// startSession starts a session for the user and sets the X-State, X-Class and
+// X-CSRF cookies. If the session can not be started, the error response is written
+// and false is returned.
+func startSession(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request, user *jwtauth.Payload) bool {
+	token, err := auth.NewSession(s, a, user, r)
+	if err != nil {
+		ctxlog.Log(r.Context()).Error("[login] failed to create authentication token ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact the system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return false
+	}
+	for _, cookie := range []http.Cookie{
+		{Name: "X-State", Value: token},
+		{Name: "X-Class", Value: string(user.Class)},
+	} {
+		cookie.Path = "/"
+		cookie.HttpOnly = true // secure the cookie from JS attacks
+		// upgrade cookie security if site is accessible over SSL
+		if s.Settings.HTTPSEnabled {
+			cookie.SameSite = http.SameSiteStrictMode
+			cookie.Secure = true
+		}
+		http.SetCookie(w, &cookie)
+	}
+	auth.SetCSRFCookie(s, w)
+	return true
+}
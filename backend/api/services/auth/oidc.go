@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/oidc"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// oidcCookie holds the state, nonce and PKCE verifier of a pending login
+	oidcCookie = "X-OIDC"
+	// oidcCookieAge is 10 minutes, how long a login at the provider may take
+	oidcCookieAge = 600
+	// oidcCallback is the path of the redirect URL registered with the provider
+	oidcCallback = "/api/auth/oidc/callback"
+)
+
+var (
+	// errNoRole is the error for a user whose groups map to no role
+	errNoRole = errors.New("no role mapped for user groups")
+)
+
+// oidcPending is the pending login stored in the oidcCookie.
+type oidcPending struct {
+	State    string `json:"state"`    // State protects the callback against CSRF
+	Nonce    string `json:"nonce"`    // Nonce binds the ID token to the login
+	Verifier string `json:"verifier"` // Verifier is the PKCE code verifier
+}
+
+// provider discovers the configured identity provider.
+func provider(r *http.Request, s *state.State) (*oidc.Provider, error) {
+	return oidc.Discover(r.Context(), s.Settings.OIDCIssuer, s.Settings.OIDCClientID,
+		s.Settings.OIDCClientSecret, strings.TrimSuffix(s.Settings.AccessURL, "/")+oidcCallback,
+		strings.Fields(s.Settings.OIDCScopes))
+}
+
+// oidcLoginHandler is "/api/auth/oidc/login". It redirects the browser to the
+// identity provider, storing the state, nonce and PKCE verifier in a cookie.
+func oidcLoginHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+
+	if !s.AuthReady || !s.Settings.OIDCEnabled {
+		l.Warn("[oidc] single sign-on not enabled")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Single sign-on is not enabled",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	p, err := provider(r, s)
+	if err != nil {
+		l.Error("[oidc] failed to discover identity provider ", err)
+		oidcError(w, r, "provider")
+		return
+	}
+
+	// generate pending login
+	var pending oidcPending
+	for _, value := range []*string{&pending.State, &pending.Nonce, &pending.Verifier} {
+		*value, err = oidc.RandomString(32)
+		if err != nil {
+			l.Error("[oidc] failed to generate login state ", err)
+			oidcError(w, r, "internal")
+			return
+		}
+	}
+	encoded, err := json.Marshal(pending)
+	if err != nil {
+		l.Error("[oidc] failed to encode login state ", err)
+		oidcError(w, r, "internal")
+		return
+	}
+	// the cookie must be sent on the cross-site redirect back from the
+	// provider, so it is lax
+	cookie := http.Cookie{
+		Name:     oidcCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(encoded),
+		MaxAge:   oidcCookieAge,
+		Path:     "/api/auth/oidc/",
+		HttpOnly: true, // secure the cookie from JS attacks
+		SameSite: http.SameSiteLaxMode,
+		Secure:   s.Settings.HTTPSEnabled,
+	}
+	http.SetCookie(w, &cookie)
+	http.Redirect(w, r, p.AuthCodeURL(pending.State, pending.Nonce, pending.Verifier), http.StatusFound)
+}
+
+// oidcCallbackHandler is "/api/auth/oidc/callback". It redeems the authorization
+// code, verifies the ID token and signs in the user by verified email. Users are
+// created on first login and their role is synchronized from the mapped groups
+// on every login. Local accounts are only signed in if OIDC_LINK_LOCAL is set
+// and keep their role. Errors redirect to the login page.
+func oidcCallbackHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+
+	if !s.AuthReady || !s.Settings.OIDCEnabled {
+		l.Warn("[oidc] single sign-on not enabled")
+		oidcError(w, r, "disabled")
+		return
+	}
+	// restore + clear pending login
+	var pending oidcPending
+	cookie, err := r.Cookie(oidcCookie)
+	if err == nil {
+		var decoded []byte
+		decoded, err = base64.RawURLEncoding.DecodeString(cookie.Value)
+		if err == nil {
+			err = json.Unmarshal(decoded, &pending)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		MaxAge:   -1,
+		Path:     "/api/auth/oidc/",
+		HttpOnly: true,
+	})
+	query := r.URL.Query()
+	if err != nil || pending.State == "" || query.Get("state") != pending.State {
+		l.Warn("[oidc] callback state mismatch")
+		oidcError(w, r, "state")
+		return
+	}
+	if query.Get("error") != "" {
+		l.Warn("[oidc] identity provider returned error ", query.Get("error"))
+		oidcError(w, r, "denied")
+		return
+	}
+
+	// redeem code + verify ID token
+	p, err := provider(r, s)
+	if err != nil {
+		l.Error("[oidc] failed to discover identity provider ", err)
+		oidcError(w, r, "provider")
+		return
+	}
+	raw, err := p.Exchange(r.Context(), query.Get("code"), pending.Verifier)
+	if err != nil {
+		l.Error("[oidc] failed to redeem authorization code ", err)
+		oidcError(w, r, "provider")
+		return
+	}
+	claims, err := p.Verify(r.Context(), raw, pending.Nonce)
+	if err != nil {
+		l.Warn("[oidc] invalid ID token ", err)
+		oidcError(w, r, "token")
+		return
+	}
+	email := strings.ToLower(claims.String("email"))
+	if verified, _ := claims["email_verified"].(bool); email == "" || !verified {
+		l.Warn("[oidc] ID token without verified email")
+		oidcError(w, r, "email")
+		return
+	}
+	name := claims.String("name")
+	if name == "" {
+		name = email
+	}
+
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, email)
+	switch {
+	case err != nil:
+		// provision user just in time
+		class, err := mapRole(s, claims.Strings(s.Settings.OIDCGroupsClaim))
+		if err != nil {
+			l.Warn("[oidc] user ", email, " denied: ", err)
+			oidcError(w, r, "role")
+			return
+		}
+		user = elasticsearch.DocumentAuth{
+			UUID:      email,
+			Name:      name,
+			Activated: true,
+			SSO:       true,
+			Class:     class,
+		}
+		_, err = user.Index(s)
+		if err != nil {
+			l.Error("[oidc] failed to provision user ", err)
+			oidcError(w, r, "internal")
+			return
+		}
+		l.Info("[oidc] provisioned user ", email)
+	case !user.Activated:
+		l.Warn("[oidc] user is not activated ", email)
+		oidcError(w, r, "activated")
+		return
+	case user.SSO:
+		// synchronize role of provisioned user
+		class, err := mapRole(s, claims.Strings(s.Settings.OIDCGroupsClaim))
+		if err != nil {
+			l.Warn("[oidc] user ", email, " denied: ", err)
+			oidcError(w, r, "role")
+			return
+		}
+		if user.Class != class {
+			user.Class = class
+			err = user.Update(s, esDocID)
+			if err != nil {
+				l.Error("[oidc] failed to synchronize user role ", err)
+				oidcError(w, r, "internal")
+				return
+			}
+		}
+	default:
+		// local account, linked only if enabled and keeping its own role; the
+		// MFA step of password login cannot be performed here
+		if !s.Settings.OIDCLinkLocal {
+			l.Warn("[oidc] refused login to local account ", email)
+			oidcError(w, r, "local")
+			return
+		}
+		if auth.AccountLocked(user) {
+			l.Warn("[oidc] user is locked out ", email)
+			oidcError(w, r, "locked")
+			return
+		}
+		if user.TOTPEnabled || auth.MFARequired(s, user.Class) {
+			l.Warn("[oidc] local account requires MFA ", email)
+			oidcError(w, r, "mfa")
+			return
+		}
+	}
+
+	// generate + send cookies
+	payload := &jwtauth.Payload{
+		UUID:      user.UUID,
+		Class:     user.Class,
+		Name:      user.Name,
+		Activated: user.Activated,
+		Assets:    user.Assets,
+	}
+	if !startSession(s, a, w, r, payload) {
+		return
+	}
+	l.Info("[oidc] token issued, X-State and X-Class cookies set")
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// mapRole returns the role of the first "group=role" pair in the role mapping
+// setting whose group the user belongs to, or the default role. It returns an
+// error if no role applies or the role does not exist.
+func mapRole(s *state.State, groups []string) (jwtauth.UserClass, error) {
+	role := s.Settings.OIDCDefaultRole
+	member := map[string]bool{}
+	for _, group := range groups {
+		member[group] = true
+	}
+	for _, pair := range strings.Split(s.Settings.OIDCRoleMapping, ",") {
+		group, mapped, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && member[strings.TrimSpace(group)] {
+			role = strings.TrimSpace(mapped)
+			break
+		}
+	}
+	if role == "" {
+		return "", errNoRole
+	}
+	if _, ok := auth.RolePermissions(role); !ok {
+		return "", errors.New("mapped role " + role + " does not exist")
+	}
+	return jwtauth.UserClass(role), nil
+}
+
+// oidcError redirects the browser to the login page with the error reason.
+func oidcError(w http.ResponseWriter, r *http.Request, reason string) {
+	http.Redirect(w, r, "/auth/login?sso="+url.QueryEscape(reason), http.StatusFound)
+}
@@ -12,26 +12,46 @@ func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 
 	r.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
 		loginHandler(s, a, w, r)
-	})
+	}).Methods("POST")
 
 	r.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
 		logoutHandler(s, a, w, r)
-	})
+	}).Methods("POST")
 
 	r.HandleFunc("/requestReset", func(w http.ResponseWriter, r *http.Request) {
 		requestResetHandler(s, a, w, r)
-	})
+	}).Methods("POST")
 
 	r.HandleFunc("/resetPassword", func(w http.ResponseWriter, r *http.Request) {
 		resetHandler(s, a, w, r)
-	})
+	}).Methods("POST")
 
 	r.HandleFunc("/registerUser", func(w http.ResponseWriter, r *http.Request) {
 		registerUserHandler(s, a, w, r)
-	})
+	}).Methods("POST")
 
 	r.HandleFunc("/setup", func(w http.ResponseWriter, r *http.Request) {
 		setupUserHandler(s, a, w, r)
+	}).Methods("POST")
+
+	r.HandleFunc("/mfa/verify", func(w http.ResponseWriter, r *http.Request) {
+		mfaVerifyHandler(s, a, w, r)
+	}).Methods("POST")
+
+	r.HandleFunc("/mfa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		mfaEnrollHandler(s, a, w, r)
+	}).Methods("POST")
+
+	r.HandleFunc("/mfa/activate", func(w http.ResponseWriter, r *http.Request) {
+		mfaActivateHandler(s, a, w, r)
+	}).Methods("POST")
+
+	r.HandleFunc("/oidc/login", func(w http.ResponseWriter, r *http.Request) {
+		oidcLoginHandler(s, a, w, r)
+	})
+
+	r.HandleFunc("/oidc/callback", func(w http.ResponseWriter, r *http.Request) {
+		oidcCallbackHandler(s, a, w, r)
 	})
 
 	r.HandleFunc("/isActive", func(w http.ResponseWriter, r *http.Request) {
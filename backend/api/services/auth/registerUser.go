@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -39,6 +40,18 @@ func registerUserHandler(s *state.State, a *jwtauth.Config, w http.ResponseWrite
 		return
 	}
 
+	// local passwords disabled in favour of single sign-on
+	if s.Settings.LocalLoginDisable {
+		l.Info("[register] local login disabled")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Registration is disabled, please use single sign-on",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	// Validate all fields
 	err = utils.ValidateBasic(request.Name)
 	if err != nil {
@@ -100,6 +113,19 @@ func registerUserHandler(s *state.State, a *jwtauth.Config, w http.ResponseWrite
 		return
 	}
 
+	// delay repeated requests from the client or for the account
+	if wait := auth.Throttle(r, request.UUID); wait > 0 {
+		l.Warn("[register] throttled request for ", request.UUID)
+		auth.TooManyRequests(w, wait)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Too many requests, please try again later.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	auth.ThrottleFail(r, request.UUID)
+
 	// Check if email already in elasticsearch
 	_, _, err = elasticsearch.QueryAuthByUUID(s, request.UUID)
 	if err == nil {
@@ -149,6 +175,7 @@ func registerUserHandler(s *state.State, a *jwtauth.Config, w http.ResponseWrite
 	}
 
 	// return register page with success message
+	auth.AuditDiff(s, r, "user.register", user.UUID, "user registered", nil, user)
 	l.Info("[register] created new user auth/", docID)
 	// if the account isn't activated yet, notify the user
 	successMsg := "Successful registration. Now redirecting to login page."
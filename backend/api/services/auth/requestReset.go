@@ -47,6 +47,18 @@ func requestResetHandler(s *state.State, a *jwtauth.Config, w http.ResponseWrite
 		return
 	}
 
+	// local passwords disabled in favour of single sign-on
+	if s.Settings.LocalLoginDisable {
+		l.Info("[request reset] local login disabled")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Password reset is disabled, please use single sign-on",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	// Ensure email is entered
 	err = utils.ValidateBasic(request.UUID)
 	if err != nil {
@@ -60,6 +72,19 @@ func requestResetHandler(s *state.State, a *jwtauth.Config, w http.ResponseWrite
 		return
 	}
 
+	// delay repeated requests from the client or for the account
+	if wait := auth.Throttle(r, request.UUID); wait > 0 {
+		l.Warn("[request reset] throttled request for ", request.UUID)
+		auth.TooManyRequests(w, wait)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Too many requests, please try again later.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	auth.ThrottleFail(r, request.UUID)
+
 	// Retrieve user from elasticsearch
 	user, _, err := elasticsearch.QueryAuthByUUID(s, request.UUID)
 	if err != nil {
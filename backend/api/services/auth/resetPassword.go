@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -49,6 +50,18 @@ func resetHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *h
 		return
 	}
 
+	// local passwords disabled in favour of single sign-on
+	if s.Settings.LocalLoginDisable {
+		l.Info("[reset] local login disabled")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Password reset is disabled, please use single sign-on",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	// Check for token present
 	if request.Token == "" {
 		l.Info("[reset] new password token not present")
@@ -152,6 +165,7 @@ func resetHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *h
 	}
 
 	//Success
+	auth.Audit(s, r, "user.resetPassword", payload.UUID, "password changed with reset link")
 	w.WriteHeader(http.StatusOK)
 	out := GeneralResponse{
 		Success: true,
@@ -3,7 +3,6 @@ package auth
 import (
 	"encoding/json"
 	"net/http"
-	"time"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
 	"github.com/mcmaster-circ/canids-v2/backend/auth"
@@ -170,6 +169,7 @@ func setupUserHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter,
 		json.NewEncoder(w).Encode(out)
 		return
 	}
+	auth.AuditDiff(s, r, "user.setup", user.UUID, "initial administrator created", nil, user)
 
 	payload := &jwtauth.Payload{
 		UUID:      request.UUID,
@@ -178,8 +178,7 @@ func setupUserHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter,
 		Class:     jwtauth.UserAdmin,
 	}
 
-	payload.IssuedAt = time.Now().Unix()
-	token, err := a.CreateToken(payload, auth.ExpireAge)
+	token, err := auth.NewSession(s, a, payload, r)
 	if err != nil {
 		// can't issue new token, return login page with error
 		l.Error("[setup] failed to create authentication token ", err)
@@ -219,6 +218,7 @@ func setupUserHandler(s *state.State, a *jwtauth.Config, w http.ResponseWriter,
 		cookie.Secure = true
 	}
 	http.SetCookie(w, &cookie)
+	auth.SetCSRFCookie(s, w)
 
 	l.Info("[login] token issued, X-State and X-Class cookies set")
 	w.WriteHeader(http.StatusOK)
@@ -11,6 +11,7 @@ import (
 	"net/url"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -26,25 +27,13 @@ type addRequest struct {
 }
 
 // addHandler is "/api/blacklist/add". It is responsible for creating a new blacklist.
-// Only an admin can request for a new blacklist to be created. The blacklist UUID
+// It requires the "blacklist.write" permission. The blacklist UUID
 // must not exist and the blacklist name must be unique.
 func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// only admins can use this endpoint
-	if current.Class != jwtauth.UserAdmin {
-		l.Warn("non admin attempting to create new blacklist")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Only an admin can create a new blacklist.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
-
 	// attempt to parse request
 	var request addRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -164,6 +153,7 @@ func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.R
 	go scheduler.Refresh(s)
 
 	// success
+	auth.AuditDiff(s, r, "blacklist.add", blacklist.UUID, "blacklist created", nil, blacklist)
 	l.Info("successfully created new blacklist ", blacklist.UUID)
 	out := GeneralResponse{
 		Success: true,
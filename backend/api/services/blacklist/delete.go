@@ -10,6 +10,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -22,24 +23,13 @@ type deleteRequest struct {
 	UUID string `json:"uuid"` // UUID is a unique blacklist identifier
 }
 
-// deleteHandler is "/api/blacklist/delete". It is responsible ..
+// deleteHandler is "/api/blacklist/delete". It is responsible for deleting a
+// blacklist. It requires the "blacklist.write" permission.
 func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// only admins can use this endpoint
-	if current.Class != jwtauth.UserAdmin {
-		l.Warn("non admin attempting to delete blacklist")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Only an admin can delete blacklist.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
-
 	// attempt to parse request
 	var request deleteRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -67,6 +57,11 @@ func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		return
 	}
 
+	// query blacklist for the audit log
+	var before interface{}
+	if existing, _, err := elasticsearch.QueryBlacklistByUUID(s, request.UUID); err == nil {
+		before = existing
+	}
 	// delete blacklist
 	err = elasticsearch.DeleteBlacklistByUUID(s, request.UUID)
 	if err != nil {
@@ -80,6 +75,7 @@ func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	go scheduler.Refresh(s)
 
 	// success
+	auth.AuditDiff(s, r, "blacklist.delete", request.UUID, "blacklist deleted", before, nil)
 	l.Info("successfully deleted blacklist ", request.UUID)
 	out := GeneralResponse{
 		Success: true,
@@ -12,6 +12,7 @@ import (
 	"unicode"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -25,24 +26,12 @@ type updateRequest struct {
 }
 
 // updateHandler is "/api/blacklist/update". It is responsible for updating an
-// existing blacklist. Only an admin can request for a blacklist to be updated.
+// existing blacklist. It requires the "blacklist.write" permission.
 func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// only admins can use this endpoint
-	if current.Class != jwtauth.UserAdmin {
-		l.Warn("non admin attempting to update blacklist")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Only an admin can update blacklist.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
-
 	// attempt to parse request
 	var request updateRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -201,6 +190,7 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	go scheduler.Refresh(s)
 
 	// success
+	auth.AuditDiff(s, r, "blacklist.update", request.UUID, "blacklist updated", existing, request)
 	l.Info("successfully updated blacklist ", request.UUID)
 	out := GeneralResponse{
 		Success: true,
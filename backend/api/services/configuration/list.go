@@ -19,7 +19,8 @@ type listResponse struct {
 	Configuration []state.DocumentSetting `json:"configuration"` // Configuation is the list of editable settings
 }
 
-// listHandler is "/api/configuration/list"
+// listHandler is "/api/configuration/list". It returns every setting, including
+// secrets, and requires the "settings.write" permission.
 func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 	// get user making current request + logging context
 	_, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -29,11 +30,11 @@ var (
 // RegisterRoutes registers routes to interact with the configuration.
 func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 	// get configuration /api/configuration/list
-	r.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/list", auth.Authorize(s, jwtauth.PermSettingsWrite, func(w http.ResponseWriter, r *http.Request) {
 		listHandler(r.Context(), s, a, w, r)
-	})
+	}))
 	// update configuration /api/configuration/update
-	r.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/update", auth.Authorize(s, jwtauth.PermSettingsWrite, func(w http.ResponseWriter, r *http.Request) {
 		updateHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 }
@@ -7,9 +7,9 @@ package configuration
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
@@ -21,24 +21,12 @@ type updateRequest struct {
 }
 
 // updateHandler is "/api/configuration/update". It is responsible for updating the
-// existing configuration. Only an admin can request for the configuration to be updated.
+// existing configuration. It requires the "settings.write" permission.
 func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// only admins can use this endpoint
-	if current.Class != jwtauth.UserAdmin {
-		l.Warn("non admin attempting to update settings")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Only an admin can update settings.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
-
 	// attempt to parse request
 	var request updateRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -53,8 +41,18 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		return
 	}
 
-	// print request
-	fmt.Printf("received request to update settings: %+v", request)
+	// record current values for the audit log
+	before, after := map[string]string{}, map[string]string{}
+	existing, err := state.AllSettings(s)
+	if err != nil {
+		l.Warn("cannot get settings for audit log ", err)
+	}
+	for _, setting := range existing {
+		before[setting.Name], after[setting.Name] = setting.Value, setting.Value
+	}
+	for _, setting := range request.Configuration {
+		after[setting.Name] = setting.Value
+	}
 
 	// update configuration
 	err = state.UpdateSettings(s, request.Configuration)
@@ -66,6 +64,7 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 
 	// success
+	auth.AuditDiff(s, r, "settings.update", "configuration", "settings updated", before, after)
 	l.Info("successfully updated settings")
 	out := GeneralResponse{
 		Success: true,
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -33,7 +34,7 @@ func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 		getHandler(r.Context(), s, a, w, r)
 	})
 	// update dashboard /api/dashboard/update
-	r.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/update", auth.Authorize(s, jwtauth.PermDashboardWrite, func(w http.ResponseWriter, r *http.Request) {
 		updateHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 }
@@ -10,6 +10,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -22,23 +23,12 @@ type updateRequest struct {
 }
 
 // updateHandler is "/api/dashboard/update". It is responsible for updating an
-// existing dashboard. An admin can update the dashboard for everyone.
+// existing dashboard for everyone. It requires the "dashboard.write" permission.
 func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// reject request if standard user is making it
-	if current.Class == jwtauth.UserStandard {
-		l.Warn("standard user attempting to update dashboard")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Standard users can not update dashboard.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
 	// attempt to parse request
 	var request updateRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -77,6 +67,18 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		return
 	}
 
+	// ensure asset IDs are valid
+	if !utils.ValidAssetIDs(request.Assets) {
+		l.Warn("invalid asset IDs ", request.Assets)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset ID provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	// query current dashboard to update
 	dashboard, esDocID, err := elasticsearch.QueryDashboardByUUID(s, request.UUID)
 	if err != nil {
@@ -107,9 +109,11 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		}
 	}
 	// update dashboard with new parameters
+	before := dashboard
 	dashboard.Name = request.Name
 	dashboard.Views = request.Views
 	dashboard.Sizes = request.Sizes
+	dashboard.Assets = request.Assets
 
 	// index changes
 	err = dashboard.Update(s, esDocID)
@@ -121,6 +125,7 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 
 	// success
+	auth.AuditDiff(s, r, "dashboard.update", request.UUID, "dashboard updated", before, dashboard)
 	l.Info("successfully updated dashboard ", request.UUID)
 	out := GeneralResponse{
 		Success: true,
@@ -7,9 +7,11 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
@@ -23,15 +25,28 @@ type dataResponse struct {
 	Fields        []string        `json:"fields"`
 	Class         string          `json:"class"`
 	Data          [][]interface{} `json:"data"`
+	Series        []string        `json:"series,omitempty"`
 	AvailableRows int             `json:"availableRows"`
 }
 
-const maxTableRows = 100
+const (
+	maxTableRows = 100
+	// maxBuckets is the maximum number of time buckets in a time based view
+	maxBuckets = 10000
+	// timeSeriesTerms is the number of terms a time series or grouped line view
+	// is split by
+	timeSeriesTerms = 10
+	// heatmapTerms is the number of terms on each axis of a heatmap
+	heatmapTerms = 20
+	// sankeyTerms is the number of destinations for each of the sources of a
+	// sankey view
+	sankeyTerms = 10
+)
 
 // dataHandler is "/api/data. It is responsible for populating a view with the data related to that view.
 func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 	// get user making current request + logging context
-	_, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
 	// get query parameters "start" and "end"
@@ -42,6 +57,7 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 	intervalStr := v.Get("interval")
 	maxSizeStr := v.Get("maxSize")
 	fromStr := v.Get("from")
+	dashboardUUID := v.Get("dashboard")
 
 	// Parse "start" and "end" into time objects
 	start, err := time.Parse(time.RFC3339, startStr)
@@ -68,6 +84,7 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 			Success: false,
 			Message: "End time is before start time",
 		})
+		return
 	}
 	// get view from database
 	view, _, err := elasticsearch.QueryViewByUUID(s, visualizationUUID)
@@ -78,11 +95,49 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		return
 	}
 
+	// restrict the view to the assets of its dashboards, the assets in its
+	// asset groups or with its tags (if any), the request and the user
+	dashboard, err := dashboardAssets(s, visualizationUUID, dashboardUUID)
+	if errors.Is(err, errDashboard) {
+		l.Warnf("view '%s' is not on dashboard '%s'", visualizationUUID, dashboardUUID)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Invalid dashboard provided.",
+		})
+		return
+	}
+	if err != nil {
+		l.Error("error getting dashboards: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	groupAssets, err := elasticsearch.AssetsMatching(s, view.Groups, view.Tags)
+	if err != nil && !errors.Is(err, elasticsearch.ErrNoAssets) {
+		l.Error("error resolving view asset groups: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	if err != nil {
+		l.Warn("no assets in view asset groups or tags")
+		scopeError(w, err)
+		return
+	}
+	assets := current.AssetScope(view.Assets, groupAssets, dashboard, requestAssets(r))
+
 	// generate indexName to query
-	indexName := "data-" + view.DataIndex
+	indexName, err := elasticsearch.DataIndexPattern(view.DataIndex, assets)
+	if err != nil {
+		l.Warn("invalid asset scope: ", err)
+		scopeError(w, err)
+		return
+	}
 
 	// Get data in whatever way the given view class requires
 	data := [][]interface{}{}
+	series := []string{}
 	availableRows := 0
 	if (view.Class == elasticsearch.ViewBar) || (view.Class == elasticsearch.ViewPie) {
 		// check that the view has the right amount of fields for this class
@@ -97,7 +152,12 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		var counts []int64
 
 		if view.Name == elasticsearch.DefaultViewName {
-			keys, counts, err = elasticsearch.CountTotalDataInRange(s, view.Fields[0], start, end)
+			// default view counts every data index of the permitted assets
+			var totalName string
+			totalName, err = elasticsearch.DataIndexPattern("", assets)
+			if err == nil {
+				keys, counts, err = elasticsearch.CountTotalDataInRange(s, totalName, view.Fields[0], start, end)
+			}
 		} else {
 			keys, counts, err = elasticsearch.CountDataInRange(s, indexName, view.Fields[0], start, end)
 		}
@@ -128,108 +188,232 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		}
 
 		// parse interval from query parameter
-		interval, err := strconv.ParseInt(intervalStr, 10, 64)
+		interval, err := parseInterval(intervalStr, start, end)
 		if err != nil {
-			l.Error("error parsing interval string: ", err)
+			l.Error("invalid interval: ", err)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(GeneralResponse{
 				Success: false,
-				Message: "Could not parse interval string",
+				Message: err.Error(),
 			})
 			return
 		}
 
-		// make sure interval is greater than 0
-		if interval <= 0 {
-			l.Error("invalid interval: ", interval)
+		// views without a metric average both fields over time
+		if view.Metric == "" {
+			// get data for the specified fields in the specified time range
+			xdata, ydata, err := elasticsearch.QueryDataInRangeAggregated(s, indexName, view.Fields[0], view.Fields[1], start, end, interval)
+			if err != nil {
+				l.Error("error querying data conn: ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(InternalServerError)
+				return
+			}
+
+			data = [][]interface{}{
+				xdata, ydata,
+			}
+		} else {
+			// compute the metric over the y field, split by the group by field
+			times, names, values, err := elasticsearch.QueryMetricHistogram(s, indexName, view.Fields[1], view.Metric, view.Percentile, view.GroupBy, start, end, interval, timeSeriesTerms)
+			if err != nil {
+				l.Error("error querying metric: ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(InternalServerError)
+				return
+			}
+
+			data = append([][]interface{}{times}, values...)
+			series = names
+		}
+	} else if view.Class == elasticsearch.ViewTable {
+		// parse maxSize from query parameter
+		maxSize, err := parseMaxSize(maxSizeStr)
+		if err != nil {
+			l.Error("invalid max size: ", err)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(GeneralResponse{
 				Success: false,
-				Message: "Invalid interval, must be greater than 0",
+				Message: err.Error(),
 			})
 			return
 		}
 
-		// make sure is not over 10000 buckets
-		buckets := (end.Unix() - start.Unix()) / interval
-		if buckets > 10000 {
-			l.Error("Too many buckets: ", buckets)
+		// parse 'from' from query parameter
+		from, err := strconv.ParseInt(fromStr, 10, 32)
+		if err != nil {
+			l.Error("error parsing 'from' string: ", err)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(GeneralResponse{
 				Success: false,
-				Message: "Interval is too small for this time range",
+				Message: "Could not parse 'from' string",
 			})
 			return
 		}
 
-		// get data for the specified fields in the specified time range
-		xdata, ydata, err := elasticsearch.QueryDataInRangeAggregated(s, indexName, view.Fields[0], view.Fields[1], start, end, interval)
+		// get data for the specified fields in the specified time range, sorted by timestamp
+		// TODO(Tanner)
+		data, availableRows, err = elasticsearch.QueryDataInRange(s, indexName, view.Fields, start, end, maxSize, int(from))
 		if err != nil {
 			l.Error("error querying data conn: ", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(InternalServerError)
 			return
 		}
-
-		data = [][]interface{}{
-			xdata, ydata,
+	} else if view.Class == elasticsearch.ViewTimeSeries {
+		// check that the view has the right amount of fields for this class
+		if len(view.Fields) != 1 {
+			l.Errorf("%s view: expected 1 fields, got %d", view.Class, len(view.Fields))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
 		}
-	} else if view.Class == elasticsearch.ViewTable {
-		// parse maxSize from query parameter
-		maxSize, err := strconv.ParseInt(maxSizeStr, 10, 32)
+
+		// parse interval from query parameter
+		interval, err := parseInterval(intervalStr, start, end)
 		if err != nil {
-			l.Error("error parsing max size string: ", err)
+			l.Error("invalid interval: ", err)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(GeneralResponse{
 				Success: false,
-				Message: "Could not parse max size string",
+				Message: err.Error(),
 			})
 			return
 		}
 
-		// make sure maxSize is greater than 0
-		if maxSize <= 0 {
-			l.Error("invalid max size: ", maxSize)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(GeneralResponse{
-				Success: false,
-				Message: "Invalid max size, must be greater than 0",
-			})
+		// get counts over time for the most common terms of the field
+		times, terms, counts, err := elasticsearch.QueryTermsHistogram(s, indexName, view.Fields[0], start, end, interval, timeSeriesTerms)
+		if err != nil {
+			l.Error("error querying time series: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
 			return
 		}
 
-		// make sure maxSize is under or equal to max allowed value
-		if maxSize > maxTableRows {
-			l.Error("invalid max size: ", maxSize)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(GeneralResponse{
-				Success: false,
-				Message: fmt.Sprintf("Invalid max size, must be under %d", maxTableRows),
-			})
+		data = append([][]interface{}{times}, counts...)
+		series = terms
+	} else if view.Class == elasticsearch.ViewHeatmap {
+		// check that the view has the right amount of fields for this class
+		if len(view.Fields) != 2 {
+			l.Errorf("%s view: expected 2 fields, got %d", view.Class, len(view.Fields))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
 			return
 		}
 
-		// parse 'from' from query parameter
-		from, err := strconv.ParseInt(fromStr, 10, 32)
+		pairs, err := elasticsearch.QueryTermsPairs(s, indexName, view.Fields[0], view.Fields[1], start, end, heatmapTerms)
 		if err != nil {
-			l.Error("error parsing 'from' string: ", err)
+			l.Error("error querying heatmap: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+
+		// first row is the x axis, followed by a row of counts for each y value
+		xIndex, yIndex := map[string]int{}, map[string]int{}
+		xKeys := []interface{}{}
+		for _, pair := range pairs {
+			if _, ok := xIndex[pair.Source]; !ok {
+				xIndex[pair.Source] = len(xKeys)
+				xKeys = append(xKeys, pair.Source)
+			}
+			if _, ok := yIndex[pair.Destination]; !ok {
+				yIndex[pair.Destination] = len(series)
+				series = append(series, pair.Destination)
+			}
+		}
+		data = make([][]interface{}, len(series)+1)
+		data[0] = xKeys
+		for i := range series {
+			data[i+1] = make([]interface{}, len(xKeys))
+			for j := range xKeys {
+				data[i+1][j] = int64(0)
+			}
+		}
+		for _, pair := range pairs {
+			data[yIndex[pair.Destination]+1][xIndex[pair.Source]] = pair.Count
+		}
+	} else if view.Class == elasticsearch.ViewTopN {
+		// check that the view has the right amount of fields for this class
+		if len(view.Fields) == 0 {
+			l.Errorf("%s view: expected at least 1 field", view.Class)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+
+		// parse maxSize from query parameter
+		maxSize, err := parseMaxSize(maxSizeStr)
+		if err != nil {
+			l.Error("invalid max size: ", err)
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(GeneralResponse{
 				Success: false,
-				Message: "Could not parse 'from' string",
+				Message: err.Error(),
 			})
 			return
 		}
 
-		// get data for the specified fields in the specified time range, sorted by timestamp
-		// TODO(Tanner)
-		data, availableRows, err = elasticsearch.QueryDataInRange(s, indexName, view.Fields, start, end, int(maxSize), int(from))
+		// get the most common combinations of values with their counts
+		data, err = elasticsearch.QueryTopTerms(s, indexName, view.Fields, start, end, maxSize)
 		if err != nil {
-			l.Error("error querying data conn: ", err)
+			l.Error("error querying top terms: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+	} else if view.Class == elasticsearch.ViewStat {
+		// check that the view has the right amount of fields for this class
+		if len(view.Fields) != 1 {
+			l.Errorf("%s view: expected 1 fields, got %d", view.Class, len(view.Fields))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+
+		// compare the current period to the previous period of equal length
+		value, err := elasticsearch.QueryStatInRange(s, indexName, view.Fields[0], view.Metric, view.Percentile, start, end)
+		if err != nil {
+			l.Error("error querying stat: ", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(InternalServerError)
 			return
 		}
+		previous, err := elasticsearch.QueryStatInRange(s, indexName, view.Fields[0], view.Metric, view.Percentile, start.Add(-end.Sub(start)), start)
+		if err != nil {
+			l.Error("error querying previous stat: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+
+		data = [][]interface{}{
+			{value}, {previous},
+		}
+	} else if view.Class == elasticsearch.ViewSankey {
+		// check that the view has the right amount of fields for this class
+		if len(view.Fields) != 2 {
+			l.Errorf("%s view: expected 2 fields, got %d", view.Class, len(view.Fields))
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+
+		pairs, err := elasticsearch.QueryTermsPairs(s, indexName, view.Fields[0], view.Fields[1], start, end, sankeyTerms)
+		if err != nil {
+			l.Error("error querying sankey: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+
+		// parallel arrays of sources, destinations and counts
+		data = [][]interface{}{{}, {}, {}}
+		for _, pair := range pairs {
+			data[0] = append(data[0], pair.Source)
+			data[1] = append(data[1], pair.Destination)
+			data[2] = append(data[2], pair.Count)
+		}
 	}
 
 	// success
@@ -239,6 +423,119 @@ func dataHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		Fields:        view.Fields,
 		Class:         string(view.Class),
 		Data:          data,
+		Series:        series,
 		AvailableRows: availableRows,
 	})
 }
+
+// parseInterval parses the interval in seconds of a time based view. The
+// interval must be positive and not produce more than maxBuckets buckets over
+// the time range.
+func parseInterval(intervalStr string, start time.Time, end time.Time) (int64, error) {
+	interval, err := strconv.ParseInt(intervalStr, 10, 64)
+	if err != nil {
+		return 0, errors.New("Could not parse interval string")
+	}
+	if interval <= 0 {
+		return 0, errors.New("Invalid interval, must be greater than 0")
+	}
+	if (end.Unix()-start.Unix())/interval > maxBuckets {
+		return 0, errors.New("Interval is too small for this time range")
+	}
+	return interval, nil
+}
+
+// parseMaxSize parses the number of rows of a table view. It must be between 1
+// and maxTableRows.
+func parseMaxSize(maxSizeStr string) (int, error) {
+	maxSize, err := strconv.ParseInt(maxSizeStr, 10, 32)
+	if err != nil {
+		return 0, errors.New("Could not parse max size string")
+	}
+	if maxSize <= 0 {
+		return 0, errors.New("Invalid max size, must be greater than 0")
+	}
+	if maxSize > maxTableRows {
+		return 0, fmt.Errorf("Invalid max size, must be under %d", maxTableRows)
+	}
+	return int(maxSize), nil
+}
+
+// requestAssets returns the comma separated asset IDs of the "assets" query
+// parameter.
+func requestAssets(r *http.Request) []string {
+	assets := r.URL.Query().Get("assets")
+	if assets == "" {
+		return nil
+	}
+	return strings.Split(assets, ",")
+}
+
+// errDashboard is returned when a view is requested for a dashboard it is not
+// on.
+var errDashboard = errors.New("data: view is not on the dashboard")
+
+// dashboardAssets returns the assets the dashboards showing the view restrict
+// it to, nil if it is not restricted. If a dashboard UUID is given, the view
+// must be on that dashboard and only its assets apply. Otherwise the view is
+// restricted to the assets of every dashboard showing it, and is only
+// unrestricted if one of them is, so that leaving out the dashboard does not
+// lift its restriction.
+func dashboardAssets(s *state.State, viewUUID string, dashboardUUID string) ([]string, error) {
+	var dashboards []elasticsearch.DocumentDashboard
+	if dashboardUUID != "" {
+		dashboard, _, err := elasticsearch.QueryDashboardByUUID(s, dashboardUUID)
+		if err != nil {
+			return nil, errDashboard
+		}
+		dashboards = append(dashboards, dashboard)
+	} else {
+		all, err := elasticsearch.AllDashboard(s)
+		if err != nil {
+			return nil, err
+		}
+		dashboards = all
+	}
+
+	var assets []string
+	found := false
+	for _, dashboard := range dashboards {
+		showing := false
+		for _, view := range dashboard.Views {
+			if view == viewUUID {
+				showing = true
+				break
+			}
+		}
+		if !showing {
+			continue
+		}
+		if len(dashboard.Assets) == 0 {
+			return nil, nil
+		}
+		found = true
+		assets = append(assets, dashboard.Assets...)
+	}
+	if dashboardUUID != "" && !found {
+		return nil, errDashboard
+	}
+	return assets, nil
+}
+
+// scopeError writes the response for a data query that could not be
+// restricted to the permitted assets.
+func scopeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, elasticsearch.ErrNoAssets) {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "No access to the requested assets.",
+		})
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(GeneralResponse{
+		Success: false,
+		Message: "Invalid index or asset provided.",
+	})
+}
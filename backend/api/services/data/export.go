@@ -0,0 +1,426 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package data provides the data API service for the backend.
+package data
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// maxExportRows is the maximum number of documents in a single export
+	maxExportRows = 1000000
+	// maxBPFConnections is the maximum number of connections in a BPF filter
+	maxBPFConnections = 500
+	// exportTimeout is the maximum time an export may stream for
+	exportTimeout = 30 * time.Minute
+
+	exportCSV    = "csv"
+	exportNDJSON = "ndjson"
+	exportBPF    = "bpf"
+)
+
+// exportContentTypes maps the export format to the response content type.
+var exportContentTypes = map[string]string{
+	exportCSV:    "text/csv",
+	exportNDJSON: "application/x-ndjson",
+	exportBPF:    "text/plain",
+}
+
+// exportRecord describes an export in the audit log.
+type exportRecord struct {
+	View       string   `json:"view"`       // View is the UUID of the exported view, if any
+	DataIndex  string   `json:"index"`      // DataIndex is the exported data index
+	Fields     []string `json:"fields"`     // Fields are the exported fields
+	Format     string   `json:"format"`     // Format is the output format (csv, ndjson or bpf)
+	Compressed bool     `json:"compressed"` // Compressed indicates if the output was gzip compressed
+	Start      string   `json:"start"`      // Start is the start of the exported time range
+	End        string   `json:"end"`        // End is the end of the exported time range
+	Rows       int      `json:"rows"`       // Rows is the number of documents streamed
+	Complete   bool     `json:"complete"`   // Complete indicates if every matching document was streamed
+}
+
+// exportUsers tracks the users with an export in progress. Each user may only
+// run one export at a time.
+type exportUsers struct {
+	m sync.Mutex
+	u map[string]bool
+}
+
+var running = exportUsers{
+	u: map[string]bool{},
+}
+
+// acquire marks an export in progress for the user, returning false if the
+// user already has an export running.
+func (e *exportUsers) acquire(user string) bool {
+	e.m.Lock()
+	defer e.m.Unlock()
+	if e.u[user] {
+		return false
+	}
+	e.u[user] = true
+	return true
+}
+
+// release marks the export of the user as finished.
+func (e *exportUsers) release(user string) {
+	e.m.Lock()
+	delete(e.u, user)
+	e.m.Unlock()
+}
+
+// bpfConnection is a connection to be included in a generated BPF filter.
+type bpfConnection struct {
+	SourceIP        string `json:"id_orig_h"`
+	SourcePort      int    `json:"id_orig_p"`
+	DestinationIP   string `json:"id_resp_h"`
+	DestinationPort int    `json:"id_resp_p"`
+	Proto           string `json:"proto"`
+}
+
+// filter returns the BPF expression matching both directions of the
+// connection.
+func (c bpfConnection) filter() string {
+	parts := []string{"host " + c.SourceIP, "host " + c.DestinationIP}
+	switch c.Proto {
+	case "tcp", "udp":
+		parts = append(parts, c.Proto)
+		if c.SourcePort != 0 {
+			parts = append(parts, fmt.Sprintf("port %d", c.SourcePort))
+		}
+		if c.DestinationPort != 0 {
+			parts = append(parts, fmt.Sprintf("port %d", c.DestinationPort))
+		}
+	case "icmp":
+		if strings.Contains(c.SourceIP, ":") {
+			parts = append(parts, "icmp6")
+		} else {
+			parts = append(parts, "icmp")
+		}
+	}
+	return "(" + strings.Join(parts, " and ") + ")"
+}
+
+// exportHandler is "/api/data/export". It streams every document of a view
+// (or of "index" with the comma separated "fields") between "start" and "end"
+// as "csv", "ndjson" or a "bpf" filter matching the exported connections. If
+// "compress" is "gzip" the output is gzip compressed. Only the permitted
+// assets of the user are exported, narrowed by the dashboards of the view
+// (see dashboardAssets) and optionally by "assets". A user can
+// only run one export at a time, and every export is recorded in the audit
+// log.
+func exportHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+
+	v := r.URL.Query()
+	viewUUID := v.Get("view")
+	format := v.Get("format")
+	compress := v.Get("compress") == "gzip"
+	if format == "" {
+		format = exportCSV
+	}
+
+	// ensure format is valid
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		l.Warn("invalid export format ", format)
+		exportError(w, http.StatusBadRequest, GeneralResponse{
+			Success: false,
+			Message: "Invalid format, must be csv, ndjson or bpf.",
+		})
+		return
+	}
+
+	// parse "start" and "end" into time objects
+	start, err := time.Parse(time.RFC3339, v.Get("start"))
+	if err != nil {
+		l.Warnf("error parsing start time '%s': %v", v.Get("start"), err)
+		exportError(w, http.StatusBadRequest, GeneralResponse{
+			Success: false,
+			Message: "Could not parse start time",
+		})
+		return
+	}
+	end, err := time.Parse(time.RFC3339, v.Get("end"))
+	if err != nil {
+		l.Warnf("error parsing end time '%s': %v", v.Get("end"), err)
+		exportError(w, http.StatusBadRequest, GeneralResponse{
+			Success: false,
+			Message: "Could not parse end time",
+		})
+		return
+	}
+	if end.Before(start) {
+		l.Warn("end time is before start time")
+		exportError(w, http.StatusBadRequest, GeneralResponse{
+			Success: false,
+			Message: "End time is before start time",
+		})
+		return
+	}
+
+	// determine index and fields from the view or the query parameters
+	var dataIndex string
+	var fields []string
+	var viewAssets []string
+	var groupAssets []string
+	var dashboard []string
+	if viewUUID != "" {
+		view, _, err := elasticsearch.QueryViewByUUID(s, viewUUID)
+		if err != nil {
+			l.Errorf("error getting view with UUID '%s': %v", viewUUID, err)
+			exportError(w, http.StatusBadRequest, GeneralResponse{
+				Success: false,
+				Message: "Invalid view provided.",
+			})
+			return
+		}
+		dataIndex, fields, viewAssets = view.DataIndex, view.Fields, view.Assets
+		groupAssets, err = elasticsearch.AssetsMatching(s, view.Groups, view.Tags)
+		if err != nil && !errors.Is(err, elasticsearch.ErrNoAssets) {
+			l.Error("error resolving view asset groups: ", err)
+			exportError(w, http.StatusInternalServerError, InternalServerError)
+			return
+		}
+		if err != nil {
+			l.Warn("no assets in view asset groups or tags")
+			w.Header().Set("Content-Type", "application/json")
+			scopeError(w, err)
+			return
+		}
+		dashboard, err = dashboardAssets(s, viewUUID, v.Get("dashboard"))
+		if errors.Is(err, errDashboard) {
+			l.Warnf("view '%s' is not on dashboard '%s'", viewUUID, v.Get("dashboard"))
+			exportError(w, http.StatusBadRequest, GeneralResponse{
+				Success: false,
+				Message: "Invalid dashboard provided.",
+			})
+			return
+		}
+		if err != nil {
+			l.Error("error getting dashboards: ", err)
+			exportError(w, http.StatusInternalServerError, InternalServerError)
+			return
+		}
+	} else {
+		dataIndex = v.Get("index")
+		if v.Get("fields") != "" {
+			fields = strings.Split(v.Get("fields"), ",")
+		}
+	}
+	if dataIndex == "" {
+		l.Warn("export requires view or index")
+		exportError(w, http.StatusBadRequest, GeneralResponse{
+			Success: false,
+			Message: "Must provide view or index.",
+		})
+		return
+	}
+	// a comma or wildcard in the index would export other indices
+	if !elasticsearch.ValidDataIndex(dataIndex) {
+		l.Warn("invalid export index ", dataIndex)
+		exportError(w, http.StatusBadRequest, GeneralResponse{
+			Success: false,
+			Message: "Invalid index provided.",
+		})
+		return
+	}
+
+	// restrict the export to the permitted assets
+	indexName, err := elasticsearch.DataIndexPattern(dataIndex, current.AssetScope(viewAssets, groupAssets, dashboard, requestAssets(r)))
+	if err != nil {
+		l.Warn("invalid asset scope: ", err)
+		w.Header().Set("Content-Type", "application/json")
+		scopeError(w, err)
+		return
+	}
+
+	// csv requires a fixed set of columns, default to every mapped field
+	if format == exportCSV && len(fields) == 0 {
+		mapping, err := elasticsearch.GetDataMapping(s, indexName)
+		if err != nil {
+			l.Error("error getting data mapping: ", err)
+			exportError(w, http.StatusInternalServerError, InternalServerError)
+			return
+		}
+		for _, field := range mapping {
+			fields = append(fields, field.Name)
+		}
+		sort.Strings(fields)
+	}
+
+	// limit each user to a single running export
+	if !running.acquire(current.UUID) {
+		l.Warn("user already has an export in progress")
+		exportError(w, http.StatusTooManyRequests, GeneralResponse{
+			Success: false,
+			Message: "An export is already in progress.",
+		})
+		return
+	}
+	defer running.release(current.UUID)
+
+	// exports outlive the default server write timeout
+	err = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(exportTimeout))
+	if err != nil {
+		l.Error("error extending export write deadline: ", err)
+		exportError(w, http.StatusInternalServerError, InternalServerError)
+		return
+	}
+
+	// headers are only sent with the first document so an early query failure
+	// can still be reported
+	started := false
+	var out io.Writer = w
+	var zw *gzip.Writer
+	var cw *csv.Writer
+	begin := func() {
+		started = true
+		fileName := fmt.Sprintf("canids-%s-%s.%s", dataIndex, start.Format("20060102T150405"), format)
+		if compress {
+			fileName += ".gz"
+			w.Header().Set("Content-Type", "application/gzip")
+			zw = gzip.NewWriter(w)
+			out = zw
+		} else {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+		w.WriteHeader(http.StatusOK)
+		cw = csv.NewWriter(out)
+		if format == exportCSV {
+			cw.Write(fields)
+		}
+	}
+
+	connections := map[bpfConnection]bool{}
+	rows, err := elasticsearch.ExportDataInRange(s, indexName, start, end, maxExportRows, func(doc map[string]json.RawMessage) error {
+		if !started {
+			begin()
+		}
+		switch format {
+		case exportCSV:
+			cw.Write(csvRecord(doc, fields))
+			if cw.Error() != nil {
+				return cw.Error()
+			}
+		case exportNDJSON:
+			// only keep selected fields, if any
+			if len(fields) > 0 {
+				selected := make(map[string]json.RawMessage, len(fields))
+				for _, field := range fields {
+					if value, ok := doc[field]; ok {
+						selected[field] = value
+					}
+				}
+				doc = selected
+			}
+			err := json.NewEncoder(out).Encode(doc)
+			if err != nil {
+				return err
+			}
+		case exportBPF:
+			var c bpfConnection
+			raw, _ := json.Marshal(doc)
+			if json.Unmarshal(raw, &c) != nil || c.SourceIP == "" || c.DestinationIP == "" {
+				return nil
+			}
+			connections[c] = true
+			if len(connections) >= maxBPFConnections {
+				return elasticsearch.ErrExportLimit
+			}
+		}
+		return nil
+	})
+	complete := err == nil
+	if err != nil && !errors.Is(err, elasticsearch.ErrExportLimit) {
+		if !started {
+			l.Error("error querying export data: ", err)
+			exportError(w, http.StatusInternalServerError, InternalServerError)
+			return
+		}
+		l.Error("export interrupted: ", err)
+	}
+	if !started {
+		begin()
+	}
+
+	// write the combined filter of every connection
+	if format == exportBPF {
+		filters := []string{}
+		for c := range connections {
+			filters = append(filters, c.filter())
+		}
+		sort.Strings(filters)
+		fmt.Fprintln(out, strings.Join(filters, " or\n"))
+	}
+	cw.Flush()
+	if zw != nil {
+		zw.Close()
+	}
+
+	// record the export in the audit log
+	target := viewUUID
+	if target == "" {
+		target = dataIndex
+	}
+	auth.AuditDiff(s, r, "data.export", target, fmt.Sprintf("exported %d documents as %s", rows, format), nil, exportRecord{
+		View:       viewUUID,
+		DataIndex:  dataIndex,
+		Fields:     fields,
+		Format:     format,
+		Compressed: compress,
+		Start:      start.Format(time.RFC3339),
+		End:        end.Format(time.RFC3339),
+		Rows:       rows,
+		Complete:   complete,
+	})
+
+	l.Infof("successfully exported %d documents from %s as %s", rows, indexName, format)
+}
+
+// csvRecord returns the CSV columns for the document. Strings are unquoted,
+// other values are written as JSON.
+func csvRecord(doc map[string]json.RawMessage, fields []string) []string {
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		raw, ok := doc[field]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		var str string
+		if json.Unmarshal(raw, &str) == nil {
+			record[i] = str
+		} else {
+			record[i] = string(raw)
+		}
+	}
+	return record
+}
+
+// exportError writes a JSON error response before any export data was sent.
+func exportError(w http.ResponseWriter, status int, out GeneralResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(out)
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -32,4 +33,12 @@ func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		dataHandler(r.Context(), s, a, w, r)
 	})
+	// get related records for a connection /api/data/timeline
+	r.HandleFunc("/timeline", func(w http.ResponseWriter, r *http.Request) {
+		timelineHandler(r.Context(), s, a, w, r)
+	})
+	// stream data as a file /api/data/export
+	r.HandleFunc("/export", auth.Authorize(s, jwtauth.PermDataExport, func(w http.ResponseWriter, r *http.Request) {
+		exportHandler(r.Context(), s, a, w, r)
+	}))
 }
@@ -0,0 +1,153 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package data provides the data API service for the backend.
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// timelineResponse is the format of the timeline response.
+type timelineResponse struct {
+	UIDs      []string                      `json:"uids"`      // UIDs are the Zeek connection identifiers in the timeline
+	Entries   []elasticsearch.TimelineEntry `json:"entries"`   // Entries are the related records in ascending time
+	Truncated bool                          `json:"truncated"` // Truncated indicates records were left out, narrow "start" and "end" to see them
+}
+
+// timelineHandler is "/api/data/timeline". It reconstructs a session by
+// returning every record related to a Zeek connection across all data indices,
+// with alarms inlined. The connection is either identified by "uid" (with an
+// optional "start" and "end") or by the 5-tuple "srcIP", "srcPort", "dstIP",
+// "dstPort" and "proto" with a required "start" and "end". Only the permitted
+// assets of the user are searched, optionally narrowed by "assets". At most
+// elasticsearch.MaxTimelineEntries records are returned, earliest first.
+func timelineHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	v := r.URL.Query()
+	uid := v.Get("uid")
+	startStr := v.Get("start")
+	endStr := v.Get("end")
+
+	// parse "start" and "end" if provided, they are required for a 5-tuple
+	var start, end time.Time
+	var err error
+	if startStr != "" {
+		start, err = time.Parse(time.RFC3339, startStr)
+		if err != nil {
+			l.Warnf("error parsing start time '%s': %v", startStr, err)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(GeneralResponse{
+				Success: false,
+				Message: "Could not parse start time",
+			})
+			return
+		}
+	}
+	if endStr != "" {
+		end, err = time.Parse(time.RFC3339, endStr)
+		if err != nil {
+			l.Warnf("error parsing end time '%s': %v", endStr, err)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(GeneralResponse{
+				Success: false,
+				Message: "Could not parse end time",
+			})
+			return
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		l.Warn("end time is before start time")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "End time is before start time",
+		})
+		return
+	}
+
+	// only search the data indices of the permitted assets
+	indexName, err := elasticsearch.DataIndexPattern("", current.AssetScope(requestAssets(r)))
+	if err != nil {
+		l.Warn("invalid asset scope: ", err)
+		scopeError(w, err)
+		return
+	}
+
+	// lookup by uid
+	if uid != "" {
+		entries, truncated, err := elasticsearch.QueryTimelineByUID(s, indexName, []string{uid}, start, end)
+		if err != nil {
+			l.Error("error querying timeline by uid: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(InternalServerError)
+			return
+		}
+		l.Info("successfully queried timeline for uid ", uid)
+		json.NewEncoder(w).Encode(timelineResponse{
+			UIDs:      []string{uid},
+			Entries:   entries,
+			Truncated: truncated,
+		})
+		return
+	}
+
+	// lookup by 5-tuple, a time range is required to bound the search
+	tuple := elasticsearch.ConnTuple{
+		SourceIP:      v.Get("srcIP"),
+		DestinationIP: v.Get("dstIP"),
+		Proto:         v.Get("proto"),
+	}
+	if tuple.SourceIP == "" || tuple.DestinationIP == "" || start.IsZero() || end.IsZero() {
+		l.Warn("timeline requires uid or source, destination and time range")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Must provide uid, or srcIP, dstIP, start and end.",
+		})
+		return
+	}
+	for param, port := range map[string]*int{"srcPort": &tuple.SourcePort, "dstPort": &tuple.DestinationPort} {
+		if v.Get(param) == "" {
+			continue
+		}
+		*port, err = strconv.Atoi(v.Get(param))
+		if err != nil || *port < 0 || *port > 65535 {
+			l.Warnf("invalid %s '%s'", param, v.Get(param))
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(GeneralResponse{
+				Success: false,
+				Message: "Invalid " + param + ".",
+			})
+			return
+		}
+	}
+
+	entries, uids, truncated, err := elasticsearch.QueryTimelineByTuple(s, indexName, tuple, start, end)
+	if err != nil {
+		l.Error("error querying timeline by tuple: ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	// success
+	l.Infof("successfully queried timeline for %d connections", len(uids))
+	json.NewEncoder(w).Encode(timelineResponse{
+		UIDs:      uids,
+		Entries:   entries,
+		Truncated: truncated,
+	})
+}
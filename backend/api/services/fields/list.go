@@ -27,11 +27,11 @@ type listReponse struct {
 // listHandler is "/api/fields/list"
 func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 	// get user making current request + logging context
-	_, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// get data conn fields from database
-	fields, err := elasticsearch.GetAllDataMapping(s)
+	// get data conn fields of the permitted assets from database
+	fields, err := elasticsearch.GetAllDataMapping(s, current.AssetScope())
 	if err != nil {
 		l.Error("failed to get data conn mapping ", err)
 		w.WriteHeader(http.StatusInternalServerError)
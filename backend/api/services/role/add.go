@@ -0,0 +1,82 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package role provides the role API service for the backend.
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// roleRequest is the format of the add and update role requests.
+type roleRequest struct {
+	Name        string   `json:"name"`        // Name is unique role identifier
+	Permissions []string `json:"permissions"` // Permissions is a list of permissions granted by the role
+}
+
+// addHandler is "/api/role/add". It is responsible for creating a new role. It
+// requires the "role.write" permission. The role name must be unique and every
+// permission must be valid.
+func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse + validate request
+	request, permissions, ok := parseRequest(w, r, l)
+	if !ok {
+		return
+	}
+	// ensure role does not exist
+	if _, exists := auth.RolePermissions(request.Name); exists {
+		l.Warn("role already exists ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Role name already exists.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	if _, _, err := elasticsearch.QueryRoleByName(s, request.Name); err == nil {
+		l.Warn("role already exists ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Role name already exists.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// create role
+	role := elasticsearch.DocumentRole{
+		Name:        request.Name,
+		Permissions: permissions,
+	}
+	_, err := role.Index(s)
+	if err != nil {
+		l.Error("failed to index role ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	reloadRoles(s, l)
+
+	// success
+	auth.AuditDiff(s, r, "role.add", role.Name, "role created", nil, role)
+	l.Info("successfully created role ", role.Name)
+	out := GeneralResponse{
+		Success: true,
+		Message: "The role has been successfully created.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package role provides the role API service for the backend.
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// deleteRequest is the format of the delete role request.
+type deleteRequest struct {
+	Name string `json:"name"` // Name is unique role identifier
+}
+
+// deleteHandler is "/api/role/delete". It is responsible for deleting a role. It
+// requires the "role.write" permission. Built-in roles and roles assigned to a
+// user can not be deleted.
+func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request deleteRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// prevent deletion of built-in role
+	if auth.BuiltinRole(request.Name) {
+		l.Warn("attempting to delete built-in role ", request.Name)
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Built-in roles can not be deleted.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// query role from database
+	role, _, err := elasticsearch.QueryRoleByName(s, request.Name)
+	if err != nil {
+		l.Warn("invalid role name ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid role name provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// prevent deletion of a role that is assigned to a user
+	users, err := elasticsearch.AllAuth(s)
+	if err != nil {
+		l.Error("failed to get users ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	for _, user := range users {
+		if string(user.Class) == request.Name {
+			l.Warn("attempting to delete role that is assigned to a user")
+			w.WriteHeader(http.StatusForbidden)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Role is assigned to a user. Please reassign the users first.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	}
+
+	// delete role
+	err = elasticsearch.DeleteRoleByName(s, request.Name)
+	if err != nil {
+		l.Error("failed to delete role ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	reloadRoles(s, l)
+
+	// success
+	auth.AuditDiff(s, r, "role.delete", role.Name, "role deleted", role, nil)
+	l.Info("successfully deleted role ", request.Name)
+	out := GeneralResponse{
+		Success: true,
+		Message: "The role has been successfully deleted.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package role provides the role API service for the backend.
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// listResponse is the format of the list role response.
+type listResponse struct {
+	Success     bool                 `json:"success"`     // Success indicates if the request was successful
+	Roles       []Role               `json:"roles"`       // Roles is a list of roles
+	Permissions []jwtauth.Permission `json:"permissions"` // Permissions is a list of every permission a role may grant
+}
+
+// Role represents a role in the system.
+type Role struct {
+	Name        string               `json:"name"`        // Name is unique role identifier
+	Permissions []jwtauth.Permission `json:"permissions"` // Permissions is a list of permissions granted by the role
+	Builtin     bool                 `json:"builtin"`     // Builtin indicates if the role can not be modified
+}
+
+// listHandler is "/api/role/list". It will return the built-in and stored roles
+// with their permissions, and every permission a role may grant.
+func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// fetch stored roles
+	roles, err := elasticsearch.AllRole(s)
+	if err != nil {
+		l.Error("error fetching roles ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	out := listResponse{Success: true}
+	for _, class := range []jwtauth.UserClass{jwtauth.UserAdmin, jwtauth.UserStandard} {
+		permissions, _ := auth.RolePermissions(string(class))
+		out.Roles = append(out.Roles, Role{
+			Name:        string(class),
+			Permissions: permissions,
+			Builtin:     true,
+		})
+	}
+	for _, role := range roles {
+		out.Roles = append(out.Roles, Role{
+			Name:        role.Name,
+			Permissions: role.Permissions,
+		})
+	}
+	for _, permission := range jwtauth.PermissionMap {
+		out.Permissions = append(out.Permissions, permission)
+	}
+	sort.Slice(out.Permissions, func(i, j int) bool { return out.Permissions[i] < out.Permissions[j] })
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package role provides the role API service for the backend.
+package role
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// GeneralResponse is the structure of a general response.
+type GeneralResponse struct {
+	Success bool   `json:"success"` // Success indicates if the request was successful
+	Message string `json:"message"` // Message describes the request response
+}
+
+var (
+	// InternalServerError is the a JSON error message.
+	InternalServerError = GeneralResponse{
+		Success: false,
+		Message: "500 Internal Server Error",
+	}
+)
+
+// RegisterRoutes registers routes to interact with the roles.
+func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
+	// list roles and permissions /api/role/list
+	r.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+		listHandler(r.Context(), s, a, w, r)
+	})
+	// add role /api/role/add
+	r.HandleFunc("/add", auth.Authorize(s, jwtauth.PermRoleWrite, func(w http.ResponseWriter, r *http.Request) {
+		addHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
+	// update role /api/role/update
+	r.HandleFunc("/update", auth.Authorize(s, jwtauth.PermRoleWrite, func(w http.ResponseWriter, r *http.Request) {
+		updateHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
+	// delete role /api/role/delete
+	r.HandleFunc("/delete", auth.Authorize(s, jwtauth.PermRoleWrite, func(w http.ResponseWriter, r *http.Request) {
+		deleteHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
+}
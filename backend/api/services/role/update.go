@@ -0,0 +1,137 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package role provides the role API service for the backend.
+package role
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+	"github.com/sirupsen/logrus"
+)
+
+// updateHandler is "/api/role/update". It is responsible for updating the
+// permissions of an existing role. It requires the "role.write" permission.
+// Built-in roles can not be updated. Changes apply to every user with the role
+// within the role synchronization interval.
+func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse + validate request
+	request, permissions, ok := parseRequest(w, r, l)
+	if !ok {
+		return
+	}
+	// query role from database
+	role, esDocID, err := elasticsearch.QueryRoleByName(s, request.Name)
+	if err != nil {
+		l.Warn("invalid role name ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid role name provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// update role
+	before := role
+	role.Permissions = permissions
+	err = role.Update(s, esDocID)
+	if err != nil {
+		l.Error("failed to update role ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	reloadRoles(s, l)
+
+	// success
+	auth.AuditDiff(s, r, "role.update", role.Name, "role updated", before, role)
+	l.Info("successfully updated role ", role.Name)
+	out := GeneralResponse{
+		Success: true,
+		Message: "The role has been successfully updated.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// parseRequest parses and validates the add and update role requests, returning
+// the request and its permissions. If the request is not valid, the error
+// response is written and false is returned.
+func parseRequest(w http.ResponseWriter, r *http.Request, l *logrus.Entry) (roleRequest, []jwtauth.Permission, bool) {
+	var request roleRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return request, nil, false
+	}
+	// ensure name is valid and not built-in
+	if !utils.ValidRoleName(request.Name) {
+		l.Warn("invalid role name ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Role name must be lowercase alphanumeric and start with a letter.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return request, nil, false
+	}
+	if auth.BuiltinRole(request.Name) {
+		l.Warn("attempting to modify built-in role ", request.Name)
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Built-in roles can not be modified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return request, nil, false
+	}
+	// ensure permissions are valid
+	permissions := []jwtauth.Permission{}
+	seen := map[jwtauth.Permission]bool{}
+	for _, p := range request.Permissions {
+		permission, ok := jwtauth.PermissionMap[p]
+		if !ok {
+			l.Warn("invalid permission ", p)
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Invalid permission " + p + " provided.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return request, nil, false
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			permissions = append(permissions, permission)
+		}
+	}
+	return request, permissions, true
+}
+
+// reloadRoles applies role changes on this backend immediately, other backends
+// reload within the role synchronization interval.
+func reloadRoles(s *state.State, l *logrus.Entry) {
+	err := auth.LoadRoles(s)
+	if err != nil {
+		l.Error("failed to reload roles ", err)
+	}
+}
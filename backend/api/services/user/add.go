@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/email"
@@ -20,14 +21,15 @@ import (
 
 // addRequest is the format of the add user request.
 type addRequest struct {
-	Name  string `json:"name"`  // Name of user to be created
-	UUID  string `json:"uuid"`  // UUID is email of user to be created
-	Class string `json:"class"` // Class of user to be created=
+	Name   string   `json:"name"`   // Name of user to be created
+	UUID   string   `json:"uuid"`   // UUID is email of user to be created
+	Class  string   `json:"class"`  // Class of user to be created=
+	Assets []string `json:"assets"` // Assets are the asset IDs granted to the user, "*" grants all
 }
 
-// addHandler is "/api/user/add". It is responsible for creating new users. An
-// admin may create a user. An error will be returned if not all fields are
-// specified or if the current user does not hold permissions to perform the action.
+// addHandler is "/api/user/add". It is responsible for creating new users. It
+// requires the "user.write" permission. An error will be returned if not all
+// fields are specified.
 // If the account was successfully created, an email will be sent for the new user
 // to set a password.
 func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
@@ -35,17 +37,6 @@ func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.R
 	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// reject request if standard user is making it
-	if current.Class == jwtauth.UserStandard {
-		l.Warn("standard user attempting to add user")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Standard users can not add users.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
 	// attempt to parse request
 	var request addRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -107,7 +98,7 @@ func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.R
 	}
 
 	// ensure class is valid
-	class, ok := jwtauth.UserClassMap[request.Class]
+	_, ok := auth.RolePermissions(request.Class)
 	if !ok {
 		l.Warn("invalid class ", request.Class)
 		w.WriteHeader(http.StatusBadRequest)
@@ -118,6 +109,17 @@ func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.R
 		json.NewEncoder(w).Encode(out)
 		return
 	}
+	// ensure asset IDs are valid
+	if !utils.ValidAssetGrants(request.Assets) {
+		l.Warn("invalid asset IDs ", request.Assets)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset ID provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
 	// ensure user does not already exist
 	_, _, err = elasticsearch.QueryAuthByUUID(s, request.UUID)
 	if err == nil {
@@ -135,9 +137,10 @@ func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.R
 	user := elasticsearch.DocumentAuth{
 		UUID:      request.UUID,
 		Password:  "",
-		Class:     class,
+		Class:     jwtauth.UserClass(request.Class),
 		Name:      request.Name,
 		Activated: true,
+		Assets:    request.Assets,
 	}
 	// index user in database
 	docID, err := user.Index(s)
@@ -148,6 +151,7 @@ func addHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.R
 		return
 	}
 	l.Info("created new user auth/", docID)
+	auth.AuditDiff(s, r, "user.add", user.UUID, "user created", nil, user)
 
 	// generate account activation token (24 hour expiry)
 	payload := &jwtauth.Payload{UUID: user.UUID}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -22,24 +23,13 @@ type deleteRequest struct {
 }
 
 // deleteHandler is "/api/user/delete". It is responsible for deleting users. A
-// user can not delete their own account. A standard user can not delete an
-// account. Admins can delete all users.
+// user can not delete their own account. It requires the "user.write"
+// permission.
 func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 	// get user making current request + logging context
 	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// standard user can not delete user
-	if current.Class == jwtauth.UserStandard {
-		l.Warn("standard user attempting to delete user")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Standard user can not delete users.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
 	// attempt to parse request
 	var request deleteRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -78,7 +68,7 @@ func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		return
 	}
 	// query user from database
-	_, _, err = elasticsearch.QueryAuthByUUID(s, request.UUID)
+	existing, _, err := elasticsearch.QueryAuthByUUID(s, request.UUID)
 	if err != nil {
 		l.Error("error getting user specified in request ", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -97,6 +87,12 @@ func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		json.NewEncoder(w).Encode(InternalServerError)
 		return
 	}
+	auth.AuditDiff(s, r, "user.delete", request.UUID, "user deleted", existing, nil)
+	// revoke sessions of deleted user
+	err = auth.RevokeUserSessions(s, request.UUID)
+	if err != nil {
+		l.Error("failed to revoke sessions of deleted account ", err)
+	}
 
 	// success
 	l.Info("successfully deleted user account ", request.UUID)
@@ -13,11 +13,21 @@ import (
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
 
-// infoHandler is "/api/user/info". It returns the authenticated user info.
+// infoResponse is the format of the user info response.
+type infoResponse struct {
+	*jwtauth.Payload
+	Permissions []jwtauth.Permission `json:"permissions"` // Permissions are granted by the user role
+}
+
+// infoHandler is "/api/user/info". It returns the authenticated user info and
+// the permissions granted by the user role.
 func infoHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
 	// get user from request
 	current := jwtauth.FromContext(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	json.NewEncoder(w).Encode(current)
+	json.NewEncoder(w).Encode(infoResponse{
+		Payload:     current,
+		Permissions: current.Permissions,
+	})
 }
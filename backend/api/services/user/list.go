@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -23,11 +24,14 @@ type listResponse struct {
 
 // User represents the list of users in the system.
 type User struct {
-	Name             string `json:"name"`             // Name of user
-	UUID             string `json:"uuid"`             // UUID is email of user
-	Class            string `json:"class"`            // Class of user
-	Activated        bool   `json:"activated"`        // Activated indicates if user is activated
-	UpdatePermission bool   `json:"updatePermission"` // UpdatePermission indicates if current user can modify this user.
+	Name             string   `json:"name"`             // Name of user
+	UUID             string   `json:"uuid"`             // UUID is email of user
+	Class            string   `json:"class"`            // Class of user
+	Activated        bool     `json:"activated"`        // Activated indicates if user is activated
+	Assets           []string `json:"assets"`           // Assets are the asset IDs granted to the user, "*" grants all
+	MFAEnabled       bool     `json:"mfaEnabled"`       // MFAEnabled indicates if user logs in with a TOTP code
+	Locked           bool     `json:"locked"`           // Locked indicates if user is locked out after too many failed logins
+	UpdatePermission bool     `json:"updatePermission"` // UpdatePermission indicates if current user can modify this user.
 }
 
 // listHandler is "/api/user/list". It will return the list of users and
@@ -41,8 +45,8 @@ func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 	// output
 	var out listResponse
 
-	// retreive users if admin
-	if current.Class == jwtauth.UserAdmin {
+	// retreive users if allowed to manage users
+	if current.Can(jwtauth.PermUserWrite) {
 		users, err := elasticsearch.AllAuth(s)
 		if err != nil {
 			l.Error("error getting users ", err)
@@ -52,17 +56,15 @@ func listHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.
 		}
 
 		for _, u := range users {
-			// can update user if self or admin
-			canUpdateUser := u.UUID == current.UUID
-			if current.Class == jwtauth.UserAdmin {
-				canUpdateUser = true
-			}
 			out.Users = append(out.Users, User{
 				Name:             u.Name,
 				UUID:             u.UUID,
 				Class:            string(u.Class),
 				Activated:        u.Activated,
-				UpdatePermission: canUpdateUser,
+				Assets:           u.Assets,
+				MFAEnabled:       u.TOTPEnabled,
+				Locked:           auth.AccountLocked(u),
+				UpdatePermission: true, // allowed to manage users
 			})
 		}
 	}
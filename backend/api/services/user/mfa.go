@@ -0,0 +1,217 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package user provides the user API service for the backend.
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// mfaRequest is the format of the MFA activate and disable requests.
+type mfaRequest struct {
+	Code string `json:"code"` // Code is a TOTP code or recovery code
+}
+
+// mfaResetRequest is the format of the reset MFA request.
+type mfaResetRequest struct {
+	UUID string `json:"uuid"` // UUID is email of user to reset MFA for
+}
+
+// mfaEnrollResponse is the format of the MFA enrollment response.
+type mfaEnrollResponse struct {
+	Success bool   `json:"success"` // Success indicates if the request was successful
+	Secret  string `json:"secret"`  // Secret is the base32 TOTP secret for manual entry
+	URI     string `json:"uri"`     // URI is the otpauth:// provisioning URI to show as a QR code
+}
+
+// mfaActivateResponse is the format of the MFA activation response.
+type mfaActivateResponse struct {
+	Success       bool     `json:"success"`       // Success indicates if the request was successful
+	Message       string   `json:"message"`       // Message describes the request response
+	RecoveryCodes []string `json:"recoveryCodes"` // RecoveryCodes are shown once
+}
+
+// mfaEnrollHandler is "/api/user/mfa/enroll". It will generate a new TOTP
+// secret for the current user. The enrollment is pending until activated.
+func mfaEnrollHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	secret, uri, err := auth.BeginMFAEnrollment(s, current.UUID)
+	if err != nil {
+		l.Warn("failed to begin MFA enrollment ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Multi-factor authentication is already enabled.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	out := mfaEnrollResponse{
+		Success: true,
+		Secret:  secret,
+		URI:     uri,
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// mfaActivateHandler is "/api/user/mfa/activate". It will activate the pending
+// enrollment of the current user with a TOTP code, returning the recovery
+// codes.
+func mfaActivateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	var request mfaRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	codes, err := auth.ActivateMFAEnrollment(s, current.UUID, request.Code)
+	if err != nil {
+		l.Info("failed to activate MFA enrollment ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid authentication code.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// success
+	auth.Audit(s, r, "mfa.enable", current.UUID, "multi-factor authentication enabled")
+	l.Info("successfully enabled MFA for ", current.UUID)
+	out := mfaActivateResponse{
+		Success:       true,
+		Message:       "Multi-factor authentication has been enabled.",
+		RecoveryCodes: codes,
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// mfaDisableHandler is "/api/user/mfa/disable". It will remove the MFA
+// enrollment of the current user after verifying a code. Users required to use
+// MFA by the MFA_ENFORCE setting can not disable it.
+func mfaDisableHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	if auth.MFARequired(s, current.Class) {
+		l.Warn("user attempting to disable enforced MFA")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Multi-factor authentication is required for your account.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	var request mfaRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	err = auth.VerifyMFA(s, current.UUID, request.Code)
+	if err != nil {
+		l.Info("failed to verify MFA code ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid authentication code.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	err = auth.ResetMFA(s, current.UUID)
+	if err != nil {
+		l.Error("failed to disable MFA ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	// success
+	auth.Audit(s, r, "mfa.disable", current.UUID, "multi-factor authentication disabled")
+	l.Info("successfully disabled MFA for ", current.UUID)
+	out := GeneralResponse{
+		Success: true,
+		Message: "Multi-factor authentication has been disabled.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// mfaResetHandler is "/api/user/mfa/reset". It will remove the MFA enrollment
+// of the user provided in the request, for users that lost their authenticator
+// and recovery codes. It requires the "user.write" permission.
+func mfaResetHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request mfaResetRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	uuid := request.UUID
+	err = auth.ResetMFA(s, uuid)
+	if err != nil {
+		l.Warn("failed to reset MFA of user specified in request ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid user provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// existing sessions may have been started by whoever held the lost factor
+	err = auth.RevokeUserSessions(s, uuid)
+	if err != nil {
+		l.Error("failed to revoke sessions of user ", err)
+	}
+
+	// success
+	auth.Audit(s, r, "mfa.reset", uuid, "multi-factor authentication reset")
+	l.Info("successfully reset MFA for ", uuid)
+	out := GeneralResponse{
+		Success: true,
+		Message: "Multi-factor authentication has been reset.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
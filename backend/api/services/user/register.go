@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -37,19 +38,59 @@ func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 		listHandler(r.Context(), s, a, w, r)
 	})
 	// add user /api/user/add
-	r.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/add", auth.Authorize(s, jwtauth.PermUserWrite, func(w http.ResponseWriter, r *http.Request) {
 		addHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 	// update user /api/user/update
 	r.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
 		updateHandler(r.Context(), s, a, w, r)
-	})
+	}).Methods("POST")
 	// reset pass for other user /api/user/add
-	r.HandleFunc("/resetPass", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/resetPass", auth.Authorize(s, jwtauth.PermUserWrite, func(w http.ResponseWriter, r *http.Request) {
 		resetPassHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 	// delete other user /api/user/delete
-	r.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/delete", auth.Authorize(s, jwtauth.PermUserWrite, func(w http.ResponseWriter, r *http.Request) {
 		deleteHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
+	// unlock locked out user /api/user/unlock
+	r.HandleFunc("/unlock", auth.Authorize(s, jwtauth.PermUserWrite, func(w http.ResponseWriter, r *http.Request) {
+		unlockHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
+	// list active sessions /api/user/sessions
+	r.HandleFunc("/sessions", func(w http.ResponseWriter, r *http.Request) {
+		sessionsHandler(r.Context(), s, a, w, r)
+	})
+	// revoke session /api/user/sessions/revoke
+	r.HandleFunc("/sessions/revoke", func(w http.ResponseWriter, r *http.Request) {
+		revokeSessionHandler(r.Context(), s, a, w, r)
+	}).Methods("POST")
+	// list API tokens /api/user/tokens
+	r.HandleFunc("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		tokensHandler(r.Context(), s, a, w, r)
 	})
+	// create API token /api/user/tokens/add
+	r.HandleFunc("/tokens/add", func(w http.ResponseWriter, r *http.Request) {
+		addTokenHandler(r.Context(), s, a, w, r)
+	}).Methods("POST")
+	// revoke API token /api/user/tokens/revoke
+	r.HandleFunc("/tokens/revoke", func(w http.ResponseWriter, r *http.Request) {
+		revokeTokenHandler(r.Context(), s, a, w, r)
+	}).Methods("POST")
+	// begin MFA enrollment /api/user/mfa/enroll
+	r.HandleFunc("/mfa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		mfaEnrollHandler(r.Context(), s, a, w, r)
+	}).Methods("POST")
+	// activate MFA enrollment /api/user/mfa/activate
+	r.HandleFunc("/mfa/activate", func(w http.ResponseWriter, r *http.Request) {
+		mfaActivateHandler(r.Context(), s, a, w, r)
+	}).Methods("POST")
+	// disable MFA /api/user/mfa/disable
+	r.HandleFunc("/mfa/disable", func(w http.ResponseWriter, r *http.Request) {
+		mfaDisableHandler(r.Context(), s, a, w, r)
+	}).Methods("POST")
+	// reset MFA of other user /api/user/mfa/reset
+	r.HandleFunc("/mfa/reset", auth.Authorize(s, jwtauth.PermUserWrite, func(w http.ResponseWriter, r *http.Request) {
+		mfaResetHandler(r.Context(), s, a, w, r)
+	})).Methods("POST")
 }
@@ -24,27 +24,14 @@ type resetPassRequest struct {
 }
 
 // Pass is "/api/user/resetPass". It is responsible for sending a password reset
-// link to the provided user. A standard user can not use this endpoint. An admin
-// may request a password reset for any user. If the requesting user has
-// permissions and the provided user email is valid, the user will be emailed a
-// password reset link. If the requesting user does not have permissions or if
-// the user email is not valid, an error will be returned.
+// link to the provided user. It requires the "user.write" permission. If the
+// provided user email is valid, the user will be emailed a password reset link.
+// If the user email is not valid, an error will be returned.
 func resetPassHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// standard user can not reset password here
-	if current.Class == jwtauth.UserStandard {
-		l.Warn("standard user attempting to reset password")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Standard user can not reset password.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
 	// attempt to parse request
 	var request resetPassRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -103,6 +90,7 @@ func resetPassHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w
 	}
 
 	// success
+	auth.Audit(s, r, "user.resetPass", existing.UUID, "password reset issued")
 	l.Info("successfully issued password reset for user account ", request.UUID)
 	out := GeneralResponse{
 		Success: true,
@@ -0,0 +1,140 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package user provides the user API service for the backend.
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// sessionsResponse is the format of the list sessions response.
+type sessionsResponse struct {
+	Success  bool      `json:"success"`  // Success indicates if the request was successful
+	Sessions []Session `json:"sessions"` // Sessions is a list of active sessions
+}
+
+// revokeSessionRequest is the format of the revoke session request.
+type revokeSessionRequest struct {
+	UUID string `json:"uuid"` // UUID is unique session identifier
+}
+
+// Session represents an active login session.
+type Session struct {
+	UUID      string `json:"uuid"`      // UUID is unique session identifier
+	User      string `json:"user"`      // User is email of session user
+	Address   string `json:"address"`   // Address is the client address at login
+	UserAgent string `json:"userAgent"` // UserAgent is the client user agent at login
+	Created   string `json:"created"`   // Created is the login time
+	LastSeen  string `json:"lastSeen"`  // LastSeen is the last time the session was renewed
+	Expires   string `json:"expires"`   // Expires is when the session expires
+	Current   bool   `json:"current"`   // Current indicates if this is the session of the request
+}
+
+// sessionsHandler is "/api/user/sessions". It will return the active sessions.
+// Without the "user.write" permission only the own sessions are listed.
+// Otherwise all sessions are listed, or the sessions of the user provided in
+// the "uuid" query parameter.
+func sessionsHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	user := current.UUID
+	if current.Can(jwtauth.PermUserWrite) {
+		user = r.URL.Query().Get("uuid")
+	}
+	sessions, _, err := elasticsearch.ActiveSession(s, user)
+	if err != nil {
+		l.Error("error getting sessions ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	out := sessionsResponse{Success: true, Sessions: []Session{}}
+	for _, session := range sessions {
+		out.Sessions = append(out.Sessions, Session{
+			UUID:      session.UUID,
+			User:      session.User,
+			Address:   session.Address,
+			UserAgent: session.UserAgent,
+			Created:   session.Created,
+			LastSeen:  session.LastSeen,
+			Expires:   session.Expires,
+			Current:   session.UUID == current.Id,
+		})
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// revokeSessionHandler is "/api/user/sessions/revoke". It will revoke the
+// session provided in the request, logging it out on every backend. Without the "user.write" permission only the own sessions can be
+// revoked.
+func revokeSessionHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request revokeSessionRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// query session from database
+	session, _, err := elasticsearch.QuerySessionByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("error getting session specified in request ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid session provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// user without permission can only revoke own sessions
+	if !current.Can(jwtauth.PermUserWrite) && session.User != current.UUID {
+		l.Warn("user attempting to revoke session of other user")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Permission user.write is required to revoke sessions of other users.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// revoke session
+	err = auth.RevokeSession(s, session.UUID)
+	if err != nil {
+		l.Error("failed to revoke session ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	// success
+	auth.Audit(s, r, "session.revoke", session.UUID, "session of "+session.User+" revoked")
+	l.Info("successfully revoked session ", session.UUID)
+	out := GeneralResponse{
+		Success: true,
+		Message: "The session has been successfully revoked.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,317 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package user provides the user API service for the backend.
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// tokensResponse is the format of the list API tokens response.
+type tokensResponse struct {
+	Success bool       `json:"success"` // Success indicates if the request was successful
+	Tokens  []APIToken `json:"tokens"`  // Tokens is a list of API tokens that are not revoked
+}
+
+// APIToken represents an API token without its secret.
+type APIToken struct {
+	UUID        string               `json:"uuid"`        // UUID is unique token identifier
+	Name        string               `json:"name"`        // Name describes the token
+	Class       string               `json:"class"`       // Class is "personal" or "service"
+	User        string               `json:"user"`        // User is email of the user that created the token
+	Permissions []jwtauth.Permission `json:"permissions"` // Permissions is a list of permissions granted to the token
+	Assets      []string             `json:"assets"`      // Assets restricts a service token to the asset IDs, empty is all
+	Created     string               `json:"created"`     // Created is when the token was created
+	Expires     string               `json:"expires"`     // Expires is when the token expires
+	LastUsed    string               `json:"lastUsed"`    // LastUsed is the last time the token was used
+	LastAddress string               `json:"lastAddress"` // LastAddress is the client address of the last request
+}
+
+// addTokenRequest is the format of the add API token request.
+type addTokenRequest struct {
+	Name        string   `json:"name"`        // Name describes the token
+	Class       string   `json:"class"`       // Class is "personal" or "service"
+	Permissions []string `json:"permissions"` // Permissions is a list of permissions granted to the token
+	Assets      []string `json:"assets"`      // Assets restricts a service token to the asset IDs, empty is all
+	Days        int      `json:"days"`        // Days is how many days the token is valid for
+}
+
+// addTokenResponse is the format of the add API token response.
+type addTokenResponse struct {
+	Success bool   `json:"success"` // Success indicates if the request was successful
+	UUID    string `json:"uuid"`    // UUID is unique token identifier
+	Token   string `json:"token"`   // Token is the bearer token, it is only returned once
+}
+
+// revokeTokenRequest is the format of the revoke API token request.
+type revokeTokenRequest struct {
+	UUID string `json:"uuid"` // UUID is unique token identifier
+}
+
+// tokensHandler is "/api/user/tokens". It will return the API tokens that are
+// not revoked. Without the "user.write" permission only the own tokens are
+// listed. Otherwise all tokens are listed, or the tokens of the user provided
+// in the "uuid" query parameter.
+func tokensHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	user := current.UUID
+	if current.Can(jwtauth.PermUserWrite) {
+		user = r.URL.Query().Get("uuid")
+	}
+	tokens, err := elasticsearch.AllAPIToken(s, user)
+	if err != nil {
+		l.Error("error getting API tokens ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	out := tokensResponse{Success: true, Tokens: []APIToken{}}
+	for _, token := range tokens {
+		out.Tokens = append(out.Tokens, APIToken{
+			UUID:        token.UUID,
+			Name:        token.Name,
+			Class:       string(token.Class),
+			User:        token.User,
+			Permissions: token.Permissions,
+			Assets:      token.Assets,
+			Created:     token.Created,
+			Expires:     token.Expires,
+			LastUsed:    token.LastUsed,
+			LastAddress: token.LastAddress,
+		})
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// addTokenHandler is "/api/user/tokens/add". It is responsible for creating API
+// tokens. A token can only be granted permissions held by the current user.
+// Personal tokens act as the current user. Service tokens act as a service
+// identity and require the "user.write" permission. The token is returned
+// once, only its hash is stored.
+func addTokenHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request addTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	err = utils.ValidateBasic(request.Name)
+	if err != nil {
+		l.Warn("not all fields specified")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Name " + err.Error(),
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// ensure class is valid
+	class, ok := elasticsearch.TokenClassMap[request.Class]
+	if !ok {
+		l.Warn("invalid token class ", request.Class)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid class provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	if class == elasticsearch.TokenService && !current.Can(jwtauth.PermUserWrite) {
+		l.Warn("user attempting to create service token")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Permission user.write is required to create service tokens.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// ensure expiry is valid
+	expires := time.Duration(request.Days) * 24 * time.Hour
+	if expires <= 0 || expires > auth.TokenMaxAge {
+		l.Warn("invalid token expiry ", request.Days)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Token must expire within 1 to 365 days.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// ensure permissions are valid and held by current user
+	permissions := []jwtauth.Permission{}
+	for _, p := range request.Permissions {
+		permission, ok := jwtauth.PermissionMap[p]
+		if !ok || !current.Can(permission) {
+			l.Warn("invalid token permission ", p)
+			w.WriteHeader(http.StatusForbidden)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Permission " + p + " can not be granted.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+		permissions = append(permissions, permission)
+	}
+	// service tokens are restricted to the assets of the current user, personal
+	// tokens follow the grant of the current user
+	var assets []string
+	if class == elasticsearch.TokenService {
+		if !utils.ValidAssetIDs(request.Assets) {
+			l.Warn("invalid asset IDs ", request.Assets)
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Invalid asset ID provided.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+		assets = current.AssetScope(request.Assets)
+		if assets != nil && len(assets) == 0 {
+			l.Warn("no access to requested token assets ", request.Assets)
+			w.WriteHeader(http.StatusForbidden)
+			out := GeneralResponse{
+				Success: false,
+				Message: "No access to the requested assets.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+		// every asset is granted explicitly, a token without grants has none
+		if assets == nil {
+			assets = []string{jwtauth.AllAssets}
+		}
+	}
+
+	// generate + store token
+	id, secret, hash, err := auth.NewAPIToken()
+	if err != nil {
+		l.Error("failed to generate API token ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	token := elasticsearch.DocumentAPIToken{
+		UUID:        id,
+		Name:        request.Name,
+		Class:       class,
+		User:        current.UUID,
+		Hash:        hash,
+		Permissions: permissions,
+		Assets:      assets,
+		Created:     now.Format(time.RFC3339),
+		Expires:     now.Add(expires).Format(time.RFC3339),
+	}
+	_, err = token.Index(s)
+	if err != nil {
+		l.Error("failed to index API token ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	// success
+	auth.AuditDiff(s, r, "token.add", token.UUID, "API token created", nil, token)
+	l.Info("successfully created API token ", id)
+	out := addTokenResponse{
+		Success: true,
+		UUID:    id,
+		Token:   secret,
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// revokeTokenHandler is "/api/user/tokens/revoke". It is responsible for
+// revoking API tokens. Without the "user.write" permission only the own tokens
+// can be revoked.
+func revokeTokenHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get user making current request + logging context
+	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request revokeTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// query token from database
+	token, esDocID, err := elasticsearch.QueryAPITokenByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("error getting API token specified in request ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid token provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// user without permission can only revoke own tokens
+	if !current.Can(jwtauth.PermUserWrite) && token.User != current.UUID {
+		l.Warn("user attempting to revoke API token of other user")
+		w.WriteHeader(http.StatusForbidden)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Permission user.write is required to revoke tokens of other users.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	// revoke token
+	token.Revoked = true
+	err = token.Update(s, esDocID)
+	if err != nil {
+		l.Error("failed to revoke API token ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+
+	// success
+	auth.Audit(s, r, "token.revoke", token.UUID, "API token revoked")
+	l.Info("successfully revoked API token ", token.UUID)
+	out := GeneralResponse{
+		Success: true,
+		Message: "The token has been successfully revoked.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
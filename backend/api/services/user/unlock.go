@@ -0,0 +1,64 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package user provides the user API service for the backend.
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// unlockRequest is the format of the unlock user request.
+type unlockRequest struct {
+	UUID string `json:"uuid"` // UUID is email of user to unlock
+}
+
+// unlockHandler is "/api/user/unlock". It will remove the lockout after too
+// many failed logins of the user provided in the request. It requires the
+// "user.write" permission.
+func unlockHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
+	// get logging context
+	l := ctxlog.Log(ctx)
+	w.Header().Set("Content-Type", "application/json")
+
+	// attempt to parse request
+	var request unlockRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Warn("invalid request format")
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	uuid := request.UUID
+	err = auth.UnlockAccount(s, r, uuid)
+	if err != nil {
+		l.Warn("failed to unlock user specified in request ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid user provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// success
+	l.Info("successfully unlocked user ", uuid)
+	out := GeneralResponse{
+		Success: true,
+		Message: "The user has been successfully unlocked.",
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -18,10 +19,11 @@ import (
 
 // updateRequest is the format of the update user request.
 type updateRequest struct {
-	Name      string `json:"name"`      // Name is desired user name
-	UUID      string `json:"uuid"`      // UUID is desired user email
-	Class     string `json:"class"`     // Class is desired user class
-	Activated bool   `json:"activated"` // Activated is desired user activation status
+	Name      string   `json:"name"`      // Name is desired user name
+	UUID      string   `json:"uuid"`      // UUID is desired user email
+	Class     string   `json:"class"`     // Class is desired user class
+	Activated bool     `json:"activated"` // Activated is desired user activation status
+	Assets    []string `json:"assets"`    // Assets are the desired asset IDs granted to the user, "*" grants all
 }
 
 // updateHandler is "/api/user/update". It allows for standard users and admins
@@ -118,17 +120,18 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	// find if modifying self
 	modifyingSelf := current.UUID == userToUpdate
 
-	// find current user status
-	isStandard := current.Class == jwtauth.UserStandard
+	// find current user status, users that can not manage users are standard
+	isStandard := !current.Can(jwtauth.PermUserWrite)
 
 	// check what parameters are being modified
 	nameModified := existing.Name != request.Name
 	emailModified := existing.UUID != request.UUID
 	classModified := string(existing.Class) != request.Class
 	activatedModified := existing.Activated != request.Activated
+	assetsModified := !equalAssets(existing.Assets, request.Assets)
 
 	// check if things have to change
-	if !nameModified && !emailModified && !classModified && !activatedModified {
+	if !nameModified && !emailModified && !classModified && !activatedModified && !assetsModified {
 		l.Info("no changes in user update")
 		out := GeneralResponse{
 			Success: true,
@@ -149,8 +152,8 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		return
 	}
 	// standard can change: name, email
-	if isStandard && (classModified || activatedModified) {
-		l.Warn("standard user attempting to change class/activation")
+	if isStandard && (classModified || activatedModified || assetsModified) {
+		l.Warn("standard user attempting to change class/activation/assets")
 		w.WriteHeader(http.StatusForbidden)
 		out := GeneralResponse{
 			Success: false,
@@ -159,6 +162,17 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		json.NewEncoder(w).Encode(out)
 		return
 	}
+	// if assets modified, ensure asset IDs are valid
+	if assetsModified && !utils.ValidAssetGrants(request.Assets) {
+		l.Warn("invalid asset IDs ", request.Assets)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset ID provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
 	// prevent lockout: admins cannot modify own class/activation
 	if modifyingSelf && (classModified || activatedModified) {
 		l.Warn("user attempting to modify own class/activation")
@@ -188,7 +202,7 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 	// if class modified, ensure class is valid
 	if classModified {
-		_, ok := jwtauth.UserClassMap[request.Class]
+		_, ok := auth.RolePermissions(request.Class)
 		if !ok {
 			l.Warn("invalid class ", request.Class)
 			w.WriteHeader(http.StatusBadRequest)
@@ -202,10 +216,12 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 
 	// passed all the tests, update existing user as requested
+	before := existing
 	existing.Name = request.Name
 	existing.UUID = request.UUID
-	existing.Class = jwtauth.UserClassMap[request.Class]
+	existing.Class = jwtauth.UserClass(request.Class)
 	existing.Activated = request.Activated
+	existing.Assets = request.Assets
 
 	// attempt to commit changes to database
 	err = existing.Update(s, esDocID)
@@ -215,6 +231,14 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		json.NewEncoder(w).Encode(InternalServerError)
 		return
 	}
+	auth.AuditDiff(s, r, "user.update", before.UUID, "user updated", before, existing)
+	// revoke sessions of deactivated user
+	if !existing.Activated {
+		err = auth.RevokeUserSessions(s, existing.UUID)
+		if err != nil {
+			l.Error("failed to revoke sessions of deactivated account ", err)
+		}
+	}
 
 	// success
 	l.Info("successfully updated user account ", existing.UUID)
@@ -224,3 +248,17 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 	json.NewEncoder(w).Encode(out)
 }
+
+// equalAssets returns true if both asset lists contain the same asset IDs in
+// the same order.
+func equalAssets(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
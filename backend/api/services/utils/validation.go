@@ -8,6 +8,8 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 )
 
 // Returns false if passed string is empty, begins/ends in whitespace
@@ -76,3 +78,32 @@ func ValidEmail(email string) bool {
 
 	return match
 }
+
+// Returns false if any asset ID is empty or not alphanumeric
+func ValidAssetIDs(assets []string) bool {
+	pattern := regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+	for _, asset := range assets {
+		if !pattern.MatchString(asset) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns false if any asset grant of a user is not a valid asset ID or the
+// grant of every asset
+func ValidAssetGrants(assets []string) bool {
+	for _, asset := range assets {
+		if asset != jwtauth.AllAssets && !ValidAssetIDs([]string{asset}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns false if role name is not lowercase alphanumeric with dashes or
+// underscores, starting with a letter
+func ValidRoleName(name string) bool {
+	pattern := regexp.MustCompile(`^[a-z][a-z0-9_\-]{0,63}$`)
+	return pattern.MatchString(name)
+}
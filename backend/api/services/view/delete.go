@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -21,24 +22,12 @@ type deleteRequest struct {
 }
 
 // deleteHandler is "/api/view/deleteHandler". It is responsible for deleting a
-// view. A standard user cannot delete views. An admin can delete any view.
+// view. It requires the "view.write" permission.
 func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// only admins can use this endpoint
-	if current.Class != jwtauth.UserAdmin {
-		l.Warn("non admin attempting to delete view")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Only an admin can delete view.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
-
 	// attempt to parse request
 	var request deleteRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -118,6 +107,7 @@ func deleteHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 
 	// success
+	auth.AuditDiff(s, r, "view.delete", request.UUID, "view deleted", view, nil)
 	l.Info("successfully deleted view ", request.UUID)
 	out := GeneralResponse{
 		Success: true,
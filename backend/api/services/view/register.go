@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -33,15 +34,15 @@ func RegisterRoutes(s *state.State, a *jwtauth.Config, r *mux.Router) {
 		listHandler(r.Context(), s, a, w, r)
 	})
 	// add new visualization /api/view/add
-	r.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/add", auth.Authorize(s, jwtauth.PermViewWrite, func(w http.ResponseWriter, r *http.Request) {
 		addHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 	// update visualization /api/view/update
-	r.HandleFunc("/update", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/update", auth.Authorize(s, jwtauth.PermViewWrite, func(w http.ResponseWriter, r *http.Request) {
 		updateHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 	// delete visualization /api/view/delete
-	r.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/delete", auth.Authorize(s, jwtauth.PermViewWrite, func(w http.ResponseWriter, r *http.Request) {
 		deleteHandler(r.Context(), s, a, w, r)
-	})
+	})).Methods("POST")
 }
@@ -10,6 +10,8 @@ import (
 	"net/http"
 	"unicode"
 
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
@@ -24,28 +26,22 @@ type updateRequest struct {
 	DataIndex  string   `json:"index"`      // DataIndex is index fields are contained in
 	Fields     []string `json:"fields"`     // Fields is the array of fields to be used in this view
 	FieldNames []string `json:"fieldNames"` // FieldNames is the array of common field names
+	Metric     string   `json:"metric"`     // Metric is the statistic computed by a line or single-stat view
+	Percentile float64  `json:"percentile"` // Percentile is the percentile computed by a percentile metric
+	GroupBy    string   `json:"groupBy"`    // GroupBy is the field a line view is split by
+	Assets     []string `json:"assets"`     // Assets restricts the view to the asset IDs, empty is all
+	Groups     []string `json:"groups"`     // Groups restricts the view to the assets in the asset groups, empty is all
+	Tags       []string `json:"tags"`       // Tags restricts the view to the assets with the tags, empty is all
 }
 
 // updateHandler is "/api/view/update". It is responsible for updating an
-// existing view. A standard user cannot update views. An admin can update
-// any view. The same restrictions regarding addHandler apply here.
+// existing view. It requires the "view.write" permission. The same
+// restrictions regarding addHandler apply here.
 func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w http.ResponseWriter, r *http.Request) {
-	// get user making current request + logging context
-	current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+	// get logging context
+	l := ctxlog.Log(ctx)
 	w.Header().Set("Content-Type", "application/json")
 
-	// reject request if standard user is making it
-	if current.Class == jwtauth.UserStandard {
-		l.Warn("standard user attempting to add view")
-		w.WriteHeader(http.StatusForbidden)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Standard users can not add views.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
-
 	// attempt to parse request
 	var request updateRequest
 	err := json.NewDecoder(r.Body).Decode(&request)
@@ -144,6 +140,37 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		return
 	}
 
+	// ensure asset IDs are valid
+	if !utils.ValidAssetIDs(request.Assets) {
+		l.Warn("invalid asset IDs ", request.Assets)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset ID provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// ensure asset groups exist
+	known, err := knownGroups(s, request.Groups)
+	if err != nil {
+		l.Error("error fetching asset groups ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(InternalServerError)
+		return
+	}
+	if !known {
+		l.Warn("invalid asset groups ", request.Groups)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset group provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	// ensure correct number of fields for each view class
 	if (class == elasticsearch.ViewBar) || (class == elasticsearch.ViewPie) {
 		if len(request.Fields) != 1 {
@@ -178,10 +205,99 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 			json.NewEncoder(w).Encode(out)
 			return
 		}
+	} else if class == elasticsearch.ViewTimeSeries {
+		if len(request.Fields) != 1 {
+			l.Warnf("view class %s, expected 1 field, got %d", class, len(request.Fields))
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Time series views take 1 field.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	} else if (class == elasticsearch.ViewHeatmap) || (class == elasticsearch.ViewSankey) {
+		if len(request.Fields) != 2 {
+			l.Warnf("view class %s, expected 2 field, got %d", class, len(request.Fields))
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Heatmap/Sankey views take 2 field.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	} else if class == elasticsearch.ViewTopN {
+		if len(request.Fields) == 0 {
+			l.Warnf("view class %s, got no fields", class)
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Top-N view requires atleast one field.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	} else if class == elasticsearch.ViewStat {
+		if len(request.Fields) != 1 {
+			l.Warnf("view class %s, expected 1 field, got %d", class, len(request.Fields))
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Single-stat views take 1 field.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	}
+
+	// ensure metric is valid, single-stat views require one
+	metric, ok := elasticsearch.ViewMetricMap[request.Metric]
+	if (request.Metric != "" && !ok) || (class == elasticsearch.ViewStat && !ok) {
+		l.Warn("invalid metric ", request.Metric)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid metric provided.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	if metric != "" && class != elasticsearch.ViewLine && class != elasticsearch.ViewStat {
+		l.Warnf("view class %s does not take a metric", class)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Only line and single-stat views take a metric.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	if metric == elasticsearch.MetricPercentile && (request.Percentile <= 0 || request.Percentile >= 100) {
+		l.Warn("invalid percentile ", request.Percentile)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Percentile must be between 0 and 100.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// only line views with a metric can be grouped
+	if request.GroupBy != "" && (class != elasticsearch.ViewLine || metric == "") {
+		l.Warnf("view class %s with metric '%s' cannot be grouped", class, metric)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Only line views with a metric can be grouped.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
 	}
 
 	// query elasticsearch for existing document ID
-	_, esDocID, err := elasticsearch.QueryViewByUUID(s, request.UUID)
+	existing, esDocID, err := elasticsearch.QueryViewByUUID(s, request.UUID)
 	if err != nil {
 		l.Warn("invalid view uuid ", request.UUID)
 		w.WriteHeader(http.StatusBadRequest)
@@ -201,6 +317,12 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 		DataIndex:  request.DataIndex,
 		Fields:     request.Fields,
 		FieldNames: request.FieldNames,
+		Metric:     metric,
+		Percentile: request.Percentile,
+		GroupBy:    request.GroupBy,
+		Assets:     request.Assets,
+		Groups:     request.Groups,
+		Tags:       request.Tags,
 	}
 
 	// update document
@@ -213,6 +335,7 @@ func updateHandler(ctx context.Context, s *state.State, a *jwtauth.Config, w htt
 	}
 
 	// success
+	auth.AuditDiff(s, r, "view.update", request.UUID, "view updated", existing, updatedDoc)
 	l.Info("successfully updated view ", request.UUID)
 	out := GeneralResponse{
 		Success: true,
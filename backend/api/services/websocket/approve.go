@@ -5,13 +5,15 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
 
 type approveIngestionRequest struct {
-	UUID string `json:"uuid"` // Name of the ingestion engine
+	UUID        string `json:"uuid"`        // Name of the ingestion engine
+	Fingerprint string `json:"fingerprint"` // Fingerprint of the identity key compared with the client log
 }
 
 func approveIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
@@ -33,8 +35,6 @@ func approveIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	auth := waitList.getItem(request.UUID)
-
 	err = utils.ValidateBasic(request.UUID)
 	if err != nil {
 		l.Warn("UUID name not specified")
@@ -61,11 +61,51 @@ func approveIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ensure ingestion client is awaiting approval with the identity key the
+	// administrator compared
+	conn, pending, ok := waitList.find(request.UUID, request.Fingerprint)
+	if !ok {
+		l.Warn("ingestion client not awaiting approval with fingerprint ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Ingestion client is not awaiting approval with this fingerprint.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// pin the identity key the client authenticates with
 	document := elasticsearch.DocumentIngestion{
-		Key:     auth.Key,
-		UUID:    request.UUID,
-		Address: auth.Address,
-		Name:    request.UUID,
+		UUID:        request.UUID,
+		Address:     pending.Address,
+		Name:        request.UUID,
+		IdentityKey: pending.IdentityKey,
+	}
+
+	// issue the client certificate bound to the asset ID
+	var certificate string
+	if pending.CSR != "" {
+		certificate, document.CertSerial, err = auth.IssueIngestionCert(request.UUID, pending.CSR)
+		if err != nil {
+			l.Warn("invalid certificate signing request ", err)
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Ingestion client sent an invalid certificate request.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	} else if s.Settings.IngestionMTLSRequired {
+		l.Warn("ingestion client did not request a certificate ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Ingestion client does not support client certificates.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
 	}
 
 	_, err = document.Index(s)
@@ -81,7 +121,8 @@ func approveIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success
-	waitList.approve(request.UUID)
+	waitList.approve(conn, certificate)
+	auth.AuditDiff(s, r, "ingestion.approve", document.UUID, "ingestion client approved", nil, document)
 
 	resp := GeneralResponse{
 		Success: true,
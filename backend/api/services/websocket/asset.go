@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+type assetRequest struct {
+	UUID string `json:"uuid"` // UUID of the ingestion client
+	Name string `json:"name"` // Name of the ingestion client
+
+	elasticsearch.AssetMetadata
+}
+
+// assetHandler is "/api/ingestion/update". It replaces the name and asset
+// metadata of an ingestion client.
+func assetHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+
+	var request assetRequest
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode request to json
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Error("Failed to decode json", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	err = utils.ValidateBasic(request.Name)
+	if err != nil {
+		l.Warn("invalid ingestion name ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Name " + err.Error(),
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	err = validateMetadata(s, &request.AssetMetadata)
+	if err != nil {
+		l.Warn("invalid asset metadata: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: err.Error(),
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	existing, esDocID, err := elasticsearch.QueryIngestionByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("invalid ingestion uuid ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid ingestion UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	document := existing
+	document.Name = request.Name
+	document.AssetMetadata = request.AssetMetadata
+	err = document.Update(s, esDocID)
+	if err != nil {
+		l.Error("Failed to update ingestion", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// Success
+	auth.AuditDiff(s, r, "ingestion.update", document.UUID, "ingestion client metadata updated", existing, document)
+	l.Info("Updated ingestion metadata")
+
+	w.WriteHeader(http.StatusOK)
+	out := GeneralResponse{
+		Success: true,
+		Message: "Successfully updated ingestion client",
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// validateMetadata returns an error describing the first invalid field of the
+// asset metadata. Empty lists are stored as empty rather than null.
+func validateMetadata(s *state.State, m *elasticsearch.AssetMetadata) error {
+	for _, segment := range m.Segments {
+		_, _, err := net.ParseCIDR(segment)
+		if err != nil {
+			return errors.New("Invalid network segment " + segment + ", expected a CIDR such as 10.0.0.0/24.")
+		}
+	}
+	for _, tag := range m.Tags {
+		if utils.ValidateBasic(tag) != nil {
+			return errors.New("Tags cannot be empty or begin or end in whitespace.")
+		}
+	}
+	if m.Criticality != "" && !elasticsearch.Criticality[m.Criticality] {
+		return errors.New("Criticality must be low, medium, high or critical.")
+	}
+	if len(m.Groups) > 0 {
+		groups, err := elasticsearch.AllAssetGroup(s)
+		if err != nil {
+			return errors.New("Failed to retrieve asset groups.")
+		}
+		known := map[string]bool{}
+		for _, g := range groups {
+			known[g.UUID] = true
+		}
+		for _, group := range m.Groups {
+			if !known[group] {
+				return errors.New("Invalid asset group specified.")
+			}
+		}
+	}
+
+	if m.Segments == nil {
+		m.Segments = []string{}
+	}
+	if m.Tags == nil {
+		m.Tags = []string{}
+	}
+	if m.Groups == nil {
+		m.Groups = []string{}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// caHandler returns the PEM encoded ingestion certificate authority
+// certificate, provided to ingestion clients with the "--ca" flag to verify the
+// backend.
+func caHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="canids-ca.pem"`)
+	w.Write(auth.CACertificate())
+}
+
+// renewCertificate issues a client certificate to the approved ingestion client
+// from its certificate signing request, revoking the certificate it replaces.
+// It returns the PEM encoded certificate, or an empty string if it could not be
+// issued.
+func renewCertificate(s *state.State, r *http.Request, ingestion elasticsearch.DocumentIngestion, esDocID string, csr string) string {
+	certificate, serial, err := auth.IssueIngestionCert(ingestion.UUID, csr)
+	if err != nil {
+		log.Println("Failed to issue client certificate: ", err)
+		return ""
+	}
+	previous := ingestion.CertSerial
+	ingestion.CertSerial = serial
+	err = ingestion.Update(s, esDocID)
+	if err != nil {
+		log.Println("Failed to store client certificate serial: ", err)
+		return ""
+	}
+	err = auth.RevokeIngestionCert(s, r, ingestion.UUID, previous)
+	if err != nil {
+		log.Println("Failed to revoke previous client certificate: ", err)
+	}
+	auth.Audit(s, r, "ingestion.certificate", ingestion.UUID, "ingestion client certificate "+serial+" issued")
+	return certificate
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
@@ -48,6 +49,37 @@ func deleteIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// query ingestion client for the audit log
+	var before interface{}
+	if existing, _, err := elasticsearch.QueryIngestionByUUID(s, request.UUID); err == nil {
+		before = existing
+
+		// revoke the client certificate so it can not be used to reconnect
+		err = auth.RevokeIngestionCert(s, r, request.UUID, existing.CertSerial)
+		if err != nil {
+			l.Error("Failed to revoke ingestion client certificate", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Please contact system administrator.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	}
+
+	err = elasticsearch.DeleteIngestionProfiles(s, request.UUID)
+	if err != nil {
+		l.Error("Failed to delete ingestion client profile", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
 	err = elasticsearch.DeleteIngestByUUID(s, request.UUID)
 	if err != nil {
 		l.Error("Failed to delete ingestion client", err)
@@ -63,6 +95,8 @@ func deleteIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 	//Success
 
 	del.update(request.UUID, false)
+	statuses.delete(request.UUID)
+	auth.AuditDiff(s, r, "ingestion.delete", request.UUID, "ingestion client deleted", before, nil)
 
 	w.WriteHeader(http.StatusOK)
 	out := GeneralResponse{
@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+type encryptionRequest struct {
+	UUID     string `json:"uuid"`     // UUID of the ingestion client
+	Required bool   `json:"required"` // Whether the client must encrypt payloads
+}
+
+// encryptionHandler is "/api/ingestion/encryption". It sets whether the
+// ingestion client must encrypt payloads. Clients are told during the key
+// exchange, so the change applies from their next connection. Only encrypted
+// data frames are protected against tampering and replay.
+func encryptionHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+
+	var request encryptionRequest
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode request to json
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Error("Failed to decode json", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	existing, esDocID, err := elasticsearch.QueryIngestionByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("invalid ingestion uuid ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid ingestion UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	document := existing
+	document.EncryptionRequired = request.Required
+	err = document.Update(s, esDocID)
+	if err != nil {
+		l.Error("Failed to update ingestion", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// Success
+	auth.AuditDiff(s, r, "ingestion.encryption", document.UUID, "ingestion client encryption requirement updated", existing, document)
+	l.Info("Updated ingestion encryption requirement")
+
+	w.WriteHeader(http.StatusOK)
+	out := GeneralResponse{
+		Success: true,
+		Message: "Successfully updated ingestion client",
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/kex"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// handshakeTimeout is how long to wait for the key exchange reply of the
+// client, which may be on a slow link
+const handshakeTimeout = 10 * time.Second
+
+var (
+	errExchange    = errors.New("invalid key exchange message")
+	errConfirm     = errors.New("key confirmation failed")
+	errUnencrypted = errors.New("unencrypted frame from client required to encrypt")
+)
+
+// KeyExchange is the key agreement message, sent with message type 5. The
+// backend sends its ephemeral and static keys, the client answers with its
+// ephemeral key and confirmation, and the backend confirms.
+type KeyExchange struct {
+	Ephemeral string `json:"ephemeral,omitempty"` // Base64 X25519 ephemeral public key
+	Static    string `json:"static,omitempty"`    // Base64 X25519 static public key of the backend
+	PSK       bool   `json:"psk,omitempty"`       // Whether the legacy shared key is mixed in
+	Confirm   string `json:"confirm,omitempty"`   // Base64 key confirmation
+	Encrypt   bool   `json:"encrypt,omitempty"`   // Whether the client must encrypt payloads
+}
+
+// keyExchange performs the authenticated key agreement with the ingestion
+// client holding the identity key. It returns the session of the connection,
+// or an error if the client can not confirm the keys.
+func keyExchange(conn *websocket.Conn, assetID string, identity *ecdh.PublicKey, psk []byte, encrypt bool) (*kex.Session, error) {
+	static := auth.ExchangeKey()
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	hello := Message{
+		MsgType: 5,
+		Exchange: &KeyExchange{
+			Ephemeral: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+			Static:    base64.StdEncoding.EncodeToString(static.PublicKey().Bytes()),
+			PSK:       psk != nil,
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	err = wsjson.Write(ctx, conn, hello)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	var reply Message
+	ctx, cancel = context.WithTimeout(context.Background(), handshakeTimeout)
+	err = wsjson.Read(ctx, conn, &reply)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	if reply.MsgType != 5 || reply.Exchange == nil {
+		return nil, errExchange
+	}
+	clientKey, err := base64.StdEncoding.DecodeString(reply.Exchange.Ephemeral)
+	if err != nil {
+		return nil, errExchange
+	}
+	clientEphemeral, err := ecdh.X25519().NewPublicKey(clientKey)
+	if err != nil {
+		return nil, errExchange
+	}
+	confirm, err := base64.StdEncoding.DecodeString(reply.Exchange.Confirm)
+	if err != nil {
+		return nil, errExchange
+	}
+
+	keys, err := kex.Server(static, ephemeral, assetID, identity, clientEphemeral, psk)
+	if err != nil {
+		return nil, err
+	}
+	if !keys.VerifyClient(confirm) {
+		return nil, errConfirm
+	}
+
+	done := Message{
+		MsgType: 5,
+		Exchange: &KeyExchange{
+			Confirm: base64.StdEncoding.EncodeToString(keys.ServerConfirm(encrypt)),
+			Encrypt: encrypt,
+		},
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
+	err = wsjson.Write(ctx, conn, done)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	return kex.NewSession(assetID, keys.Data), nil
+}
+
+// openFrame checks the sequence number of a data frame and decrypts its
+// payload. Unencrypted frames are rejected if the client must encrypt. Only
+// sealed frames authenticate their sequence number, so replay is only blocked
+// for sealed frames; status, acknowledgement and unencrypted data frames carry
+// no MAC.
+func openFrame(session *kex.Session, frame *Frame, encrypt bool) error {
+	if !frame.Header.Encrypted {
+		if encrypt {
+			return errUnencrypted
+		}
+		return session.Sequence(frame.Header.Seq)
+	}
+	payload, err := session.Open(frame.FileName, frame.Header.Seq, frame.Header.Epoch, frame.Payload)
+	if err != nil {
+		return err
+	}
+	frame.Payload = payload
+	return nil
+}
+
+// pinIdentity pins the identity key of an ingestion client approved before
+// identity keys were pinned, once it proved the legacy shared key, and removes
+// the shared key.
+func pinIdentity(s *state.State, r *http.Request, ingestion *elasticsearch.DocumentIngestion, esDocID string, identityKey string) {
+	before := *ingestion
+	ingestion.IdentityKey = identityKey
+	ingestion.Key = ""
+	err := ingestion.Update(s, esDocID)
+	if err != nil {
+		log.Println("Failed to pin identity key: ", err)
+		*ingestion = before
+		return
+	}
+	auth.AuditDiff(s, r, "ingestion.pin", ingestion.UUID, "ingestion client identity key pinned", before, *ingestion)
+}
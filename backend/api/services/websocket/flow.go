@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"errors"
+	"sync"
+)
+
+// creditWindow is the number of data frames a connection may have queued or
+// in flight before it must wait for more credits
+const creditWindow = 64
+
+var errNoCredit = errors.New("data frame sent without flow credit")
+
+// flow is the credit based flow control of a connection. The client may send
+// one data frame per credit. Credits are granted back in message type 6 once
+// the frames of the connection have been indexed, so a client can never queue
+// more than creditWindow frames.
+type flow struct {
+	m        sync.Mutex
+	credits  int           // credits are the data frames the client may still send
+	released int           // released are the frames indexed since the last grant
+	notify   chan struct{} // notify signals the write pump that credits were released
+}
+
+// newFlow returns the flow control of a new connection, with the full window
+// ready to be granted.
+func newFlow() *flow {
+	f := &flow{
+		released: creditWindow,
+		notify:   make(chan struct{}, 1),
+	}
+	f.notify <- struct{}{}
+	return f
+}
+
+// use consumes the credit of a received data frame. It returns errNoCredit if
+// the client has no credit left.
+func (f *flow) use() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.credits == 0 {
+		return errNoCredit
+	}
+	f.credits--
+	return nil
+}
+
+// release returns the credit of an indexed frame, to be granted by the write
+// pump.
+func (f *flow) release() {
+	f.m.Lock()
+	f.released++
+	f.m.Unlock()
+	select {
+	case f.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dropFrame returns the credit of a data frame that is not indexed. The client
+// acknowledges its oldest frame in flight with every credit granted, so a
+// dropped frame must still be granted back in order. Other message types use no
+// credit.
+func dropFrame(frame *Frame, f *flow) error {
+	if frame.Header.MsgType != 0 {
+		return nil
+	}
+	err := f.use()
+	if err != nil {
+		return err
+	}
+	f.release()
+	return nil
+}
+
+// grant moves the released credits to the client. It returns the number of
+// credits to send.
+func (f *flow) grant() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	n := f.released
+	f.credits += n
+	f.released = 0
+	return n
+}
+
+// fairQueue holds the frames waiting to be indexed in a queue per asset. The
+// assets are served in turn, so that a client sending many frames does not
+// delay the frames of the others.
+type fairQueue struct {
+	m      sync.Mutex
+	ready  *sync.Cond          // ready is signalled when a frame is pushed
+	queues map[string][]*Frame // queues are the waiting frames by asset
+	order  []string            // order are the assets with waiting frames, next to serve first
+	length int                 // length is the number of waiting frames
+}
+
+// newFairQueue returns an empty queue.
+func newFairQueue() *fairQueue {
+	q := &fairQueue{
+		queues: map[string][]*Frame{},
+	}
+	q.ready = sync.NewCond(&q.m)
+	return q
+}
+
+// push adds the frame to the queue of its asset. It never blocks, the queue is
+// bounded by the credits of each connection.
+func (q *fairQueue) push(frame *Frame) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if len(q.queues[frame.AssetID]) == 0 {
+		q.order = append(q.order, frame.AssetID)
+	}
+	q.queues[frame.AssetID] = append(q.queues[frame.AssetID], frame)
+	q.length++
+	q.ready.Signal()
+}
+
+// pop removes the next frame of the next asset, waiting until a frame is
+// pushed if the queue is empty.
+func (q *fairQueue) pop() *Frame {
+	q.m.Lock()
+	defer q.m.Unlock()
+	for q.length == 0 {
+		q.ready.Wait()
+	}
+	assetID := q.order[0]
+	q.order = q.order[1:]
+	frames := q.queues[assetID]
+	frame := frames[0]
+	frames[0] = nil
+	if len(frames) > 1 {
+		q.queues[assetID] = frames[1:]
+		// serve the other assets before the next frame of this asset
+		q.order = append(q.order, assetID)
+	} else {
+		delete(q.queues, assetID)
+	}
+	q.length--
+	return frame
+}
+
+// len returns the number of waiting frames.
+func (q *fairQueue) len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.length
+}
@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlow(t *testing.T) {
+	f := newFlow()
+
+	// no credit before the window is granted
+	if err := f.use(); err != errNoCredit {
+		t.Fatalf("expected no credit, got %v", err)
+	}
+	select {
+	case <-f.notify:
+	default:
+		t.Fatal("initial window not signalled")
+	}
+	if n := f.grant(); n != creditWindow {
+		t.Fatalf("expected %d credits, got %d", creditWindow, n)
+	}
+	for i := 0; i < creditWindow; i++ {
+		if err := f.use(); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if err := f.use(); err != errNoCredit {
+		t.Fatalf("expected no credit after the window, got %v", err)
+	}
+
+	// released frames are granted back once, with a single notification
+	f.release()
+	f.release()
+	select {
+	case <-f.notify:
+	default:
+		t.Fatal("release not signalled")
+	}
+	select {
+	case <-f.notify:
+		t.Fatal("releases signalled twice")
+	default:
+	}
+	if n := f.grant(); n != 2 {
+		t.Fatalf("expected 2 credits, got %d", n)
+	}
+	if n := f.grant(); n != 0 {
+		t.Fatalf("expected credits to be granted once, got %d", n)
+	}
+	for i := 0; i < 2; i++ {
+		if err := f.use(); err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+	}
+	if err := f.use(); err != errNoCredit {
+		t.Fatalf("expected no credit, got %v", err)
+	}
+}
+
+func TestFairQueue(t *testing.T) {
+	q := newFairQueue()
+	for _, frame := range []*Frame{
+		{AssetID: "a", FileName: "a1"},
+		{AssetID: "a", FileName: "a2"},
+		{AssetID: "a", FileName: "a3"},
+		{AssetID: "b", FileName: "b1"},
+		{AssetID: "c", FileName: "c1"},
+		{AssetID: "c", FileName: "c2"},
+	} {
+		q.push(frame)
+	}
+	if q.len() != 6 {
+		t.Fatalf("expected 6 frames, got %d", q.len())
+	}
+
+	// assets are served in turn, frames of an asset in order
+	expected := []string{"a1", "b1", "c1", "a2", "c2", "a3"}
+	for i, name := range expected {
+		if frame := q.pop(); frame.FileName != name {
+			t.Fatalf("pop %d: expected %s, got %s", i, name, frame.FileName)
+		}
+	}
+	if q.len() != 0 || len(q.order) != 0 || len(q.queues) != 0 {
+		t.Fatalf("queue not empty: %d frames, order %v", q.len(), q.order)
+	}
+
+	// an asset pushing again joins the end of the order
+	q.push(&Frame{AssetID: "b", FileName: "b2"})
+	q.push(&Frame{AssetID: "a", FileName: "a4"})
+	if frame := q.pop(); frame.FileName != "b2" {
+		t.Fatalf("expected b2, got %s", frame.FileName)
+	}
+	if frame := q.pop(); frame.FileName != "a4" {
+		t.Fatalf("expected a4, got %s", frame.FileName)
+	}
+}
+
+func TestFairQueueWaits(t *testing.T) {
+	q := newFairQueue()
+	popped := make(chan *Frame)
+	go func() {
+		popped <- q.pop()
+	}()
+
+	select {
+	case <-popped:
+		t.Fatal("pop returned from an empty queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.push(&Frame{AssetID: "a", FileName: "a1"})
+	select {
+	case frame := <-popped:
+		if frame.FileName != "a1" {
+			t.Fatalf("expected a1, got %s", frame.FileName)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop not woken by push")
+	}
+}
+
+func TestDropFrame(t *testing.T) {
+	f := newFlow()
+	<-f.notify
+	f.grant()
+
+	// the client acknowledges its oldest frame in flight with every credit
+	inflight := []string{"invalid", "f1", "f2"}
+	acked := []string{}
+	ack := func() {
+		for n := f.grant(); n > 0; n-- {
+			acked = append(acked, inflight[0])
+			inflight = inflight[1:]
+		}
+	}
+
+	// an invalid frame is dropped, followed by spooled frames
+	err := dropFrame(&Frame{FileName: "invalid"}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := newFairQueue()
+	for _, name := range []string{"f1", "f2"} {
+		if err := f.use(); err != nil {
+			t.Fatal(err)
+		}
+		q.push(&Frame{AssetID: "a", FileName: name, flow: f})
+	}
+	ack()
+	if len(acked) != 1 || acked[0] != "invalid" {
+		t.Fatalf("expected only the invalid frame acknowledged, got %v", acked)
+	}
+
+	// spooled frames are acknowledged once indexed
+	for q.len() > 0 {
+		frame := q.pop()
+		frame.flow.release()
+		ack()
+		if acked[len(acked)-1] != frame.FileName {
+			t.Fatalf("indexed %s, acknowledged %v", frame.FileName, acked)
+		}
+	}
+
+	// control messages use no credit
+	err = dropFrame(&Frame{Header: Header{MsgType: 1}}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := f.grant(); n != 0 {
+		t.Fatalf("expected no credit for a control message, got %d", n)
+	}
+}
@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+type groupRequest struct {
+	UUID        string `json:"uuid"`        // UUID of the asset group, empty when adding
+	Name        string `json:"name"`        // Name of the asset group
+	Description string `json:"description"` // Description of the asset group
+}
+
+// groupListResponse is the format of the list asset groups response.
+type groupListResponse struct {
+	Success bool                               `json:"success"` // Success indicates if the request was successful
+	Groups  []elasticsearch.DocumentAssetGroup `json:"groups"`  // Groups is the list of asset groups
+}
+
+// groupListHandler is "/api/ingestion/group/list". It will return the list of
+// asset groups.
+func groupListHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	groups, err := elasticsearch.AllAssetGroup(s)
+	if err != nil {
+		l.Error("error getting asset groups ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Failed to retrieve asset groups.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+	json.NewEncoder(w).Encode(groupListResponse{
+		Success: true,
+		Groups:  groups,
+	})
+}
+
+// groupAddHandler is "/api/ingestion/group/add". It creates an asset group.
+func groupAddHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	request, ok := decodeGroup(s, w, r)
+	if !ok {
+		return
+	}
+
+	document := elasticsearch.DocumentAssetGroup{
+		UUID:        uuid.Generate(),
+		Name:        request.Name,
+		Description: request.Description,
+	}
+	_, err := document.Index(s)
+	if err != nil {
+		l.Error("Failed to index asset group", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	auth.AuditDiff(s, r, "ingestion.group.add", document.UUID, "asset group created", nil, document)
+	l.Info("Created asset group ", document.UUID)
+	json.NewEncoder(w).Encode(GeneralResponse{
+		Success: true,
+		Message: "Successfully created asset group",
+	})
+}
+
+// groupUpdateHandler is "/api/ingestion/group/update". It renames an asset
+// group or changes its description.
+func groupUpdateHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	request, ok := decodeGroup(s, w, r)
+	if !ok {
+		return
+	}
+
+	existing, esDocID, err := elasticsearch.QueryAssetGroupByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("invalid asset group uuid ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset group UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	document := existing
+	document.Name = request.Name
+	document.Description = request.Description
+	err = document.Update(s, esDocID)
+	if err != nil {
+		l.Error("Failed to update asset group", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	auth.AuditDiff(s, r, "ingestion.group.update", document.UUID, "asset group updated", existing, document)
+	l.Info("Updated asset group ", document.UUID)
+	json.NewEncoder(w).Encode(GeneralResponse{
+		Success: true,
+		Message: "Successfully updated asset group",
+	})
+}
+
+// groupDeleteHandler is "/api/ingestion/group/delete". It deletes an asset
+// group and removes it from the ingestion clients in it.
+func groupDeleteHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+	var request groupRequest
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Error("Failed to decode json", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	existing, _, err := elasticsearch.QueryAssetGroupByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("invalid asset group uuid ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid asset group UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// remove the group from its members first, so that no client refers to a
+	// deleted group if the deletion fails
+	clients, err := elasticsearch.AllIngest(s)
+	if err != nil {
+		l.Error("error getting clients ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		})
+		return
+	}
+	for _, c := range clients {
+		groups := []string{}
+		for _, group := range c.Groups {
+			if group != existing.UUID {
+				groups = append(groups, group)
+			}
+		}
+		if len(groups) == len(c.Groups) {
+			continue
+		}
+		_, esDocID, err := elasticsearch.QueryIngestionByUUID(s, c.UUID)
+		if err == nil {
+			c.Groups = groups
+			err = c.Update(s, esDocID)
+		}
+		if err != nil {
+			l.Error("Failed to remove asset group from ingestion ", c.UUID, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(GeneralResponse{
+				Success: false,
+				Message: "Please contact your system administrator.",
+			})
+			return
+		}
+	}
+
+	err = elasticsearch.DeleteAssetGroupByUUID(s, existing.UUID)
+	if err != nil {
+		l.Error("Failed to delete asset group", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		})
+		return
+	}
+
+	auth.AuditDiff(s, r, "ingestion.group.delete", existing.UUID, "asset group deleted", existing, nil)
+	l.Info("Deleted asset group ", existing.UUID)
+	json.NewEncoder(w).Encode(GeneralResponse{
+		Success: true,
+		Message: "Successfully deleted asset group",
+	})
+}
+
+// decodeGroup decodes and validates an add or update asset group request,
+// writing the error response if it is invalid. Group names are unique.
+func decodeGroup(s *state.State, w http.ResponseWriter, r *http.Request) (groupRequest, bool) {
+	var request groupRequest
+	l := ctxlog.Log(r.Context())
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Error("Failed to decode json", err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Bad request format",
+		})
+		return request, false
+	}
+
+	err = utils.ValidateBasic(request.Name)
+	if err != nil {
+		l.Warn("invalid asset group name ", request.Name)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Name " + err.Error(),
+		})
+		return request, false
+	}
+
+	groups, err := elasticsearch.AllAssetGroup(s)
+	if err != nil {
+		l.Error("error getting asset groups ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		})
+		return request, false
+	}
+	for _, group := range groups {
+		if group.Name == request.Name && group.UUID != request.UUID {
+			l.Warn("duplicate asset group name ", request.Name)
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(GeneralResponse{
+				Success: false,
+				Message: "Cannot have two asset groups with the same name",
+			})
+			return request, false
+		}
+	}
+	return request, true
+}
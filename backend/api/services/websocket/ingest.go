@@ -42,21 +42,17 @@ func ingest(frame *Frame, state *state.State, maxIndexSize int) {
 		}
 	}
 
+	start := time.Now()
+	defer func() {
+		ingestDuration.Observe(time.Since(start).Seconds())
+	}()
+	framesIngested.Inc(frame.AssetID)
+	linesIngested.Add(float64(len(frame.Payload)), frame.AssetID)
+
 	maxSize = maxIndexSize
 	client, ctx := state.Elastic, state.ElasticCtx
 	for _, entry := range frame.Payload {
 
-		// If encrypted data has been sent, decrypt it
-		if frame.Header.Encrypted {
-			var err error
-			entry, err = Decrypt(entry, frame.Key)
-
-			if err != nil {
-				state.Log.Println("Error decrypting data: ", err)
-				continue
-			}
-		}
-
 		updated, _, alarm := dynamicInjection(state, entry)
 
 		var selectedIndex string
@@ -158,6 +154,7 @@ func ingest(frame *Frame, state *state.State, maxIndexSize int) {
 
 		//Alarm
 		if len(alarm) > 0 {
+			alarmHits.Inc(frame.AssetID)
 			var selectedAlarmIndex string
 
 			// Check if there are locally stored indices
@@ -1,11 +1,13 @@
 package websocket
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/kex"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
 
@@ -17,11 +19,16 @@ type listResponse struct {
 
 // User represents the list of clients in the system.
 type Ingestion struct {
-	UUID        string `json:"uuid"`      // Represents the name of the ingestion client
-	Approved    bool   `json:"approved"`  // Whether this ingestion client has been approved
-	IsConnected bool   `json:"connected"` // Whether this ingestion client is connected
-	Address     string `json:"address"`   // Network address for identification processes
-	Name        string `json:"name"`      // User defined name
+	UUID        string  `json:"uuid"`             // Represents the name of the ingestion client
+	Approved    bool    `json:"approved"`         // Whether this ingestion client has been approved
+	IsConnected bool    `json:"connected"`        // Whether this ingestion client is connected
+	Address     string  `json:"address"`          // Network address for identification processes
+	Name        string  `json:"name"`             // User defined name
+	Fingerprint string  `json:"fingerprint"`      // Fingerprint of the identity key, compared with the client log before approval
+	Encryption  bool    `json:"encryption"`       // Whether the client must encrypt payloads
+	Status      *Status `json:"status,omitempty"` // Latest status report, if received since the backend started
+
+	elasticsearch.AssetMetadata
 }
 
 // listHandler is "/api/ingestion/list". It will return the list of clients
@@ -47,22 +54,32 @@ func listHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, c := range clients {
+		var status *Status
+		if latest, ok := statuses.getItem(c.UUID); ok {
+			status = &latest
+		}
 		out.Clients = append(out.Clients, Ingestion{
 			UUID:        c.UUID,
 			Approved:    true,
 			IsConnected: active.exists(c.UUID),
 			Address:     c.Address,
 			Name:        c.Name,
+			Fingerprint: fingerprint(c.IdentityKey),
+			Encryption:  c.EncryptionRequired,
+			Status:      status,
+
+			AssetMetadata: c.AssetMetadata,
 		})
 	}
 
-	for _, uuid := range waitList.getAllItems() {
+	for _, pending := range waitList.getAllItems() {
 		out.Clients = append(out.Clients, Ingestion{
-			UUID:        uuid,
-			Approved:    waitList.getItem(uuid).Approved,
+			UUID:        pending.AssetID,
+			Approved:    pending.Approved,
 			IsConnected: true,
-			Address:     waitList.getItem(uuid).Address,
-			Name:        uuid,
+			Address:     pending.Address,
+			Name:        pending.AssetID,
+			Fingerprint: fingerprint(pending.IdentityKey),
 		})
 	}
 
@@ -70,3 +87,13 @@ func listHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
 	out.Success = true
 	json.NewEncoder(w).Encode(out)
 }
+
+// fingerprint returns the fingerprint of the base64 identity key, or an empty
+// string if there is none.
+func fingerprint(identityKey string) string {
+	key, err := base64.StdEncoding.DecodeString(identityKey)
+	if err != nil || len(key) == 0 {
+		return ""
+	}
+	return kex.Fingerprint(key)
+}
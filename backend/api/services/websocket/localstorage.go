@@ -1,6 +1,11 @@
 package websocket
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
+)
 
 // Housing items being deleted
 type Deleted struct {
@@ -34,39 +39,58 @@ func (del *Deleted) getIDs() []string {
 	return list
 }
 
-// Housing items waiting for approval
+// Housing items waiting for approval, keyed by connection as several
+// connections may claim the same asset ID
 type Waiting struct {
 	m sync.Mutex
 	w map[string]Authorization
 }
 
-func (waiting *Waiting) update(assetID string, auth Authorization) {
+// add adds the connection awaiting approval, returning its key.
+func (waiting *Waiting) add(auth Authorization) string {
+	conn := uuid.Generate()
 	waiting.m.Lock()
-	waiting.w[assetID] = auth
+	waiting.w[conn] = auth
 	waiting.m.Unlock()
+	return conn
 }
-func (waiting *Waiting) approve(assetID string) {
+func (waiting *Waiting) approve(conn string, certificate string) {
 	waiting.m.Lock()
-	curr := waiting.w[assetID]
+	curr := waiting.w[conn]
 	curr.Approved = true
-	waiting.w[assetID] = curr
+	curr.Certificate = certificate
+	waiting.w[conn] = curr
 	waiting.m.Unlock()
 }
-func (waiting *Waiting) delete(assetID string) {
+func (waiting *Waiting) delete(conn string) {
 	waiting.m.Lock()
-	delete(waiting.w, assetID)
+	delete(waiting.w, conn)
 	waiting.m.Unlock()
 }
-func (waiting *Waiting) getItem(assetID string) Authorization {
+func (waiting *Waiting) getItem(conn string) Authorization {
 	waiting.m.Lock()
 	defer waiting.m.Unlock()
-	return waiting.w[assetID]
+	return waiting.w[conn]
 }
-func (waiting *Waiting) getAllItems() []string {
+
+// find returns the key and authorization of the connection awaiting approval
+// as the asset ID with the identity key fingerprint, if there is one.
+func (waiting *Waiting) find(assetID string, keyFingerprint string) (string, Authorization, bool) {
 	waiting.m.Lock()
 	defer waiting.m.Unlock()
-	var list []string
-	for item := range waiting.w {
+	for conn, auth := range waiting.w {
+		if auth.AssetID == assetID && !auth.Approved && keyFingerprint != "" &&
+			fingerprint(auth.IdentityKey) == keyFingerprint {
+			return conn, auth, true
+		}
+	}
+	return "", Authorization{}, false
+}
+func (waiting *Waiting) getAllItems() []Authorization {
+	waiting.m.Lock()
+	defer waiting.m.Unlock()
+	var list []Authorization
+	for _, item := range waiting.w {
 		list = append(list, item)
 	}
 
@@ -107,3 +131,62 @@ func (active *Active) exists(assetID string) bool {
 	}
 	return false
 }
+
+// Housing the latest status report of each client
+type Statuses struct {
+	m sync.Mutex
+	s map[string]elasticsearch.DocumentIngestionStatus
+}
+
+func (statuses *Statuses) update(assetID string, status elasticsearch.DocumentIngestionStatus) {
+	statuses.m.Lock()
+	statuses.s[assetID] = status
+	statuses.m.Unlock()
+}
+func (statuses *Statuses) delete(assetID string) {
+	statuses.m.Lock()
+	delete(statuses.s, assetID)
+	statuses.m.Unlock()
+}
+func (statuses *Statuses) getItem(assetID string) (elasticsearch.DocumentIngestionStatus, bool) {
+	statuses.m.Lock()
+	defer statuses.m.Unlock()
+	status, ok := statuses.s[assetID]
+	return status, ok
+}
+
+// Housing the profile pushes of connected clients
+type Pushes struct {
+	m sync.Mutex
+	p map[string]chan *Profile
+}
+
+func (pushes *Pushes) register(assetID string) chan *Profile {
+	pushes.m.Lock()
+	defer pushes.m.Unlock()
+	profiles := make(chan *Profile, 1)
+	pushes.p[assetID] = profiles
+	return profiles
+}
+func (pushes *Pushes) delete(assetID string, profiles chan *Profile) {
+	pushes.m.Lock()
+	// a newer connection of the client may have registered since
+	if pushes.p[assetID] == profiles {
+		delete(pushes.p, assetID)
+	}
+	pushes.m.Unlock()
+}
+func (pushes *Pushes) push(assetID string, profile *Profile) {
+	pushes.m.Lock()
+	defer pushes.m.Unlock()
+	profiles, ok := pushes.p[assetID]
+	if !ok {
+		return
+	}
+	// replace a profile not yet sent
+	select {
+	case <-profiles:
+	default:
+	}
+	profiles <- profile
+}
@@ -0,0 +1,42 @@
+package websocket
+
+import (
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/metrics"
+)
+
+var (
+	// queueDepth is the number of frames waiting to be indexed
+	queueDepth = metrics.NewGaugeFunc("canids_ingest_queue_depth",
+		"Frames received from ingestion clients waiting to be indexed.",
+		func() float64 { return float64(server.queue.len()) })
+	// connections is the number of connected ingestion clients
+	connections = metrics.NewGauge("canids_ingest_connections",
+		"Connected ingestion clients, including clients awaiting approval.")
+	// exchangeFailures counts failed key agreements
+	exchangeFailures = metrics.NewCounter("canids_ingest_key_exchange_failures_total",
+		"Ingestion connections closed because the key exchange failed.")
+	// decryptFailures counts frames that failed to authenticate or decrypt
+	decryptFailures = metrics.NewCounter("canids_ingest_decrypt_failures_total",
+		"Frames rejected because they were replayed, unencrypted when required or failed to decrypt.", "asset")
+	// creditViolations counts data frames sent without flow credit
+	creditViolations = metrics.NewCounter("canids_ingest_credit_violations_total",
+		"Ingestion connections closed because a data frame was sent without flow credit.", "asset")
+	// framesIngested counts indexed frames
+	framesIngested = metrics.NewCounter("canids_ingest_frames_total",
+		"Data frames indexed.", "asset")
+	// linesIngested counts indexed log lines
+	linesIngested = metrics.NewCounter("canids_ingest_lines_total",
+		"Log lines indexed.", "asset")
+	// alarmHits counts log lines matching an alarm blacklist
+	alarmHits = metrics.NewCounter("canids_alarm_hits_total",
+		"Log lines with an address on an alarm blacklist.", "asset")
+	// lagBytes is the reported backlog of each client
+	lagBytes = metrics.NewGauge("canids_ingest_client_lag_bytes",
+		"Bytes of log files not yet sent, from the latest status report of each client.", "asset")
+	// lagSeconds is the reported lag of each client
+	lagSeconds = metrics.NewGauge("canids_ingest_client_lag_seconds",
+		"Largest time a log file has had unsent data, from the latest status report of each client.", "asset")
+	// ingestDuration is the time to index a frame
+	ingestDuration = metrics.NewHistogram("canids_ingest_frame_duration_seconds",
+		"Time to index a frame, including GeoIP and alarm lookups.", nil)
+)
@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// profileHistory is the maximum number of profile versions returned
+	profileHistory = 100
+	// minChunkSize and maxChunkSize bound the lines sent in a frame
+	minChunkSize = 10
+	maxChunkSize = 1000
+)
+
+// logFileName matches the name of a Zeek log file
+var logFileName = regexp.MustCompile(`^[a-z0-9_\-]+\.log$`)
+
+// Profile is the configuration of an ingestion client, pushed with message
+// type 7 and acknowledged by the client with frame type 3.
+type Profile = elasticsearch.DocumentIngestionProfile
+
+var pushes = Pushes{
+	p: map[string]chan *Profile{},
+}
+
+// defaultProfile returns the configuration of ingestion clients without a
+// profile.
+func defaultProfile(assetID string) Profile {
+	return Profile{
+		AssetID:   assetID,
+		Scan:      "5s",
+		Delay:     "5s",
+		ChunkSize: maxChunkSize,
+		Whitelist: []string{"conn.log", "dns.log", "http.log", "sip.log", "ssl.log", "stats.log", "weird.log", "telemetry.log"},
+	}
+}
+
+// profileRequest is the format of the profile update request.
+type profileRequest struct {
+	UUID      string   `json:"uuid"`      // UUID of the ingestion client
+	Scan      string   `json:"scan"`      // Scan is how often to scan for new log files
+	Delay     string   `json:"delay"`     // Delay is the delay before reconnecting
+	Encrypt   bool     `json:"encrypt"`   // Encrypt is whether log entries are encrypted
+	ChunkSize int      `json:"chunkSize"` // ChunkSize is the largest number of lines sent in a frame
+	Whitelist []string `json:"whitelist"` // Whitelist are the names of the log files sent
+}
+
+// profileResponse is the format of the profile response.
+type profileResponse struct {
+	Success bool      `json:"success"` // Success indicates if the request was successful
+	Profile Profile   `json:"profile"` // Profile is the latest version, or the defaults with version 0
+	History []Profile `json:"history"` // History are the versions of the profile, most recent first
+}
+
+// validateProfile returns a message describing the first invalid field of the
+// request, or an empty string if it is valid.
+func validateProfile(request profileRequest) string {
+	scan, err := time.ParseDuration(request.Scan)
+	if err != nil || scan < time.Second {
+		return "Scan interval must be a duration of at least 1s."
+	}
+	delay, err := time.ParseDuration(request.Delay)
+	if err != nil || delay < time.Second {
+		return "Reconnect delay must be a duration of at least 1s."
+	}
+	if request.ChunkSize < minChunkSize || request.ChunkSize > maxChunkSize {
+		return "Chunk size must be between 10 and 1000 lines."
+	}
+	if len(request.Whitelist) == 0 {
+		return "At least one log file must be whitelisted."
+	}
+	for _, name := range request.Whitelist {
+		if !logFileName.MatchString(name) {
+			return "Invalid log file name " + name + "."
+		}
+	}
+	return ""
+}
+
+// pushProfile queues the latest profile of the ingestion client to be sent
+// after the handshake. Clients without a profile keep their flags.
+func pushProfile(s *state.State, assetID string) {
+	profile, _, err := elasticsearch.QueryIngestionProfile(s, assetID)
+	if err != nil {
+		return
+	}
+	pushes.push(assetID, &profile)
+}
+
+// acknowledgeProfile records that the ingestion client applied the profile
+// version, or logs why it was rejected.
+func acknowledgeProfile(s *state.State, assetID string, version int, reason string) {
+	if reason != "" {
+		s.Log.Warn("[ingestion] ", assetID, " rejected profile version ", version, ": ", reason)
+		return
+	}
+	profile, esDocID, err := elasticsearch.QueryIngestionProfile(s, assetID)
+	if err != nil || profile.Version != version {
+		// superseded by a newer version, which is pushed next
+		return
+	}
+	profile.Applied = time.Now().UTC().Format(time.RFC3339)
+	err = profile.Update(s, esDocID)
+	if err != nil {
+		s.Log.Error("[ingestion] failed to record profile acknowledgement of ", assetID, " ", err)
+	}
+}
+
+// profileHandler is "/api/ingestion/profile". It returns the profile of the
+// ingestion client "uuid" and its version history.
+func profileHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	uuid := r.URL.Query().Get("uuid")
+	if uuid == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid ingestion UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	history, err := elasticsearch.QueryIngestionProfileHistory(s, uuid, profileHistory)
+	if err != nil {
+		l.Error("error getting ingestion profile ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Failed to retrieve ingestion profile.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	out := profileResponse{
+		Success: true,
+		Profile: defaultProfile(uuid),
+		History: history,
+	}
+	if len(history) > 0 {
+		out.Profile = history[0]
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+// profileUpdateHandler is "/api/ingestion/profile/update". It saves a new
+// version of the profile of the ingestion client and pushes it to the client
+// if connected.
+func profileUpdateHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+
+	var request profileRequest
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	// Decode request to json
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		l.Error("Failed to decode json", err)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Bad request format",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	if message := validateProfile(request); message != "" {
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: message,
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	_, _, err = elasticsearch.QueryIngestionByUUID(s, request.UUID)
+	if err != nil {
+		l.Warn("invalid ingestion uuid ", request.UUID)
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid ingestion UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// the previous version, if any, for the audit log
+	var before interface{}
+	version := 1
+	if existing, _, err := elasticsearch.QueryIngestionProfile(s, request.UUID); err == nil {
+		before = existing
+		version = existing.Version + 1
+	}
+
+	document := Profile{
+		AssetID:   request.UUID,
+		Version:   version,
+		Scan:      request.Scan,
+		Delay:     request.Delay,
+		Encrypt:   request.Encrypt,
+		ChunkSize: request.ChunkSize,
+		Whitelist: request.Whitelist,
+		Author:    jwtauth.FromContext(r.Context()).UUID,
+		Time:      time.Now().UTC().Format(time.RFC3339),
+	}
+	_, err = document.Index(s)
+	if err != nil {
+		l.Error("Failed to store ingestion profile", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Please contact your system administrator.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	// send to the client now if connected, otherwise after its next handshake
+	pushes.push(request.UUID, &document)
+
+	auth.AuditDiff(s, r, "ingestion.profile", request.UUID, "ingestion client profile updated", before, document)
+	l.Info("Updated ingestion profile")
+
+	w.WriteHeader(http.StatusOK)
+	out := GeneralResponse{
+		Success: true,
+		Message: "Successfully updated ingestion profile",
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
 
@@ -14,22 +16,52 @@ func RegisterWS(s *state.State, r *mux.Router) {
 }
 
 func RegisterUpdateFunctions(s *state.State, r *mux.Router) {
-	r.HandleFunc("/getESMax", func(w http.ResponseWriter, r *http.Request) {
+	r.HandleFunc("/getESMax", auth.Authorize(s, jwtauth.PermIngestionRead, func(w http.ResponseWriter, r *http.Request) {
 		getMaxHandler(s, w, r)
-	})
-	r.HandleFunc("/setESMax", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	r.HandleFunc("/setESMax", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
 		setMaxHandler(s, w, r)
-	})
-	r.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
+	})).Methods("POST")
+	r.HandleFunc("/delete", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
 		deleteIngestion(s, w, r)
-	})
-	r.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+	})).Methods("POST")
+	r.HandleFunc("/list", auth.Authorize(s, jwtauth.PermIngestionRead, func(w http.ResponseWriter, r *http.Request) {
 		listHandler(s, w, r)
-	})
-	r.HandleFunc("/approve", func(w http.ResponseWriter, r *http.Request) {
+	}))
+	r.HandleFunc("/approve", auth.Authorize(s, jwtauth.PermIngestionApprove, func(w http.ResponseWriter, r *http.Request) {
 		approveIngestion(s, w, r)
-	})
-	r.HandleFunc("/rename", func(w http.ResponseWriter, r *http.Request) {
+	})).Methods("POST")
+	r.HandleFunc("/status", auth.Authorize(s, jwtauth.PermIngestionRead, func(w http.ResponseWriter, r *http.Request) {
+		statusHandler(s, w, r)
+	}))
+	r.HandleFunc("/profile", auth.Authorize(s, jwtauth.PermIngestionRead, func(w http.ResponseWriter, r *http.Request) {
+		profileHandler(s, w, r)
+	}))
+	r.HandleFunc("/profile/update", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
+		profileUpdateHandler(s, w, r)
+	})).Methods("POST")
+	r.HandleFunc("/ca", auth.Authorize(s, jwtauth.PermIngestionRead, func(w http.ResponseWriter, r *http.Request) {
+		caHandler(s, w, r)
+	}))
+	r.HandleFunc("/encryption", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
+		encryptionHandler(s, w, r)
+	})).Methods("POST")
+	r.HandleFunc("/rename", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
 		renameIngestion(s, w, r)
-	})
+	})).Methods("POST")
+	r.HandleFunc("/update", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
+		assetHandler(s, w, r)
+	})).Methods("POST")
+	r.HandleFunc("/group/list", auth.Authorize(s, jwtauth.PermIngestionRead, func(w http.ResponseWriter, r *http.Request) {
+		groupListHandler(s, w, r)
+	}))
+	r.HandleFunc("/group/add", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
+		groupAddHandler(s, w, r)
+	})).Methods("POST")
+	r.HandleFunc("/group/update", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
+		groupUpdateHandler(s, w, r)
+	})).Methods("POST")
+	r.HandleFunc("/group/delete", auth.Authorize(s, jwtauth.PermIngestionWrite, func(w http.ResponseWriter, r *http.Request) {
+		groupDeleteHandler(s, w, r)
+	})).Methods("POST")
 }
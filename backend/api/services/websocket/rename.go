@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/mcmaster-circ/canids-v2/backend/api/services/utils"
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
@@ -51,14 +52,8 @@ func renameIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.Log.Println("Name: ", request.Name)
-
-	document := elasticsearch.DocumentIngestion{
-		Name: request.Name,
-	}
-
-	// query current ingestion to update
-	existing, _, err := elasticsearch.QueryIngestionByUUID(s, request.UUID)
+	// query current ingestion to update, keeping its asset metadata
+	existing, esDocID, err := elasticsearch.QueryIngestionByUUID(s, request.UUID)
 	if err != nil {
 		l.Warn("invalid ingestion uuid ", request.UUID)
 		w.WriteHeader(http.StatusBadRequest)
@@ -69,25 +64,10 @@ func renameIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(out)
 		return
 	}
-	document.Address = existing.Address
-	document.Key = existing.Key
-	document.UUID = existing.UUID
-
-	s.Log.Println("Document: ", document)
-
-	err = elasticsearch.DeleteIngestByUUID(s, existing.UUID)
-	if err != nil {
-		l.Error("Failed to update ingestion", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		out := GeneralResponse{
-			Success: false,
-			Message: "Please contact your system administrator.",
-		}
-		json.NewEncoder(w).Encode(out)
-		return
-	}
 
-	_, err = document.Index(s)
+	document := existing
+	document.Name = request.Name
+	err = document.Update(s, esDocID)
 	if err != nil {
 		l.Error("Failed to update ingestion", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -104,6 +84,7 @@ func renameIngestion(s *state.State, w http.ResponseWriter, r *http.Request) {
 		Message: "Successfully updates ingestion client",
 	}
 
+	auth.AuditDiff(s, r, "ingestion.rename", document.UUID, "ingestion client renamed", existing, document)
 	l.Info("Updated ingestion in elasticsearch")
 
 	w.WriteHeader(http.StatusOK)
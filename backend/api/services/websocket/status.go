@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// StatusRetention is 7 days, how long status reports are kept
+	StatusRetention = 7 * 24 * time.Hour
+	// statusPrune is how often expired status reports are deleted
+	statusPrune = time.Hour
+	// statusHistory is the maximum number of reports returned
+	statusHistory = 10000
+)
+
+// Status is the health report sent periodically by an ingestion client with
+// message type 2.
+type Status = elasticsearch.DocumentIngestionStatus
+
+var statuses = Statuses{
+	s: map[string]elasticsearch.DocumentIngestionStatus{},
+}
+
+// statusResponse is the format of the status response.
+type statusResponse struct {
+	Success bool                                    `json:"success"` // Success indicates if the request was successful
+	Status  *Status                                 `json:"status"`  // Status is the latest report, null if none was received
+	History []elasticsearch.DocumentIngestionStatus `json:"history"` // History are the reports in the requested period, most recent first
+}
+
+// recordStatus stores the status report sent by the ingestion client. Totals
+// are computed from the files rather than trusted from the client.
+func recordStatus(s *state.State, assetID string, status *Status) {
+	if status == nil {
+		return
+	}
+	status.AssetID = assetID
+	status.Time = time.Now().UTC().Format(time.RFC3339)
+	status.LagBytes, status.LagSeconds, status.ParseErrors = 0, 0, 0
+	for _, file := range status.Files {
+		status.LagBytes += file.LagBytes
+		status.ParseErrors += file.ParseErrors
+		if file.LagSeconds > status.LagSeconds {
+			status.LagSeconds = file.LagSeconds
+		}
+	}
+	statuses.update(assetID, *status)
+	lagBytes.Set(float64(status.LagBytes), assetID)
+	lagSeconds.Set(float64(status.LagSeconds), assetID)
+
+	_, err := status.Index(s)
+	if err != nil {
+		s.Log.Error("[ingestion] failed to store status of ", assetID, " ", err)
+	}
+}
+
+// PruneStatus periodically deletes status reports older than StatusRetention.
+func PruneStatus(s *state.State) {
+	ticker := time.NewTicker(statusPrune)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := elasticsearch.DeleteIngestionStatusBefore(s, time.Now().Add(-StatusRetention))
+		if err != nil {
+			s.Log.Error("[ingestion] failed to delete expired status reports ", err)
+		}
+	}
+}
+
+// statusHandler is "/api/ingestion/status". It returns the latest status
+// report of the ingestion client "uuid" and its reports of the last "hours"
+// hours (24 by default).
+func statusHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
+
+	l := ctxlog.Log(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+
+	uuid := r.URL.Query().Get("uuid")
+	hours := 24
+	if value := r.URL.Query().Get("hours"); value != "" {
+		var err error
+		hours, err = strconv.Atoi(value)
+		if err != nil || hours <= 0 || time.Duration(hours)*time.Hour > StatusRetention {
+			w.WriteHeader(http.StatusBadRequest)
+			out := GeneralResponse{
+				Success: false,
+				Message: "Invalid number of hours specified.",
+			}
+			json.NewEncoder(w).Encode(out)
+			return
+		}
+	}
+	if uuid == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Invalid ingestion UUID specified.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	history, err := elasticsearch.QueryIngestionStatus(s, uuid, time.Now().Add(-time.Duration(hours)*time.Hour), statusHistory)
+	if err != nil {
+		l.Error("error getting ingestion status ", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		out := GeneralResponse{
+			Success: false,
+			Message: "Failed to retrieve ingestion status.",
+		}
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	out := statusResponse{
+		Success: true,
+		History: history,
+	}
+	if latest, ok := statuses.getItem(uuid); ok {
+		out.Status = &latest
+	} else if len(history) > 0 {
+		out.Status = &history[0]
+	}
+	json.NewEncoder(w).Encode(out)
+}
@@ -1,28 +1,25 @@
 package websocket
 
 import (
-	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
+	"crypto/ecdh"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
-	"io"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/mcmaster-circ/canids-v2/backend/auth"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/pki"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 	"nhooyr.io/websocket"
 	"nhooyr.io/websocket/wsjson"
 )
 
 const (
-	WSPort     = 50000
-	bufferSize = 4096
+	WSPort = 50000
 )
 
 type Header struct {
@@ -30,8 +27,10 @@ type Header struct {
 	MsgTimestamp time.Time `json:"msg_timestamp,omitempty"` // Message timestamp
 	ErrorMsg     string    `json:"error_msg,omitempty"`     // Request error message(s) (use with NACK)
 	Session      string    `json:"session,omitempty"`       // Connection session UUID
-	MsgType      int       `json:"type,omitempty"`          // Message type: 0 - data, 1 - pong, 2 - connection success, 3 - wait on approval
+	MsgType      int       `json:"type,omitempty"`          // Message type: 0 - data, 1 - pong, 2 - status, 3 - profile acknowledgement
 	Encrypted    bool      `json:"encrypted,omitempty"`     // Whether the payload is encrypted (true) or not (false)
+	Seq          uint64    `json:"seq,omitempty"`           // Data frame sequence number, increasing within the session
+	Epoch        uint32    `json:"epoch,omitempty"`         // Key epoch of the encrypted payload
 }
 
 type Frame struct {
@@ -39,29 +38,36 @@ type Frame struct {
 	AssetID   string   `json:"asset_id,omitempty"`  // Asset identifier
 	FileName  string   `json:"file_name,omitempty"` // Name of file payload is from
 	Payload   [][]byte `json:"payload,omitempty"`   // Multiple JSON byte lines from Zeek
-	Key       []byte   // For storing associated key
+	Status    *Status  `json:"status,omitempty"`    // For status frames, the health report of the client
+	Version   int      `json:"version,omitempty"`   // For profile acknowledgements, the profile version applied or rejected with ErrorMsg
 	GoingAway bool     // Will be set to true when ingestion client has been closed. Flag for ingest (backend) to be able to remove given ingestion client from delete map
+	flow      *flow    // Flow control of the connection, released once the data frame is indexed
 }
 
 type Authorization struct {
-	Key      string `json:"key"`
-	AssetID  string `json:"assetId"`
-	Address  string `json:"address"`
-	Approved bool
+	AssetID     string `json:"assetId"`
+	Address     string `json:"address"`
+	IdentityKey string `json:"identityKey"` // Base64 X25519 identity public key, pinned at approval
+	CSR         string `json:"csr"`         // PEM encoded certificate signing request, sent when the client needs a certificate
+	Approved    bool
+	Certificate string // PEM encoded client certificate issued on approval
 }
 
 type Message struct {
-	MsgType int    `json:"type,omitempty"` // Message type: 0 - Misc, 1 - Ping, 2 - connection success, 3 - wait on approval
-	Msg     string `json:"msg,omitempty"`
+	MsgType  int          `json:"type,omitempty"`     // Message type: 0 - Misc, 1 - Ping, 2 - connection success, 3 - wait on approval, 4 - approved, 5 - key exchange, 6 - flow credits, 7 - profile
+	Msg      string       `json:"msg,omitempty"`      // For approved and connection success, the issued client certificate if any
+	Exchange *KeyExchange `json:"exchange,omitempty"` // For key exchange, the key agreement values
+	Credits  int          `json:"credits,omitempty"`  // For flow credits, the number of additional data frames the client may send
+	Profile  *Profile     `json:"profile,omitempty"`  // For profile, the configuration the client must apply
 }
 
 // IngestServer handles WebSocket connections.
 type WebSocketServer struct {
-	queue chan *Frame
+	queue *fairQueue
 }
 
 var server = &WebSocketServer{
-	queue: make(chan *Frame, bufferSize),
+	queue: newFairQueue(),
 }
 
 var del = Deleted{
@@ -111,15 +117,67 @@ func HandleWebSocket(s *state.State, w http.ResponseWriter, r *http.Request) {
 	uuid := header.AssetID
 	log.Println("Uuid, ", uuid)
 
-	var key string
+	identityKey, err := base64.StdEncoding.DecodeString(header.IdentityKey)
+	if err != nil {
+		log.Println("Failed to decode identity key: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	identity, err := ecdh.X25519().NewPublicKey(identityKey)
+	if err != nil {
+		log.Println("Invalid identity key: ", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// A client certificate verified by the ingestion listener binds the
+	// connection to the asset it was issued to
+	var cert *x509.Certificate
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cert = r.TLS.PeerCertificates[0]
+		if cert.Subject.CommonName != uuid {
+			log.Println("Client certificate of ", cert.Subject.CommonName, " presented by ", uuid)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if auth.CertRevoked(pki.Serial(cert)) {
+			log.Println("Revoked client certificate presented by ", uuid)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	}
+
+	// Clients approved before identity keys were pinned mix in their legacy
+	// shared key, and have their identity key pinned once they prove it
+	var psk []byte
 	// If err was unable to get ingestion from elasticsearch - push to frontend for confirmation
-	ingestion, _, err := elasticsearch.QueryIngestionByUUID(s, uuid)
+	ingestion, esDocID, err := elasticsearch.QueryIngestionByUUID(s, uuid)
 	if err != nil {
 		inES = false
-		key = header.Key
 		log.Println("Unable to get specified ingestion from elasticsearch: ", err)
 	} else {
-		key = ingestion.Key
+		if ingestion.IdentityKey == "" {
+			psk, err = base64.StdEncoding.DecodeString(ingestion.Key)
+			if err != nil || len(psk) == 0 {
+				log.Println("No identity key or shared key for ", uuid)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+		} else if ingestion.IdentityKey != header.IdentityKey {
+			log.Println("Identity key does not match key pinned for ", uuid)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if cert == nil && s.Settings.IngestionMTLSRequired {
+			log.Println("Client certificate required but not presented by ", uuid)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if cert != nil && pki.Serial(cert) != ingestion.CertSerial {
+			log.Println("Superseded client certificate presented by ", uuid)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
 	}
 
 	// Accept (temporarily) ws connection
@@ -131,11 +189,13 @@ func HandleWebSocket(s *state.State, w http.ResponseWriter, r *http.Request) {
 	defer conn.Close(websocket.StatusInternalError, "WebSocket closed")
 	active.append(uuid)
 	defer active.delete(uuid)
+	connections.Add(1)
+	defer connections.Add(-1)
 
 	if !inES {
 		// Push to frontend, establish heartbeat, monitor for approval
-		waitList.update(uuid, header)
-		defer waitList.delete(uuid)
+		pending := waitList.add(header)
+		defer waitList.delete(pending)
 
 		// Put ingestion client into 'waiting' mode
 		waitMsg := Message{
@@ -179,16 +239,23 @@ func HandleWebSocket(s *state.State, w http.ResponseWriter, r *http.Request) {
 				lastTime = time.Now()
 			}
 
-			// When approved send a 4
-			if waitList.getItem(uuid).Approved {
+			// When approved send a 4 with the issued certificate
+			if approval := waitList.getItem(pending); approval.Approved {
+				// The approved identity key must be the one of this
+				// connection
+				ingestion, _, err = elasticsearch.QueryIngestionByUUID(s, uuid)
+				if err != nil || ingestion.IdentityKey != header.IdentityKey {
+					log.Println("Approved identity key does not match connection of ", uuid)
+					return
+				}
 				approvedMessage := Message{
 					MsgType: 4,
-					Msg:     "",
+					Msg:     approval.Certificate,
 				}
 				ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
 				wsjson.Write(ctx, conn, approvedMessage)
 				cancel()
-				waitList.delete(uuid)
+				waitList.delete(pending)
 				break
 			}
 		}
@@ -202,61 +269,30 @@ func HandleWebSocket(s *state.State, w http.ResponseWriter, r *http.Request) {
 		cancel()
 	}
 
-	// Generate random data for symmetrical encryption key check
-	randData := make([]byte, 32)
-	_, err = rand.Read(randData)
-	if err != nil {
-		log.Println("Failed to generate random data: ", err)
-		return
-	}
-
-	encodedData := base64.StdEncoding.EncodeToString(randData)
-
-	dataMessage := Message{
-		MsgType: 0,
-		Msg:     encodedData,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
-	wsjson.Write(ctx, conn, dataMessage)
-	cancel()
-
-	// Get encrypted message
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
-	var msg Message
-	err = wsjson.Read(ctx, conn, &msg)
+	// Agree on the session keys, authenticating the client by its identity
+	// key
+	session, err := keyExchange(conn, uuid, identity, psk, ingestion.EncryptionRequired)
 	if err != nil {
-		log.Println("Did not receive response: ", err)
-		cancel()
+		log.Println("Key exchange failed with ", uuid, ": ", err)
+		exchangeFailures.Inc()
 		return
 	}
-	cancel()
-
-	decoded, err := base64.StdEncoding.DecodeString(msg.Msg)
-	if err != nil {
-		log.Println("Failed to decode message", err)
-	}
-
-	decodedKey, err := base64.StdEncoding.DecodeString(key)
-	if err != nil {
-		log.Println("Failed to decode key: ", err)
-	}
-
-	decrypted, err := Decrypt(decoded, decodedKey)
-	if err != nil {
-		log.Println("Failed to decrypt received text: ", err)
+	if inES && ingestion.IdentityKey == "" {
+		pinIdentity(s, r, &ingestion, esDocID, header.IdentityKey)
 	}
 
-	if !bytes.Equal(randData, decrypted) {
-		log.Println("Data received does not equal original data")
-		return
+	// Issue a certificate to approved clients requesting one, such as clients
+	// approved before certificates were issued or with an expiring certificate
+	var certificate string
+	if inES && header.CSR != "" && (cert == nil || auth.CertExpiring(cert)) {
+		certificate = renewCertificate(s, r, ingestion, esDocID, header.CSR)
 	}
 
 	successMsg := Message{
 		MsgType: 2,
-		Msg:     "",
+		Msg:     certificate,
 	}
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
 	wsjson.Write(ctx, conn, successMsg)
 	cancel()
 
@@ -264,7 +300,11 @@ func HandleWebSocket(s *state.State, w http.ResponseWriter, r *http.Request) {
 
 	var timeLastPong = time.Now()
 	msgQueue := make(chan Message)
-	go writePump(conn, msgQueue)
+	credits := newFlow()
+	profiles := pushes.register(uuid)
+	defer pushes.delete(uuid, profiles)
+	pushProfile(s, uuid)
+	go writePump(conn, msgQueue, credits, profiles)
 
 	for {
 
@@ -277,44 +317,77 @@ func HandleWebSocket(s *state.State, w http.ResponseWriter, r *http.Request) {
 				}
 
 				s.Log.Printf("Ingestion staged for deletion. Sending close frame")
-				server.queue <- &closeFrame
-				break
+				server.queue.push(&closeFrame)
+				return
 			}
 		}
 
 		var frame Frame
 		err := wsjson.Read(context.Background(), conn, &frame)
 		if err != nil {
+			// the connection is closed once a read fails
 			log.Println("Error reading WebSocket message: ", err)
-			//conn.Close(websocket.StatusInvalidFramePayloadData, "Could not read websocket message")
-			continue
+			return
 		}
 		err = Validate(&frame.Header)
 		if err != nil {
 			log.Println("Invalid header: ", err)
+			err = dropFrame(&frame, credits)
+			if err != nil {
+				log.Println("Rejected frame from ", uuid, ": ", err)
+				creditViolations.Inc(uuid)
+				close(msgQueue)
+				break
+			}
 			continue
 		}
 
-		if frame.Header.Encrypted {
-			frame.Key = decodedKey
-		}
-
 		if frame.Header.MsgType == 1 {
 			timeLastPong = time.Now()
 			continue
 		}
+		if frame.Header.MsgType == 2 {
+			recordStatus(s, uuid, frame.Status)
+			continue
+		}
+		if frame.Header.MsgType == 3 {
+			acknowledgeProfile(s, uuid, frame.Version, frame.Header.ErrorMsg)
+			continue
+		}
 
 		if timeLastPong.Add(time.Second * 15).Before(time.Now()) {
 			log.Println("No pong recieved for 15 seconds")
 			close(msgQueue)
 			break
 		}
-		server.queue <- &frame
+
+		// Each data frame uses a credit, so that the queue stays bounded and
+		// this loop is never blocked from reading pongs
+		err = credits.use()
+		if err != nil {
+			log.Println("Rejected frame from ", uuid, ": ", err)
+			creditViolations.Inc(uuid)
+			close(msgQueue)
+			break
+		}
+
+		// Frames are stored for the asset of the connection only
+		frame.AssetID = uuid
+		frame.flow = credits
+		err = openFrame(session, &frame, ingestion.EncryptionRequired)
+		if err != nil {
+			log.Println("Rejected frame from ", uuid, ": ", err)
+			decryptFailures.Inc(uuid)
+			close(msgQueue)
+			break
+		}
+		server.queue.push(&frame)
 	}
 }
 
-func writePump(conn *websocket.Conn, msgQueue chan Message) error {
+func writePump(conn *websocket.Conn, msgQueue chan Message, credits *flow, profiles chan *Profile) error {
 	ticker := time.NewTicker(3*time.Second)
+	defer ticker.Stop()
 
 	for {
 		select {
@@ -328,6 +401,26 @@ func writePump(conn *websocket.Conn, msgQueue chan Message) error {
 				return err
 			}
 			
+		case <-credits.notify:
+			msg := Message{
+				MsgType: 6,
+				Credits: credits.grant(),
+			}
+			err := wsjson.Write(context.Background(), conn, msg)
+			if err != nil {
+				return err
+			}
+
+		case profile := <-profiles:
+			msg := Message{
+				MsgType: 7,
+				Profile: profile,
+			}
+			err := wsjson.Write(context.Background(), conn, msg)
+			if err != nil {
+				return err
+			}
+
 		case message, ok := <-msgQueue:
 			if !ok {
 				err := conn.Close(websocket.StatusGoingAway, "")
@@ -344,49 +437,11 @@ func writePump(conn *websocket.Conn, msgQueue chan Message) error {
 
 func HandleQueue(s *state.State) {
 	for {
-		chunk := <-server.queue
+		chunk := server.queue.pop()
 
 		ingest(chunk, s, maxIndexSize)
+		if chunk.flow != nil {
+			chunk.flow.release()
+		}
 	}
 }
-
-func Encrypt(text []byte, key []byte) ([]byte, error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		log.Println("Failed to generate cipher")
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(c)
-	if err != nil {
-		log.Println("Failed to generate gcm")
-		return nil, err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
-	}
-
-	return gcm.Seal(nonce, nonce, text, nil), nil
-}
-
-func Decrypt(text []byte, key []byte) ([]byte, error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(c)
-	if err != nil {
-		return nil, err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(text) < nonceSize {
-		return nil, errors.New("ciphertext too short")
-	}
-
-	nonce, text := text[:nonceSize], text[nonceSize:]
-	return gcm.Open(nil, nonce, text, nil)
-}
@@ -51,7 +51,7 @@ func statusHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
 // standard 404 message. Context is normally used for logging but a 404 bypass
 // the initial middleware that generates the context.
 func notFoundHandler(s *state.State, w http.ResponseWriter, r *http.Request) {
-	// if real ip is available, use it
+	// if real ip is available from a trusted proxy, use it
 	realIP := r.Header.Get("X-Real-IP")
 	addr := r.RemoteAddr
 	if realIP != "" {
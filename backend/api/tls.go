@@ -0,0 +1,158 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package api provides the API service for the backend.
+package api
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certReloadInterval is how often the certificate files are checked for changes
+const certReloadInterval = time.Minute
+
+// certReloader serves the certificate from TLSCertFile and TLSKeyFile,
+// reloading it when either file changes, e.g. after renewal by an external
+// ACME client.
+type certReloader struct {
+	certFile string           // certFile is the PEM certificate chain
+	keyFile  string           // keyFile is the PEM private key
+	mutex    sync.RWMutex     // mutex guards cert and modified
+	cert     *tls.Certificate // cert is the loaded certificate
+	modified time.Time        // modified is the latest modification time of the files
+}
+
+// newCertReloader loads the certificate files and starts watching them for
+// changes. It returns an error if the certificate can not be loaded.
+func newCertReloader(s *state.State, certFile string, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	err := c.reload()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for range time.Tick(certReloadInterval) {
+			if !c.changed() {
+				continue
+			}
+			err := c.reload()
+			if err != nil {
+				s.Log.Error("[main] failed to reload TLS certificate, keeping previous ", err)
+				continue
+			}
+			s.Log.Info("[main] reloaded TLS certificate")
+		}
+	}()
+	return c, nil
+}
+
+// lastModified returns the latest modification time of the certificate files.
+func (c *certReloader) lastModified() time.Time {
+	var out time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err == nil && info.ModTime().After(out) {
+			out = info.ModTime()
+		}
+	}
+	return out
+}
+
+// changed returns true if either certificate file changed since it was loaded.
+func (c *certReloader) changed() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.lastModified().After(c.modified)
+}
+
+// reload loads the certificate files.
+func (c *certReloader) reload() error {
+	modified := c.lastModified()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.cert = &cert
+	c.modified = modified
+	c.mutex.Unlock()
+	return nil
+}
+
+// getCertificate returns the loaded certificate for the TLS handshake.
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.cert, nil
+}
+
+// listen serves the backend server over plain HTTP, or over TLS if a
+// certificate or ACME domains are configured. With ACME, certificates are
+// obtained and renewed using HTTP-01 challenges answered on ACMEHTTPAddr,
+// which redirects other requests to HTTPS.
+func listen(s *state.State, server *http.Server) error {
+	config := s.Config
+	switch {
+	case config.TLSCertFile != "":
+		reloader, err := newCertReloader(s, config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.getCertificate,
+		}
+		s.Log.Infof("[main] backend now listening on %s with TLS", server.Addr)
+		return server.ListenAndServeTLS("", "")
+
+	case len(config.ACMEDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(config.ACMEDomains...),
+			Cache:      autocert.DirCache(config.ACMECacheDir),
+			Email:      config.ACMEEmail,
+		}
+		challenge := &http.Server{
+			Addr:         config.ACMEHTTPAddr,
+			Handler:      manager.HTTPHandler(redirectHTTPS(server.Addr)),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			s.Log.Infof("[main] ACME challenges now answered on %s", challenge.Addr)
+			err := challenge.ListenAndServe()
+			s.Log.Error("[main] ACME challenge listener stopped ", err)
+		}()
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		s.Log.Infof("[main] backend now listening on %s with ACME certificates for %v", server.Addr, config.ACMEDomains)
+		return server.ListenAndServeTLS("", "")
+	}
+
+	s.Log.Infof("[main] backend now listening on %s", server.Addr)
+	return server.ListenAndServe()
+}
+
+// redirectHTTPS returns the handler redirecting plain HTTP requests to the
+// backend server listening with TLS on addr.
+func redirectHTTPS(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// auditRetries is the number of attempts to append an entry when other
+	// backends append concurrently
+	auditRetries = 5
+	// auditRedacted replaces the values of sensitive fields in changes
+	auditRedacted = "[redacted]"
+)
+
+var (
+	// auditMutex guards auditLast
+	auditMutex sync.Mutex
+	// auditLast is the last entry appended by this backend, nil if unknown
+	auditLast *elasticsearch.DocumentAudit
+	// auditSensitive are parts of field names whose values are not recorded
+	auditSensitive = []string{"password", "secret", "key", "token", "recoverycodes", "hash"}
+)
+
+// AuditBreak describes where the audit hash chain is broken.
+type AuditBreak struct {
+	Sequence int64  `json:"sequence"` // Sequence is the first entry that does not verify
+	Reason   string `json:"reason"`   // Reason describes the mismatch
+}
+
+// Audit records the action on the target in the audit log. The actor, client
+// address and request UUID are taken from the request. Failures are logged.
+func Audit(s *state.State, r *http.Request, action string, target string, message string) {
+	AuditDiff(s, r, action, target, message, nil, nil)
+}
+
+// AuditDiff records the action on the target in the audit log, with the
+// fields that differ between before and after. Either may be nil for created or
+// deleted objects. Sensitive fields are redacted. Failures are logged.
+func AuditDiff(s *state.State, r *http.Request, action string, target string, message string, before interface{}, after interface{}) {
+	ctx := r.Context()
+	entry := elasticsearch.DocumentAudit{
+		UUID:    uuid.Generate(),
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Actor:   jwtauth.FromContext(ctx).UUID,
+		Action:  action,
+		Target:  target,
+		Address: ClientAddr(r),
+		Request: ctxlog.RequestUUID(ctx),
+		Message: message,
+		Changes: Diff(before, after),
+	}
+	err := appendAudit(s, &entry)
+	if err != nil {
+		ctxlog.Log(ctx).Error("[audit] failed to record ", action, " ", err)
+	}
+}
+
+// appendAudit links the entry to the last entry of the chain and creates it.
+// If another backend appended first, the last entry is reloaded and the append
+// retried.
+func appendAudit(s *state.State, entry *elasticsearch.DocumentAudit) error {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	for i := 0; i < auditRetries; i++ {
+		if auditLast == nil {
+			last, err := elasticsearch.LastAudit(s)
+			if err != nil {
+				return err
+			}
+			auditLast = &last
+		}
+		entry.Sequence = auditLast.Sequence + 1
+		entry.PrevHash = auditLast.Hash
+		entry.Hash = AuditHash(*entry)
+		err := entry.Create(s)
+		if err == elasticsearch.ErrAuditConflict {
+			auditLast = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		appended := *entry
+		auditLast = &appended
+		return nil
+	}
+	return errors.New("audit: too many concurrent appends")
+}
+
+// AuditHash returns the hex SHA-256 hash of the entry without its own hash.
+// Since the hash of the previous entry is included, modifying or removing an
+// entry breaks the hash of every following entry.
+func AuditHash(entry elasticsearch.DocumentAudit) string {
+	entry.Hash = ""
+	encoded, _ := json.Marshal(entry)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAudit walks the audit log in chain order, checking the sequence and
+// hash of every entry. It returns the number of verified entries and the first
+// break, or nil if the chain is intact.
+func VerifyAudit(s *state.State) (int64, *AuditBreak, error) {
+	var prev elasticsearch.DocumentAudit
+	for {
+		entries, err := elasticsearch.AuditAfter(s, prev.Sequence, 1000)
+		if err != nil {
+			return prev.Sequence, nil, err
+		}
+		if len(entries) == 0 {
+			return prev.Sequence, nil, nil
+		}
+		for _, entry := range entries {
+			switch {
+			case entry.Sequence != prev.Sequence+1:
+				return prev.Sequence, &AuditBreak{Sequence: prev.Sequence + 1, Reason: "entry missing"}, nil
+			case entry.PrevHash != prev.Hash:
+				return prev.Sequence, &AuditBreak{Sequence: entry.Sequence, Reason: "previous hash mismatch"}, nil
+			case entry.Hash != AuditHash(entry):
+				return prev.Sequence, &AuditBreak{Sequence: entry.Sequence, Reason: "entry modified"}, nil
+			}
+			prev = entry
+		}
+	}
+}
+
+// Diff returns the top level fields whose JSON encoding differs between before
+// and after, sorted by field name. Either may be nil.
+func Diff(before interface{}, after interface{}) []elasticsearch.AuditChange {
+	if before == nil && after == nil {
+		return nil
+	}
+	prior, next := fields(before), fields(after)
+	names := []string{}
+	for name := range prior {
+		names = append(names, name)
+	}
+	for name := range next {
+		if _, ok := prior[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	changes := []elasticsearch.AuditChange{}
+	for _, name := range names {
+		change := elasticsearch.AuditChange{Field: name, Before: string(prior[name]), After: string(next[name])}
+		if change.Before == change.After {
+			continue
+		}
+		if sensitive(name) {
+			for _, value := range []*string{&change.Before, &change.After} {
+				if *value != "" {
+					*value = auditRedacted
+				}
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// fields returns the JSON encoded top level fields of the object.
+func fields(object interface{}) map[string]json.RawMessage {
+	out := map[string]json.RawMessage{}
+	if object == nil {
+		return out
+	}
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return out
+	}
+	json.Unmarshal(encoded, &out)
+	return out
+}
+
+// sensitive returns true if the values of the field must not be recorded.
+func sensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, part := range auditSensitive {
+		if strings.Contains(field, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientAddr returns the address of the client, without port. Like the request
+// logging, the "X-Real-IP" header set by a trusted reverse proxy is preferred,
+// the header is removed from requests of other clients.
+func ClientAddr(r *http.Request) string {
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -7,6 +7,7 @@ package auth
 import (
 	"time"
 
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
@@ -34,18 +35,73 @@ func Provision(s *state.State) (*jwtauth.Config, error) {
 
 	s.AuthReady = true
 
-	s.Log.Info("[api] initializing authentication secret")
-	secret, err := jwtauth.GenerateSeed(SecretLength)
+	// Generate JWTState from the signing keys in the database
+	s.Log.Info("[api] initializing JWT authentication state")
+	a = &jwtauth.Config{}
+	err = loadKeys(s, a)
 	if err != nil {
 		return nil, err
 	}
-
-	// Generate JWTState
-	s.Log.Info("[api] initializing JWT authentication state")
-	a, err = jwtauth.Init(secret)
+	err = loadRevoked(s)
+	if err != nil {
+		return nil, err
+	}
+	err = LoadRoles(s)
+	if err != nil {
+		return nil, err
+	}
+	err = loadCA(s)
 	if err != nil {
 		return nil, err
 	}
+	err = loadRevokedCerts(s)
+	if err != nil {
+		return nil, err
+	}
+	err = loadExchangeKey(s)
+	if err != nil {
+		return nil, err
+	}
+	go syncKeys(s, a)
 
 	return a, nil
 }
+
+// syncKeys reloads the signing keys, revoked sessions, roles and revoked client
+// certificates every SyncInterval, and deletes expired sessions and revoked
+// certificates every SessionCleanup. Old failed login attempts are forgotten.
+func syncKeys(s *state.State, a *jwtauth.Config) {
+	ticker := time.NewTicker(SyncInterval)
+	defer ticker.Stop()
+	cleanup := time.Now()
+	for range ticker.C {
+		err := loadKeys(s, a)
+		if err != nil {
+			s.Log.Error("[api] failed to load signing keys ", err)
+		}
+		err = loadRevoked(s)
+		if err != nil {
+			s.Log.Error("[api] failed to load revoked sessions ", err)
+		}
+		err = LoadRoles(s)
+		if err != nil {
+			s.Log.Error("[api] failed to load roles ", err)
+		}
+		err = loadRevokedCerts(s)
+		if err != nil {
+			s.Log.Error("[api] failed to load revoked certificates ", err)
+		}
+		pruneThrottle()
+		if time.Since(cleanup) > SessionCleanup {
+			cleanup = time.Now()
+			err = elasticsearch.DeleteExpiredSession(s, cleanup)
+			if err != nil {
+				s.Log.Error("[api] failed to delete expired sessions ", err)
+			}
+			err = elasticsearch.DeleteExpiredRevokedCert(s, cleanup)
+			if err != nil {
+				s.Log.Error("[api] failed to delete expired revoked certificates ", err)
+			}
+		}
+	}
+}
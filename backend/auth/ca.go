@@ -0,0 +1,213 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/pki"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// CAName is the subject of the ingestion certificate authority
+	CAName = "CanIDS Ingestion CA"
+	// CAValidity is 20 years, how long the certificate authority is valid for
+	CAValidity = 20 * 365 * 24 * time.Hour
+	// ClientCertValidity is 1 year, how long an ingestion client certificate
+	// is valid for
+	ClientCertValidity = 365 * 24 * time.Hour
+	// ClientCertRenewal is 30 days, how long before expiry a client
+	// certificate is renewed when the client requests it
+	ClientCertRenewal = 30 * 24 * time.Hour
+	// ServerCertValidity is 30 days, how long a server certificate for the
+	// ingestion listener is used before a new one is issued
+	ServerCertValidity = 30 * 24 * time.Hour
+	// serverCertLimit is the number of cached server certificates, clients
+	// may request any host name
+	serverCertLimit = 64
+)
+
+var (
+	// caMutex guards ingestionCA, revokedCerts and serverCerts
+	caMutex sync.RWMutex
+	// ingestionCA issues ingestion client and server certificates
+	ingestionCA *pki.CA
+	// revokedCerts are the serial numbers of revoked client certificates
+	revokedCerts = map[string]bool{}
+	// serverCerts are the issued server certificates by host name
+	serverCerts = map[string]*tls.Certificate{}
+)
+
+// loadCA reads the ingestion certificate authority from the database, or
+// generates it if it does not exist yet. If another backend generates it
+// concurrently, the stored certificate authority is used.
+func loadCA(s *state.State) error {
+	d, err := elasticsearch.QueryCA(s)
+	if err == elasticsearch.ErrCANotFound {
+		s.Log.Info("[api] generating ingestion certificate authority")
+		certPEM, keyPEM, err := pki.NewCA(CAName, CAValidity)
+		if err != nil {
+			return err
+		}
+		d = elasticsearch.DocumentCA{
+			Certificate: string(certPEM),
+			Key:         string(keyPEM),
+			Created:     time.Now().UTC().Format(time.RFC3339),
+		}
+		err = d.Create(s)
+		if err == elasticsearch.ErrCAConflict {
+			d, err = elasticsearch.QueryCA(s)
+		}
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	ca, err := pki.LoadCA([]byte(d.Certificate), []byte(d.Key))
+	if err != nil {
+		return err
+	}
+	caMutex.Lock()
+	ingestionCA = ca
+	caMutex.Unlock()
+	return nil
+}
+
+// loadRevokedCerts reads the serial numbers of revoked client certificates from
+// the database into the authentication state.
+func loadRevokedCerts(s *state.State) error {
+	certs, err := elasticsearch.AllRevokedCert(s)
+	if err != nil {
+		return err
+	}
+	out := map[string]bool{}
+	for _, cert := range certs {
+		out[cert.Serial] = true
+	}
+	caMutex.Lock()
+	revokedCerts = out
+	caMutex.Unlock()
+	return nil
+}
+
+// CACertificate returns the PEM encoded ingestion certificate authority
+// certificate, which ingestion clients use to verify the backend.
+func CACertificate() []byte {
+	caMutex.RLock()
+	defer caMutex.RUnlock()
+	if ingestionCA == nil {
+		return nil
+	}
+	return ingestionCA.CertPEM
+}
+
+// IssueIngestionCert signs the PEM encoded certificate signing request of the
+// ingestion client. The request subject must be the asset ID. It returns the
+// PEM encoded certificate and its serial number, or an error.
+func IssueIngestionCert(assetID string, csrPEM string) (string, string, error) {
+	caMutex.RLock()
+	ca := ingestionCA
+	caMutex.RUnlock()
+	if ca == nil {
+		return "", "", errors.New("auth: ingestion certificate authority not loaded")
+	}
+	certPEM, serial, err := ca.SignClient([]byte(csrPEM), assetID, ClientCertValidity)
+	if err != nil {
+		return "", "", err
+	}
+	return string(certPEM), serial, nil
+}
+
+// RevokeIngestionCert revokes the client certificate of the ingestion client
+// with the serial number. Connections presenting it are rejected by every
+// backend. The revocation is recorded in the audit log.
+func RevokeIngestionCert(s *state.State, r *http.Request, assetID string, serial string) error {
+	if serial == "" {
+		return nil
+	}
+	now := time.Now().UTC()
+	d := elasticsearch.DocumentRevokedCert{
+		Serial:  serial,
+		AssetID: assetID,
+		Revoked: now.Format(time.RFC3339),
+		Expires: now.Add(ClientCertValidity).Format(time.RFC3339),
+	}
+	_, err := d.Index(s)
+	if err != nil {
+		return err
+	}
+	caMutex.Lock()
+	revokedCerts[serial] = true
+	caMutex.Unlock()
+	Audit(s, r, "ingestion.revoke", assetID, "ingestion client certificate "+serial+" revoked")
+	return nil
+}
+
+// CertRevoked returns true if the client certificate with the serial number
+// has been revoked.
+func CertRevoked(serial string) bool {
+	caMutex.RLock()
+	defer caMutex.RUnlock()
+	return revokedCerts[serial]
+}
+
+// CertExpiring returns true if the client certificate expires within
+// ClientCertRenewal.
+func CertExpiring(cert *x509.Certificate) bool {
+	return time.Now().Add(ClientCertRenewal).After(cert.NotAfter)
+}
+
+// IngestionTLSConfig returns the TLS configuration of the ingestion listener.
+// Client certificates are optional at the TLS layer so that clients awaiting
+// approval can connect, but any presented certificate must be issued by the
+// ingestion certificate authority. Server certificates are issued on demand
+// for the host name requested by the client.
+func IngestionTLSConfig() *tls.Config {
+	caMutex.RLock()
+	pool := ingestionCA.Pool()
+	caMutex.RUnlock()
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientAuth:     tls.VerifyClientCertIfGiven,
+		ClientCAs:      pool,
+		GetCertificate: serverCertificate,
+	}
+}
+
+// serverCertificate returns the server certificate for the host name requested
+// in the TLS handshake, or the local address if no host name was sent.
+func serverCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := hello.ServerName
+	if host == "" && hello.Conn != nil {
+		host, _, _ = net.SplitHostPort(hello.Conn.LocalAddr().String())
+	}
+	caMutex.Lock()
+	defer caMutex.Unlock()
+	if cert, ok := serverCerts[host]; ok && time.Now().Add(24*time.Hour).Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	cert, err := ingestionCA.ServerCertificate([]string{host}, ServerCertValidity)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(serverCerts) >= serverCertLimit {
+		serverCerts = map[string]*tls.Certificate{}
+	}
+	serverCerts[host] = &cert
+	return &cert, nil
+}
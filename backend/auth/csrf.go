@@ -0,0 +1,93 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// CSRFCookie is the cookie holding the CSRF token, readable by the
+	// frontend
+	CSRFCookie = "X-CSRF"
+	// CSRFHeader is the header the frontend copies the CSRF token into
+	CSRFHeader = "X-CSRF-Token"
+)
+
+var (
+	// forbiddenError is the error for a missing or invalid CSRF token.
+	forbiddenError = GeneralResponse{
+		Success: false,
+		Message: "403 Forbidden: invalid CSRF token",
+	}
+)
+
+// SetCSRFCookie sends a new CSRF token in the X-CSRF cookie. It is called when
+// a session is started.
+func SetCSRFCookie(s *state.State, w http.ResponseWriter) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		s.Log.Error("[csrf] failed to generate CSRF token ", err)
+		return
+	}
+	cookie := http.Cookie{
+		Name:     CSRFCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(token),
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+	}
+	// upgrade cookie security if site is accessible over SSL
+	if s.Settings.HTTPSEnabled {
+		cookie.Secure = true
+	}
+	http.SetCookie(w, &cookie)
+}
+
+// CSRF takes the global state and the HTTP handler, rejecting state changing
+// requests authenticated by the X-State cookie unless the X-CSRF-Token header
+// matches the X-CSRF cookie (double submit). Requests authenticated by an API
+// token are not sent by browsers automatically and are not checked. Safe
+// methods are not checked either, so state changing routes must only accept
+// POST. Sessions started before the token was issued receive one on their next
+// safe request.
+func CSRF(s *state.State, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := r.Cookie("X-State"); err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cookie, err := r.Cookie(CSRFCookie)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if err != nil || cookie.Value == "" {
+				SetCSRFCookie(s, w)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil || cookie.Value == "" ||
+			subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(r.Header.Get(CSRFHeader))) != 1 {
+			ctxlog.Log(r.Context()).Warn("[csrf] missing or invalid CSRF token")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(forbiddenError)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// exchangeKey is the static X25519 key authenticating the backend in the key
+// agreement with ingestion clients
+var exchangeKey *ecdh.PrivateKey
+
+// loadExchangeKey reads the static key from the database, or generates it if it
+// does not exist yet. If another backend generates it concurrently, the stored
+// key is used.
+func loadExchangeKey(s *state.State) error {
+	d, err := elasticsearch.QueryExchangeKey(s)
+	if err == elasticsearch.ErrExchangeKeyNotFound {
+		s.Log.Info("[api] generating ingestion key exchange static key")
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		d = elasticsearch.DocumentExchangeKey{
+			PrivateKey: base64.StdEncoding.EncodeToString(key.Bytes()),
+			Created:    time.Now().UTC().Format(time.RFC3339),
+		}
+		err = d.Create(s)
+		if err == elasticsearch.ErrExchangeKeyConflict {
+			d, err = elasticsearch.QueryExchangeKey(s)
+		}
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(d.PrivateKey)
+	if err != nil {
+		return err
+	}
+	exchangeKey, err = ecdh.X25519().NewPrivateKey(raw)
+	return err
+}
+
+// ExchangeKey returns the static X25519 key of the backend.
+func ExchangeKey() *ecdh.PrivateKey {
+	return exchangeKey
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// KeyRotation is 7 days, how long a signing key is used before rotation
+	KeyRotation = 7 * 24 * time.Hour
+	// KeyGrace is how long a retired key is accepted, tokens signed by it
+	// expire within ExpireAge
+	KeyGrace = ExpireAge
+	// SyncInterval is 10 seconds, how often keys and revoked sessions are
+	// reloaded from the database
+	SyncInterval = 10 * time.Second
+	// SessionCleanup is 1 hour, how often expired sessions are deleted
+	SessionCleanup = 1 * time.Hour
+)
+
+// loadKeys reads the signing keys from the database into the authentication
+// state. Keys retired longer than KeyGrace are deleted. If there is no current
+// key or it is older than KeyRotation, it is retired and a new key is generated.
+// Every backend sharing the database signs with the newest current key.
+func loadKeys(s *state.State, a *jwtauth.Config) error {
+	keys, ids, err := elasticsearch.AllAuthKey(s)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+
+	// newest keys first
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return keys[order[i]].Created > keys[order[j]].Created
+	})
+
+	var current *elasticsearch.DocumentAuthKey
+	verify := []jwtauth.Key{}
+	for _, i := range order {
+		key := keys[i]
+		if key.Retired == "" && current == nil {
+			current = &keys[i]
+			continue
+		}
+		// retire every other key (e.g. generated concurrently by another
+		// backend)
+		if key.Retired == "" {
+			key.Retired = now.Format(time.RFC3339)
+			err = key.Update(s, ids[i])
+			if err != nil {
+				return err
+			}
+		}
+		// delete keys past the grace period
+		retired, err := time.Parse(time.RFC3339, key.Retired)
+		if err != nil || now.After(retired.Add(KeyGrace)) {
+			err = elasticsearch.DeleteAuthKeyByUUID(s, key.UUID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		secret, err := base64.StdEncoding.DecodeString(key.Secret)
+		if err != nil {
+			return err
+		}
+		verify = append(verify, jwtauth.Key{ID: key.UUID, Secret: secret})
+	}
+
+	// rotate the current key when due
+	if current != nil {
+		created, err := time.Parse(time.RFC3339, current.Created)
+		if err != nil || now.After(created.Add(KeyRotation)) {
+			secret, err := base64.StdEncoding.DecodeString(current.Secret)
+			if err != nil {
+				return err
+			}
+			verify = append(verify, jwtauth.Key{ID: current.UUID, Secret: secret})
+			current.Retired = now.Format(time.RFC3339)
+			err = current.Update(s, ids[indexOf(keys, current)])
+			if err != nil {
+				return err
+			}
+			current = nil
+		}
+	}
+	if current == nil {
+		secret, err := jwtauth.GenerateSeed(SecretLength)
+		if err != nil {
+			return err
+		}
+		current = &elasticsearch.DocumentAuthKey{
+			UUID:    uuid.Generate(),
+			Secret:  base64.StdEncoding.EncodeToString(secret),
+			Created: now.Format(time.RFC3339),
+		}
+		_, err = current.Index(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(current.Secret)
+	if err != nil {
+		return err
+	}
+	if len(secret) == 0 {
+		return errors.New("auth: empty signing key " + current.UUID)
+	}
+	return a.SetKeys(jwtauth.Key{ID: current.UUID, Secret: secret}, verify)
+}
+
+// indexOf returns the index of key in keys.
+func indexOf(keys []elasticsearch.DocumentAuthKey, key *elasticsearch.DocumentAuthKey) int {
+	for i := range keys {
+		if &keys[i] == key {
+			return i
+		}
+	}
+	return -1
+}
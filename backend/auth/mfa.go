@@ -0,0 +1,187 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/totp"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// MFAAge is 5 minutes, how long the intermediate token between the password
+	// and the TOTP code of a login is valid for
+	MFAAge = 5 * time.Minute
+	// MFAIssuer is the issuer shown in authenticator apps
+	MFAIssuer = "CanIDS"
+	// RecoveryCodeCount is the number of recovery codes generated on enrollment
+	RecoveryCodeCount = 10
+	// RecoveryCodeLength is length of a recovery code
+	RecoveryCodeLength = 10 // bytes (80 bits), 16 base32 characters
+	// mfaSubject marks intermediate tokens, they are not accepted as sessions
+	mfaSubject = "mfa"
+)
+
+var (
+	// recoveryEncoding is unpadded base32, easy to type
+	recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+	// errMFAToken is the error for an invalid or expired intermediate token.
+	errMFAToken = errors.New("invalid MFA token")
+	// ErrMFACode is the error for an invalid, reused or expired code.
+	ErrMFACode = errors.New("invalid MFA code")
+	// ErrMFANotEnrolled is the error for activating without a pending enrollment.
+	ErrMFANotEnrolled = errors.New("MFA enrollment not started")
+	// ErrMFALocked is the error for a code of an account locked out meanwhile.
+	ErrMFALocked = errors.New("account is locked")
+)
+
+// MFARequired returns true if the MFA_ENFORCE setting requires users of the
+// class to log in with a TOTP code.
+func MFARequired(s *state.State, class jwtauth.UserClass) bool {
+	switch s.Settings.MFAEnforce {
+	case "all":
+		return true
+	case "admins":
+		return class == jwtauth.UserAdmin
+	}
+	return false
+}
+
+// NewMFAToken returns the intermediate token issued after the password of a
+// user is verified. It only grants the second login step and expires after
+// MFAAge.
+func NewMFAToken(a *jwtauth.Config, user *jwtauth.Payload) (string, error) {
+	pending := *user
+	pending.Id = ""
+	pending.Subject = mfaSubject
+	pending.IssuedAt = time.Now().Unix()
+	return a.CreateToken(&pending, MFAAge)
+}
+
+// ParseMFAToken validates an intermediate token, returning the user it was
+// issued to or an error.
+func ParseMFAToken(a *jwtauth.Config, token string) (*jwtauth.Payload, error) {
+	user, err := a.ParseToken(token)
+	if err != nil || user.Subject != mfaSubject {
+		return nil, errMFAToken
+	}
+	user.Subject = ""
+	return user, nil
+}
+
+// BeginMFAEnrollment generates a new TOTP secret for the user, replacing any
+// pending enrollment. It returns the secret and its provisioning URI, or an
+// error. Login does not require a code until the enrollment is activated.
+func BeginMFAEnrollment(s *state.State, uuid string) (string, string, error) {
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", errors.New("MFA already enabled")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	user.TOTPSecret = secret
+	err = user.Update(s, esDocID)
+	if err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(MFAIssuer, user.UUID, secret), nil
+}
+
+// ActivateMFAEnrollment confirms a pending enrollment with a code from the
+// authenticator app. It returns the recovery codes, which are only stored
+// hashed, or an error.
+func ActivateMFAEnrollment(s *state.State, uuid string, code string) ([]string, error) {
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if AccountLocked(user) {
+		return nil, ErrMFALocked
+	}
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrMFACode
+	}
+	codes, hashes := []string{}, []string{}
+	for i := 0; i < RecoveryCodeCount; i++ {
+		seed, err := jwtauth.GenerateSeed(RecoveryCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryEncoding.EncodeToString(seed))
+		hash, err := jwtauth.HashPassword(code)
+		if err != nil {
+			return nil, err
+		}
+		codes, hashes = append(codes, code), append(hashes, hash)
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = hashes
+	err = user.Update(s, esDocID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyMFA checks a TOTP code or an unused recovery code of the user. Codes can
+// only be used once. It returns ErrMFACode if the code is not valid, or
+// ErrMFALocked if the account is locked out.
+func VerifyMFA(s *state.State, uuid string, code string) error {
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil {
+		return err
+	}
+	if AccountLocked(user) {
+		return ErrMFALocked
+	}
+	if !user.TOTPEnabled {
+		return ErrMFANotEnrolled
+	}
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		// reject replay of a code within its validity
+		if step <= user.TOTPLastStep {
+			return ErrMFACode
+		}
+		user.TOTPLastStep = step
+		return user.Update(s, esDocID)
+	}
+	for i, hash := range user.RecoveryCodes {
+		if jwtauth.HashCompare(hash, strings.ToLower(code)) {
+			user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+			return user.Update(s, esDocID)
+		}
+	}
+	return ErrMFACode
+}
+
+// ResetMFA removes the TOTP enrollment and recovery codes of the user.
+func ResetMFA(s *state.State, uuid string) error {
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil {
+		return err
+	}
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = []string{}
+	return user.Update(s, esDocID)
+}
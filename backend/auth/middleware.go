@@ -6,7 +6,9 @@ package auth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
@@ -33,15 +35,21 @@ var (
 		Success: false,
 		Message: "401 Unauthorized",
 	}
+	// errRevoked is the error for a token without a session or with a revoked
+	// session.
+	errRevoked = errors.New("session revoked")
 )
 
 // Middleware takes the global state, the auth state and the HTTP handler,
-// conditionally forwarding the request to the next handler. The middleware will
-// validate the X-State token. If the token is invalid or expired (older than
-// ExpireAge), it will return a 401 Unauthorized error. If the token is valid
-// and older than RenewAge, the middleware will query the database and update
-// the token automatically. The request will then proceed normally. If the token
-// is valid and not older than RenewAge, the request will proceed normally.
+// conditionally forwarding the request to the next handler. If an
+// "Authorization: Bearer" header is present, the middleware will validate the
+// API token and the request will proceed without cookies. Otherwise the
+// middleware will validate the X-State token. If the token is invalid or
+// expired (older than ExpireAge), it will return a 401 Unauthorized error. If
+// the token is valid and older than RenewAge, the middleware will query the
+// database and update the token automatically. The request will then proceed
+// normally. If the token is valid and not older than RenewAge, the request will
+// proceed normally.
 func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// get log context from request
@@ -54,6 +62,27 @@ func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handl
 			next.ServeHTTP(w, r)
 			return
 		}
+		// API token in Authorization header takes precedence over the cookie
+		if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			user, err := authenticateToken(s, r, strings.TrimPrefix(header, "Bearer "))
+			if err != nil {
+				// token is not valid, return 401
+				l.Warn("[middleware] invalid API token: ", err)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnauthorized)
+				json.NewEncoder(w).Encode(unauthorizedError)
+				return
+			}
+			l = l.WithFields(log.Fields{
+				"uuid":  user.UUID,
+				"class": string(user.Class),
+				"auth":  "token",
+			})
+			ctx = ctxlog.WithFields(ctx, l)
+			l.Debug("[middleware] request")
+			next.ServeHTTP(w, r.WithContext(user.Context(ctx)))
+			return
+		}
 		// middleware is enabled, get the state token in cookie
 		cookie, err := r.Cookie("X-State")
 		if err != nil || cookie.Value == "" {
@@ -66,6 +95,9 @@ func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handl
 		}
 		// validate the state token
 		user, err := a.ParseToken(cookie.Value)
+		if err == nil && (user.Id == "" || SessionRevoked(user.Id)) {
+			err = errRevoked
+		}
 		if err != nil {
 			// token is not valid, return 401
 			l.Warn("[middleware] invalid X-State cookie: ", err)
@@ -89,9 +121,11 @@ func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handl
 		if time.Now().After(renewTime) {
 			// query user in database for state changes
 			esUser, _, err := elasticsearch.QueryAuthByUUID(s, user.UUID)
-			// if user can not be located or is no longer activated, revoke
-			// access
-			if err != nil || !esUser.Activated {
+			// query session in database for revocation
+			session, sessionID, sessionErr := elasticsearch.QuerySessionByUUID(s, user.Id)
+			// if user or session can not be located, the user is no longer
+			// activated or the session is revoked, revoke access
+			if err != nil || !esUser.Activated || sessionErr != nil || session.Revoked {
 				// delete the X-State cookie
 				cookie := http.Cookie{
 					Name:     "X-State",
@@ -133,6 +167,7 @@ func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handl
 			user.Class = esUser.Class
 			user.Name = esUser.Name
 			user.Activated = esUser.Activated
+			user.Assets = esUser.Assets
 
 			// update time + generate new token
 			user.IssuedAt = time.Now().Unix()
@@ -145,6 +180,13 @@ func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handl
 				json.NewEncoder(w).Encode(internalServerError)
 				return
 			}
+			// extend the session
+			session.LastSeen = time.Now().UTC().Format(time.RFC3339)
+			session.Expires = time.Unix(user.ExpiresAt, 0).UTC().Format(time.RFC3339)
+			err = session.Update(s, sessionID)
+			if err != nil {
+				l.Error("[middleware] failed to update session ", err)
+			}
 			// generate new X-State cookie, send to browser
 			cookie := http.Cookie{
 				Name:     "X-State",
@@ -176,6 +218,9 @@ func Middleware(s *state.State, a *jwtauth.Config, next http.Handler) http.Handl
 			http.SetCookie(w, &cookie)
 		}
 
+		// resolve the permissions of the user role
+		user.Permissions, _ = RolePermissions(string(user.Class))
+
 		// inject user authentication payload into context
 		ctx = user.Context(ctx)
 		l.Debug("[middleware] request")
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/ctxlog"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+var (
+	// rolesMutex guards roles
+	rolesMutex sync.RWMutex
+	// roles maps every role name to its permissions, reloaded every
+	// SyncInterval
+	roles = builtinRoles()
+)
+
+// builtinRoles returns the roles that always exist and can not be modified.
+// Admins have every permission, standard users may export data.
+func builtinRoles() map[string][]jwtauth.Permission {
+	all := []jwtauth.Permission{}
+	for _, permission := range jwtauth.PermissionMap {
+		all = append(all, permission)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	return map[string][]jwtauth.Permission{
+		string(jwtauth.UserAdmin):    all,
+		string(jwtauth.UserStandard): {jwtauth.PermDataExport},
+	}
+}
+
+// BuiltinRole returns true if the role is built-in, or is the name reserved for
+// service tokens.
+func BuiltinRole(name string) bool {
+	_, ok := jwtauth.UserClassMap[name]
+	return ok || name == string(jwtauth.UserService)
+}
+
+// RolePermissions returns the permissions granted by the role and true, or
+// false if the role does not exist.
+func RolePermissions(name string) ([]jwtauth.Permission, bool) {
+	rolesMutex.RLock()
+	defer rolesMutex.RUnlock()
+	permissions, ok := roles[name]
+	return permissions, ok
+}
+
+// LoadRoles reloads the roles from the database.
+func LoadRoles(s *state.State) error {
+	stored, err := elasticsearch.AllRole(s)
+	if err != nil {
+		return err
+	}
+	out := builtinRoles()
+	for _, role := range stored {
+		if BuiltinRole(role.Name) {
+			continue
+		}
+		// permissions that no longer exist grant nothing
+		permissions := []jwtauth.Permission{}
+		for _, permission := range role.Permissions {
+			if _, ok := jwtauth.PermissionMap[string(permission)]; ok {
+				permissions = append(permissions, permission)
+			}
+		}
+		out[role.Name] = permissions
+	}
+	rolesMutex.Lock()
+	roles = out
+	rolesMutex.Unlock()
+	return nil
+}
+
+// Authorize takes the global state, the permission required by a route and its
+// handler, returning a handler that only forwards the request if the role of
+// the authenticated user grants the permission. Otherwise it will return a 403
+// Forbidden error.
+func Authorize(s *state.State, permission jwtauth.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// if middleware disabled, just serve request
+		if s.Settings.MiddlewareDisable {
+			next(w, r)
+			return
+		}
+		ctx := r.Context()
+		current, l := jwtauth.FromContext(ctx), ctxlog.Log(ctx)
+		if !current.Can(permission) {
+			l.Warn("[authorize] missing permission ", permission)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(GeneralResponse{
+				Success: false,
+				Message: "Permission " + string(permission) + " is required.",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+var (
+	// revokedMutex guards revoked
+	revokedMutex sync.RWMutex
+	// revoked is the set of revoked session IDs that have not expired,
+	// reloaded every SyncInterval
+	revoked = map[string]bool{}
+)
+
+// NewSession starts a session for the user, storing it in the database. The
+// session ID is set as the token "jti" claim. It returns the signed token or an
+// error.
+func NewSession(s *state.State, a *jwtauth.Config, user *jwtauth.Payload, r *http.Request) (string, error) {
+	now := time.Now()
+	user.Id = uuid.Generate()
+	user.IssuedAt = now.Unix()
+	token, err := a.CreateToken(user, ExpireAge)
+	if err != nil {
+		return "", err
+	}
+	session := elasticsearch.DocumentSession{
+		UUID:      user.Id,
+		User:      user.UUID,
+		Address:   ClientAddr(r),
+		UserAgent: r.UserAgent(),
+		Created:   now.UTC().Format(time.RFC3339),
+		LastSeen:  now.UTC().Format(time.RFC3339),
+		Expires:   time.Unix(user.ExpiresAt, 0).UTC().Format(time.RFC3339),
+	}
+	_, err = session.Index(s)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeSession revokes the session with the provided ID. Tokens of the session
+// are rejected by every backend within SyncInterval.
+func RevokeSession(s *state.State, id string) error {
+	session, docID, err := elasticsearch.QuerySessionByUUID(s, id)
+	if err != nil {
+		return err
+	}
+	session.Revoked = true
+	err = session.Update(s, docID)
+	if err != nil {
+		return err
+	}
+	revokedMutex.Lock()
+	revoked[id] = true
+	revokedMutex.Unlock()
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of the user with the
+// provided UUID.
+func RevokeUserSessions(s *state.State, user string) error {
+	sessions, _, err := elasticsearch.ActiveSession(s, user)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		err = RevokeSession(s, session.UUID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SessionRevoked returns true if the session with the provided ID is revoked.
+func SessionRevoked(id string) bool {
+	revokedMutex.RLock()
+	defer revokedMutex.RUnlock()
+	return revoked[id]
+}
+
+// loadRevoked reloads the revoked sessions from the database.
+func loadRevoked(s *state.State) error {
+	sessions, err := elasticsearch.RevokedSession(s)
+	if err != nil {
+		return err
+	}
+	out := map[string]bool{}
+	for _, session := range sessions {
+		out[session.UUID] = true
+	}
+	revokedMutex.Lock()
+	revoked = out
+	revokedMutex.Unlock()
+	return nil
+}
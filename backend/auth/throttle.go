@@ -0,0 +1,202 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// ThrottleFreeAccount is the number of failed attempts for an account
+	// before requests are delayed
+	ThrottleFreeAccount = 3
+	// ThrottleFreeAddress is the number of failed attempts from a client address
+	// before requests are delayed, higher as clients may share an address
+	ThrottleFreeAddress = 10
+	// ThrottleBase is 1 second, the delay after the free attempts, doubled for
+	// every further failed attempt
+	ThrottleBase = 1 * time.Second
+	// ThrottleMax is 15 minutes, the longest delay between attempts
+	ThrottleMax = 15 * time.Minute
+	// ThrottleForget is 1 hour, how long failed attempts are remembered
+	ThrottleForget = 1 * time.Hour
+	// LockoutThreshold is the number of consecutive failed logins that lock an
+	// account
+	LockoutThreshold = 10
+	// LockoutDuration is 30 minutes, how long an account is locked for
+	LockoutDuration = 30 * time.Minute
+)
+
+// attempts are the failed attempts of an account or client address.
+type attempts struct {
+	failures int       // failures is the number of failed attempts
+	last     time.Time // last is the time of the last failed attempt
+}
+
+var (
+	// throttleMutex guards throttled
+	throttleMutex sync.Mutex
+	// throttled are the failed attempts of this backend, keyed by account or
+	// client address
+	throttled = map[string]*attempts{}
+)
+
+// Throttle returns how long the client of the request must wait before
+// attempting to authenticate as the account, or 0 if it may proceed.
+func Throttle(r *http.Request, account string) time.Duration {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	wait := backoff(throttled[addressKey(r)], ThrottleFreeAddress)
+	if account != "" {
+		if accountWait := backoff(throttled[accountKey(account)], ThrottleFreeAccount); accountWait > wait {
+			wait = accountWait
+		}
+	}
+	return wait
+}
+
+// ThrottleFail records a failed or costly attempt from the client of the request
+// for the account, increasing the delay of further attempts.
+func ThrottleFail(r *http.Request, account string) {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	keys := []string{addressKey(r)}
+	if account != "" {
+		keys = append(keys, accountKey(account))
+	}
+	for _, key := range keys {
+		a, ok := throttled[key]
+		if !ok || time.Since(a.last) > ThrottleForget {
+			a = &attempts{}
+			throttled[key] = a
+		}
+		a.failures++
+		a.last = time.Now()
+	}
+}
+
+// ThrottleReset forgets the failed attempts for the account.
+func ThrottleReset(account string) {
+	throttleMutex.Lock()
+	delete(throttled, accountKey(account))
+	throttleMutex.Unlock()
+}
+
+// TooManyRequests writes the "Retry-After" header and 429 status for a
+// throttled request.
+func TooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(wait.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+// AccountLocked returns true if the account is locked after too many failed
+// logins.
+func AccountLocked(user elasticsearch.DocumentAuth) bool {
+	if user.LockedUntil == "" {
+		return false
+	}
+	until, err := time.Parse(time.RFC3339, user.LockedUntil)
+	return err == nil && time.Now().Before(until)
+}
+
+// LoginFailed records a failed password or MFA code for the account with the
+// provided UUID. The account is locked for LockoutDuration after
+// LockoutThreshold consecutive failures, which is recorded in the audit log.
+func LoginFailed(s *state.State, r *http.Request, uuid string) error {
+	ThrottleFail(r, uuid)
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil || AccountLocked(user) {
+		// unknown accounts are only throttled
+		return nil
+	}
+	user.FailedLogins++
+	if user.FailedLogins < LockoutThreshold {
+		return user.Update(s, esDocID)
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = time.Now().Add(LockoutDuration).UTC().Format(time.RFC3339)
+	err = user.Update(s, esDocID)
+	if err != nil {
+		return err
+	}
+	Audit(s, r, "auth.lockout", user.UUID, "account locked after "+strconv.Itoa(LockoutThreshold)+" failed logins until "+user.LockedUntil)
+	return nil
+}
+
+// LoginSucceeded clears the failed logins of the account.
+func LoginSucceeded(s *state.State, uuid string) error {
+	ThrottleReset(uuid)
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil || (user.FailedLogins == 0 && user.LockedUntil == "") {
+		return err
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = ""
+	return user.Update(s, esDocID)
+}
+
+// UnlockAccount removes the lockout and failed logins of the account with the
+// provided UUID, which is recorded in the audit log.
+func UnlockAccount(s *state.State, r *http.Request, uuid string) error {
+	user, esDocID, err := elasticsearch.QueryAuthByUUID(s, uuid)
+	if err != nil {
+		return err
+	}
+	ThrottleReset(user.UUID)
+	user.FailedLogins = 0
+	user.LockedUntil = ""
+	err = user.Update(s, esDocID)
+	if err != nil {
+		return err
+	}
+	Audit(s, r, "auth.unlock", user.UUID, "account unlocked")
+	return nil
+}
+
+// pruneThrottle forgets failed attempts older than ThrottleForget.
+func pruneThrottle() {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+	for key, a := range throttled {
+		if time.Since(a.last) > ThrottleForget {
+			delete(throttled, key)
+		}
+	}
+}
+
+// backoff returns the remaining delay of the attempts after the free attempts.
+func backoff(a *attempts, free int) time.Duration {
+	if a == nil || a.failures < free || time.Since(a.last) > ThrottleForget {
+		return 0
+	}
+	delay := ThrottleMax
+	if shift := a.failures - free; shift < 20 {
+		if d := ThrottleBase << shift; d < ThrottleMax {
+			delay = d
+		}
+	}
+	return time.Until(a.last.Add(delay))
+}
+
+// addressKey is the throttle key of the client address of the request.
+func addressKey(r *http.Request) string {
+	return "addr:" + ClientAddr(r)
+}
+
+// accountKey is the throttle key of the account.
+func accountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package auth provides the authentication state for the backend.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// TokenPrefix identifies API tokens, e.g. in secret scanners
+	TokenPrefix = "canids_"
+	// TokenSecretLength is length of API token secret
+	TokenSecretLength = 32 // bytes (256 bits)
+	// TokenMaxAge is 1 year, the longest an API token can be valid for
+	TokenMaxAge = 365 * 24 * time.Hour
+)
+
+var (
+	// errToken is the error for a malformed, unknown, expired or revoked API
+	// token.
+	errToken = errors.New("invalid API token")
+)
+
+// NewAPIToken generates a new API token. It returns the token UUID, the token
+// to hand to the client once and the hash to store, or an error.
+func NewAPIToken() (string, string, string, error) {
+	secret, err := jwtauth.GenerateSeed(TokenSecretLength)
+	if err != nil {
+		return "", "", "", err
+	}
+	id := uuid.Generate()
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return id, TokenPrefix + id + "." + encoded, hashTokenSecret(encoded), nil
+}
+
+// hashTokenSecret returns the hex encoded SHA-256 hash of an API token secret.
+// The secret is random, so it is not salted.
+func hashTokenSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// authenticateToken validates the API token from an "Authorization: Bearer"
+// header, returning the payload it authenticates as. Personal tokens act as
+// their user, restricted to the token permissions still granted by the user
+// role. Service tokens act as a service identity with the token permissions.
+func authenticateToken(s *state.State, r *http.Request, bearer string) (*jwtauth.Payload, error) {
+	// parse "canids_<uuid>.<secret>"
+	if !strings.HasPrefix(bearer, TokenPrefix) {
+		return nil, errToken
+	}
+	id, secret, ok := strings.Cut(strings.TrimPrefix(bearer, TokenPrefix), ".")
+	if !ok || id == "" || secret == "" {
+		return nil, errToken
+	}
+	token, esDocID, err := elasticsearch.QueryAPITokenByUUID(s, id)
+	if err != nil {
+		return nil, errToken
+	}
+	hash := hashTokenSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(token.Hash)) != 1 || token.Revoked {
+		return nil, errToken
+	}
+	now := time.Now()
+	expires, err := time.Parse(time.RFC3339, token.Expires)
+	if err != nil || now.After(expires) {
+		return nil, errToken
+	}
+
+	var user *jwtauth.Payload
+	switch token.Class {
+	case elasticsearch.TokenPersonal:
+		// user must still exist and be activated
+		esUser, _, err := elasticsearch.QueryAuthByUUID(s, token.User)
+		if err != nil || !esUser.Activated {
+			return nil, errToken
+		}
+		user = &jwtauth.Payload{
+			UUID:      esUser.UUID,
+			Class:     esUser.Class,
+			Name:      esUser.Name,
+			Activated: esUser.Activated,
+			Assets:    esUser.Assets,
+		}
+		granted, _ := RolePermissions(string(esUser.Class))
+		for _, permission := range token.Permissions {
+			for _, g := range granted {
+				if g == permission {
+					user.Permissions = append(user.Permissions, permission)
+					break
+				}
+			}
+		}
+	case elasticsearch.TokenService:
+		user = &jwtauth.Payload{
+			UUID:        "service:" + token.Name,
+			Class:       jwtauth.UserService,
+			Name:        token.Name,
+			Activated:   true,
+			Assets:      token.Assets,
+			Permissions: token.Permissions,
+		}
+	default:
+		return nil, errToken
+	}
+	user.ExpiresAt = expires.Unix()
+
+	// record usage, at most once per RenewAge
+	lastUsed, err := time.Parse(time.RFC3339, token.LastUsed)
+	if err != nil || now.After(lastUsed.Add(RenewAge)) {
+		token.LastUsed = now.UTC().Format(time.RFC3339)
+		token.LastAddress = ClientAddr(r)
+		err = token.Update(s, esDocID)
+		if err != nil {
+			s.Log.Error("[middleware] failed to record API token usage ", err)
+		}
+	}
+	return user, nil
+}
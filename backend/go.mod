@@ -23,6 +23,7 @@ require (
 	github.com/google/go-cmp v0.5.9 // indirect
 	github.com/klauspost/compress v1.10.3 // indirect
 	github.com/oschwald/maxminddb-golang v1.12.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.10.0 // indirect
-
+	golang.org/x/text v0.11.0 // indirect
 )
@@ -0,0 +1,421 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+// TermsPair is the number of documents with a pair of field values.
+type TermsPair struct {
+	Source      string `json:"source"`      // Source is the value of the first field
+	Destination string `json:"destination"` // Destination is the value of the second field
+	Count       int64  `json:"count"`       // Count is the number of documents with both values
+}
+
+// termsBucket is a terms aggregation bucket independent of the field type.
+type termsBucket struct {
+	Key          string
+	DocCount     int64
+	Aggregations map[string]types.Aggregate
+}
+
+// QueryTermsHistogram aggregates the documents of the index pattern in the
+// given time range into time buckets of interval seconds, split by the size
+// most common values of field. It returns the bucket times, the field values
+// and the document counts of each value per bucket or an error.
+func QueryTermsHistogram(s *state.State, indexPattern string, field string, start time.Time, end time.Time, interval int64, size int) ([]interface{}, []string, [][]interface{}, error) {
+	return QueryMetricHistogram(s, indexPattern, "", MetricCount, 0, field, start, end, interval, size)
+}
+
+// QueryMetricHistogram aggregates the documents of the index pattern in the
+// given time range into time buckets of interval seconds and computes the
+// metric over field for each bucket. percentile is only used by
+// MetricPercentile. If groupBy is not empty, a series is computed for each of
+// the size most common values of groupBy, otherwise a single series named
+// after field is returned. It returns the bucket times, the series names and
+// the values of each series per bucket (nil for an empty bucket) or an error.
+func QueryMetricHistogram(s *state.State, indexPattern string, field string, metric ViewMetric, percentile float64, groupBy string, start time.Time, end time.Time, interval int64, size int) ([]interface{}, []string, [][]interface{}, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	fields, err := aggregatableFields(s, indexPattern, field, groupBy)
+	if err != nil {
+		return []interface{}{}, []string{}, [][]interface{}{}, err
+	}
+
+	// empty buckets are kept so every series shares the same time axis
+	ts := "timestamp"
+	minDocCount := 0
+	histogram := types.Aggregations{
+		DateHistogram: &types.DateHistogramAggregation{
+			Field:         &ts,
+			FixedInterval: fmt.Sprintf("%ds", interval),
+			MinDocCount:   &minDocCount,
+			ExtendedBounds: &types.ExtendedBoundsFieldDateMath{
+				Min: start.UnixMilli(),
+				Max: end.UnixMilli(),
+			},
+		},
+	}
+	// the bucket document count is the count metric
+	if metric != MetricCount {
+		agg, err := metricAggregation(metric, field, fields[0], percentile)
+		if err != nil {
+			return []interface{}{}, []string{}, [][]interface{}{}, err
+		}
+		histogram.Aggregations = map[string]types.Aggregations{
+			"metric": agg,
+		}
+	}
+
+	aggregation := histogram
+	if groupBy != "" {
+		aggregation = types.Aggregations{
+			Terms: &types.TermsAggregation{
+				Field: &fields[1],
+				Size:  &size,
+			},
+			Aggregations: map[string]types.Aggregations{
+				"time": histogram,
+			},
+		}
+	}
+
+	queryResult, err := client.Search().Index(indexPattern).Query(timeRangeQuery(start, end)).Size(0).
+		Aggregations(map[string]types.Aggregations{
+			"series": aggregation,
+		}).Do(ctx)
+	if err != nil {
+		return []interface{}{}, []string{}, [][]interface{}{}, err
+	}
+
+	// collect the histogram of every series
+	keys := []string{}
+	histograms := []types.Aggregate{}
+	if groupBy == "" {
+		if _, ok := queryResult.Aggregations["series"]; ok {
+			keys = append(keys, field)
+			histograms = append(histograms, queryResult.Aggregations["series"])
+		}
+	} else {
+		for _, term := range termsBuckets(queryResult.Aggregations["series"]) {
+			keys = append(keys, term.Key)
+			histograms = append(histograms, term.Aggregations["time"])
+		}
+	}
+
+	// collect the union of bucket times over every series
+	values := make([]map[int64]interface{}, len(histograms))
+	times := map[int64]string{}
+	for i, histogram := range histograms {
+		values[i] = map[int64]interface{}{}
+		aggT, ok := histogram.(*types.DateHistogramAggregate)
+		if !ok {
+			continue
+		}
+		buckets, _ := aggT.Buckets.([]types.DateHistogramBucket)
+		for _, bucket := range buckets {
+			if metric == MetricCount {
+				values[i][bucket.Key] = bucket.DocCount
+			} else if bucket.DocCount > 0 {
+				values[i][bucket.Key] = metricValue(bucket.Aggregations["metric"])
+			}
+			if bucket.KeyAsString != nil {
+				times[bucket.Key] = *bucket.KeyAsString
+			} else {
+				times[bucket.Key] = time.UnixMilli(bucket.Key).UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	order := make([]int64, 0, len(times))
+	for t := range times {
+		order = append(order, t)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	// create a row of values for each series, missing counts are 0
+	xresult := []interface{}{}
+	for _, t := range order {
+		xresult = append(xresult, times[t])
+	}
+	series := make([][]interface{}, len(histograms))
+	for i := range histograms {
+		series[i] = []interface{}{}
+		for _, t := range order {
+			value, ok := values[i][t]
+			if !ok && metric == MetricCount {
+				value = int64(0)
+			}
+			series[i] = append(series[i], value)
+		}
+	}
+	return xresult, keys, series, nil
+}
+
+// QueryTermsPairs counts the documents of the index pattern in the given time
+// range for the size most common values of sourceField, and for each of them
+// the size most common values of destinationField. It returns the pairs in
+// descending count of the source value or an error.
+func QueryTermsPairs(s *state.State, indexPattern string, sourceField string, destinationField string, start time.Time, end time.Time, size int) ([]TermsPair, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	fields, err := aggregatableFields(s, indexPattern, sourceField, destinationField)
+	if err != nil {
+		return []TermsPair{}, err
+	}
+
+	queryResult, err := client.Search().Index(indexPattern).Query(timeRangeQuery(start, end)).Size(0).
+		Aggregations(map[string]types.Aggregations{
+			"source": {
+				Terms: &types.TermsAggregation{
+					Field: &fields[0],
+					Size:  &size,
+				},
+				Aggregations: map[string]types.Aggregations{
+					"destination": {
+						Terms: &types.TermsAggregation{
+							Field: &fields[1],
+							Size:  &size,
+						},
+					},
+				},
+			},
+		}).Do(ctx)
+	if err != nil {
+		return []TermsPair{}, err
+	}
+
+	pairs := []TermsPair{}
+	for _, source := range termsBuckets(queryResult.Aggregations["source"]) {
+		for _, destination := range termsBuckets(source.Aggregations["destination"]) {
+			pairs = append(pairs, TermsPair{
+				Source:      source.Key,
+				Destination: destination.Key,
+				Count:       destination.DocCount,
+			})
+		}
+	}
+	return pairs, nil
+}
+
+// QueryTopTerms counts the documents of the index pattern in the given time
+// range for the size most common combinations of values of fields. It returns
+// an array of values for each field followed by an array of counts, or an
+// error.
+func QueryTopTerms(s *state.State, indexPattern string, fields []string, start time.Time, end time.Time, size int) ([][]interface{}, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	result := make([][]interface{}, len(fields)+1)
+	for i := range result {
+		result[i] = []interface{}{}
+	}
+	keywords, err := aggregatableFields(s, indexPattern, fields...)
+	if err != nil {
+		return result, err
+	}
+
+	// multi_terms requires at least two fields
+	agg := types.Aggregations{}
+	if len(keywords) == 1 {
+		agg.Terms = &types.TermsAggregation{
+			Field: &keywords[0],
+			Size:  &size,
+		}
+	} else {
+		lookups := make([]types.MultiTermLookup, len(keywords))
+		for i, field := range keywords {
+			lookups[i] = types.MultiTermLookup{Field: field}
+		}
+		agg.MultiTerms = &types.MultiTermsAggregation{
+			Terms: lookups,
+			Size:  &size,
+		}
+	}
+
+	queryResult, err := client.Search().Index(indexPattern).Query(timeRangeQuery(start, end)).Size(0).
+		Aggregations(map[string]types.Aggregations{
+			"top": agg,
+		}).Do(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	count := len(fields)
+	if multi, ok := queryResult.Aggregations["top"].(*types.MultiTermsAggregate); ok {
+		buckets, _ := multi.Buckets.([]types.MultiTermsBucket)
+		for _, bucket := range buckets {
+			for i := range fields {
+				var key interface{}
+				if i < len(bucket.Key) {
+					key = bucket.Key[i]
+				}
+				result[i] = append(result[i], key)
+			}
+			result[count] = append(result[count], bucket.DocCount)
+		}
+		return result, nil
+	}
+	for _, bucket := range termsBuckets(queryResult.Aggregations["top"]) {
+		result[0] = append(result[0], bucket.Key)
+		result[count] = append(result[count], bucket.DocCount)
+	}
+	return result, nil
+}
+
+// QueryStatInRange computes the metric over field for the documents of the
+// index pattern in the given time range. percentile is only used by
+// MetricPercentile. It returns the value or an error.
+func QueryStatInRange(s *state.State, indexPattern string, field string, metric ViewMetric, percentile float64, start time.Time, end time.Time) (interface{}, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	fields, err := aggregatableFields(s, indexPattern, field)
+	if err != nil {
+		return nil, err
+	}
+	agg, err := metricAggregation(metric, field, fields[0], percentile)
+	if err != nil {
+		return nil, err
+	}
+
+	queryResult, err := client.Search().Index(indexPattern).Query(timeRangeQuery(start, end)).Size(0).
+		Aggregations(map[string]types.Aggregations{
+			"stat": agg,
+		}).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return metricValue(queryResult.Aggregations["stat"]), nil
+}
+
+// metricAggregation returns the aggregation computing metric over field.
+// Unique counts are computed over the keyword of the field, counts over the
+// timestamp so every document is counted.
+func metricAggregation(metric ViewMetric, field string, keyword string, percentile float64) (types.Aggregations, error) {
+	agg := types.Aggregations{}
+	switch metric {
+	case MetricCount:
+		ts := "timestamp"
+		agg.ValueCount = &types.ValueCountAggregation{Field: &ts}
+	case MetricSum:
+		agg.Sum = &types.SumAggregation{Field: &field}
+	case MetricAvg:
+		agg.Avg = &types.AverageAggregation{Field: &field}
+	case MetricMin:
+		agg.Min = &types.MinAggregation{Field: &field}
+	case MetricMax:
+		agg.Max = &types.MaxAggregation{Field: &field}
+	case MetricCardinality:
+		agg.Cardinality = &types.CardinalityAggregation{Field: &keyword}
+	case MetricPercentile:
+		keyed := false
+		agg.Percentiles = &types.PercentilesAggregation{
+			Field:    &field,
+			Percents: []types.Float64{types.Float64(percentile)},
+			Keyed:    &keyed,
+		}
+	default:
+		return agg, fmt.Errorf("metric: unknown metric '%s'", metric)
+	}
+	return agg, nil
+}
+
+// metricValue returns the value of a metric aggregation. It returns nil if the
+// aggregation is missing, which probably means the asset doesnt have any
+// indices yet.
+func metricValue(agg types.Aggregate) interface{} {
+	switch m := agg.(type) {
+	case *types.ValueCountAggregate:
+		return float64(m.Value)
+	case *types.SumAggregate:
+		return float64(m.Value)
+	case *types.AvgAggregate:
+		return float64(m.Value)
+	case *types.MinAggregate:
+		return float64(m.Value)
+	case *types.MaxAggregate:
+		return float64(m.Value)
+	case *types.CardinalityAggregate:
+		return float64(m.Value)
+	case *types.TDigestPercentilesAggregate:
+		items, _ := m.Values.([]types.ArrayPercentilesItem)
+		if len(items) > 0 {
+			return float64(items[0].Value)
+		}
+	}
+	return nil
+}
+
+// aggregatableFields returns the names to aggregate the fields of the index
+// pattern on. Text fields are aggregated on their keyword sub-field.
+func aggregatableFields(s *state.State, indexPattern string, fields ...string) ([]string, error) {
+	mapping, err := GetDataMapping(s, indexPattern)
+	if err != nil {
+		return nil, err
+	}
+	fieldTypes := make(map[string]string, len(mapping))
+	for _, fieldProp := range mapping {
+		fieldTypes[fieldProp.Name] = fieldProp.Type
+	}
+
+	out := make([]string, len(fields))
+	for i, field := range fields {
+		if fieldTypes[field] == "text" {
+			field = fmt.Sprintf("%s.keyword", field)
+		}
+		out[i] = field
+	}
+	return out, nil
+}
+
+// termsBuckets returns the buckets of a string, long or double terms
+// aggregation. Any other aggregation returns no buckets.
+func termsBuckets(agg types.Aggregate) []termsBucket {
+	out := []termsBucket{}
+	switch terms := agg.(type) {
+	case *types.StringTermsAggregate:
+		buckets, _ := terms.Buckets.([]types.StringTermsBucket)
+		for _, bucket := range buckets {
+			out = append(out, termsBucket{fmt.Sprintf("%v", bucket.Key), bucket.DocCount, bucket.Aggregations})
+		}
+	case *types.LongTermsAggregate:
+		buckets, _ := terms.Buckets.([]types.LongTermsBucket)
+		for _, bucket := range buckets {
+			key := strconv.FormatInt(bucket.Key, 10)
+			if bucket.KeyAsString != nil {
+				key = *bucket.KeyAsString
+			}
+			out = append(out, termsBucket{key, bucket.DocCount, bucket.Aggregations})
+		}
+	case *types.DoubleTermsAggregate:
+		buckets, _ := terms.Buckets.([]types.DoubleTermsBucket)
+		for _, bucket := range buckets {
+			key := strconv.FormatFloat(float64(bucket.Key), 'f', -1, 64)
+			if bucket.KeyAsString != nil {
+				key = *bucket.KeyAsString
+			}
+			out = append(out, termsBucket{key, bucket.DocCount, bucket.Aggregations})
+		}
+	}
+	return out
+}
+
+// timeRangeQuery returns a query matching documents with a timestamp in the
+// given time range.
+func timeRangeQuery(start time.Time, end time.Time) *types.Query {
+	return &types.Query{
+		Range: map[string]types.RangeQuery{
+			"timestamp": types.DateRangeQuery{
+				From: start.Format(time.RFC3339),
+				To:   end.Format(time.RFC3339),
+			},
+		},
+	}
+}
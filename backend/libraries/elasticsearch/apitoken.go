@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexAPIToken = "apitoken"
+)
+
+// TokenClass indicates who an API token authenticates as.
+type TokenClass string
+
+const (
+	// TokenPersonal authenticates as the user that created it
+	TokenPersonal TokenClass = "personal"
+	// TokenService authenticates as a service identity named after the token
+	TokenService TokenClass = "service"
+)
+
+var (
+	// TokenClassMap maps the string representation back to TokenClass
+	TokenClassMap = map[string]TokenClass{
+		"personal": TokenPersonal,
+		"service":  TokenService,
+	}
+)
+
+// DocumentAPIToken represents a document from the "apitoken" index. Only the
+// SHA-256 hash of the token secret is stored.
+type DocumentAPIToken struct {
+	UUID        string               `json:"uuid"`        // UUID is unique token identifier
+	Name        string               `json:"name"`        // Name describes the token
+	Class       TokenClass           `json:"class"`       // Class is the token class
+	User        string               `json:"user"`        // User is the UUID of the user that created the token
+	Hash        string               `json:"hash"`        // Hash is the hex encoded SHA-256 hash of the token secret
+	Permissions []jwtauth.Permission `json:"permissions"` // Permissions is a list of permissions granted to the token
+	Assets      []string             `json:"assets"`      // Assets restricts a service token to the asset IDs, empty is all
+	Created     string               `json:"created"`     // Created is when the token was created
+	Expires     string               `json:"expires"`     // Expires is when the token expires
+	LastUsed    string               `json:"lastUsed"`    // LastUsed is the last time the token authenticated a request
+	LastAddress string               `json:"lastAddress"` // LastAddress is the client address of the last request
+	Revoked     bool                 `json:"revoked"`     // Revoked indicates if the token was revoked
+}
+
+// Index will attempt to index the document to the "apitoken" index. It will
+// return the newly created document ID or an error.
+func (d *DocumentAPIToken) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexAPIToken).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// Update will attempt to update the document in the "apitoken" index with the
+// provided Elasticsearch document ID. It will return an error if the
+// transaction can not be performed.
+func (d *DocumentAPIToken) Update(s *state.State, esDocID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(indexAPIToken, esDocID).
+		Doc(map[string]interface{}{
+			"uuid":        d.UUID,
+			"name":        d.Name,
+			"class":       d.Class,
+			"user":        d.User,
+			"hash":        d.Hash,
+			"permissions": d.Permissions,
+			"assets":      d.Assets,
+			"created":     d.Created,
+			"expires":     d.Expires,
+			"lastUsed":    d.LastUsed,
+			"lastAddress": d.LastAddress,
+			"revoked":     d.Revoked,
+		}).DetectNoop(true).Do(ctx)
+	return err
+}
+
+// QueryAPITokenByUUID will attempt to query the "apitoken" index for a token,
+// returning a DocumentAPIToken entry and document ID string. It may return an
+// error if the query cannot be completed or if the token is not found.
+func QueryAPITokenByUUID(s *state.State, uuid string) (DocumentAPIToken, string, error) {
+	var d DocumentAPIToken
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for token with provided uuid
+	result, err := client.Search().Index(indexAPIToken).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"uuid.keyword": {Value: uuid},
+		},
+	}).IgnoreUnavailable(true).Do(ctx)
+	if err != nil {
+		return d, "", err
+	}
+	// ensure token was returned
+	if result.Hits.Total.Value == 0 {
+		return d, "", errors.New("apitoken: no document with uuid found")
+	}
+	// select + parse token into DocumentAPIToken
+	token := result.Hits.Hits[0]
+	err = json.Unmarshal(token.Source_, &d)
+	if err != nil {
+		return d, "", err
+	}
+	// successful query
+	return d, token.Id_, nil
+}
+
+// AllAPIToken will attempt to query the "apitoken" index and return the tokens
+// that are not revoked, most recent first. If user is not empty, only the
+// tokens created by that user are returned. It may return an error if the
+// query cannot be completed.
+func AllAPIToken(s *state.State, user string) ([]DocumentAPIToken, error) {
+	out := []DocumentAPIToken{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	filters := []types.Query{
+		{Term: map[string]types.TermQuery{"revoked": {Value: false}}},
+	}
+	if user != "" {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"user.keyword": {Value: user}}})
+	}
+	results, err := client.Search().Index(indexAPIToken).Query(&types.Query{
+		Bool: &types.BoolQuery{
+			Filter: filters,
+		},
+	}).Sort(types.SortOptions{
+		SortOptions: map[string]types.FieldSort{
+			"created": {Order: &sortorder.Desc},
+		},
+	}).IgnoreUnavailable(true).Size(1000).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// parse tokens into DocumentAPIToken, append to out
+	for _, token := range results.Hits.Hits {
+		var d DocumentAPIToken
+		err := json.Unmarshal(token.Source_, &d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexAssetGroup = "assetgroup"
+)
+
+// DocumentAssetGroup represents a document from the "assetgroup" index. Assets
+// are added to a group from their metadata.
+type DocumentAssetGroup struct {
+	UUID        string `json:"uuid"`        // UUID is unique asset group identifier
+	Name        string `json:"name"`        // Name is the name of the asset group
+	Description string `json:"description"` // Description describes the asset group
+}
+
+// Index will attempt to index the document to the "assetgroup" index. It will
+// return the newly created document ID or an error.
+func (d *DocumentAssetGroup) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexAssetGroup).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// Update will attempt to update the document in the "assetgroup" index with
+// the provided Elasticsearch document ID. It will return an error if the
+// transaction can not be performed.
+func (d *DocumentAssetGroup) Update(s *state.State, esDocID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(indexAssetGroup, esDocID).
+		Doc(map[string]interface{}{
+			"uuid":        d.UUID,
+			"name":        d.Name,
+			"description": d.Description,
+		}).DetectNoop(true).Refresh(refresh.True).Do(ctx)
+	return err
+}
+
+// QueryAssetGroupByUUID will attempt to query the "assetgroup" index for an
+// asset group, returning a DocumentAssetGroup entry and document ID string. It
+// may return an error if the query cannot be completed or if the group is not
+// found.
+func QueryAssetGroupByUUID(s *state.State, uuid string) (DocumentAssetGroup, string, error) {
+	var d DocumentAssetGroup
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for asset group with provided uuid
+	result, err := client.Search().Index(indexAssetGroup).IgnoreUnavailable(true).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"uuid.keyword": {Value: uuid},
+		},
+	}).Do(ctx)
+	if err != nil {
+		return d, "", err
+	}
+	// ensure asset group was returned
+	if result.Hits.Total.Value == 0 {
+		return d, "", errors.New("assetgroup: no document with uuid found")
+	}
+	// select + parse asset group into DocumentAssetGroup
+	group := result.Hits.Hits[0]
+	err = json.Unmarshal(group.Source_, &d)
+	if err != nil {
+		return d, "", err
+	}
+	// successful query
+	return d, group.Id_, nil
+}
+
+// DeleteAssetGroupByUUID will attempt to delete a document in the "assetgroup"
+// index with the specified UUID. It may return an error if the deletion cannot
+// be completed.
+func DeleteAssetGroupByUUID(s *state.State, uuid string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.DeleteByQuery(indexAssetGroup).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"uuid.keyword": {Value: uuid},
+		},
+	}).Refresh(true).Do(ctx)
+	return err
+}
+
+// AllAssetGroup will attempt to query the "assetgroup" index and return all
+// asset groups in the system. It may return an error if the query cannot be
+// completed.
+func AllAssetGroup(s *state.State) ([]DocumentAssetGroup, error) {
+	out := []DocumentAssetGroup{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for all documents
+	results, err := client.Search().Index(indexAssetGroup).IgnoreUnavailable(true).Query(&types.Query{
+		MatchAll: &types.MatchAllQuery{},
+	}).Size(1000).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// parse asset groups into DocumentAssetGroup, append to out
+	for _, group := range results.Hits.Hits {
+		var d DocumentAssetGroup
+		err := json.Unmarshal(group.Source_, &d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexAudit = "audit"
+)
+
+// DocumentAudit represents a document from the "audit" index. An entry is
+// written for every administrative and security relevant action. Entries form
+// a hash chain: the document ID is the sequence number and every entry includes
+// the hash of the previous entry.
+type DocumentAudit struct {
+	Sequence int64         `json:"sequence"` // Sequence is the position of the entry in the chain, starting at 1
+	UUID     string        `json:"uuid"`     // UUID is unique entry identifier
+	Time     string        `json:"time"`     // Time is when the action occurred
+	Actor    string        `json:"actor"`    // Actor is the UUID of the user performing the action, empty if unauthenticated
+	Action   string        `json:"action"`   // Action is the type of action, such as "user.update"
+	Target   string        `json:"target"`   // Target is the identifier of the object acted on
+	Address  string        `json:"address"`  // Address is the client address of the request
+	Request  string        `json:"request"`  // Request is the request UUID from the logging context
+	Message  string        `json:"message"`  // Message describes the action
+	Changes  []AuditChange `json:"changes"`  // Changes are the fields modified by the action
+	PrevHash string        `json:"prevHash"` // PrevHash is the hash of the previous entry, empty for the first entry
+	Hash     string        `json:"hash"`     // Hash is the hash of this entry including PrevHash
+}
+
+// AuditChange is the before and after value of a modified field, JSON encoded.
+type AuditChange struct {
+	Field  string `json:"field"`  // Field is the name of the modified field
+	Before string `json:"before"` // Before is the value before the action, empty if added
+	After  string `json:"after"`  // After is the value after the action, empty if removed
+}
+
+// AuditFilter selects entries from the "audit" index. Empty fields match every
+// entry.
+type AuditFilter struct {
+	Actor  string // Actor is the UUID of the user performing the action
+	Action string // Action is the type of action
+	Target string // Target is the identifier of the object acted on
+	From   string // From is the earliest time of the entries
+	To     string // To is the latest time of the entries
+	Size   int    // Size is the maximum number of entries returned
+}
+
+// Create will attempt to create the document in the "audit" index with its
+// sequence number as document ID. It will return ErrAuditConflict if an entry
+// with the sequence number already exists, or another error.
+func (d *DocumentAudit) Create(s *state.State) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Create(indexAudit, strconv.FormatInt(d.Sequence, 10)).Document(d).Refresh(refresh.True).Do(ctx)
+	var esErr *types.ElasticsearchError
+	if errors.As(err, &esErr) && esErr.Status == http.StatusConflict {
+		return ErrAuditConflict
+	}
+	return err
+}
+
+// ErrAuditConflict is the error for creating an entry whose sequence number is
+// already taken.
+var ErrAuditConflict = errors.New("audit: sequence number already exists")
+
+// LastAudit will attempt to query the "audit" index for the entry with the
+// highest sequence number. It returns an empty entry if the index is empty or
+// missing, or an error if the query cannot be completed.
+func LastAudit(s *state.State) (DocumentAudit, error) {
+	var d DocumentAudit
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Search().Index(indexAudit).Sort(types.SortOptions{
+		SortOptions: map[string]types.FieldSort{
+			"sequence": {Order: &sortorder.Desc},
+		},
+	}).IgnoreUnavailable(true).Size(1).Do(ctx)
+	if err != nil {
+		return d, err
+	}
+	if len(result.Hits.Hits) == 0 {
+		return d, nil
+	}
+	err = json.Unmarshal(result.Hits.Hits[0].Source_, &d)
+	return d, err
+}
+
+// QueryAudit will attempt to query the "audit" index for the entries matching
+// the filter, most recent first. It returns the entries and the total number of
+// matching entries, or an error if the query cannot be completed.
+func QueryAudit(s *state.State, filter AuditFilter) ([]DocumentAudit, int64, error) {
+	filters := []types.Query{}
+	for field, value := range map[string]string{
+		"actor.keyword":  filter.Actor,
+		"action.keyword": filter.Action,
+		"target.keyword": filter.Target,
+	} {
+		if value != "" {
+			filters = append(filters, types.Query{Term: map[string]types.TermQuery{field: {Value: value}}})
+		}
+	}
+	if filter.From != "" || filter.To != "" {
+		timeRange := types.DateRangeQuery{}
+		if filter.From != "" {
+			timeRange.Gte = &filter.From
+		}
+		if filter.To != "" {
+			timeRange.Lte = &filter.To
+		}
+		filters = append(filters, types.Query{Range: map[string]types.RangeQuery{"time": timeRange}})
+	}
+	return searchAudit(s, filters, sortorder.Desc, filter.Size)
+}
+
+// AuditAfter will attempt to query the "audit" index for up to size entries
+// following the provided sequence number, in chain order. It may return an
+// error if the query cannot be completed.
+func AuditAfter(s *state.State, sequence int64, size int) ([]DocumentAudit, error) {
+	after := types.Float64(sequence)
+	entries, _, err := searchAudit(s, []types.Query{
+		{Range: map[string]types.RangeQuery{"sequence": types.NumberRangeQuery{Gt: &after}}},
+	}, sortorder.Asc, size)
+	return entries, err
+}
+
+// searchAudit returns up to size entries matching every filter, sorted by
+// sequence number, and the total number of matching entries. A missing index
+// returns no entries.
+func searchAudit(s *state.State, filters []types.Query, order sortorder.SortOrder, size int) ([]DocumentAudit, int64, error) {
+	out := []DocumentAudit{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	results, err := client.Search().Index(indexAudit).Query(&types.Query{
+		Bool: &types.BoolQuery{
+			Filter: filters,
+		},
+	}).Sort(types.SortOptions{
+		SortOptions: map[string]types.FieldSort{
+			"sequence": {Order: &order},
+		},
+	}).TrackTotalHits(true).IgnoreUnavailable(true).Size(size).Do(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	// parse entries into DocumentAudit, append to out
+	for _, entry := range results.Hits.Hits {
+		var d DocumentAudit
+		err := json.Unmarshal(entry.Source_, &d)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, d)
+	}
+	var total int64
+	if results.Hits.Total != nil {
+		total = results.Hits.Total.Value
+	}
+	return out, total, nil
+}
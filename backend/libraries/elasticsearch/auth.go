@@ -25,6 +25,16 @@ type DocumentAuth struct {
 	Class     jwtauth.UserClass `json:"class"`     // Class is user class
 	Name      string            `json:"name"`      // Name is the user's name
 	Activated bool              `json:"activated"` // Activated if account is active
+	SSO       bool              `json:"sso"`       // SSO if the account was provisioned by single sign-on
+	Assets    []string          `json:"assets"`    // Assets are the asset IDs a standard user is granted, "*" grants all
+
+	TOTPSecret    string   `json:"totpSecret"`    // TOTPSecret is the base32 TOTP secret, set on enrollment
+	TOTPEnabled   bool     `json:"totpEnabled"`   // TOTPEnabled indicates if enrollment was confirmed and login requires a code
+	TOTPLastStep  int64    `json:"totpLastStep"`  // TOTPLastStep is the time step of the last accepted code, to prevent replay
+	RecoveryCodes []string `json:"recoveryCodes"` // RecoveryCodes are salted hashes of the unused recovery codes
+
+	FailedLogins int    `json:"failedLogins"` // FailedLogins is the number of consecutive failed logins
+	LockedUntil  string `json:"lockedUntil"`  // LockedUntil is when the lockout after too many failed logins ends, empty if not locked
 }
 
 // Index will attempt to index the document to the "auth" index. It will return
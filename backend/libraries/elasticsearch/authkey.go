@@ -0,0 +1,92 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexAuthKey = "authkey"
+)
+
+// DocumentAuthKey represents a document from the "authkey" index. Every
+// backend signs and validates tokens with the keys in this index.
+type DocumentAuthKey struct {
+	UUID    string `json:"uuid"`    // UUID is the key identifier used as the token "kid"
+	Secret  string `json:"secret"`  // Secret is the base64 encoded HMAC secret
+	Created string `json:"created"` // Created is when the key was generated
+	Retired string `json:"retired"` // Retired is when the key stopped signing tokens, empty if current
+}
+
+// Index will attempt to index the document to the "authkey" index. It will
+// return the newly created document ID or an error.
+func (d *DocumentAuthKey) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexAuthKey).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// Update will attempt to update the document in the "authkey" index with the
+// provided Elasticsearch document ID. It will return an error if the
+// transaction can not be performed.
+func (d *DocumentAuthKey) Update(s *state.State, esDocID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(indexAuthKey, esDocID).
+		Doc(map[string]interface{}{
+			"uuid":    d.UUID,
+			"secret":  d.Secret,
+			"created": d.Created,
+			"retired": d.Retired,
+		}).DetectNoop(true).Do(ctx)
+	return err
+}
+
+// DeleteAuthKeyByUUID will attempt to delete a document in the "authkey" index
+// with the specified UUID. It may return an error if the deletion cannot be
+// completed.
+func DeleteAuthKeyByUUID(s *state.State, uuid string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.DeleteByQuery(indexAuthKey).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"uuid.keyword": {Value: uuid},
+		},
+	}).Do(ctx)
+	return err
+}
+
+// AllAuthKey will attempt to query the "authkey" index and return all keys with
+// their document IDs. A missing index returns no keys. It may return an error
+// if the query cannot be completed.
+func AllAuthKey(s *state.State) ([]DocumentAuthKey, []string, error) {
+	out, ids := []DocumentAuthKey{}, []string{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for all documents
+	results, err := client.Search().Index(indexAuthKey).Query(&types.Query{
+		MatchAll: &types.MatchAllQuery{},
+	}).IgnoreUnavailable(true).Size(1000).Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// parse keys into DocumentAuthKey, append to out
+	for _, key := range results.Hits.Hits {
+		var d DocumentAuthKey
+		err := json.Unmarshal(key.Source_, &d)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, d)
+		ids = append(ids, key.Id_)
+	}
+	return out, ids, nil
+}
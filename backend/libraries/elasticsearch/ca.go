@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexCA = "ca"
+	// docCA is the document ID of the ingestion certificate authority, fixed
+	// so that backends generating it concurrently conflict
+	docCA = "ingestion"
+)
+
+var (
+	// ErrCANotFound is the error for a certificate authority that has not been
+	// generated yet.
+	ErrCANotFound = errors.New("ca: no certificate authority found")
+	// ErrCAConflict is the error for creating a certificate authority when
+	// another backend created it first.
+	ErrCAConflict = errors.New("ca: certificate authority already exists")
+)
+
+// DocumentCA represents a document from the "ca" index. Every backend issues
+// ingestion client certificates with the certificate authority in this index.
+type DocumentCA struct {
+	Certificate string `json:"certificate"` // Certificate is the PEM encoded CA certificate
+	Key         string `json:"key"`         // Key is the PEM encoded CA private key
+	Created     string `json:"created"`     // Created is when the certificate authority was generated
+}
+
+// Create will attempt to create the document in the "ca" index. It will return
+// ErrCAConflict if the certificate authority already exists, or another error.
+func (d *DocumentCA) Create(s *state.State) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Create(indexCA, docCA).Document(d).Refresh(refresh.True).Do(ctx)
+	var esErr *types.ElasticsearchError
+	if errors.As(err, &esErr) && esErr.Status == http.StatusConflict {
+		return ErrCAConflict
+	}
+	return err
+}
+
+// QueryCA will attempt to query the "ca" index for the certificate authority.
+// It will return ErrCANotFound if the certificate authority or the index is
+// missing, or an error if the query cannot be completed.
+func QueryCA(s *state.State) (DocumentCA, error) {
+	var d DocumentCA
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Get(indexCA, docCA).Do(ctx)
+	var esErr *types.ElasticsearchError
+	if errors.As(err, &esErr) && esErr.Status == http.StatusNotFound {
+		return d, ErrCANotFound
+	}
+	if err != nil {
+		return d, err
+	}
+	if !result.Found {
+		return d, ErrCANotFound
+	}
+	err = json.Unmarshal(result.Source_, &d)
+	return d, err
+}
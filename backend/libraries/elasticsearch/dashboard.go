@@ -36,10 +36,11 @@ var (
 
 // DocumentDashboard represents a document from the "dashboard" index.
 type DocumentDashboard struct {
-	UUID  string      `json:"uuid"`  // UUID is unique dashboard identifier
-	Name  string      `json:"name"`  // Name is dashboard name
-	Views []string    `json:"views"` // Views is a list of views on the dashboard
-	Sizes []SizeClass `json:"sizes"` // Sizes is a list of sizes corresponding to each view
+	UUID   string      `json:"uuid"`   // UUID is unique dashboard identifier
+	Name   string      `json:"name"`   // Name is dashboard name
+	Views  []string    `json:"views"`  // Views is a list of views on the dashboard
+	Sizes  []SizeClass `json:"sizes"`  // Sizes is a list of sizes corresponding to each view
+	Assets []string    `json:"assets"` // Assets restricts the views on the dashboard to the asset IDs, empty is all
 }
 
 // Index will attempt to index the document to the "dashboard" index. It will
@@ -60,10 +61,11 @@ func (d *DocumentDashboard) Update(s *state.State, esDocID string) error {
 	client, ctx := s.Elastic, s.ElasticCtx
 	_, err := client.Update(indexDashboard, esDocID).
 		Doc(map[string]interface{}{
-			"uuid":  d.UUID,
-			"name":  d.Name,
-			"views": d.Views,
-			"sizes": d.Sizes,
+			"uuid":   d.UUID,
+			"name":   d.Name,
+			"views":  d.Views,
+			"sizes":  d.Sizes,
+			"assets": d.Assets,
 		}).DetectNoop(true).Do(ctx)
 	return err
 }
@@ -9,11 +9,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
 	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/metrics"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
 
@@ -31,6 +34,16 @@ type DataField struct {
 	Type string `json:"type"`
 }
 
+var (
+	// indexDuration is the latency of indexing a log line by kind, "data" or
+	// "alarm"
+	indexDuration = metrics.NewHistogram("canids_elasticsearch_index_duration_seconds",
+		"Time to index a log line in Elasticsearch.", nil, "kind")
+	// indexFailures counts log lines that failed to index by kind
+	indexFailures = metrics.NewCounter("canids_elasticsearch_index_failures_total",
+		"Log lines that failed to index in Elasticsearch.", "kind")
+)
+
 var alarmFields = []string{"uid", "host", "timestamp", "id_orig_h", "id_orig_p", "id_orig_h_pos", "id_resp_h", "id_resp_p", "id_resp_h_pos"}
 
 // Alarm contains the data for an alarm.
@@ -44,22 +57,48 @@ type Alarm struct {
 	DestinationIP     string   `json:"id_resp_h"`
 	DestinationPort   int      `json:"id_resp_p"`
 	DestinationAlarms []string `json:"id_resp_h_pos"`
+
+	Index     string         `json:"index"`              // Index is the Elasticsearch index of the alarm
+	ID        string         `json:"id"`                 // ID is the Elasticsearch document ID of the alarm
+	Triage    *AlarmTriage   `json:"triage,omitempty"`   // Triage is the latest triage of the alarm, nil if it was never triaged
+	Asset     string         `json:"asset"`              // Asset is the asset ID of the alarm
+	AssetName string         `json:"assetName"`          // AssetName is the name of the ingestion client of the asset
+	Metadata  *AssetMetadata `json:"metadata,omitempty"` // Metadata describes the asset, nil if it is not known
 }
 
+// AlarmTriage is the triage of an alarm, stored in the alarm document.
+type AlarmTriage struct {
+	Status string `json:"status"` // Status is "open", "acknowledged", "resolved" or "false_positive"
+	User   string `json:"user"`   // User is the UUID of the user who triaged the alarm
+	Time   string `json:"time"`   // Time is the RFC3339 time of the triage
+	Note   string `json:"note"`   // Note is an optional comment
+}
+
+// ErrAlarmNotFound is returned when the alarm to triage does not exist.
+var ErrAlarmNotFound = errors.New("alarm: alarm not found")
+
 // IndexPayload attempts to index the provided payload under the index name. It
 // will return the newly created document ID or an error.
 func IndexPayload(s *state.State, indexName string, payload []byte) (string, error) {
+	kind := "data"
+	if strings.Contains(indexName, ".alarm-") {
+		kind = "alarm"
+	}
+	start := time.Now()
 	client, ctx := s.Elastic, s.ElasticCtx
 	result, err := client.Index(indexName).Raw(bytes.NewReader(payload)).Do(ctx)
+	indexDuration.Observe(time.Since(start).Seconds(), kind)
 	if err != nil {
+		indexFailures.Inc(kind)
 		return "", err
 	}
 	return result.Id_, nil
 }
 
-// GetAllDataMapping will fetch all data mappings. It returns a list of
-// fields+type for each index type, or an error.
-func GetAllDataMapping(s *state.State) ([]IndexDataField, error) {
+// GetAllDataMapping will fetch all data mappings of the provided asset IDs (nil
+// for every asset). It returns a list of fields+type for each index type, or an
+// error.
+func GetAllDataMapping(s *state.State, assets []string) ([]IndexDataField, error) {
 	out := make([]IndexDataField, 0)
 
 	// fetch all indexes
@@ -77,7 +116,11 @@ func GetAllDataMapping(s *state.State) ([]IndexDataField, error) {
 			// ingore non-data files
 			continue
 		}
-		prefix := fmt.Sprintf("data-%s", parts[1])
+		// ignore assets that are not permitted
+		if !AssetPermitted(parts[2], assets) {
+			continue
+		}
+		prefix := parts[1]
 		// check if in prefix map
 		_, ok := prefixes[prefix]
 		if !ok {
@@ -88,13 +131,17 @@ func GetAllDataMapping(s *state.State) ([]IndexDataField, error) {
 
 	// iterate over all prefixes
 	for index := range prefixes {
-		field, err := GetDataMapping(s, index)
+		pattern, err := DataIndexPattern(index, assets)
+		if err != nil {
+			continue
+		}
+		field, err := GetDataMapping(s, pattern)
 		if err != nil {
 			// index does not have a document, skip
 			continue
 		}
 		out = append(out, IndexDataField{
-			Index:  strings.Split(index, "-")[1],
+			Index:  index,
 			Fields: field,
 		})
 	}
@@ -119,14 +166,14 @@ func GetIndexes(s *state.State) ([]string, error) {
 	return out, nil
 }
 
-// GetDataMapping queries for the latest document and fetches the mapping for
-// the document. It returns a list of field names and types in the mapping or an
-// error.
-func GetDataMapping(s *state.State, indexPrefix string) ([]DataField, error) {
+// GetDataMapping queries the index pattern for the latest document and fetches
+// the mapping for the document. It returns a list of field names and types in
+// the mapping or an error.
+func GetDataMapping(s *state.State, indexPattern string) ([]DataField, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
 	// Get latest doc
-	latestDoc, err := client.Search().Index(indexPrefix + "*").
+	latestDoc, err := client.Search().Index(indexPattern).
 		Query(&types.Query{
 			MatchAll: &types.MatchAllQuery{},
 		}).
@@ -171,9 +218,9 @@ func GetDataMapping(s *state.State, indexPrefix string) ([]DataField, error) {
 	return fields, nil
 }
 
-// ListDataAssets queries all indexes to fetch the asset names. It returns a
-// list of assets or an error.
-func ListDataAssets(s *state.State) ([]string, error) {
+// ListDataAssets queries all indexes to fetch the asset names of the provided
+// asset IDs (nil for every asset). It returns a list of assets or an error.
+func ListDataAssets(s *state.State, assets []string) ([]string, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
 	// query for all index names
@@ -188,7 +235,9 @@ func ListDataAssets(s *state.State) ([]string, error) {
 			splitIndexName := strings.Split(*index.Index, "-")
 			if len(splitIndexName) == 4 {
 				assetName := splitIndexName[2]
-				assetNameSet[assetName] = true
+				if AssetPermitted(assetName, assets) {
+					assetNameSet[assetName] = true
+				}
 			} else {
 				//TODO(Jon): error?
 			}
@@ -202,8 +251,9 @@ func ListDataAssets(s *state.State) ([]string, error) {
 	return result, nil
 }
 
-// get alarms for a given asset in a given time range from a
-func GetAlarms(s *state.State, indices []string, sources []string, destinations []string, start time.Time, end time.Time, size int, from int, sourceIP string, destIP string) ([]Alarm, int, error) {
+// get alarms for a given asset in a given time range from a, restricted to the
+// provided asset IDs (nil for every asset)
+func GetAlarms(s *state.State, indices []string, assets []string, sources []string, destinations []string, start time.Time, end time.Time, size int, from int, sourceIP string, destIP string) ([]Alarm, int, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
 	// return empty array if no sources or indices
@@ -222,7 +272,11 @@ func GetAlarms(s *state.State, indices []string, sources []string, destinations
 	}
 
 	for i, index := range indices {
-		indices[i] = fmt.Sprintf("data-%s-*", index)
+		pattern, err := DataIndexPattern(index, assets)
+		if err != nil {
+			return []Alarm{}, 0, err
+		}
+		indices[i] = pattern
 	}
 
 	r := types.Query{
@@ -302,13 +356,42 @@ func GetAlarms(s *state.State, indices []string, sources []string, destinations
 		if err != nil {
 			return alarms, 0, err
 		}
+		alarm.Asset, _ = AlarmAsset(hit.Index_)
+		alarm.Index = hit.Index_
+		alarm.ID = hit.Id_
 		alarms = append(alarms, alarm)
 	}
 
 	return alarms, int(queryResult.Hits.Total.Value), nil
 }
 
-func QueryDataInRangeAggregated(s *state.State, indexPrefix string, xField string, yField string, start time.Time, end time.Time, interval int64) ([]interface{}, []interface{}, error) {
+// AlarmAsset returns the asset ID of the alarm index and true, or false if the
+// name is not an alarm index.
+func AlarmAsset(index string) (string, bool) {
+	// pattern data-fileName.alarm-assetID-n
+	parts := strings.Split(index, "-")
+	if len(parts) != 4 || parts[0] != "data" || !strings.HasSuffix(parts[1], alarmSuffix) {
+		return "", false
+	}
+	return parts[2], true
+}
+
+// TriageAlarm stores the triage in the alarm document with the ID in the alarm
+// index. It returns ErrAlarmNotFound if the alarm does not exist.
+func TriageAlarm(s *state.State, index string, id string, triage AlarmTriage) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(index, id).
+		Doc(map[string]interface{}{
+			"triage": triage,
+		}).Refresh(refresh.True).Do(ctx)
+	var esErr *types.ElasticsearchError
+	if errors.As(err, &esErr) && esErr.Status == http.StatusNotFound {
+		return ErrAlarmNotFound
+	}
+	return err
+}
+
+func QueryDataInRangeAggregated(s *state.State, indexPattern string, xField string, yField string, start time.Time, end time.Time, interval int64) ([]interface{}, []interface{}, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
 	// query for docs in the given time range
@@ -339,8 +422,7 @@ func QueryDataInRangeAggregated(s *state.State, indexPrefix string, xField strin
 	}
 
 	// do query
-	indexName := fmt.Sprintf("%s-*", indexPrefix)
-	queryResult, err := client.Search().Index(indexName).Query(query).Size(0).Aggregations(map[string]types.Aggregations{
+	queryResult, err := client.Search().Index(indexPattern).Query(query).Size(0).Aggregations(map[string]types.Aggregations{
 		"aggT": {
 			DateHistogram: &aggregation,
 			Aggregations: map[string]types.Aggregations{
@@ -398,13 +480,12 @@ func QueryDataInRangeAggregated(s *state.State, indexPrefix string, xField strin
 
 // QueryDataInRange queries the specified asset for all fields specified,
 // returns an array of data for each field
-func QueryDataInRange(s *state.State, indexPrefix string, fields []string, start time.Time, end time.Time, size int, from int) ([][]interface{}, int, error) {
+func QueryDataInRange(s *state.State, indexPattern string, fields []string, start time.Time, end time.Time, size int, from int) ([][]interface{}, int, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
 	// query for all data conn documents for this asset in the given timerange,
 	// sorted in descending time
-	indexName := fmt.Sprintf("%s-*", indexPrefix)
-	queryResult, err := client.Search().Index(indexName).
+	queryResult, err := client.Search().Index(indexPattern).
 		Query(&types.Query{
 			Range: map[string]types.RangeQuery{
 				"timestamp": types.DateRangeQuery{
@@ -447,34 +528,21 @@ func QueryDataInRange(s *state.State, indexPrefix string, fields []string, start
 	return result, int(queryResult.Hits.Total.Value), nil
 }
 
-func CountDataInRange(s *state.State, indexPrefix, field string, start time.Time, end time.Time) ([]string, []int64, error) {
+func CountDataInRange(s *state.State, indexPattern, field string, start time.Time, end time.Time) ([]string, []int64, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
-	// Get the mapping
-	mapping, err := GetDataMapping(s, indexPrefix)
+	// aggregate text fields on their keyword
+	fields, err := aggregatableFields(s, indexPattern, field)
 	if err != nil {
 		return []string{}, []int64{}, err
 	}
 
-	// find the type of this field
-	fieldType := ""
-	for _, fieldProp := range mapping {
-		if fieldProp.Name == field {
-			fieldType = fieldProp.Type
-		}
-	}
-
-	if fieldType == "text" {
-		field = fmt.Sprintf("%s.keyword", field)
-	}
-
 	agg := types.TermsAggregation{
-		Field: &field,
+		Field: &fields[0],
 	}
 
 	// query for all data conn documents for this asset in the given timerange, sorted in ascending time
-	indexName := fmt.Sprintf("%s-*", indexPrefix)
-	queryResult, err := client.Search().Index(indexName).
+	queryResult, err := client.Search().Index(indexPattern).
 		Query(&types.Query{
 			Range: map[string]types.RangeQuery{
 				"timestamp": types.DateRangeQuery{
@@ -510,7 +578,7 @@ func CountDataInRange(s *state.State, indexPrefix, field string, start time.Time
 	return keys, counts, nil
 }
 
-func CountTotalDataInRange(s *state.State, field string, start time.Time, end time.Time) ([]string, []int64, error) {
+func CountTotalDataInRange(s *state.State, indexPattern string, field string, start time.Time, end time.Time) ([]string, []int64, error) {
 	client, ctx := s.Elastic, s.ElasticCtx
 
 	// Create Range Aggregation
@@ -537,8 +605,7 @@ func CountTotalDataInRange(s *state.State, field string, start time.Time, end ti
 	}
 
 	// query for all data conn documents for this asset in the given timerange, sorted in ascending time
-	indexName := "data-*"
-	queryResult, err := client.Search().Index(indexName).
+	queryResult, err := client.Search().Index(indexPattern).
 		Query(&types.Query{
 			Range: map[string]types.RangeQuery{
 				"timestamp": types.DateRangeQuery{
@@ -0,0 +1,73 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexExchangeKey = "exchangekey"
+	// docExchangeKey is the document ID of the static key, fixed so that
+	// backends generating it concurrently conflict
+	docExchangeKey = "ingestion"
+)
+
+var (
+	// ErrExchangeKeyNotFound is the error for a static key that has not been
+	// generated yet.
+	ErrExchangeKeyNotFound = errors.New("exchangekey: no static key found")
+	// ErrExchangeKeyConflict is the error for creating a static key when
+	// another backend created it first.
+	ErrExchangeKeyConflict = errors.New("exchangekey: static key already exists")
+)
+
+// DocumentExchangeKey represents a document from the "exchangekey" index. Every
+// backend authenticates the key agreement with ingestion clients with the
+// static X25519 key in this index.
+type DocumentExchangeKey struct {
+	PrivateKey string `json:"privateKey"` // PrivateKey is the base64 encoded X25519 private key
+	Created    string `json:"created"`    // Created is when the key was generated
+}
+
+// Create will attempt to create the document in the "exchangekey" index. It
+// will return ErrExchangeKeyConflict if the static key already exists, or
+// another error.
+func (d *DocumentExchangeKey) Create(s *state.State) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Create(indexExchangeKey, docExchangeKey).Document(d).Refresh(refresh.True).Do(ctx)
+	var esErr *types.ElasticsearchError
+	if errors.As(err, &esErr) && esErr.Status == http.StatusConflict {
+		return ErrExchangeKeyConflict
+	}
+	return err
+}
+
+// QueryExchangeKey will attempt to query the "exchangekey" index for the static
+// key. It will return ErrExchangeKeyNotFound if the key or the index is
+// missing, or an error if the query cannot be completed.
+func QueryExchangeKey(s *state.State) (DocumentExchangeKey, error) {
+	var d DocumentExchangeKey
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Get(indexExchangeKey, docExchangeKey).Do(ctx)
+	var esErr *types.ElasticsearchError
+	if errors.As(err, &esErr) && esErr.Status == http.StatusNotFound {
+		return d, ErrExchangeKeyNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+	if !result.Found {
+		return d, ErrExchangeKeyNotFound
+	}
+	err = json.Unmarshal(result.Source_, &d)
+	return d, err
+}
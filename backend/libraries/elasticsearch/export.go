@@ -0,0 +1,116 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// exportPageSize is the number of documents fetched per search_after page
+	exportPageSize = 1000
+	// exportKeepAlive is how long the point in time is kept between pages
+	exportKeepAlive = "2m"
+)
+
+// ErrExportLimit is returned when an export reaches the maximum number of
+// documents it is allowed to stream.
+var ErrExportLimit = errors.New("export: document limit reached")
+
+// ExportDataInRange pages through every document of the index pattern in the
+// given time range in ascending time. It uses a point in time with
+// search_after so the result is consistent and not bound by the 10000 result
+// window. The callback is called for every document, iteration stops at the
+// first callback error. If more than max documents match, ErrExportLimit is
+// returned once max documents have been streamed. It returns the number of
+// documents streamed or an error.
+func ExportDataInRange(s *state.State, indexPattern string, start time.Time, end time.Time, max int, fn func(doc map[string]json.RawMessage) error) (int, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// open point in time over all indices of the pattern
+	pit, err := client.OpenPointInTime(indexPattern).KeepAlive(exportKeepAlive).Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+	pitID := pit.Id
+	defer func() {
+		client.ClosePointInTime().Id(pitID).Do(ctx)
+	}()
+
+	query := &types.Query{
+		Range: map[string]types.RangeQuery{
+			"timestamp": types.DateRangeQuery{
+				From: start.Format(time.RFC3339),
+				To:   end.Format(time.RFC3339),
+			},
+		},
+	}
+
+	count := 0
+	var after []types.FieldValue
+	for {
+		// sort by timestamp, tie break on shard doc for a stable search_after
+		search := client.Search().
+			Query(query).
+			Pit(&types.PointInTimeReference{
+				Id:        pitID,
+				KeepAlive: exportKeepAlive,
+			}).
+			Sort(
+				types.SortOptions{
+					SortOptions: map[string]types.FieldSort{
+						"timestamp": {Order: &sortorder.Asc},
+					},
+				},
+				types.SortOptions{
+					SortOptions: map[string]types.FieldSort{
+						"_shard_doc": {Order: &sortorder.Asc},
+					},
+				},
+			).
+			TrackTotalHits(false).
+			Size(exportPageSize)
+		if after != nil {
+			search = search.SearchAfter(after...)
+		}
+		result, err := search.Do(ctx)
+		if err != nil {
+			return count, err
+		}
+		// point in time id may change between requests
+		if result.PitId != nil {
+			pitID = *result.PitId
+		}
+
+		hits := result.Hits.Hits
+		for _, hit := range hits {
+			if count >= max {
+				return count, ErrExportLimit
+			}
+			var d map[string]json.RawMessage
+			err = json.Unmarshal(hit.Source_, &d)
+			if err != nil {
+				return count, err
+			}
+			err = fn(d)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		// last page reached
+		if len(hits) < exportPageSize {
+			return count, nil
+		}
+		after = hits[len(hits)-1].Sort
+	}
+}
@@ -10,10 +10,56 @@ import (
 )
 
 type DocumentIngestion struct {
-	UUID    string `json:"uuid"`    // Represents the name of the ingestion client
-	Key     string `json:"key"`     // Represents the encryption key shared with the ingestion client
-	Address string `json:"address"` // Debug network address string
-	Name    string `json:"string"`  // Set name for the ingestion client
+	UUID       string `json:"uuid"`       // Represents the name of the ingestion client
+	Key        string `json:"key"`        // Represents the encryption key shared with the ingestion client
+	Address    string `json:"address"`    // Debug network address string
+	Name       string `json:"name"`       // Set name for the ingestion client
+	CertSerial string `json:"certSerial"` // Serial number of the client certificate, empty if none was issued
+
+	IdentityKey        string `json:"identityKey"`        // Base64 X25519 identity key pinned at approval
+	EncryptionRequired bool   `json:"encryptionRequired"` // Whether the client must encrypt payloads
+
+	AssetMetadata
+}
+
+// AssetMetadata describes the asset monitored by an ingestion client, as
+// entered by administrators.
+type AssetMetadata struct {
+	Site        string   `json:"site"`        // Site is the site of the asset, such as a campus or data centre
+	Location    string   `json:"location"`    // Location is where the asset is at the site, such as a building or rack
+	Description string   `json:"description"` // Description describes the asset
+	Segments    []string `json:"segments"`    // Segments are the CIDRs of the network segments monitored
+	Tags        []string `json:"tags"`        // Tags are free-form labels of the asset
+	Owner       string   `json:"owner"`       // Owner is the contact of the owner of the asset
+	Criticality string   `json:"criticality"` // Criticality is one of the Criticality values, empty if unset
+	Groups      []string `json:"groups"`      // Groups are the UUIDs of the asset groups of the asset
+}
+
+// Criticality is the set of valid criticality levels of an asset.
+var Criticality = map[string]bool{
+	"low":      true,
+	"medium":   true,
+	"high":     true,
+	"critical": true,
+}
+
+// UnmarshalJSON decodes the document, reading the name of documents indexed
+// before it was stored under the "name" key.
+func (d *DocumentIngestion) UnmarshalJSON(data []byte) error {
+	type document DocumentIngestion
+	var legacy struct {
+		document
+		LegacyName string `json:"string"`
+	}
+	err := json.Unmarshal(data, &legacy)
+	if err != nil {
+		return err
+	}
+	*d = DocumentIngestion(legacy.document)
+	if d.Name == "" {
+		d.Name = legacy.LegacyName
+	}
+	return nil
 }
 
 const indexIngestion = "ingestion"
@@ -91,10 +137,56 @@ func (d *DocumentIngestion) Update(s *state.State, esDocID string) error {
 	client, ctx := s.Elastic, s.ElasticCtx
 	_, err := client.Update(indexIngestion, esDocID).
 		Doc(map[string]interface{}{
-			"uuid":    d.UUID,
-			"name":    d.Name,
-			"address": d.Address,
-			"key":     d.Key,
+			"uuid":               d.UUID,
+			"name":               d.Name,
+			"address":            d.Address,
+			"key":                d.Key,
+			"certSerial":         d.CertSerial,
+			"identityKey":        d.IdentityKey,
+			"encryptionRequired": d.EncryptionRequired,
+			"site":               d.Site,
+			"location":           d.Location,
+			"description":        d.Description,
+			"segments":           d.Segments,
+			"tags":               d.Tags,
+			"owner":              d.Owner,
+			"criticality":        d.Criticality,
+			"groups":             d.Groups,
 		}).DetectNoop(true).Do(ctx)
 	return err
 }
+
+// AssetsMatching returns the UUIDs of the ingestion clients in any of the
+// asset groups or with any of the tags. It returns nil if no group or tag is
+// given, and ErrNoAssets if no client matches.
+func AssetsMatching(s *state.State, groups []string, tags []string) ([]string, error) {
+	if len(groups) == 0 && len(tags) == 0 {
+		return nil, nil
+	}
+	clients, err := AllIngest(s)
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, c := range clients {
+		if containsAny(c.Groups, groups) || containsAny(c.Tags, tags) {
+			out = append(out, c.UUID)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrNoAssets
+	}
+	return out, nil
+}
+
+// containsAny returns true if any value is in the list.
+func containsAny(list []string, values []string) bool {
+	for _, value := range values {
+		for _, item := range list {
+			if item == value {
+				return true
+			}
+		}
+	}
+	return false
+}
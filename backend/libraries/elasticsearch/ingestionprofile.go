@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexIngestionProfile = "ingestionprofile"
+)
+
+// DocumentIngestionProfile represents a document from the "ingestionprofile"
+// index, a version of the configuration of an ingestion client. Every edit is
+// stored as a new version.
+type DocumentIngestionProfile struct {
+	AssetID   string   `json:"assetId"`   // AssetID is the ingestion client configured
+	Version   int      `json:"version"`   // Version is the version of the profile, starting at 1
+	Scan      string   `json:"scan"`      // Scan is how often to scan for new log files, such as "5s"
+	Delay     string   `json:"delay"`     // Delay is the delay before reconnecting, such as "5s"
+	Encrypt   bool     `json:"encrypt"`   // Encrypt is whether log entries are encrypted
+	ChunkSize int      `json:"chunkSize"` // ChunkSize is the largest number of lines sent in a frame
+	Whitelist []string `json:"whitelist"` // Whitelist are the names of the log files sent
+	Author    string   `json:"author"`    // Author is the user that saved the version
+	Time      string   `json:"time"`      // Time is when the version was saved
+	Applied   string   `json:"applied"`   // Applied is when the client acknowledged the version, empty if not yet
+}
+
+// Index will attempt to index the document to the "ingestionprofile" index. It
+// will return the newly created document ID or an error.
+func (d *DocumentIngestionProfile) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexIngestionProfile).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// QueryIngestionProfile will attempt to query the "ingestionprofile" index for
+// the latest version of the profile of the ingestion client. It will return the
+// document and its ID, or an error if the client has no profile.
+func QueryIngestionProfile(s *state.State, assetID string) (DocumentIngestionProfile, string, error) {
+	var d DocumentIngestionProfile
+	history, ids, err := queryIngestionProfiles(s, assetID, 1)
+	if err != nil {
+		return d, "", err
+	}
+	if len(history) == 0 {
+		return d, "", errors.New("ingestionprofile: no document with asset ID found")
+	}
+	return history[0], ids[0], nil
+}
+
+// QueryIngestionProfileHistory will attempt to query the "ingestionprofile"
+// index for up to size versions of the profile of the ingestion client, most
+// recent first. It may return an error if the query cannot be completed.
+func QueryIngestionProfileHistory(s *state.State, assetID string, size int) ([]DocumentIngestionProfile, error) {
+	history, _, err := queryIngestionProfiles(s, assetID, size)
+	return history, err
+}
+
+// queryIngestionProfiles returns up to size versions of the profile of the
+// ingestion client and their document IDs, most recent first. A missing index
+// returns no versions.
+func queryIngestionProfiles(s *state.State, assetID string, size int) ([]DocumentIngestionProfile, []string, error) {
+	out, ids := []DocumentIngestionProfile{}, []string{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	results, err := client.Search().Index(indexIngestionProfile).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"assetId.keyword": {Value: assetID},
+		},
+	}).Sort(types.SortOptions{
+		SortOptions: map[string]types.FieldSort{
+			"version": {Order: &sortorder.Desc},
+		},
+	}).IgnoreUnavailable(true).Size(size).Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// parse versions into DocumentIngestionProfile, append to out
+	for _, version := range results.Hits.Hits {
+		var d DocumentIngestionProfile
+		err := json.Unmarshal(version.Source_, &d)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, d)
+		ids = append(ids, version.Id_)
+	}
+	return out, ids, nil
+}
+
+// Update will attempt to update when the version was applied by the ingestion
+// client. It may return an error if the update cannot be completed.
+func (d *DocumentIngestionProfile) Update(s *state.State, esDocID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(indexIngestionProfile, esDocID).
+		Doc(map[string]interface{}{
+			"applied": d.Applied,
+		}).DetectNoop(true).Refresh(refresh.True).Do(ctx)
+	return err
+}
+
+// DeleteIngestionProfiles will attempt to delete every version of the profile
+// of the ingestion client. It may return an error if the deletion cannot be
+// completed.
+func DeleteIngestionProfiles(s *state.State, assetID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.DeleteByQuery(indexIngestionProfile).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"assetId.keyword": {Value: assetID},
+		},
+	}).IgnoreUnavailable(true).Refresh(true).Do(ctx)
+	return err
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexIngestionStatus = "ingestionstatus"
+)
+
+// DocumentIngestionStatus represents a document from the "ingestionstatus"
+// index, a health report sent periodically by an ingestion client.
+type DocumentIngestionStatus struct {
+	AssetID     string                `json:"assetId"`     // AssetID is the ingestion client sending the report
+	Time        string                `json:"time"`        // Time is when the backend received the report
+	Version     string                `json:"version"`     // Version is the ingestion client version
+	Sensor      string                `json:"sensor"`      // Sensor is the name of the path on the client, empty if it sends a single path
+	Tags        []string              `json:"tags"`        // Tags are the tags of the sensor set on the client
+	Uptime      int64                 `json:"uptime"`      // Uptime is how long the ingestion client is running in seconds
+	LagBytes    int64                 `json:"lagBytes"`    // LagBytes is the total of bytes not yet sent over every file
+	LagSeconds  int64                 `json:"lagSeconds"`  // LagSeconds is the largest lag in seconds over every file
+	ParseErrors int64                 `json:"parseErrors"` // ParseErrors is the total of lines that failed to parse
+	Files       []IngestionFileStatus `json:"files"`       // Files are the tracked log files
+}
+
+// IngestionFileStatus is the progress of a log file tracked by an ingestion
+// client.
+type IngestionFileStatus struct {
+	Path        string `json:"path"`        // Path is the location of the file on the client
+	Size        int64  `json:"size"`        // Size is the current size of the file in bytes
+	Offset      int64  `json:"offset"`      // Offset is the number of bytes read and sent
+	Lines       int64  `json:"lines"`       // Lines is the number of lines read and sent
+	LagBytes    int64  `json:"lagBytes"`    // LagBytes is the number of bytes not yet sent
+	LagSeconds  int64  `json:"lagSeconds"`  // LagSeconds is how long the file has had unsent data
+	ParseErrors int64  `json:"parseErrors"` // ParseErrors is the number of lines that failed to parse
+	Modified    string `json:"modified"`    // Modified is when the file was last written, stale if Zeek stopped
+}
+
+// Index will attempt to index the document to the "ingestionstatus" index. It
+// will return the newly created document ID or an error.
+func (d *DocumentIngestionStatus) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexIngestionStatus).Document(d).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// QueryIngestionStatus will attempt to query the "ingestionstatus" index for
+// up to size reports of the ingestion client received after the provided time,
+// most recent first. A missing index returns no reports. It may return an error
+// if the query cannot be completed.
+func QueryIngestionStatus(s *state.State, assetID string, since time.Time, size int) ([]DocumentIngestionStatus, error) {
+	out := []DocumentIngestionStatus{}
+	client, ctx := s.Elastic, s.ElasticCtx
+	gte := since.UTC().Format(time.RFC3339)
+
+	results, err := client.Search().Index(indexIngestionStatus).Query(&types.Query{
+		Bool: &types.BoolQuery{
+			Filter: []types.Query{
+				{Term: map[string]types.TermQuery{"assetId.keyword": {Value: assetID}}},
+				{Range: map[string]types.RangeQuery{"time": types.DateRangeQuery{Gte: &gte}}},
+			},
+		},
+	}).Sort(types.SortOptions{
+		SortOptions: map[string]types.FieldSort{
+			"time": {Order: &sortorder.Desc},
+		},
+	}).IgnoreUnavailable(true).Size(size).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// parse reports into DocumentIngestionStatus, append to out
+	for _, report := range results.Hits.Hits {
+		var d DocumentIngestionStatus
+		err := json.Unmarshal(report.Source_, &d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// DeleteIngestionStatusBefore will attempt to delete the reports in the
+// "ingestionstatus" index received before the provided time. It may return an
+// error if the deletion cannot be completed.
+func DeleteIngestionStatusBefore(s *state.State, before time.Time) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	lt := before.UTC().Format(time.RFC3339)
+	_, err := client.DeleteByQuery(indexIngestionStatus).Query(&types.Query{
+		Range: map[string]types.RangeQuery{
+			"time": types.DateRangeQuery{Lt: &lt},
+		},
+	}).IgnoreUnavailable(true).Do(ctx)
+	return err
+}
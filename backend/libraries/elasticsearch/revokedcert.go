@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexRevokedCert = "revokedcert"
+)
+
+// DocumentRevokedCert represents a document from the "revokedcert" index. Every
+// backend rejects ingestion client certificates with a serial in this index
+// until they expire.
+type DocumentRevokedCert struct {
+	Serial  string `json:"serial"`  // Serial is the hex serial number of the certificate
+	AssetID string `json:"assetId"` // AssetID is the ingestion client the certificate was issued to
+	Revoked string `json:"revoked"` // Revoked is when the certificate was revoked
+	Expires string `json:"expires"` // Expires is when the certificate expires
+}
+
+// Index will attempt to index the document to the "revokedcert" index. It will
+// return the newly created document ID or an error.
+func (d *DocumentRevokedCert) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexRevokedCert).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// AllRevokedCert will attempt to query the "revokedcert" index for the revoked
+// certificates that have not expired yet. A missing index returns no
+// certificates. It may return an error if the query cannot be completed.
+func AllRevokedCert(s *state.State) ([]DocumentRevokedCert, error) {
+	out := []DocumentRevokedCert{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	results, err := client.Search().Index(indexRevokedCert).Query(&types.Query{
+		Range: map[string]types.RangeQuery{
+			"expires": types.DateRangeQuery{Gt: &now},
+		},
+	}).IgnoreUnavailable(true).Size(10000).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// parse certificates into DocumentRevokedCert, append to out
+	for _, document := range results.Hits.Hits {
+		var d DocumentRevokedCert
+		err := json.Unmarshal(document.Source_, &d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// DeleteExpiredRevokedCert will attempt to delete the documents in the
+// "revokedcert" index that expired before the provided time. It may return an
+// error if the deletion cannot be completed.
+func DeleteExpiredRevokedCert(s *state.State, before time.Time) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	lt := before.UTC().Format(time.RFC3339)
+	_, err := client.DeleteByQuery(indexRevokedCert).Query(&types.Query{
+		Range: map[string]types.RangeQuery{
+			"expires": types.DateRangeQuery{Lt: &lt},
+		},
+	}).IgnoreUnavailable(true).Do(ctx)
+	return err
+}
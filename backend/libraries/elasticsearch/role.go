@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/jwtauth"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexRole = "role"
+)
+
+// DocumentRole represents a document from the "role" index. Users reference a
+// role by name in their class. The built-in "admin" and "standard" roles are
+// not stored.
+type DocumentRole struct {
+	Name        string               `json:"name"`        // Name is unique role identifier
+	Permissions []jwtauth.Permission `json:"permissions"` // Permissions is a list of permissions granted by the role
+}
+
+// Index will attempt to index the document to the "role" index. It will return
+// the newly created document ID or an error.
+func (d *DocumentRole) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexRole).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// Update will attempt to update the document in the "role" index with the
+// provided Elasticsearch document ID. It will return an error if the
+// transaction can not be performed.
+func (d *DocumentRole) Update(s *state.State, esDocID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(indexRole, esDocID).
+		Doc(map[string]interface{}{
+			"name":        d.Name,
+			"permissions": d.Permissions,
+		}).DetectNoop(true).Refresh(refresh.True).Do(ctx)
+	return err
+}
+
+// QueryRoleByName will attempt to query the "role" index for a role, returning
+// a DocumentRole entry and document ID string. It may return an error if the
+// query cannot be completed or if the role is not found.
+func QueryRoleByName(s *state.State, name string) (DocumentRole, string, error) {
+	var d DocumentRole
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for role with provided name
+	result, err := client.Search().Index(indexRole).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"name.keyword": {Value: name},
+		},
+	}).IgnoreUnavailable(true).Do(ctx)
+	if err != nil {
+		return d, "", err
+	}
+	// ensure role was returned
+	if result.Hits.Total.Value == 0 {
+		return d, "", errors.New("role: no document with name found")
+	}
+	// select + parse role into DocumentRole
+	role := result.Hits.Hits[0]
+	err = json.Unmarshal(role.Source_, &d)
+	if err != nil {
+		return d, "", err
+	}
+	// successful query
+	return d, role.Id_, nil
+}
+
+// DeleteRoleByName will attempt to delete a document in the "role" index with
+// the specified name. It may return an error if the deletion cannot be
+// completed.
+func DeleteRoleByName(s *state.State, name string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.DeleteByQuery(indexRole).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"name.keyword": {Value: name},
+		},
+	}).Refresh(true).Do(ctx)
+	return err
+}
+
+// AllRole will attempt to query the "role" index and return all stored roles.
+// A missing index returns no roles. It may return an error if the query cannot
+// be completed.
+func AllRole(s *state.State) ([]DocumentRole, error) {
+	out := []DocumentRole{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for all documents
+	results, err := client.Search().Index(indexRole).Query(&types.Query{
+		MatchAll: &types.MatchAllQuery{},
+	}).IgnoreUnavailable(true).Size(1000).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// parse roles into DocumentRole, append to out
+	for _, role := range results.Hits.Hits {
+		var d DocumentRole
+		err := json.Unmarshal(role.Source_, &d)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrNoAssets is returned when a data query is restricted to no assets.
+	ErrNoAssets = errors.New("scope: no permitted assets")
+	// ErrInvalidScope is returned when an index or asset name would widen the
+	// data index pattern.
+	ErrInvalidScope = errors.New("scope: invalid index or asset name")
+)
+
+// DataIndexPattern returns the comma separated index patterns matching the
+// data index for the provided asset IDs. An empty data index matches every
+// data index. A nil asset list matches every asset, an empty asset list
+// returns ErrNoAssets. Names that could widen the pattern return
+// ErrInvalidScope.
+func DataIndexPattern(dataIndex string, assets []string) (string, error) {
+	if dataIndex == "" {
+		dataIndex = "*"
+	} else if !validScopeName(dataIndex) {
+		return "", ErrInvalidScope
+	}
+	if assets == nil {
+		return "data-" + dataIndex + "-*", nil
+	}
+	if len(assets) == 0 {
+		return "", ErrNoAssets
+	}
+
+	patterns := make([]string, len(assets))
+	for i, asset := range assets {
+		if !validScopeName(asset) {
+			return "", ErrInvalidScope
+		}
+		patterns[i] = "data-" + dataIndex + "-" + asset + "-*"
+	}
+	return strings.Join(patterns, ","), nil
+}
+
+// AssetPermitted returns true if the asset ID is in the asset list. A nil
+// asset list permits every asset.
+func AssetPermitted(assetID string, assets []string) bool {
+	if assets == nil {
+		return true
+	}
+	for _, asset := range assets {
+		if asset == assetID {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidDataIndex returns true if the name of a data index can be used in a
+// data index pattern.
+func ValidDataIndex(dataIndex string) bool {
+	return validScopeName(dataIndex)
+}
+
+// validScopeName returns true if the name can be used as part of an index
+// pattern without matching other indices.
+func validScopeName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ",*?-\"<>|\\/ #:")
+}
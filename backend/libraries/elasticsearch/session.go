@@ -0,0 +1,167 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/refresh"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	indexSession = "session"
+)
+
+// DocumentSession represents a document from the "session" index. A session is
+// created on login and referenced by the "jti" claim of the user token.
+type DocumentSession struct {
+	UUID      string `json:"uuid"`      // UUID is unique session identifier
+	User      string `json:"user"`      // User is the UUID of the session user
+	Address   string `json:"address"`   // Address is the client address at login
+	UserAgent string `json:"userAgent"` // UserAgent is the client user agent at login
+	Created   string `json:"created"`   // Created is the login time
+	LastSeen  string `json:"lastSeen"`  // LastSeen is the last time the session token was renewed
+	Expires   string `json:"expires"`   // Expires is when the session token expires
+	Revoked   bool   `json:"revoked"`   // Revoked indicates if the session was logged out or revoked
+}
+
+// Index will attempt to index the document to the "session" index. It will
+// return the newly created document ID or an error.
+func (d *DocumentSession) Index(s *state.State) (string, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+	result, err := client.Index(indexSession).Document(d).Refresh(refresh.True).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	return result.Id_, nil
+}
+
+// Update will attempt to update the document in the "session" index with the
+// provided Elasticsearch document ID. It will return an error if the
+// transaction can not be performed.
+func (d *DocumentSession) Update(s *state.State, esDocID string) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	_, err := client.Update(indexSession, esDocID).
+		Doc(map[string]interface{}{
+			"uuid":      d.UUID,
+			"user":      d.User,
+			"address":   d.Address,
+			"userAgent": d.UserAgent,
+			"created":   d.Created,
+			"lastSeen":  d.LastSeen,
+			"expires":   d.Expires,
+			"revoked":   d.Revoked,
+		}).DetectNoop(true).Refresh(refresh.True).Do(ctx)
+	return err
+}
+
+// QuerySessionByUUID will attempt to query the "session" index for a session,
+// returning a DocumentSession entry and document ID string. It may return an
+// error if the query cannot be completed or if the session is not found.
+func QuerySessionByUUID(s *state.State, uuid string) (DocumentSession, string, error) {
+	var d DocumentSession
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	// perform query for session with provided uuid
+	result, err := client.Search().Index(indexSession).Query(&types.Query{
+		Term: map[string]types.TermQuery{
+			"uuid.keyword": {Value: uuid},
+		},
+	}).Do(ctx)
+	if err != nil {
+		return d, "", err
+	}
+	// ensure session was returned
+	if result.Hits.Total.Value == 0 {
+		return d, "", errors.New("session: no document with uuid found")
+	}
+	// select + parse session into DocumentSession
+	session := result.Hits.Hits[0]
+	err = json.Unmarshal(session.Source_, &d)
+	if err != nil {
+		return d, "", err
+	}
+	// successful query
+	return d, session.Id_, nil
+}
+
+// ActiveSession will attempt to query the "session" index for the sessions
+// that are neither revoked nor expired, most recent first. If user is not
+// empty, only the sessions of that user are returned. It may return an error if
+// the query cannot be completed.
+func ActiveSession(s *state.State, user string) ([]DocumentSession, []string, error) {
+	filters := []types.Query{
+		{Term: map[string]types.TermQuery{"revoked": {Value: false}}},
+		{Range: map[string]types.RangeQuery{"expires": types.DateRangeQuery{Gt: &now}}},
+	}
+	if user != "" {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"user.keyword": {Value: user}}})
+	}
+	return searchSession(s, filters)
+}
+
+// RevokedSession will attempt to query the "session" index for the revoked
+// sessions that have not expired yet. It may return an error if the query
+// cannot be completed.
+func RevokedSession(s *state.State) ([]DocumentSession, error) {
+	sessions, _, err := searchSession(s, []types.Query{
+		{Term: map[string]types.TermQuery{"revoked": {Value: true}}},
+		{Range: map[string]types.RangeQuery{"expires": types.DateRangeQuery{Gt: &now}}},
+	})
+	return sessions, err
+}
+
+// DeleteExpiredSession will attempt to delete the documents in the "session"
+// index that expired before the provided time. It may return an error if the
+// deletion cannot be completed.
+func DeleteExpiredSession(s *state.State, before time.Time) error {
+	client, ctx := s.Elastic, s.ElasticCtx
+	lt := before.UTC().Format(time.RFC3339)
+	_, err := client.DeleteByQuery(indexSession).Query(&types.Query{
+		Range: map[string]types.RangeQuery{
+			"expires": types.DateRangeQuery{Lt: &lt},
+		},
+	}).IgnoreUnavailable(true).Do(ctx)
+	return err
+}
+
+// now is the date math for the current time.
+var now = "now"
+
+// searchSession returns the sessions matching every filter, most recent first,
+// with their document IDs. A missing index returns no sessions.
+func searchSession(s *state.State, filters []types.Query) ([]DocumentSession, []string, error) {
+	out, ids := []DocumentSession{}, []string{}
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	results, err := client.Search().Index(indexSession).Query(&types.Query{
+		Bool: &types.BoolQuery{
+			Filter: filters,
+		},
+	}).Sort(types.SortOptions{
+		SortOptions: map[string]types.FieldSort{
+			"created": {Order: &sortorder.Desc},
+		},
+	}).IgnoreUnavailable(true).Size(1000).Do(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// parse sessions into DocumentSession, append to out
+	for _, session := range results.Hits.Hits {
+		var d DocumentSession
+		err := json.Unmarshal(session.Source_, &d)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, d)
+		ids = append(ids, session.Id_)
+	}
+	return out, ids, nil
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package elasticsearch provides the simplified Elasticsearch interface.
+package elasticsearch
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types"
+	"github.com/elastic/go-elasticsearch/v8/typedapi/types/enums/sortorder"
+	"github.com/mcmaster-circ/canids-v2/backend/state"
+)
+
+const (
+	// MaxTimelineEntries is the maximum number of records returned for a
+	// single timeline
+	MaxTimelineEntries = 1000
+
+	// alarmSuffix is appended to the log name of alarm indices
+	alarmSuffix = ".alarm"
+)
+
+// ConnTuple is the 5-tuple identifying a Zeek connection. An empty Proto or a
+// zero port will match any value.
+type ConnTuple struct {
+	SourceIP        string `json:"id_orig_h"` // SourceIP is the originator address
+	SourcePort      int    `json:"id_orig_p"` // SourcePort is the originator port
+	DestinationIP   string `json:"id_resp_h"` // DestinationIP is the responder address
+	DestinationPort int    `json:"id_resp_p"` // DestinationPort is the responder port
+	Proto           string `json:"proto"`     // Proto is the transport protocol
+}
+
+// TimelineEntry is a single record in a connection timeline.
+type TimelineEntry struct {
+	Index             string                     `json:"index"`             // Index is the Elasticsearch index of the record
+	Log               string                     `json:"log"`               // Log is the Zeek log the record originated from
+	AssetID           string                     `json:"assetId"`           // AssetID is the asset that ingested the record
+	Timestamp         string                     `json:"timestamp"`         // Timestamp is the record timestamp
+	UID               string                     `json:"uid"`               // UID is the Zeek connection identifier
+	SourceAlarms      []string                   `json:"sourceAlarms"`      // SourceAlarms are the alarm sets matching the originator
+	DestinationAlarms []string                   `json:"destinationAlarms"` // DestinationAlarms are the alarm sets matching the responder
+	Record            map[string]json.RawMessage `json:"record"`            // Record is the original document
+}
+
+// QueryTimelineByUID queries the data index pattern for records related to the
+// provided Zeek connection UIDs, optionally limited to a time range (a zero
+// start or end is unbounded). Alarm documents are merged into the record they
+// were raised for. It returns the records sorted by ascending timestamp,
+// whether records after the first MaxTimelineEntries were left out, or an
+// error.
+func QueryTimelineByUID(s *state.State, indexPattern string, uids []string, start time.Time, end time.Time) ([]TimelineEntry, bool, error) {
+	if len(uids) == 0 {
+		return []TimelineEntry{}, false, nil
+	}
+
+	// files.log references connections through "conn_uids" rather than "uid"
+	related := types.Query{
+		Bool: &types.BoolQuery{
+			Should: []types.Query{
+				{Terms: &types.TermsQuery{TermsQuery: map[string]types.TermsQueryField{"uid.keyword": uids}}},
+				{Terms: &types.TermsQuery{TermsQuery: map[string]types.TermsQueryField{"conn_uids.keyword": uids}}},
+			},
+		},
+	}
+	hits, truncated, err := searchTimeline(s, indexPattern, []types.Query{related}, start, end)
+	if err != nil {
+		return nil, false, err
+	}
+	return mergeTimeline(hits), truncated, nil
+}
+
+// QueryTimelineByTuple queries the data index pattern in the provided time range
+// for records matching the connection 5-tuple. The UIDs of the matching
+// records are then used to pull every related record. It returns the merged
+// timeline, the UIDs found, whether records were left out of either search, or
+// an error.
+func QueryTimelineByTuple(s *state.State, indexPattern string, tuple ConnTuple, start time.Time, end time.Time) ([]TimelineEntry, []string, bool, error) {
+	filters := []types.Query{}
+	if tuple.SourceIP != "" {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"id_orig_h.keyword": {Value: tuple.SourceIP}}})
+	}
+	if tuple.SourcePort != 0 {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"id_orig_p": {Value: tuple.SourcePort}}})
+	}
+	if tuple.DestinationIP != "" {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"id_resp_h.keyword": {Value: tuple.DestinationIP}}})
+	}
+	if tuple.DestinationPort != 0 {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"id_resp_p": {Value: tuple.DestinationPort}}})
+	}
+	if tuple.Proto != "" {
+		filters = append(filters, types.Query{Term: map[string]types.TermQuery{"proto.keyword": {Value: tuple.Proto}}})
+	}
+
+	hits, truncated, err := searchTimeline(s, indexPattern, filters, start, end)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	// collect the connection identifiers of every matching record
+	seen := make(map[string]bool)
+	uids := []string{}
+	for _, hit := range hits {
+		var d struct {
+			UID string `json:"uid"`
+		}
+		if json.Unmarshal(hit.Source_, &d) != nil || d.UID == "" || seen[d.UID] {
+			continue
+		}
+		seen[d.UID] = true
+		uids = append(uids, d.UID)
+	}
+
+	// records without a UID (e.g. weird.log) can only be matched by tuple
+	if len(uids) == 0 {
+		return mergeTimeline(hits), uids, truncated, nil
+	}
+	entries, related, err := QueryTimelineByUID(s, indexPattern, uids, start, end)
+	return entries, uids, truncated || related, err
+}
+
+// searchTimeline performs the timeline search over the data index pattern with
+// the provided filters. A zero start or end leaves the time range unbounded. It
+// returns the first MaxTimelineEntries hits and whether there were more.
+func searchTimeline(s *state.State, indexPattern string, filters []types.Query, start time.Time, end time.Time) ([]types.Hit, bool, error) {
+	client, ctx := s.Elastic, s.ElasticCtx
+
+	if !start.IsZero() || !end.IsZero() {
+		r := types.DateRangeQuery{}
+		if !start.IsZero() {
+			r.From = start.Format(time.RFC3339)
+		}
+		if !end.IsZero() {
+			r.To = end.Format(time.RFC3339)
+		}
+		filters = append(filters, types.Query{Range: map[string]types.RangeQuery{"timestamp": r}})
+	}
+
+	result, err := client.Search().Index(indexPattern).
+		Query(&types.Query{
+			Bool: &types.BoolQuery{
+				Filter: filters,
+			},
+		}).
+		Sort(types.SortOptions{
+			SortOptions: map[string]types.FieldSort{
+				"timestamp": {
+					Order: &sortorder.Asc,
+				},
+			},
+		}).Size(MaxTimelineEntries + 1).Do(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	// one more hit than returned is fetched to tell if the timeline is cut
+	hits := result.Hits.Hits
+	if len(hits) > MaxTimelineEntries {
+		return hits[:MaxTimelineEntries], true, nil
+	}
+	return hits, false, nil
+}
+
+// mergeTimeline converts search hits into timeline entries. Alarm documents
+// are a copy of the data record with the matching alarm sets added, they are
+// merged into the data record instead of being returned twice.
+func mergeTimeline(hits []types.Hit) []TimelineEntry {
+	entries := []TimelineEntry{}
+	alarms := []TimelineEntry{}
+
+	for _, hit := range hits {
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(hit.Source_, &record); err != nil {
+			continue
+		}
+		logName, assetID := parseDataIndex(hit.Index_)
+		entry := TimelineEntry{
+			Index:             hit.Index_,
+			Log:               strings.TrimSuffix(logName, alarmSuffix),
+			AssetID:           assetID,
+			SourceAlarms:      []string{},
+			DestinationAlarms: []string{},
+			Record:            record,
+		}
+		json.Unmarshal(record["timestamp"], &entry.Timestamp)
+		json.Unmarshal(record["uid"], &entry.UID)
+
+		if strings.HasSuffix(logName, alarmSuffix) {
+			json.Unmarshal(record["id_orig_h_pos"], &entry.SourceAlarms)
+			json.Unmarshal(record["id_resp_h_pos"], &entry.DestinationAlarms)
+			alarms = append(alarms, entry)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	// inline each alarm into the record it was raised for
+	for _, alarm := range alarms {
+		found := false
+		for i := range entries {
+			e := &entries[i]
+			if e.Log == alarm.Log && e.AssetID == alarm.AssetID && e.UID == alarm.UID && e.Timestamp == alarm.Timestamp {
+				e.SourceAlarms = alarm.SourceAlarms
+				e.DestinationAlarms = alarm.DestinationAlarms
+				found = true
+				break
+			}
+		}
+		// data record fell outside of the result window, keep the alarm
+		if !found {
+			entries = append(entries, alarm)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+	return entries
+}
+
+// parseDataIndex splits a data index name in the format
+// data-fileName-assetID-number into the file name and asset ID. Unexpected
+// index names return empty strings.
+func parseDataIndex(index string) (string, string) {
+	parts := strings.Split(index, "-")
+	if len(parts) != 4 || parts[0] != "data" {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
@@ -28,6 +28,16 @@ const (
 	ViewPie ViewClass = "pie"
 	// ViewTable is a data table
 	ViewTable ViewClass = "table"
+	// ViewTimeSeries is a stacked time series split by the top terms of a field
+	ViewTimeSeries ViewClass = "timeseries"
+	// ViewHeatmap is a heatmap of the counts of two terms fields
+	ViewHeatmap ViewClass = "heatmap"
+	// ViewTopN is a table of the most common values of one or more fields
+	ViewTopN ViewClass = "topn"
+	// ViewStat is a single statistic compared to the previous period
+	ViewStat ViewClass = "stat"
+	// ViewSankey is a source to destination relationship between two fields
+	ViewSankey ViewClass = "sankey"
 	// DefaultViewName is the name given to the default view created
 	DefaultViewName string = "Data Ingested"
 )
@@ -35,21 +45,64 @@ const (
 var (
 	// ViewClassMap maps the string representation back to ViewClass
 	ViewClassMap = map[string]ViewClass{
-		"line":  ViewLine,
-		"bar":   ViewBar,
-		"pie":   ViewPie,
-		"table": ViewTable,
+		"line":       ViewLine,
+		"bar":        ViewBar,
+		"pie":        ViewPie,
+		"table":      ViewTable,
+		"timeseries": ViewTimeSeries,
+		"heatmap":    ViewHeatmap,
+		"topn":       ViewTopN,
+		"stat":       ViewStat,
+		"sankey":     ViewSankey,
 	}
+
+	// ViewMetricMap maps the string representation back to ViewMetric
+	ViewMetricMap = map[string]ViewMetric{
+		"count":       MetricCount,
+		"sum":         MetricSum,
+		"avg":         MetricAvg,
+		"min":         MetricMin,
+		"max":         MetricMax,
+		"cardinality": MetricCardinality,
+		"percentile":  MetricPercentile,
+	}
+)
+
+// ViewMetric indicates the statistic computed over a field by a line or
+// single-stat view.
+type ViewMetric string
+
+const (
+	// MetricCount is the number of documents
+	MetricCount ViewMetric = "count"
+	// MetricSum is the sum of a numeric field
+	MetricSum ViewMetric = "sum"
+	// MetricAvg is the average of a numeric field
+	MetricAvg ViewMetric = "avg"
+	// MetricMin is the minimum of a numeric field
+	MetricMin ViewMetric = "min"
+	// MetricMax is the maximum of a numeric field
+	MetricMax ViewMetric = "max"
+	// MetricCardinality is the number of unique values of a field
+	MetricCardinality ViewMetric = "cardinality"
+	// MetricPercentile is a percentile of a numeric field
+	MetricPercentile ViewMetric = "percentile"
 )
 
 // DocumentView represents a document from the "view" index.
 type DocumentView struct {
-	UUID       string    `json:"uuid"`       // UUID is unique view identifier
-	Name       string    `json:"name"`       // Name is common visualization name
-	Class      ViewClass `json:"class"`      // Class is the class of view
-	DataIndex  string    `json:"index"`      // DataIndex is index fields are contained in
-	Fields     []string  `json:"fields"`     // Fields is the array of fields to be used in this view
-	FieldNames []string  `json:"fieldNames"` // FieldNames is the array of common field names
+	UUID       string     `json:"uuid"`       // UUID is unique view identifier
+	Name       string     `json:"name"`       // Name is common visualization name
+	Class      ViewClass  `json:"class"`      // Class is the class of view
+	DataIndex  string     `json:"index"`      // DataIndex is index fields are contained in
+	Fields     []string   `json:"fields"`     // Fields is the array of fields to be used in this view
+	FieldNames []string   `json:"fieldNames"` // FieldNames is the array of common field names
+	Metric     ViewMetric `json:"metric"`     // Metric is the statistic computed over the field of a line or single-stat view
+	Percentile float64    `json:"percentile"` // Percentile is the percentile computed by a percentile metric
+	GroupBy    string     `json:"groupBy"`    // GroupBy is the field a line view is split by
+	Assets     []string   `json:"assets"`     // Assets restricts the view to the asset IDs, empty is all
+	Groups     []string   `json:"groups"`     // Groups restricts the view to the assets in the asset groups, empty is all
+	Tags       []string   `json:"tags"`       // Tags restricts the view to the assets with the tags, empty is all
 }
 
 // Index will attempt to index the document to the "view" index. It will return
@@ -76,6 +129,12 @@ func (d *DocumentView) Update(s *state.State, esDocID string) error {
 			"index":      d.DataIndex,
 			"fields":     d.Fields,
 			"fieldNames": d.FieldNames,
+			"metric":     d.Metric,
+			"percentile": d.Percentile,
+			"groupBy":    d.GroupBy,
+			"assets":     d.Assets,
+			"groups":     d.Groups,
+			"tags":       d.Tags,
 		}).DetectNoop(true).Do(ctx)
 	return err
 }
@@ -10,6 +10,7 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -20,18 +21,56 @@ import (
 type ctxAuthKey struct{}
 
 var (
-	errInit = errors.New("secret cannot be empty") // error for invalid Init()
-	ctxKey  = &ctxAuthKey{}                        // ctxKey is a context key instance.
+	errInit       = errors.New("secret cannot be empty")              // error for invalid Init()
+	errUnknownKey = errors.New("token signed with unknown key")       // error for unknown "kid" header
+	errMethod     = errors.New("token signed with unexpected method") // error for non HS512 tokens
+	ctxKey        = &ctxAuthKey{}                                     // ctxKey is a context key instance.
 )
 
-// UserClass indicates the access control class a user is registered to.
+// UserClass indicates the access control class (role) a user is registered to.
 type UserClass string
 
 const (
-	// UserAdmin is a user that has full root privileges
+	// UserAdmin is the built-in role that has every permission
 	UserAdmin UserClass = "admin"
-	// UserStandard is a user that has regular privileges
+	// UserStandard is the built-in role that has regular privileges
 	UserStandard UserClass = "standard"
+	// UserService is the class of service API tokens, it is not a role and
+	// grants no permission of its own
+	UserService UserClass = "service"
+)
+
+// AllAssets is the asset grant of a user that may query every asset.
+const AllAssets = "*"
+
+// Permission is an action that a role may grant.
+type Permission string
+
+const (
+	// PermUserWrite allows listing, adding, updating and deleting other users
+	PermUserWrite Permission = "user.write"
+	// PermRoleWrite allows adding, updating and deleting roles
+	PermRoleWrite Permission = "role.write"
+	// PermViewWrite allows adding, updating and deleting views
+	PermViewWrite Permission = "view.write"
+	// PermDashboardWrite allows updating the dashboard
+	PermDashboardWrite Permission = "dashboard.write"
+	// PermAlarmTriage allows triaging alarms
+	PermAlarmTriage Permission = "alarm.triage"
+	// PermBlacklistWrite allows adding, updating and deleting blacklists
+	PermBlacklistWrite Permission = "blacklist.write"
+	// PermSettingsWrite allows updating the configuration
+	PermSettingsWrite Permission = "settings.write"
+	// PermDataExport allows exporting data
+	PermDataExport Permission = "data.export"
+	// PermIngestionRead allows listing ingestion clients
+	PermIngestionRead Permission = "ingestion.read"
+	// PermIngestionApprove allows approving ingestion clients
+	PermIngestionApprove Permission = "ingestion.approve"
+	// PermIngestionWrite allows renaming, deleting and limiting ingestion clients
+	PermIngestionWrite Permission = "ingestion.write"
+	// PermAuditRead allows reading and verifying the audit log
+	PermAuditRead Permission = "audit.read"
 )
 
 var (
@@ -40,39 +79,98 @@ var (
 		"admin":    UserAdmin,
 		"standard": UserStandard,
 	}
+	// PermissionMap maps the string representation back to Permission
+	PermissionMap = map[string]Permission{
+		"user.write":        PermUserWrite,
+		"role.write":        PermRoleWrite,
+		"view.write":        PermViewWrite,
+		"dashboard.write":   PermDashboardWrite,
+		"alarm.triage":      PermAlarmTriage,
+		"blacklist.write":   PermBlacklistWrite,
+		"settings.write":    PermSettingsWrite,
+		"data.export":       PermDataExport,
+		"ingestion.read":    PermIngestionRead,
+		"ingestion.approve": PermIngestionApprove,
+		"ingestion.write":   PermIngestionWrite,
+		"audit.read":        PermAuditRead,
+	}
 )
 
-// Config contains the state (secret and key) function for signing and
-// validating tokens.
+// Key is a signing secret. Tokens carry the ID of the key that signed them in
+// the "kid" header.
+type Key struct {
+	ID     string // ID is the key identifier
+	Secret []byte // Secret is the HMAC secret
+}
+
+// Config contains the signing keys for signing and validating tokens. New
+// tokens are signed with the current key, tokens signed by any known key are
+// accepted. The zero value accepts no tokens until SetKeys is called.
 type Config struct {
-	secret  []byte                                // secret for signing
-	keyFunc func(*jwt.Token) (interface{}, error) // key function
+	m       sync.RWMutex      // m guards the keys
+	current Key               // current is the key for signing
+	keys    map[string][]byte // keys maps every key ID accepted to its secret
 }
 
 // Payload represents an authenticated user. All fields are application
 // specific.
 type Payload struct {
-	UUID      string    `json:"uuid"`      // UUID is unique user identifier (email)
-	Class     UserClass `json:"class"`     // Class is user class
-	Name      string    `json:"name"`      // Name is the user's name
-	Activated bool      `json:"activated"` // Activated if account is active
-	jwt.StandardClaims
+	UUID               string       `json:"uuid"`      // UUID is unique user identifier (email)
+	Class              UserClass    `json:"class"`     // Class is user class
+	Name               string       `json:"name"`      // Name is the user's name
+	Activated          bool         `json:"activated"` // Activated if account is active
+	Assets             []string     `json:"assets"`    // Assets are the asset IDs a non-admin user is granted, AllAssets grants all
+	Permissions        []Permission `json:"-"`         // Permissions are granted by the role, resolved on every request
+	jwt.StandardClaims              // StandardClaims holds the expiry and the session ID ("jti")
 }
 
 // Init takes a secret and returns a new state or an error.
 func Init(secret []byte) (*Config, error) {
+	return InitKeys(Key{Secret: secret}, nil)
+}
+
+// InitKeys takes the current signing key and the additional keys accepted for
+// validation (e.g. recently rotated keys), returning a new state or an error.
+func InitKeys(current Key, verify []Key) (*Config, error) {
+	config := &Config{}
+	err := config.SetKeys(current, verify)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetKeys replaces the current signing key and the additional keys accepted
+// for validation. It returns an error if a secret is empty.
+func (c *Config) SetKeys(current Key, verify []Key) error {
 	// disallow empty secret
-	if bytes.Equal(secret, nil) {
-		return nil, errInit
+	keys := map[string][]byte{}
+	for _, key := range append([]Key{current}, verify...) {
+		if bytes.Equal(key.Secret, nil) {
+			return errInit
+		}
+		keys[key.ID] = key.Secret
 	}
-	// keyFunc is required for JWT library
-	config := &Config{
-		secret: secret,
-		keyFunc: func(token *jwt.Token) (interface{}, error) {
-			return secret, nil
-		},
+	c.m.Lock()
+	c.current, c.keys = current, keys
+	c.m.Unlock()
+	return nil
+}
+
+// keyFunc returns the secret of the key that signed the token. It is required
+// for JWT library.
+func (c *Config) keyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodHS512 {
+		return nil, errMethod
 	}
-	return config, nil
+	kid, _ := token.Header["kid"].(string)
+	c.m.RLock()
+	defer c.m.RUnlock()
+	secret, ok := c.keys[kid]
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return secret, nil
 }
 
 // CreateToken takes a payload and expiry duration, returning a signed base64
@@ -80,10 +178,16 @@ func Init(secret []byte) (*Config, error) {
 func (c *Config) CreateToken(p *Payload, duration time.Duration) (string, error) {
 	// set expiry time of now + duration (e.g. 5 minutes)
 	p.ExpiresAt = time.Now().Add(duration).Unix()
-	// generate token using HMAC with SHA-512
+	// generate token using HMAC with SHA-512, identify the signing key
+	c.m.RLock()
+	key := c.current
+	c.m.RUnlock()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, p)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
 	// sign string with secret, if error return error, else return token
-	signedStr, err := token.SignedString(c.secret)
+	signedStr, err := token.SignedString(key.Secret)
 	if err != nil {
 		return "", err
 	}
@@ -132,6 +236,59 @@ func FromContext(ctx context.Context) *Payload {
 	return p
 }
 
+// Can returns true if the role of the user grants the permission.
+func (p *Payload) Can(permission Permission) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AssetScope returns the asset IDs the user may query, narrowed by every
+// non-empty filter (e.g. the assets of a view or dashboard). Admins and users
+// granted AllAssets are only restricted by the filters, other users without
+// grants may not query any asset. A nil result permits every asset, an empty
+// result permits none.
+func (p *Payload) AssetScope(filters ...[]string) []string {
+	var scope []string
+	if p.Class != UserAdmin && !grantsAll(p.Assets) {
+		scope = append([]string{}, p.Assets...)
+	}
+	for _, filter := range filters {
+		if len(filter) == 0 {
+			continue
+		}
+		if scope == nil {
+			scope = append([]string{}, filter...)
+			continue
+		}
+		// keep the assets present in both
+		narrowed := []string{}
+		for _, asset := range scope {
+			for _, f := range filter {
+				if asset == f {
+					narrowed = append(narrowed, asset)
+					break
+				}
+			}
+		}
+		scope = narrowed
+	}
+	return scope
+}
+
+// grantsAll returns true if the asset grants include AllAssets.
+func grantsAll(assets []string) bool {
+	for _, asset := range assets {
+		if asset == AllAssets {
+			return true
+		}
+	}
+	return false
+}
+
 // GenerateSeed will return a random byte array of the specified input length,
 // or an error.
 func GenerateSeed(length int) ([]byte, error) {
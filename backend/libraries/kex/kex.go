@@ -0,0 +1,226 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package kex provides the authenticated X25519 key agreement and the payload
+// encryption of ingestion sessions.
+//
+// The backend sends an ephemeral and its static public key. The ingestion
+// client combines the ephemeral-ephemeral, ephemeral-identity and
+// static-ephemeral X25519 shared secrets (and the legacy pre-shared key, if
+// any) with HKDF-SHA256 over the transcript. Only the holder of the identity
+// key pinned at approval can derive the session keys, and only the backend
+// holding the static key can confirm them. Payload entries are sealed with
+// AES-256-GCM, binding the frame sequence number, key epoch, entry index, asset
+// ID and file name. Keys are ratcheted forward every epoch.
+package kex
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// Protocol identifies the key agreement in the transcript
+	Protocol = "canids-ingest-kex-v1"
+	// RekeyInterval is how often the client ratchets the session key
+	RekeyInterval = 15 * time.Minute
+	// RekeyFrames is the number of frames after which the client ratchets the
+	// session key
+	RekeyFrames = 1 << 16
+)
+
+var (
+	errReplay = errors.New("kex: frame sequence number not increasing")
+	errEpoch  = errors.New("kex: frame key epoch out of order")
+	errShort  = errors.New("kex: ciphertext too short")
+)
+
+// Keys are the keys derived by the key agreement.
+type Keys struct {
+	Data          []byte // Data is the initial payload key of the session
+	transcript    []byte // transcript is the hash of the public values
+	clientConfirm []byte // clientConfirm is the key of the client confirmation
+	serverConfirm []byte // serverConfirm is the key of the server confirmation
+}
+
+// Server derives the session keys on the backend from its static and ephemeral
+// keys, the pinned identity key and ephemeral key of the client, and the
+// legacy pre-shared key (nil if none).
+func Server(static *ecdh.PrivateKey, ephemeral *ecdh.PrivateKey, assetID string, identity *ecdh.PublicKey, clientEphemeral *ecdh.PublicKey, psk []byte) (Keys, error) {
+	ee, err := ephemeral.ECDH(clientEphemeral)
+	if err != nil {
+		return Keys{}, err
+	}
+	es, err := ephemeral.ECDH(identity)
+	if err != nil {
+		return Keys{}, err
+	}
+	se, err := static.ECDH(clientEphemeral)
+	if err != nil {
+		return Keys{}, err
+	}
+	return derive(assetID, identity, ephemeral.PublicKey(), static.PublicKey(), clientEphemeral, ee, es, se, psk), nil
+}
+
+// derive returns the keys for the shared secrets, bound to the transcript of
+// the public values.
+func derive(assetID string, identity, serverEphemeral, serverStatic, clientEphemeral *ecdh.PublicKey, ee, es, se, psk []byte) Keys {
+	h := sha256.New()
+	h.Write([]byte(Protocol))
+	h.Write([]byte{0})
+	h.Write([]byte(assetID))
+	h.Write([]byte{0})
+	for _, key := range []*ecdh.PublicKey{identity, serverEphemeral, serverStatic, clientEphemeral} {
+		h.Write(key.Bytes())
+	}
+	transcript := h.Sum(nil)
+
+	// HKDF-SHA256 extract with the transcript as salt
+	ikm := append(append(append(append([]byte{}, ee...), es...), se...), psk...)
+	prk := mac(transcript, ikm)
+	return Keys{
+		Data:          expand(prk, "data"),
+		transcript:    transcript,
+		clientConfirm: expand(prk, "client confirm"),
+		serverConfirm: expand(prk, "server confirm"),
+	}
+}
+
+// ClientConfirm returns the confirmation the client sends to prove it derived
+// the keys.
+func (k Keys) ClientConfirm() []byte {
+	return mac(k.clientConfirm, k.transcript)
+}
+
+// VerifyClient returns true if the client confirmation is valid.
+func (k Keys) VerifyClient(confirm []byte) bool {
+	return hmac.Equal(confirm, k.ClientConfirm())
+}
+
+// ServerConfirm returns the confirmation the backend sends to prove it derived
+// the keys, binding whether it requires encrypted payloads.
+func (k Keys) ServerConfirm(encrypt bool) []byte {
+	flag := byte(0)
+	if encrypt {
+		flag = 1
+	}
+	return mac(k.serverConfirm, append(append([]byte{}, k.transcript...), flag))
+}
+
+// Ratchet returns the payload key of the next epoch. Previous keys can not be
+// derived from it.
+func Ratchet(key []byte) []byte {
+	return expand(key, "rekey")
+}
+
+// AdditionalData returns the authenticated data of a payload entry.
+func AdditionalData(assetID string, fileName string, seq uint64, epoch uint32, index int) []byte {
+	out := make([]byte, 16, 16+len(assetID)+1+len(fileName))
+	binary.BigEndian.PutUint64(out[0:], seq)
+	binary.BigEndian.PutUint32(out[8:], epoch)
+	binary.BigEndian.PutUint32(out[12:], uint32(index))
+	out = append(out, assetID...)
+	out = append(out, 0)
+	return append(out, fileName...)
+}
+
+// Session tracks the payload key, key epoch and last sequence number of an
+// ingestion connection on the backend.
+type Session struct {
+	assetID string // assetID is the ingestion client of the session
+	key     []byte // key is the payload key of the current epoch
+	epoch   uint32 // epoch is the current key epoch
+	seq     uint64 // seq is the last accepted frame sequence number
+}
+
+// NewSession returns the session of the ingestion client starting with the
+// derived payload key.
+func NewSession(assetID string, key []byte) *Session {
+	return &Session{assetID: assetID, key: key}
+}
+
+// Sequence accepts the sequence number of an unencrypted frame. It returns an
+// error if the sequence number is not increasing. Unencrypted frames are not
+// authenticated, so this does not block replay, only Open does.
+func (s *Session) Sequence(seq uint64) error {
+	if seq <= s.seq {
+		return errReplay
+	}
+	s.seq = seq
+	return nil
+}
+
+// Open authenticates and decrypts the entries of an encrypted frame. The frame
+// must have a higher sequence number than every previous frame and use the
+// current or next key epoch. The session only advances if every entry opens.
+func (s *Session) Open(fileName string, seq uint64, epoch uint32, entries [][]byte) ([][]byte, error) {
+	if seq <= s.seq {
+		return nil, errReplay
+	}
+	key := s.key
+	switch epoch {
+	case s.epoch:
+	case s.epoch + 1:
+		key = Ratchet(s.key)
+	default:
+		return nil, errEpoch
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(entries))
+	for i, entry := range entries {
+		if len(entry) < gcm.NonceSize() {
+			return nil, errShort
+		}
+		nonce, text := entry[:gcm.NonceSize()], entry[gcm.NonceSize():]
+		plain, err := gcm.Open(nil, nonce, text, AdditionalData(s.assetID, fileName, seq, epoch, i))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, plain)
+	}
+	s.key, s.epoch, s.seq = key, epoch, seq
+	return out, nil
+}
+
+// newGCM returns AES-256-GCM with the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(c)
+}
+
+// mac returns the HMAC-SHA256 of data.
+func mac(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// expand returns the first HKDF-SHA256 expand block for the label.
+func expand(prk []byte, label string) []byte {
+	return mac(prk, append([]byte(label), 1))
+}
+
+// Fingerprint returns the fingerprint of the public key shown to administrators
+// approving an ingestion client, the first 16 bytes of its SHA-256 hash.
+func Fingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	out := make([]string, 16)
+	for i := range out {
+		out[i] = hex.EncodeToString(sum[i : i+1])
+	}
+	return strings.Join(out, ":")
+}
@@ -0,0 +1,121 @@
+package kex
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func newKey(t *testing.T) *ecdh.PrivateKey {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// client derives the keys as the ingestion client does.
+func client(t *testing.T, identity, ephemeral *ecdh.PrivateKey, assetID string, serverEphemeral, serverStatic *ecdh.PublicKey, psk []byte) Keys {
+	ee, err := ephemeral.ECDH(serverEphemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := identity.ECDH(serverEphemeral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	se, err := ephemeral.ECDH(serverStatic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return derive(assetID, identity.PublicKey(), serverEphemeral, serverStatic, ephemeral.PublicKey(), ee, es, se, psk)
+}
+
+// seal encrypts the entries as the ingestion client does.
+func seal(t *testing.T, key []byte, assetID, fileName string, seq uint64, epoch uint32, entries ...string) [][]byte {
+	gcm, err := newGCM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := [][]byte{}
+	for i, entry := range entries {
+		nonce := make([]byte, gcm.NonceSize())
+		rand.Read(nonce)
+		out = append(out, gcm.Seal(nonce, nonce, []byte(entry), AdditionalData(assetID, fileName, seq, epoch, i)))
+	}
+	return out
+}
+
+func TestKeyAgreement(t *testing.T) {
+	static, ephemeral, identity, clientEphemeral := newKey(t), newKey(t), newKey(t), newKey(t)
+	psk := []byte("legacy")
+
+	server, err := Server(static, ephemeral, "asset1", identity.PublicKey(), clientEphemeral.PublicKey(), psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := client(t, identity, clientEphemeral, "asset1", ephemeral.PublicKey(), static.PublicKey(), psk)
+	if !bytes.Equal(server.Data, keys.Data) {
+		t.Fatal("derived payload keys differ")
+	}
+	if !server.VerifyClient(keys.ClientConfirm()) {
+		t.Error("client confirmation rejected")
+	}
+	if !bytes.Equal(server.ServerConfirm(true), keys.ServerConfirm(true)) || bytes.Equal(server.ServerConfirm(true), keys.ServerConfirm(false)) {
+		t.Error("server confirmation does not bind encryption requirement")
+	}
+
+	// a client without the pinned identity key can not confirm
+	impostor := client(t, newKey(t), clientEphemeral, "asset1", ephemeral.PublicKey(), static.PublicKey(), psk)
+	if server.VerifyClient(impostor.ClientConfirm()) {
+		t.Error("impostor identity confirmed")
+	}
+	// a backend without the static key derives different keys
+	fake, _ := Server(newKey(t), ephemeral, "asset1", identity.PublicKey(), clientEphemeral.PublicKey(), psk)
+	if bytes.Equal(fake.ServerConfirm(false), keys.ServerConfirm(false)) {
+		t.Error("impostor backend confirmed")
+	}
+	// the pre-shared key is bound
+	withoutPSK := client(t, identity, clientEphemeral, "asset1", ephemeral.PublicKey(), static.PublicKey(), nil)
+	if server.VerifyClient(withoutPSK.ClientConfirm()) {
+		t.Error("confirmed without pre-shared key")
+	}
+}
+
+func TestSession(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	s := NewSession("asset1", key)
+
+	out, err := s.Open("conn.log", 1, 0, seal(t, key, "asset1", "conn.log", 1, 0, "a", "b"))
+	if err != nil || len(out) != 2 || string(out[1]) != "b" {
+		t.Fatalf("failed to open frame: %v %q", err, out)
+	}
+	// replayed sequence number
+	if _, err := s.Open("conn.log", 1, 0, seal(t, key, "asset1", "conn.log", 1, 0, "a")); err != errReplay {
+		t.Errorf("expected replay error, got %v", err)
+	}
+	// sequence number not bound to ciphertext
+	if _, err := s.Open("conn.log", 3, 0, seal(t, key, "asset1", "conn.log", 2, 0, "a")); err == nil {
+		t.Error("opened entry sealed for another sequence number")
+	}
+	// file name bound to ciphertext
+	if _, err := s.Open("dns.log", 3, 0, seal(t, key, "asset1", "conn.log", 3, 0, "a")); err == nil {
+		t.Error("opened entry sealed for another file")
+	}
+	// next epoch
+	next := Ratchet(key)
+	if _, err := s.Open("conn.log", 4, 1, seal(t, next, "asset1", "conn.log", 4, 1, "c")); err != nil {
+		t.Errorf("failed to open frame of next epoch: %v", err)
+	}
+	// previous epoch keys are discarded
+	if _, err := s.Open("conn.log", 5, 0, seal(t, key, "asset1", "conn.log", 5, 0, "d")); err != errEpoch {
+		t.Errorf("expected epoch error, got %v", err)
+	}
+	if err := s.Sequence(4); err != errReplay {
+		t.Errorf("expected replay error, got %v", err)
+	}
+	if err := s.Sequence(6); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
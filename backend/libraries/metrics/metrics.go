@@ -0,0 +1,314 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package metrics provides counters, gauges and histograms exported in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets for latencies in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	// registryMutex guards registry
+	registryMutex sync.Mutex
+	// registry are the registered metrics by name
+	registry = map[string]metric{}
+)
+
+// metric is a registered metric family.
+type metric interface {
+	write(w io.Writer)
+}
+
+// register adds the metric to the registry. Registering a name twice is a
+// programming error and panics.
+func register(name string, m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry[name] = m
+}
+
+// Write writes every registered metric in the text exposition format, sorted
+// by name.
+func Write(w io.Writer) {
+	registryMutex.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	families := make([]metric, len(names))
+	for i, name := range names {
+		families[i] = registry[name]
+	}
+	registryMutex.Unlock()
+
+	for _, m := range families {
+		m.write(w)
+	}
+}
+
+// vec holds the series of a metric family by label values.
+type vec struct {
+	name   string              // name is the metric name
+	help   string              // help describes the metric
+	kind   string              // kind is the metric type
+	labels []string            // labels are the label names
+	mutex  sync.Mutex          // mutex guards series and their values
+	series map[string][]string // series are the label values by key
+}
+
+// key returns the series key of the label values. The number of values must
+// match the label names.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// keys returns the series keys sorted by label values. It must be called with
+// the mutex held.
+func (v *vec) keys() []string {
+	out := make([]string, 0, len(v.series))
+	for key := range v.series {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// header writes the help and type lines.
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, strings.ReplaceAll(v.help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+}
+
+// labelString formats the label pairs, with an optional extra pair such as a
+// histogram bucket.
+func labelString(names []string, values []string, extra ...string) string {
+	pairs := []string{}
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escape(values[i])+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escape(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escape escapes a label value.
+func escape(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// format formats a sample value.
+func format(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value for each combination of label
+// values.
+type Counter struct {
+	vec
+	values map[string]float64 // values are the counts by series key
+}
+
+// NewCounter registers and returns a counter.
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{
+		vec:    vec{name: name, help: help, kind: "counter", labels: labels, series: map[string][]string{}},
+		values: map[string]float64{},
+	}
+	register(name, c)
+	return c
+}
+
+// Inc increments the counter of the label values by one.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter of the label values. Negative deltas are ignored.
+func (c *Counter) Add(delta float64, values ...string) {
+	if delta < 0 {
+		return
+	}
+	key := c.key(values)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.series[key]; !ok {
+		c.series[key] = append([]string{}, values...)
+	}
+	c.values[key] += delta
+}
+
+// write writes the counter.
+func (c *Counter) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.header(w)
+	for _, key := range c.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelString(c.labels, c.series[key]), format(c.values[key]))
+	}
+}
+
+// Gauge is a value that can go up and down for each combination of label
+// values.
+type Gauge struct {
+	vec
+	values map[string]float64 // values are the values by series key
+}
+
+// NewGauge registers and returns a gauge.
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{
+		vec:    vec{name: name, help: help, kind: "gauge", labels: labels, series: map[string][]string{}},
+		values: map[string]float64{},
+	}
+	register(name, g)
+	return g
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(value float64, values ...string) {
+	key := g.key(values)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.series[key]; !ok {
+		g.series[key] = append([]string{}, values...)
+	}
+	g.values[key] = value
+}
+
+// Add adds the delta to the gauge of the label values.
+func (g *Gauge) Add(delta float64, values ...string) {
+	key := g.key(values)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if _, ok := g.series[key]; !ok {
+		g.series[key] = append([]string{}, values...)
+	}
+	g.values[key] += delta
+}
+
+// write writes the gauge.
+func (g *Gauge) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.header(w)
+	for _, key := range g.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labelString(g.labels, g.series[key]), format(g.values[key]))
+	}
+}
+
+// GaugeFunc is a gauge without labels whose value is read when written, such
+// as the length of a queue.
+type GaugeFunc struct {
+	vec
+	value func() float64 // value returns the current value
+}
+
+// NewGaugeFunc registers and returns a gauge reading its value from the
+// function.
+func NewGaugeFunc(name string, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{
+		vec:   vec{name: name, help: help, kind: "gauge"},
+		value: value,
+	}
+	register(name, g)
+	return g
+}
+
+// write writes the gauge.
+func (g *GaugeFunc) write(w io.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, format(g.value()))
+}
+
+// Histogram counts observations in cumulative buckets for each combination of
+// label values.
+type Histogram struct {
+	vec
+	buckets []float64           // buckets are the sorted upper bounds
+	counts  map[string][]uint64 // counts are the bucket counts by series key
+	sums    map[string]float64  // sums are the observation sums by series key
+	totals  map[string]uint64   // totals are the observation counts by series key
+}
+
+// NewHistogram registers and returns a histogram with the bucket upper bounds,
+// DefaultBuckets if nil.
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	h := &Histogram{
+		vec:     vec{name: name, help: help, kind: "histogram", labels: labels, series: map[string][]string{}},
+		buckets: buckets,
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+		totals:  map[string]uint64{},
+	}
+	register(name, h)
+	return h
+}
+
+// Observe records the value for the label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	key := h.key(values)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.series[key]; !ok {
+		h.series[key] = append([]string{}, values...)
+		h.counts[key] = make([]uint64, len(h.buckets))
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[key][i]++
+		}
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+// write writes the histogram.
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.header(w)
+	for _, key := range h.keys() {
+		values := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, values, "le", format(bound)), h.counts[key][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, values, "le", "+Inf"), h.totals[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, values), format(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, values), h.totals[key])
+	}
+}
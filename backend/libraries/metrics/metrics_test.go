@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	frames := NewCounter("test_frames_total", "Frames received.", "asset")
+	frames.Inc("b")
+	frames.Add(2, "a")
+	frames.Add(-1, "a")
+	NewGaugeFunc("test_queue_depth", "Queued frames.", func() float64 { return 3 })
+	latency := NewHistogram("test_latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	latency.Observe(0.05, `/a"b`)
+	latency.Observe(0.5, `/a"b`)
+
+	var out bytes.Buffer
+	Write(&out)
+	expected := strings.Join([]string{
+		`# HELP test_frames_total Frames received.`,
+		`# TYPE test_frames_total counter`,
+		`test_frames_total{asset="a"} 2`,
+		`test_frames_total{asset="b"} 1`,
+		`# HELP test_latency_seconds Latency.`,
+		`# TYPE test_latency_seconds histogram`,
+		`test_latency_seconds_bucket{route="/a\"b",le="0.1"} 1`,
+		`test_latency_seconds_bucket{route="/a\"b",le="1"} 2`,
+		`test_latency_seconds_bucket{route="/a\"b",le="+Inf"} 2`,
+		`test_latency_seconds_sum{route="/a\"b"} 0.55`,
+		`test_latency_seconds_count{route="/a\"b"} 2`,
+		`# HELP test_queue_depth Queued frames.`,
+		`# TYPE test_queue_depth gauge`,
+		`test_queue_depth 3`,
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	NewGauge("test_duplicate", "Duplicate.")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic registering duplicate metric")
+		}
+	}()
+	NewGauge("test_duplicate", "Duplicate.")
+}
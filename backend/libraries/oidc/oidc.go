@@ -0,0 +1,300 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package oidc provides an OpenID Connect relying party using the
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	errIssuer   = errors.New("oidc: issuer mismatch")                     // error for mismatching "iss"
+	errAudience = errors.New("oidc: token not issued for client")         // error for mismatching "aud"
+	errParty    = errors.New("oidc: token not authorized for client")     // error for mismatching "azp"
+	errNonce    = errors.New("oidc: nonce mismatch")                      // error for mismatching "nonce"
+	errKey      = errors.New("oidc: token signed with unknown key")       // error for unknown "kid"
+	errMethod   = errors.New("oidc: token signed with unexpected method") // error for non RS256 tokens
+	errNoToken  = errors.New("oidc: token response without id_token")     // error for missing ID token
+)
+
+// Provider is an OpenID Connect identity provider configured for a client.
+type Provider struct {
+	Issuer       string       // Issuer is the issuer URL of the provider
+	AuthURL      string       // AuthURL is the authorization endpoint
+	TokenURL     string       // TokenURL is the token endpoint
+	JWKSURL      string       // JWKSURL is the JSON web key set endpoint
+	ClientID     string       // ClientID is the client identifier registered with the provider
+	ClientSecret string       // ClientSecret is the client secret, empty for public clients
+	RedirectURL  string       // RedirectURL is the callback registered with the provider
+	Scopes       []string     // Scopes are requested in addition to "openid"
+	Client       *http.Client // Client performs requests to the provider
+}
+
+// Claims are the verified claims of an ID token.
+type Claims map[string]interface{}
+
+// discovery is the format of the provider metadata document.
+type discovery struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+// Discover takes the issuer URL and client registration, reading the provider
+// metadata from "/.well-known/openid-configuration". It returns the configured
+// provider or an error.
+func Discover(ctx context.Context, issuer string, clientID string, clientSecret string, redirectURL string, scopes []string) (*Provider, error) {
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		Client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	var d discovery
+	err := p.getJSON(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return nil, err
+	}
+	// the issuer must match exactly, https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfigurationValidation
+	if d.Issuer != strings.TrimSuffix(issuer, "/") && d.Issuer != issuer {
+		return nil, errIssuer
+	}
+	if d.AuthURL == "" || d.TokenURL == "" || d.JWKSURL == "" {
+		return nil, errors.New("oidc: incomplete provider metadata")
+	}
+	p.Issuer, p.AuthURL, p.TokenURL, p.JWKSURL = d.Issuer, d.AuthURL, d.TokenURL, d.JWKSURL
+	return p, nil
+}
+
+// RandomString returns a URL safe random string of the provided number of
+// bytes of entropy, or an error.
+func RandomString(length int) (string, error) {
+	buff := make([]byte, length)
+	_, err := rand.Read(buff)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buff), nil
+}
+
+// Challenge returns the S256 PKCE code challenge of the code verifier.
+func Challenge(verifier string) string {
+	hash := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// AuthCodeURL returns the authorization endpoint URL to redirect the browser
+// to, with the state, nonce and PKCE code challenge.
+func (p *Provider) AuthCodeURL(state string, nonce string, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientID)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("scope", strings.Join(append([]string{"openid"}, p.Scopes...), " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.AuthURL + sep + v.Encode()
+}
+
+// Exchange redeems the authorization code with the PKCE code verifier at the
+// token endpoint, returning the raw ID token or an error.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string) (string, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.RedirectURL)
+	v.Set("client_id", p.ClientID)
+	v.Set("code_verifier", verifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var token struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc: token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.Description)
+	}
+	if token.IDToken == "" {
+		return "", errNoToken
+	}
+	return token.IDToken, nil
+}
+
+// Verify validates the signature, issuer, audience, authorized party, expiry
+// and nonce of the raw ID token, returning its claims or an error. Only RS256 signatures are
+// accepted.
+func (p *Provider) Verify(ctx context.Context, raw string, nonce string) (Claims, error) {
+	keys, err := p.keys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := jwt.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodRS256 {
+			return nil, errMethod
+		}
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := keys[kid]; ok {
+			return key, nil
+		}
+		// providers without key IDs publish a single key
+		if kid == "" && len(keys) == 1 {
+			for _, key := range keys {
+				return key, nil
+			}
+		}
+		return nil, errKey
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("oidc: invalid token")
+	}
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return nil, errIssuer
+	}
+	if !Claims(claims).Contains("aud", p.ClientID) {
+		return nil, errAudience
+	}
+	// a token issued for several clients names the client it was issued to
+	if _, ok := claims["azp"]; ok || len(Claims(claims).Strings("aud")) > 1 {
+		if Claims(claims).String("azp") != p.ClientID {
+			return nil, errParty
+		}
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("oidc: token without expiry")
+	}
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errNonce
+	}
+	return Claims(claims), nil
+}
+
+// String returns the string claim, or an empty string.
+func (c Claims) String(name string) string {
+	str, _ := c[name].(string)
+	return str
+}
+
+// Strings returns a claim that is a string or a list of strings.
+func (c Claims) Strings(name string) []string {
+	switch value := c[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		out := []string{}
+		for _, v := range value {
+			if str, ok := v.(string); ok {
+				out = append(out, str)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Contains returns true if the claim is or contains the value.
+func (c Claims) Contains(name string, value string) bool {
+	for _, v := range c.Strings(name) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// keys fetches the RSA signing keys of the provider, keyed by key ID.
+func (p *Provider) keys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	err := p.getJSON(ctx, p.JWKSURL, &set)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]*rsa.PublicKey{}
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		out[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return out, nil
+}
+
+// getJSON decodes the JSON document at the URL into out.
+func (p *Provider) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc: %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mockIdP is a minimal OpenID Connect provider issuing one code.
+type mockIdP struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	code      string
+	challenge string   // challenge of the authorization request
+	nonce     string   // nonce of the authorization request
+	audience  string   // audience of issued tokens
+	others    []string // others are the other audiences of issued tokens
+	party     string   // party is the authorized party of issued tokens, if set
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{key: key, code: "code123", audience: "canids"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != m.code || Challenge(r.Form.Get("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":    m.server.URL,
+			"sub":    "1234",
+			"aud":    append([]string{m.audience}, m.others...),
+			"exp":    time.Now().Add(time.Minute).Unix(),
+			"iat":    time.Now().Unix(),
+			"nonce":  m.nonce,
+			"email":  "user@example.com",
+			"groups": []string{"soc-analysts", "staff"},
+		}
+		if m.party != "" {
+			claims["azp"] = m.party
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize simulates the browser following the authorization URL.
+func (m *mockIdP) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("expected S256 challenge, got %q", q.Get("code_challenge_method"))
+	}
+	m.challenge, m.nonce = q.Get("code_challenge"), q.Get("nonce")
+}
+
+func TestLogin(t *testing.T) {
+	m := newMockIdP(t)
+	ctx := context.Background()
+	p, err := Discover(ctx, m.server.URL, "canids", "secret", "http://localhost/api/auth/oidc/callback", []string{"email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := RandomString(32)
+	nonce, _ := RandomString(16)
+	m.authorize(t, p.AuthCodeURL("state", nonce, verifier))
+
+	raw, err := p.Exchange(ctx, m.code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.Verify(ctx, raw, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.String("email") != "user@example.com" {
+		t.Errorf("unexpected email %q", claims.String("email"))
+	}
+	if !claims.Contains("groups", "soc-analysts") {
+		t.Errorf("expected group soc-analysts in %v", claims.Strings("groups"))
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	m := newMockIdP(t)
+	ctx := context.Background()
+	p, err := Discover(ctx, m.server.URL, "canids", "", "http://localhost/api/auth/oidc/callback", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := RandomString(32)
+	m.authorize(t, p.AuthCodeURL("state", "nonce", verifier))
+
+	// wrong PKCE verifier
+	if _, err := p.Exchange(ctx, m.code, "other"); err == nil {
+		t.Error("expected exchange with wrong verifier to fail")
+	}
+	raw, err := p.Exchange(ctx, m.code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wrong nonce
+	if _, err := p.Verify(ctx, raw, "other"); err != errNonce {
+		t.Errorf("expected nonce error, got %v", err)
+	}
+	// wrong audience
+	m.audience = "other"
+	raw, err = p.Exchange(ctx, m.code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(ctx, raw, "nonce"); err != errAudience {
+		t.Errorf("expected audience error, got %v", err)
+	}
+}
+
+func TestAuthorizedParty(t *testing.T) {
+	m := newMockIdP(t)
+	ctx := context.Background()
+	p, err := Discover(ctx, m.server.URL, "canids", "", "http://localhost/api/auth/oidc/callback", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, _ := RandomString(32)
+	m.authorize(t, p.AuthCodeURL("state", "nonce", verifier))
+
+	m.others = []string{"other"}
+	for _, c := range []struct {
+		party string
+		err   error
+	}{
+		{"", errParty},      // several audiences require azp
+		{"other", errParty}, // issued to another client
+		{"canids", nil},     // issued to this client
+	} {
+		m.party = c.party
+		raw, err := p.Exchange(ctx, m.code, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Verify(ctx, raw, "nonce"); err != c.err {
+			t.Errorf("azp %q: expected %v, got %v", c.party, c.err, err)
+		}
+	}
+
+	// azp is checked even for a single audience
+	m.others, m.party = nil, "other"
+	raw, err := p.Exchange(ctx, m.code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(ctx, raw, "nonce"); err != errParty {
+		t.Errorf("expected authorized party error, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// newCSR returns a PEM encoded certificate signing request and its key.
+func newCSR(t *testing.T, commonName string) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), key
+}
+
+func newCA(t *testing.T) *CA {
+	certPEM, keyPEM, err := NewCA("CanIDS Test CA", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func TestSignClient(t *testing.T) {
+	ca := newCA(t)
+	csr, _ := newCSR(t, "asset1")
+	if _, _, err := ca.SignClient(csr, "asset2", time.Hour); err != errCommonName {
+		t.Errorf("expected common name error, got %v", err)
+	}
+	certPEM, serial, err := ca.SignClient(csr, "asset1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Serial(cert) != serial {
+		t.Errorf("serial %s does not match %s", Serial(cert), serial)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     ca.Pool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Errorf("client certificate does not verify: %v", err)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newCA(t)
+	server, err := ca.ServerCertificate([]string{"127.0.0.1", "localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, key := newCSR(t, "asset1")
+	certPEM, _, err := ca.SignClient(csr, "asset1", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	client, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{server},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	peer := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			peer <- ""
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if tlsConn.Handshake() != nil || len(tlsConn.ConnectionState().PeerCertificates) == 0 {
+			peer <- ""
+			return
+		}
+		peer <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+		io.WriteString(conn, "ok")
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	conn, err := tls.Dial("tcp", "localhost:"+port, &tls.Config{
+		RootCAs:      ca.Pool(),
+		Certificates: []tls.Certificate{client},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.ReadAll(conn)
+	if name := <-peer; name != "asset1" {
+		t.Errorf("expected peer asset1, got %q", name)
+	}
+}
@@ -11,10 +11,27 @@ import (
 	"github.com/elastic/go-elasticsearch/v8/esapi"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/elasticsearch"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/ipsetmgr"
+	"github.com/mcmaster-circ/canids-v2/backend/libraries/metrics"
 	"github.com/mcmaster-circ/canids-v2/backend/libraries/uuid"
 	"github.com/mcmaster-circ/canids-v2/backend/state"
 )
 
+var (
+	// provisionDuration is the time to download and load the blacklists
+	provisionDuration = metrics.NewHistogram("canids_blacklist_provision_duration_seconds",
+		"Time to download the alarm blacklists and load them into the alarm IP sets.",
+		[]float64{1, 5, 15, 30, 60, 120, 300, 600})
+	// provisionFailures counts failed provisions
+	provisionFailures = metrics.NewCounter("canids_blacklist_provision_failures_total",
+		"Alarm blacklist provisions that failed to download a blacklist.")
+	// provisionLast is the time of the last successful provision
+	provisionLast = metrics.NewGauge("canids_blacklist_provision_last_success_timestamp_seconds",
+		"Unix time of the last successful alarm blacklist provision.")
+	// blacklistSize is the number of entries of each blacklist
+	blacklistSize = metrics.NewGauge("canids_blacklist_entries",
+		"Addresses and networks loaded from each alarm blacklist.", "list")
+)
+
 // Provision will accept: a map of ip set names to their urls, a time interval to schedule provisioning,
 // and an IPSetsManager instance. It will regularly provision the ipsetmgr with the contents of the url
 // based on the given time interval.
@@ -81,15 +98,18 @@ func ProvisionOnce(
 	ipSetsMgr *ipsetmgr.IPSetsManager,
 ) error {
 	t0 := time.Now()
+	start := t0
 	loadedSets := make(map[string][]string)
 	for name, url := range urls {
 		resp, err := http.Get(url)
 		if err != nil {
+			provisionFailures.Inc()
 			return err
 		}
 
 		bodyBytes, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
+			provisionFailures.Inc()
 			return err
 		}
 
@@ -101,6 +121,11 @@ func ProvisionOnce(
 	ipSetsMgr.ReloadIPs(loadedSets)
 	fmt.Printf("Update ip set manager: %d ms\n", time.Now().Sub(t0).Milliseconds())
 
+	provisionDuration.Observe(time.Since(start).Seconds())
+	provisionLast.Set(float64(time.Now().Unix()))
+	for name, ips := range loadedSets {
+		blacklistSize.Set(float64(len(ips)), name)
+	}
 	return nil
 }
 
@@ -0,0 +1,105 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+// Package totp provides time-based one-time passwords (RFC 6238) compatible
+// with common authenticator apps.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is 30 seconds, how long a code is valid for
+	Period = 30
+	// Digits is the number of digits of a code
+	Digits = 6
+	// Skew is the number of periods before and after the current period that
+	// are accepted to allow for clock drift
+	Skew = 1
+	// SecretLength is length of the shared secret
+	SecretLength = 20 // bytes (160 bits), recommended by https://tools.ietf.org/html/rfc4226#section-4
+)
+
+// encoding is unpadded base32, as expected by authenticator apps.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new base32 encoded shared secret or an error.
+func GenerateSecret() (string, error) {
+	buff := make([]byte, SecretLength)
+	_, err := rand.Read(buff)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(buff), nil
+}
+
+// URI returns the "otpauth://" provisioning URI for the secret, to be shown as
+// a QR code.
+func URI(issuer string, account string, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(Period))
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Code returns the code of the secret for the time step, or an error if the
+// secret is not valid base32.
+func Code(secret string, step int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	// dynamic truncation, https://tools.ietf.org/html/rfc4226#section-5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%mod), nil
+}
+
+// Step returns the time step of the time.
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Validate checks the code against the secret at the time, allowing Skew
+// periods of drift. It returns the matching time step, or false if the code is
+// not valid. Callers should reject steps already used to prevent replay.
+func Validate(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for step := now - Skew; step <= now+Skew; step++ {
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,49 @@
+package totp
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// TestCode checks the SHA1 test vectors of RFC 6238 Appendix B, truncated to 6
+// digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := Code(secret, Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != expected {
+			t.Errorf("time %d: expected %s, got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := Code(secret, Step(now.Add(-Period*time.Second)))
+	if step, ok := Validate(secret, code, now); !ok || step != Step(now)-1 {
+		t.Errorf("expected previous period code to be accepted")
+	}
+	code, _ = Code(secret, Step(now.Add(-2*Period*time.Second)))
+	if _, ok := Validate(secret, code, now); ok {
+		t.Errorf("expected code outside skew to be rejected")
+	}
+	if _, ok := Validate(secret, "12345", now); ok {
+		t.Errorf("expected short code to be rejected")
+	}
+}
@@ -6,13 +6,25 @@ package state
 
 import (
 	"errors"
+	"net"
 	"os"
+	"strings"
 )
 
 // Config is the environment variable configuration for the backend.
 type Config struct {
 	ElasticHost string // ElasticHost is the hostname of Elasticsearch
 	ElasticPort string // ElasticPort is the port of Elasticsearch
+
+	ListenAddr   string   // ListenAddr is the address of the backend server, ":6060" by default
+	TLSCertFile  string   // TLSCertFile is the PEM certificate chain served over TLS, reloaded when changed
+	TLSKeyFile   string   // TLSKeyFile is the PEM private key of TLSCertFile
+	ACMEDomains  []string // ACMEDomains are the domains to obtain certificates for with ACME, instead of TLSCertFile
+	ACMEEmail    string   // ACMEEmail is the contact address of the ACME account
+	ACMECacheDir string   // ACMECacheDir is where ACME certificates and the account key are stored
+	ACMEHTTPAddr string   // ACMEHTTPAddr is the address answering ACME HTTP-01 challenges, ":80" by default
+
+	TrustedProxies []*net.IPNet // TrustedProxies are the reverse proxies allowed to set "X-Real-IP"
 }
 
 // load will attempt to load the required environment variables into the Config
@@ -28,5 +40,80 @@ func (c *Config) load() error {
 		return errors.New("env ELASTIC_PORT not defined")
 	}
 
+	// TLS parameters, optional
+	c.ListenAddr = getenv("LISTEN_ADDR", ":6060")
+	c.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	c.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("env TLS_CERT_FILE and TLS_KEY_FILE must be defined together")
+	}
+	c.ACMEDomains = split(os.Getenv("ACME_DOMAINS"))
+	if len(c.ACMEDomains) > 0 && c.TLSCertFile != "" {
+		return errors.New("env ACME_DOMAINS can not be defined with TLS_CERT_FILE")
+	}
+	c.ACMEEmail = os.Getenv("ACME_EMAIL")
+	c.ACMECacheDir = getenv("ACME_CACHE_DIR", "acme")
+	c.ACMEHTTPAddr = getenv("ACME_HTTP_ADDR", ":80")
+
+	// reverse proxies, addresses or CIDR ranges
+	for _, proxy := range split(os.Getenv("TRUSTED_PROXIES")) {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return errors.New("env TRUSTED_PROXIES has invalid address " + proxy)
+		}
+		c.TrustedProxies = append(c.TrustedProxies, network)
+	}
+
 	return nil
 }
+
+// TLSEnabled returns true if the backend server serves TLS itself.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.ACMEDomains) > 0
+}
+
+// TrustedProxy returns true if the remote address of a request is a trusted
+// reverse proxy.
+func (c *Config) TrustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getenv returns the environment variable, or the fallback if it is not
+// defined.
+func getenv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// split returns the non-empty comma separated values.
+func split(value string) []string {
+	out := []string{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
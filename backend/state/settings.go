@@ -38,8 +38,56 @@ type Settings struct {
 	UserActivated    bool // UserActivated indicates if user is automatically activated after registration
 
 	DebugLogging bool // DebugLogging indicates if debug logging should be performed
+
+	OIDCEnabled       bool   // OIDCEnabled indicates if OpenID Connect single sign-on is offered
+	OIDCIssuer        string // OIDCIssuer is the issuer URL of the identity provider
+	OIDCClientID      string // OIDCClientID is the client identifier registered with the identity provider
+	OIDCClientSecret  string // OIDCClientSecret is the client secret, empty for public clients
+	OIDCScopes        string // OIDCScopes are the space separated scopes requested in addition to "openid"
+	OIDCGroupsClaim   string // OIDCGroupsClaim is the ID token claim listing the user groups
+	OIDCRoleMapping   string // OIDCRoleMapping maps groups to roles, e.g. "soc-admins=admin,soc=standard"
+	OIDCDefaultRole   string // OIDCDefaultRole is the role of users without a mapped group, empty denies them
+	OIDCLinkLocal     bool   // OIDCLinkLocal indicates if single sign-on may log into local accounts with the same email
+	LocalLoginDisable bool   // LocalLoginDisable indicates if password login, registration and resets are disabled
+
+	MFAEnforce string // MFAEnforce is "none", "admins" or "all", the users that must use TOTP to log in
+
+	IngestionMTLSRequired bool // IngestionMTLSRequired indicates if ingestion clients must present a client certificate
+
+	MetricsToken string // MetricsToken is the bearer token required to read /metrics, empty disables the endpoint
 }
 
+var (
+	// defaultSettings are indexed when missing from the configuration index
+	defaultSettings = []DocumentSetting{
+		{"MAIL_SERVICE", "NONE", false},
+		{"MAIL_URL", "", false},
+		{"MAIL_API_KEY", "", false},
+		{"MAIL_FROM_ADDRESS", "", false},
+		{"MAIL_FROM_NAME", "", false},
+		{"MAIL_DOMAIN", "", false},
+		{"MIDDLEWARE_DISABLE", "false", true},
+		{"HTTPS_ENABLED", "false", true},
+		{"USER_REGISTRATION", "true", false},
+		{"USER_ACTIVATED", "false", false},
+		{"DEBUG_LOGGING", "true", true},
+		{"ACCESS_URL", "", false},
+		{"OIDC_ENABLED", "false", false},
+		{"OIDC_ISSUER", "", false},
+		{"OIDC_CLIENT_ID", "", false},
+		{"OIDC_CLIENT_SECRET", "", false},
+		{"OIDC_SCOPES", "email profile", true},
+		{"OIDC_GROUPS_CLAIM", "groups", true},
+		{"OIDC_ROLE_MAPPING", "", false},
+		{"OIDC_DEFAULT_ROLE", "", false},
+		{"OIDC_LINK_LOCAL", "false", false},
+		{"LOCAL_LOGIN_DISABLE", "false", true},
+		{"MFA_ENFORCE", "none", false},
+		{"INGESTION_MTLS_REQUIRED", "false", true},
+		{"METRICS_TOKEN", "", true},
+	}
+)
+
 type Service int64
 
 const (
@@ -59,28 +107,25 @@ func (settings *Settings) init(s *State) error {
 	}
 
 	if !exists {
-		defaultSettings := []DocumentSetting{
-			{"MAIL_SERVICE", "NONE", false},
-			{"MAIL_URL", "", false},
-			{"MAIL_API_KEY", "", false},
-			{"MAIL_FROM_ADDRESS", "", false},
-			{"MAIL_FROM_NAME", "", false},
-			{"MAIL_DOMAIN", "", false},
-			{"MIDDLEWARE_DISABLE", "false", true},
-			{"HTTPS_ENABLED", "false", true},
-			{"USER_REGISTRATION", "true", false},
-			{"USER_ACTIVATED", "false", false},
-			{"DEBUG_LOGGING", "true", true},
-			{"ACCESS_URL", "", false},
-		}
-
 		s.Elastic.Indices.Create(indexConfiguration).Do(s.ElasticCtx)
-		for _, setting := range defaultSettings {
-			_, err := setting.index(s)
-			if err != nil {
-				s.Log.Error("error indexing new setting ", err)
-				return nil
-			}
+	}
+	// index settings missing from the index, e.g. added by an upgrade
+	existing, err := AllSettings(s)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for _, setting := range existing {
+		names[setting.Name] = true
+	}
+	for _, setting := range defaultSettings {
+		if names[setting.Name] {
+			continue
+		}
+		_, err := setting.index(s)
+		if err != nil {
+			s.Log.Error("error indexing new setting ", err)
+			return nil
 		}
 	}
 
@@ -229,6 +274,32 @@ func refreshSetting(s *State, name string, value string) error {
 		s.Settings.UserRegistration = value == "true"
 	case "USER_ACTIVATED":
 		s.Settings.UserActivated = value == "true"
+	case "OIDC_ENABLED":
+		s.Settings.OIDCEnabled = value == "true"
+	case "OIDC_ISSUER":
+		s.Settings.OIDCIssuer = value
+	case "OIDC_CLIENT_ID":
+		s.Settings.OIDCClientID = value
+	case "OIDC_CLIENT_SECRET":
+		s.Settings.OIDCClientSecret = value
+	case "OIDC_SCOPES":
+		s.Settings.OIDCScopes = value
+	case "OIDC_GROUPS_CLAIM":
+		s.Settings.OIDCGroupsClaim = value
+	case "OIDC_ROLE_MAPPING":
+		s.Settings.OIDCRoleMapping = value
+	case "OIDC_DEFAULT_ROLE":
+		s.Settings.OIDCDefaultRole = value
+	case "OIDC_LINK_LOCAL":
+		s.Settings.OIDCLinkLocal = value == "true"
+	case "LOCAL_LOGIN_DISABLE":
+		s.Settings.LocalLoginDisable = value == "true"
+	case "MFA_ENFORCE":
+		s.Settings.MFAEnforce = value
+	case "INGESTION_MTLS_REQUIRED":
+		s.Settings.IngestionMTLSRequired = value == "true"
+	case "METRICS_TOKEN":
+		s.Settings.MetricsToken = value
 	case "DEBUG_LOGGING":
 		s.Settings.DebugLogging = value == "true"
 		if s.Settings.DebugLogging {
@@ -256,7 +327,7 @@ func (d *DocumentSetting) index(s *State) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return result.Id_, nil 
+	return result.Id_, nil
 }
 
 // Update will attempt to update the document in the "configuration" with the provided
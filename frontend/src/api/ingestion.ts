@@ -1,7 +1,9 @@
 import {
   ApproveClientProps,
+  AssetGroupProps,
   DeleteClientProps,
   RenameClientProps,
+  UpdateClientProps,
 } from '@constants/types/ingestionPropsTypes'
 
 import { get, post } from './fetchRequests'
@@ -39,3 +41,53 @@ export const ingestionRename = async ({
   const data = await post({ url: baseUrl + '/ingestion/rename', body: params })
   return data
 }
+
+export const ingestionUpdate = async ({
+  params,
+}: {
+  params: UpdateClientProps
+}) => {
+  const data = await post({ url: baseUrl + '/ingestion/update', body: params })
+  return data
+}
+
+export const assetGroupList = async () => {
+  const data = await get({ url: baseUrl + '/ingestion/group/list' })
+  return data?.groups
+}
+
+export const assetGroupAdd = async ({
+  params,
+}: {
+  params: Omit<AssetGroupProps, 'uuid'>
+}) => {
+  const data = await post({
+    url: baseUrl + '/ingestion/group/add',
+    body: params,
+  })
+  return data
+}
+
+export const assetGroupUpdate = async ({
+  params,
+}: {
+  params: AssetGroupProps
+}) => {
+  const data = await post({
+    url: baseUrl + '/ingestion/group/update',
+    body: params,
+  })
+  return data
+}
+
+export const assetGroupDelete = async ({
+  params,
+}: {
+  params: DeleteClientProps
+}) => {
+  const data = await post({
+    url: baseUrl + '/ingestion/group/delete',
+    body: params,
+  })
+  return data
+}
@@ -88,6 +88,7 @@ export default () => {
                       action: () => {
                         var props: ApproveClientProps = {
                           uuid: row.uuid,
+                          fingerprint: row.fingerprint,
                         }
                         approveRequest(props)
                         setTimeout(() => makeRequest(), 3000)
@@ -125,6 +126,7 @@ export default () => {
                       action: () => {
                         var props: ApproveClientProps = {
                           uuid: row.uuid,
+                          fingerprint: row.fingerprint,
                         }
                         approveRequest(props)
                         setTimeout(() => makeRequest(), 3000)
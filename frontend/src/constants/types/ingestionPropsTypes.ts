@@ -8,6 +8,7 @@ export interface DeleteClientProps {
 
 export interface ApproveClientProps {
   uuid: string
+  fingerprint: string
 }
 
 export interface RenameClientProps {
@@ -18,3 +19,22 @@ export interface RenameClientProps {
 export interface RenameNameHouser {
   name: string
 }
+
+export interface UpdateClientProps {
+  uuid: string
+  name: string
+  site: string
+  location: string
+  description: string
+  segments: string[]
+  tags: string[]
+  owner: string
+  criticality: '' | 'low' | 'medium' | 'high' | 'critical'
+  groups: string[]
+}
+
+export interface AssetGroupProps {
+  uuid: string
+  name: string
+  description: string
+}
@@ -13,6 +13,16 @@ export const getHeaders = (token?: string): {} =>
       }
     : {}
 
+// CSRF token issued by the backend with the session, required on state
+// changing requests authenticated by cookie
+export const csrfToken = (): string =>
+  typeof document === 'undefined'
+    ? ''
+    : document.cookie
+        .split('; ')
+        .find((cookie) => cookie.startsWith('X-CSRF='))
+        ?.substring('X-CSRF='.length) ?? ''
+
 export const postHeaders = (token?: string): {} =>
   token
     ? {
@@ -21,4 +31,5 @@ export const postHeaders = (token?: string): {} =>
       }
     : {
         // 'Content-Type': 'application/json',
+        'X-CSRF-Token': csrfToken(),
       }
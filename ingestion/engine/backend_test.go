@@ -0,0 +1,315 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+// mockWindow is the number of data frames a client of the mock backend may
+// send before waiting for credits
+const mockWindow = 4
+
+// mockBackend is an in-process backend speaking the ingestion WebSocket
+// protocol: approval, key exchange, flow credits and data frames. Data frames
+// are decrypted and acknowledged as soon as they are received.
+type mockBackend struct {
+	t        *testing.T
+	server   *httptest.Server
+	static   *ecdh.PrivateKey
+	encrypt  bool                // encrypt requires clients to encrypt payloads
+	approval chan struct{}       // approval approves a client awaiting approval, nil approves clients at once
+	frames   chan *UploadRequest // frames are the data frames received
+	mutex    sync.Mutex          // mutex guards the fields below
+	conns    []*mockConn         // conns are the open connections
+	accepted int                 // accepted is the number of connections accepted
+	statuses []*Status           // statuses are the status reports received
+}
+
+// mockConn is a connection to the mock backend.
+type mockConn struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc // cancel stops serving the connection
+}
+
+// newMockBackend starts a mock backend, closed when the test ends.
+func newMockBackend(t *testing.T) *mockBackend {
+	static, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mockBackend{
+		t:      t,
+		static: static,
+		frames: make(chan *UploadRequest, 1000),
+	}
+	b.server = httptest.NewServer(http.HandlerFunc(b.handle))
+	t.Cleanup(func() {
+		b.drop()
+		b.server.Close()
+	})
+	return b
+}
+
+// url returns the WebSocket URL of the backend.
+func (b *mockBackend) url() string {
+	return "ws" + strings.TrimPrefix(b.server.URL, "http") + "/websocket/"
+}
+
+// connections returns the number of connections accepted.
+func (b *mockBackend) connections() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.accepted
+}
+
+// status returns the latest status report received, or nil if none.
+func (b *mockBackend) status() *Status {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if len(b.statuses) == 0 {
+		return nil
+	}
+	return b.statuses[len(b.statuses)-1]
+}
+
+// drop closes the open connections, as if the backend restarted.
+func (b *mockBackend) drop() {
+	b.mutex.Lock()
+	conns := b.conns
+	b.conns = nil
+	b.mutex.Unlock()
+	for _, c := range conns {
+		c.cancel()
+		c.conn.Close(websocket.StatusGoingAway, "backend restarting")
+	}
+}
+
+// lines returns the payload entries of the data frames received until count
+// entries are received, failing the test after the timeout.
+func (b *mockBackend) lines(count int, timeout time.Duration) []map[string]interface{} {
+	b.t.Helper()
+	out := []map[string]interface{}{}
+	expired := time.After(timeout)
+	for len(out) < count {
+		select {
+		case frame := <-b.frames:
+			for _, entry := range frame.Payload {
+				var line map[string]interface{}
+				err := json.Unmarshal(entry, &line)
+				if err != nil {
+					b.t.Fatalf("invalid payload entry %q: %s", entry, err)
+				}
+				out = append(out, line)
+			}
+		case <-expired:
+			b.t.Fatalf("received %d of %d lines", len(out), count)
+		}
+	}
+	return out
+}
+
+// handle serves a connection of an ingestion client.
+func (b *mockBackend) handle(w http.ResponseWriter, r *http.Request) {
+	raw, err := base64.StdEncoding.DecodeString(r.Header.Get("Authorization"))
+	if err != nil {
+		http.Error(w, "bad authorization", http.StatusUnauthorized)
+		return
+	}
+	var auth Authorization
+	err = json.Unmarshal(raw, &auth)
+	if err != nil {
+		http.Error(w, "bad authorization", http.StatusUnauthorized)
+		return
+	}
+	identity, err := publicKey(auth.IdentityKey)
+	if err != nil {
+		http.Error(w, "bad identity key", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	b.mutex.Lock()
+	b.conns = append(b.conns, &mockConn{conn: conn, cancel: cancel})
+	b.accepted++
+	b.mutex.Unlock()
+	defer conn.Close(websocket.StatusInternalError, "WebSocket closed")
+
+	if b.approval != nil {
+		wsjson.Write(ctx, conn, Message{MsgType: 3})
+		wsjson.Write(ctx, conn, Message{MsgType: 1})
+		var pong UploadRequest
+		err = wsjson.Read(ctx, conn, &pong)
+		if err != nil || pong.Header.MsgType != 1 {
+			return
+		}
+		select {
+		case <-b.approval:
+		case <-ctx.Done():
+			return
+		}
+		wsjson.Write(ctx, conn, Message{MsgType: 4})
+	} else {
+		wsjson.Write(ctx, conn, Message{MsgType: 2})
+	}
+
+	key, err := b.exchange(ctx, conn, auth.AssetID, identity)
+	if err != nil {
+		b.t.Log("mock backend key exchange failed:", err)
+		return
+	}
+	wsjson.Write(ctx, conn, Message{MsgType: 2})
+	wsjson.Write(ctx, conn, Message{MsgType: 6, Credits: mockWindow})
+
+	for {
+		var frame UploadRequest
+		err = wsjson.Read(ctx, conn, &frame)
+		if err != nil {
+			return
+		}
+		switch frame.Header.MsgType {
+		case 0:
+			if b.encrypt && !frame.Header.Encrypted {
+				b.t.Error("mock backend received unencrypted frame")
+				return
+			}
+			if frame.Header.Encrypted {
+				frame.Payload, err = open(key, auth.AssetID, &frame)
+				if err != nil {
+					b.t.Error("mock backend failed to decrypt frame:", err)
+					return
+				}
+			}
+			b.frames <- &frame
+			wsjson.Write(ctx, conn, Message{MsgType: 6, Credits: 1})
+		case 2:
+			b.mutex.Lock()
+			b.statuses = append(b.statuses, frame.Status)
+			b.mutex.Unlock()
+		}
+	}
+}
+
+// exchange performs the key agreement of the backend. It returns the payload
+// key of the connection.
+func (b *mockBackend) exchange(ctx context.Context, conn *websocket.Conn, assetID string, identity *ecdh.PublicKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	err = wsjson.Write(ctx, conn, Message{
+		MsgType: 5,
+		Exchange: &KeyExchange{
+			Ephemeral: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+			Static:    base64.StdEncoding.EncodeToString(b.static.PublicKey().Bytes()),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var reply Message
+	err = wsjson.Read(ctx, conn, &reply)
+	if err != nil {
+		return nil, err
+	}
+	if reply.MsgType != 5 || reply.Exchange == nil {
+		return nil, errKeyExchange
+	}
+	clientEphemeral, err := publicKey(reply.Exchange.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+
+	ee, err := ephemeral.ECDH(clientEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	es, err := ephemeral.ECDH(identity)
+	if err != nil {
+		return nil, err
+	}
+	se, err := b.static.ECDH(clientEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(kexProtocol))
+	h.Write([]byte{0})
+	h.Write([]byte(assetID))
+	h.Write([]byte{0})
+	for _, key := range []*ecdh.PublicKey{identity, ephemeral.PublicKey(), b.static.PublicKey(), clientEphemeral} {
+		h.Write(key.Bytes())
+	}
+	transcript := h.Sum(nil)
+	prk := mac(transcript, append(append(append([]byte{}, ee...), es...), se...))
+
+	confirm, err := base64.StdEncoding.DecodeString(reply.Exchange.Confirm)
+	if err != nil || !hmac.Equal(confirm, mac(expand(prk, "client confirm"), transcript)) {
+		return nil, errKeyConfirm
+	}
+	flag := byte(0)
+	if b.encrypt {
+		flag = 1
+	}
+	err = wsjson.Write(ctx, conn, Message{
+		MsgType: 5,
+		Exchange: &KeyExchange{
+			Confirm: base64.StdEncoding.EncodeToString(mac(expand(prk, "server confirm"), append(transcript, flag))),
+			Encrypt: b.encrypt,
+		},
+	})
+	return expand(prk, "data"), err
+}
+
+// open decrypts the payload entries of a data frame sealed with the key of
+// the first epoch.
+func open(key []byte, assetID string, frame *UploadRequest) ([][]byte, error) {
+	if frame.Header.Epoch != 0 {
+		return nil, errKeyExchange
+	}
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, err
+	}
+	out := [][]byte{}
+	for i, entry := range frame.Payload {
+		if len(entry) < gcm.NonceSize() {
+			return nil, errKeyExchange
+		}
+		nonce := entry[:gcm.NonceSize()]
+		ad := additionalData(assetID, frame.FileName, frame.Header.Seq, frame.Header.Epoch, i)
+		plain, err := gcm.Open(nil, nonce, entry[gcm.NonceSize():], ad)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, plain)
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"time"
+)
+
+// certRenewal is how long before expiry a new client certificate is requested
+const certRenewal = 30 * 24 * time.Hour
+
+// CreateCertKey creates and returns a PEM encoded ECDSA P-256 private key for
+// the client certificate.
+func CreateCertKey() (string, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+}
+
+// createCSR creates a PEM encoded certificate signing request for the asset ID,
+// signed with the client certificate key.
+func createCSR(s *state) (string, error) {
+	block, _ := pem.Decode([]byte(s.CertKey))
+	if block == nil {
+		return "", errBadCertKey
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: s.AssetID},
+	}, key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+// clientCertificate returns the client certificate and its key, or an error if
+// no valid certificate has been issued.
+func clientCertificate(s *state) (tls.Certificate, error) {
+	cert, err := tls.X509KeyPair([]byte(s.Certificate), []byte(s.CertKey))
+	if err != nil {
+		return cert, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	return cert, err
+}
+
+// needsCertificate returns true if the client has no valid certificate or it
+// expires within certRenewal.
+func needsCertificate(s *state) bool {
+	cert, err := clientCertificate(s)
+	if err != nil {
+		return true
+	}
+	return time.Now().Add(certRenewal).After(cert.Leaf.NotAfter)
+}
+
+// tlsConfig returns the TLS configuration for connecting to the backend. The
+// backend is verified with the CA certificate if provided, and the client
+// certificate is presented if one has been issued.
+func tlsConfig(s *state) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.CAFile != "" {
+		caPEM, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, errBadCA
+		}
+	}
+	if cert, err := clientCertificate(s); err == nil {
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// saveCertificate stores the client certificate issued by the backend in the
+// local database. Certificates that do not match the client certificate key
+// are ignored.
+func saveCertificate(s *state, db *database, certificate string) error {
+	s.DatabaseMutex.Lock()
+	defer s.DatabaseMutex.Unlock()
+	previous := s.Certificate
+	s.Certificate = certificate
+	_, err := clientCertificate(s)
+	if err != nil {
+		s.Certificate = previous
+		return err
+	}
+	return db.commit(s)
+}
@@ -4,10 +4,10 @@
 package engine
 
 import (
-	"log"
+	"context"
 	"os"
-	"sync"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"gopkg.in/urfave/cli.v1"
 )
@@ -24,11 +24,18 @@ var (
 	// state for comments)
 	valHostname      = ""
 	valDebug         = false
-	valRetryDelay    = 5 * time.Second
-	valFileMode      = zero
-	valFileScan      = 5 * time.Second
-	valFileChunkSize = 10
+	valRetryDelay    = defaultRetryDelay
+	valMaxDelay      = defaultMaxDelay
+	valDialTimeout   = defaultDialTimeout
+	valReplyTimeout  = defaultReplyTimeout
+	valFileScan      = defaultFileScan
 	valEncrypt       = false
+	valCA            = ""
+	valDataDir       = "."
+	valSpoolDir      = ".canids-spool"
+	valSpoolAfter    = defaultSpoolAfter
+	valSpoolMax      = defaultSpoolMax
+	valSpoolOverflow = defaultSpoolOverflow
 )
 
 // Run executes the CLI app to begin ingestion. It will return an error upon
@@ -44,7 +51,7 @@ func Run() error {
 	flags := []cli.Flag{
 		cli.StringFlag{
 			Name:        "hostname, host",
-			Usage:       "hostname and port of CanIDS WS backend",
+			Usage:       "hostname and port of CanIDS WS backend, comma separated to fail over between backends",
 			Destination: &valHostname,
 		},
 		cli.BoolFlag{
@@ -54,10 +61,28 @@ func Run() error {
 		},
 		cli.DurationFlag{
 			Name:        "delay",
-			Usage:       "time delay before recovering connection",
+			Usage:       "time delay before recovering connection, doubled after each failure",
 			Value:       valRetryDelay,
 			Destination: &valRetryDelay,
 		},
+		cli.DurationFlag{
+			Name:        "max-delay",
+			Usage:       "largest time delay before recovering connection",
+			Value:       valMaxDelay,
+			Destination: &valMaxDelay,
+		},
+		cli.DurationFlag{
+			Name:        "dial-timeout",
+			Usage:       "how long to wait for the backend to accept the connection",
+			Value:       valDialTimeout,
+			Destination: &valDialTimeout,
+		},
+		cli.DurationFlag{
+			Name:        "handshake-timeout",
+			Usage:       "how long to wait for each message of the backend while connecting",
+			Value:       valReplyTimeout,
+			Destination: &valReplyTimeout,
+		},
 		cli.DurationFlag{
 			Name:        "scan",
 			Usage:       "how often to scan file system for new files in directory",
@@ -69,12 +94,52 @@ func Run() error {
 			Usage:       "enable encrypted data transfer",
 			Destination: &valEncrypt,
 		},
+		cli.StringFlag{
+			Name:        "ca",
+			Usage:       "CA certificate of CanIDS backend for TLS connections",
+			Destination: &valCA,
+		},
+		cli.StringSliceFlag{
+			Name:  "tag",
+			Usage: "tags of a sensor reported to the backend as sensor=tag,tag, repeated for each sensor",
+		},
+		cli.StringFlag{
+			Name:        "data-dir",
+			Usage:       "directory of the local databases of named sensors",
+			Value:       valDataDir,
+			Destination: &valDataDir,
+		},
+		cli.StringFlag{
+			Name:        "spool-dir",
+			Usage:       "directory of log entries spooled while the backend is unreachable",
+			Value:       valSpoolDir,
+			Destination: &valSpoolDir,
+		},
+		cli.DurationFlag{
+			Name:        "spool-after",
+			Usage:       "how long the backend must be unreachable before spooling log entries",
+			Value:       valSpoolAfter,
+			Destination: &valSpoolAfter,
+		},
+		cli.Int64Flag{
+			Name:        "spool-max",
+			Usage:       "largest compressed size of the spool in MB, 0 to disable spooling",
+			Value:       valSpoolMax,
+			Destination: &valSpoolMax,
+		},
+		cli.StringFlag{
+			Name:        "spool-overflow",
+			Usage:       "when the spool is full, drop-oldest spooled entries or pause reading log files",
+			Value:       valSpoolOverflow,
+			Destination: &valSpoolOverflow,
+		},
 	}
 	app.Commands = []cli.Command{
 		{
-			Name:    "upload",
-			Aliases: []string{"u"},
-			Usage:   "stream data to CanIDS backend",
+			Name:      "upload",
+			Aliases:   []string{"u"},
+			Usage:     "stream data to CanIDS backend",
+			ArgsUsage: "[name=]path [[name=]path...]",
 			Action: func(c *cli.Context) error {
 				return cmd(c)
 			},
@@ -87,81 +152,59 @@ func Run() error {
 // cmd is called when the required parameters are provided to the CLI. It will
 // validate parameters and attempt to start the client.
 func cmd(c *cli.Context) error {
-	// get + validate number of arguments
-	args := c.Args()
-	if len(args) == 0 {
-		return errNoPath
-	}
-	if len(args) > 1 {
-		return errMultiplePaths
-	}
-	// ensure hostname provided
-	if valHostname == "" {
-		return errHostname
-	}
-
-	// ensure directory/file exists
-	valFilePath := args[0]
-	info, err := os.Stat(valFilePath)
+	// get + validate sensor paths
+	sensors, err := parseSensors(c.Args(), c.StringSlice("tag"), valDataDir, valSpoolDir)
 	if err != nil {
-		return errNotFound
-	}
-
-	// update mode
-	if info.Mode().IsDir() {
-		valFileMode = fileDirectory
-	} else if info.Mode().IsRegular() {
-		valFileMode = fileRegular
+		return err
 	}
+	// shut down cleanly when the container is stopped
+	shutdown, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	// generate state
-	config := &state{
-		AssetID:       "",
-		NetworkMutex:  &sync.Mutex{},
-		DatabaseMutex: &sync.Mutex{},
-		Session:       "",
-		PollingAbort:  make(chan struct{}),
-		ScannerAbort:  make(chan struct{}),
-		Debug:         valDebug,
-		RetryDelay:    valRetryDelay,
-		FilePath:      valFilePath,
-		FileMode:      valFileMode,
-		FileScan:      valFileScan,
-		FileChunkSize: valFileChunkSize,
-		EncryptionKey: "",
-		Encryption:    valEncrypt,
-	}
-
-	// sync the scanner to retreive+update (or create) latest database
-	db, err := syncScanner(config)
-	if err != nil {
-		log.Println("[CanIDS] local database error:", err)
-		return nil
+	// each sensor connects to the backend as its own asset
+	clients := []*Client{}
+	for _, sn := range sensors {
+		options := Options{
+			Hostname:         valHostname,
+			Path:             sn.path,
+			Name:             sn.name,
+			Tags:             sn.tags,
+			Database:         sn.database,
+			Encrypt:          valEncrypt,
+			CA:               valCA,
+			RetryDelay:       valRetryDelay,
+			MaxDelay:         valMaxDelay,
+			DialTimeout:      valDialTimeout,
+			HandshakeTimeout: valReplyTimeout,
+			FileScan:         valFileScan,
+			SpoolMax:         valSpoolMax,
+			SpoolAfter:       valSpoolAfter,
+			SpoolOverflow:    valSpoolOverflow,
+			Debug:            valDebug,
+		}
+		if valSpoolMax > 0 {
+			options.SpoolDir = sn.spoolDir
+		}
+		client, err := NewClient(options)
+		if err != nil {
+			return err
+		}
+		clients = append(clients, client)
 	}
-
-	for {
-		// initialize connection to gRPC and start
-		err = ConnectWebsocketServer(config, db, valHostname)
-		if config.Debug {
-			log.Println("[CanIDS DEBUG]", err)
+	started := []*Client{}
+	for _, client := range clients {
+		err = client.Start(shutdown)
+		if err != nil {
+			// stop the sensors already started
+			stop()
+			break
 		}
-		// reset config
-		config = &state{
-			AssetID:       db.AssetID,
-			NetworkMutex:  &sync.Mutex{},
-			DatabaseMutex: &sync.Mutex{},
-			Session:       "",
-			PollingAbort:  make(chan struct{}),
-			ScannerAbort:  make(chan struct{}),
-			Debug:         valDebug,
-			RetryDelay:    valRetryDelay,
-			FilePath:      valFilePath,
-			FileMode:      valFileMode,
-			FileScan:      valFileScan,
-			FileChunkSize: valFileChunkSize,
-			EncryptionKey: db.Key,
-			Encryption:    valEncrypt,
+		started = append(started, client)
+	}
+	for _, client := range started {
+		if e := client.Wait(); e != nil && err == nil {
+			err = e
 		}
-		time.Sleep(config.RetryDelay)
 	}
+	return err
 }
@@ -0,0 +1,323 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// defaults of the client options, also the defaults of the command line
+	defaultRetryDelay    = 5 * time.Second
+	defaultMaxDelay      = 5 * time.Minute
+	defaultDialTimeout   = 10 * time.Second
+	defaultReplyTimeout  = 10 * time.Second
+	defaultFileScan      = 5 * time.Second
+	defaultSpoolAfter    = 1 * time.Minute
+	defaultSpoolMax      = int64(1024)
+	defaultSpoolOverflow = overflowDrop
+)
+
+var errStarted = errors.New("[CanIDS] error: client already started")
+
+// Options configure a Client. Zero values use the defaults of the command line.
+type Options struct {
+	Hostname         string        // Hostname is the WebSocket URL of the backend, comma separated to fail over between backends
+	Path             string        // Path is the file or directory of Zeek logs
+	Name             string        // Name is the name of the sensor, empty for a single unnamed path
+	Tags             []string      // Tags are the tags of the sensor reported to the backend
+	Database         string        // Database is the path of the local database, in the working directory by default
+	Encrypt          bool          // Encrypt enables encrypted payloads
+	CA               string        // CA is the CA certificate of the backend for TLS connections, system roots if empty
+	RetryDelay       time.Duration // RetryDelay is the delay before reconnecting, doubled after each failure
+	MaxDelay         time.Duration // MaxDelay is the largest delay before reconnecting
+	DialTimeout      time.Duration // DialTimeout is how long to wait for the backend to accept the connection
+	HandshakeTimeout time.Duration // HandshakeTimeout is how long to wait for each message of the backend while connecting
+	FileScan         time.Duration // FileScan is how often to scan for new log files
+	SpoolDir         string        // SpoolDir is the directory of the spool, spooling is disabled if empty
+	SpoolMax         int64         // SpoolMax is the largest compressed size of the spool in MB
+	SpoolAfter       time.Duration // SpoolAfter is how long the backend must be unreachable before spooling
+	SpoolOverflow    string        // SpoolOverflow is the policy when the spool is full, drop-oldest or pause
+	Debug            bool          // Debug enables verbose logging
+	Hooks            Hooks         // Hooks are called as data frames are sent
+}
+
+// Hooks are called by a Client for each data frame. They are called from the
+// goroutines of the connection and must return quickly. Any hook may be nil.
+type Hooks struct {
+	Sent         func(frame *UploadRequest)            // Sent is called once the frame is written to the connection
+	Acknowledged func(frame *UploadRequest)            // Acknowledged is called once the backend indexed the frame
+	Failed       func(frame *UploadRequest, err error) // Failed is called if the connection ended before the frame was acknowledged
+}
+
+// sent calls the Sent hook if set.
+func (h *Hooks) sent(frame *UploadRequest) {
+	if h != nil && h.Sent != nil {
+		h.Sent(frame)
+	}
+}
+
+// acknowledged calls the Acknowledged hook if set.
+func (h *Hooks) acknowledged(frame *UploadRequest) {
+	if h != nil && h.Acknowledged != nil {
+		h.Acknowledged(frame)
+	}
+}
+
+// failed calls the Failed hook if set.
+func (h *Hooks) failed(frame *UploadRequest, err error) {
+	if h != nil && h.Failed != nil {
+		h.Failed(frame, err)
+	}
+}
+
+// Client sends the Zeek logs of a path to the backend as one asset,
+// reconnecting until it is stopped. The command line runs a Client for each
+// sensor; other tools can embed one.
+type Client struct {
+	options Options
+	mode    fileMode           // mode indicates if the path is a regular file or directory
+	mutex   sync.Mutex         // mutex guards cancel
+	cancel  context.CancelFunc // cancel stops the client, nil until started
+	done    chan struct{}      // done is closed once the client stopped
+	err     error              // err is why the client stopped, nil if the local database was saved
+}
+
+// NewClient returns a client with the options. It will return an error if the
+// options are invalid.
+func NewClient(options Options) (*Client, error) {
+	if len(newFailover(options.Hostname).endpoints) == 0 {
+		return nil, errHostname
+	}
+	if options.Name != "" && !sensorName.MatchString(options.Name) {
+		return nil, errSensorName
+	}
+	// ensure directory/file exists
+	info, err := os.Stat(options.Path)
+	if err != nil {
+		return nil, errNotFound
+	}
+	c := &Client{options: options, done: make(chan struct{})}
+	if info.Mode().IsDir() {
+		c.mode = fileDirectory
+	} else if info.Mode().IsRegular() {
+		c.mode = fileRegular
+	}
+
+	o := &c.options
+	if o.Database == "" {
+		o.Database = dbFileName
+	}
+	if o.RetryDelay == 0 {
+		o.RetryDelay = defaultRetryDelay
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = defaultMaxDelay
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = defaultDialTimeout
+	}
+	if o.HandshakeTimeout == 0 {
+		o.HandshakeTimeout = defaultReplyTimeout
+	}
+	if o.FileScan == 0 {
+		o.FileScan = defaultFileScan
+	}
+	if o.SpoolMax == 0 {
+		o.SpoolMax = defaultSpoolMax
+	}
+	if o.SpoolAfter == 0 {
+		o.SpoolAfter = defaultSpoolAfter
+	}
+	if o.SpoolOverflow == "" {
+		o.SpoolOverflow = defaultSpoolOverflow
+	}
+	if o.SpoolOverflow != overflowDrop && o.SpoolOverflow != overflowPause {
+		return nil, errOverflow
+	}
+	return c, nil
+}
+
+// Start loads the local database and starts sending in the background until
+// the context is cancelled or the client is stopped. It will return an error
+// if the local database or spool cannot be opened.
+func (c *Client) Start(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cancel != nil {
+		return errStarted
+	}
+
+	// open the spool, kept across reconnections
+	var sp *spool
+	var err error
+	if c.options.SpoolDir != "" {
+		sp, err = openSpool(c.options.SpoolDir, c.options.SpoolMax<<20, c.options.SpoolOverflow)
+		if err != nil {
+			return err
+		}
+	}
+
+	// generate state
+	config := c.state(nil)
+	config.Health = newHealth()
+	config.Spool = sp
+
+	// sync the scanner to retreive+update (or create) latest database
+	db, err := syncScanner(config)
+	if err != nil {
+		log.Println("[CanIDS] local database error:", err)
+		return err
+	}
+	// administrators compare the fingerprint before approving the client
+	log.Println("[CanIDS] info: identity key fingerprint", identityFingerprint(config), "sensor", c.options.Name, "asset", config.AssetID)
+
+	ctx, c.cancel = context.WithCancel(ctx)
+	go func() {
+		c.err = c.run(ctx, config, db)
+		close(c.done)
+	}()
+	return nil
+}
+
+// Stop stops the client and waits until the connection is closed and the
+// local database saved. It returns the error of Wait.
+func (c *Client) Stop() error {
+	c.mutex.Lock()
+	cancel := c.cancel
+	c.mutex.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	return c.Wait()
+}
+
+// Wait waits until the started client stopped. It will return an error if the
+// local database could not be saved.
+func (c *Client) Wait() error {
+	<-c.done
+	return c.err
+}
+
+// state returns the state of a new connection, from the options and the local
+// database if loaded.
+func (c *Client) state(db *database) *state {
+	o := c.options
+	s := &state{
+		AssetID:       "",
+		DatabaseMutex: &sync.Mutex{},
+		Session:       "",
+		ScannerAbort:  make(chan struct{}),
+		Debug:         o.Debug,
+		RetryDelay:    o.RetryDelay,
+		DialTimeout:   o.DialTimeout,
+		ReplyTimeout:  o.HandshakeTimeout,
+		Sensor:        o.Name,
+		Tags:          o.Tags,
+		Database:      o.Database,
+		FilePath:      o.Path,
+		FileMode:      c.mode,
+		FileScan:      o.FileScan,
+		FileChunkSize: minChunkSize,
+		MaxChunkSize:  maxChunkSize,
+		Whitelist:     defaultWhitelist,
+		EncryptionKey: "",
+		Encryption:    o.Encrypt,
+		CAFile:        o.CA,
+		Hooks:         &c.options.Hooks,
+	}
+	if db != nil {
+		s.AssetID = db.AssetID
+		s.EncryptionKey = db.Key
+		s.CertKey = db.CertKey
+		s.Certificate = db.Cert
+		s.IdentityKey = db.IdentityKey
+		s.ServerKey = db.ServerKey
+	}
+	return s
+}
+
+// run sends the logs to the backend, reconnecting until the context is
+// cancelled.
+func (c *Client) run(shutdown context.Context, config *state, db *database) error {
+	endpoints := newFailover(c.options.Hostname)
+
+	// disconnected is when the backend was last reachable
+	disconnected := time.Now()
+	for {
+		// initialize connection to gRPC and start
+		endpoint := endpoints.endpoint()
+		err := ConnectWebsocketServer(shutdown, config, db, endpoint)
+		if shutdown.Err() != nil {
+			return exit(config, db)
+		}
+		if config.Debug {
+			log.Println("[CanIDS DEBUG]", err)
+		}
+		if !config.Connected.IsZero() {
+			disconnected = time.Now()
+		}
+		endpoints.result(config.Connected)
+		stage := config.Stage
+		// reset config, keeping the configuration profile applied
+		health, sp, profile := config.Health, config.Spool, config.Profile
+		config = c.state(db)
+		config.Health = health
+		config.Spool = sp
+		if sp != nil {
+			// spooled frames not acknowledged are sent on the next connection
+			sp.rewind()
+		}
+		if profile != nil {
+			configure(config, profile)
+		}
+
+		// tell operators why the sensor is offline and what happens next
+		delay := endpoints.backoff(config.RetryDelay, c.options.MaxDelay)
+		logEvent("reconnect",
+			"sensor", c.options.Name,
+			"asset", config.AssetID,
+			"endpoint", endpoint,
+			"stage", stage,
+			"error", err,
+			"failures", endpoints.failures,
+			"offline", time.Since(disconnected).Round(time.Second),
+			"next", endpoints.endpoint(),
+			"retry_in", delay.Round(time.Millisecond),
+		)
+
+		// spool log entries while waiting if the backend is unreachable for
+		// long, before Zeek rotates the log files away
+		if config.Spool != nil && time.Since(disconnected) > c.options.SpoolAfter {
+			spoolFor(shutdown, config, db, delay)
+		} else {
+			select {
+			case <-shutdown.Done():
+			case <-time.After(delay):
+			}
+		}
+		if shutdown.Err() != nil {
+			return exit(config, db)
+		}
+	}
+}
+
+// exit flushes the local database and the spool before the client exits. The
+// connection and its goroutines have stopped.
+func exit(s *state, db *database) error {
+	log.Println("[CanIDS] shutting down")
+	s.DatabaseMutex.Lock()
+	err := db.commit(s)
+	s.DatabaseMutex.Unlock()
+	if s.Spool != nil {
+		s.Spool.close()
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTimeout is how long to wait for the lines sent by a client
+const testTimeout = 10 * time.Second
+
+// connHeader is the header of a Zeek TSV conn.log
+var connHeader = []string{
+	"#separator \\x09",
+	"#set_separator\t,",
+	"#empty_field\t(empty)",
+	"#unset_field\t-",
+	"#path\tconn",
+	"#open\t2020-01-01-00-00-00",
+	"#fields\tts\tuid\tid.orig_h\tid.orig_p\tid.resp_h\tid.resp_p\tproto\tduration\tlocal_orig",
+	"#types\ttime\tstring\taddr\tport\taddr\tport\tenum\tinterval\tbool",
+}
+
+// connLine returns a conn.log line of a connection to the port.
+func connLine(port int) string {
+	return fmt.Sprintf("1577836800.500000\tC%d\t10.0.0.1\t51234\t10.0.0.2\t%d\ttcp\t0.25\tT", port, port)
+}
+
+// writeLog writes the lines to the Zeek log, after the header if the file is
+// created.
+func writeLog(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	if _, err := os.Stat(path); err != nil {
+		lines = append(append([]string{}, connHeader...), lines...)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hookCounts counts the calls of the client hooks.
+type hookCounts struct {
+	mutex        sync.Mutex
+	sent         int
+	acknowledged int
+	failed       int
+}
+
+// hooks returns hooks counting their calls.
+func (h *hookCounts) hooks() Hooks {
+	return Hooks{
+		Sent: func(*UploadRequest) {
+			h.mutex.Lock()
+			h.sent++
+			h.mutex.Unlock()
+		},
+		Acknowledged: func(*UploadRequest) {
+			h.mutex.Lock()
+			h.acknowledged++
+			h.mutex.Unlock()
+		},
+		Failed: func(*UploadRequest, error) {
+			h.mutex.Lock()
+			h.failed++
+			h.mutex.Unlock()
+		},
+	}
+}
+
+// counts returns the number of calls of each hook.
+func (h *hookCounts) counts() (int, int, int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.sent, h.acknowledged, h.failed
+}
+
+// startClient starts a client sending the directory to the backend, stopped
+// when the test ends. It returns the path of its local database.
+func startClient(t *testing.T, b *mockBackend, dir string, hooks Hooks) (*Client, string) {
+	t.Helper()
+	sleep := scannerSleep
+	scannerSleep = 20 * time.Millisecond
+	t.Cleanup(func() {
+		scannerSleep = sleep
+	})
+
+	database := filepath.Join(t.TempDir(), dbFileName)
+	client, err := NewClient(Options{
+		Hostname:   b.url(),
+		Path:       dir,
+		Database:   database,
+		RetryDelay: 20 * time.Millisecond,
+		MaxDelay:   100 * time.Millisecond,
+		FileScan:   50 * time.Millisecond,
+		Hooks:      hooks,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Stop()
+	})
+	return client, database
+}
+
+// eventually fails the test if the condition is not met before testTimeout.
+func eventually(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientParsesTSV(t *testing.T) {
+	b := newMockBackend(t)
+	b.encrypt = true
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, logConn), connLine(80), connLine(443))
+	counts := &hookCounts{}
+	startClient(t, b, dir, counts.hooks())
+
+	lines := b.lines(2, testTimeout)
+	line := lines[1]
+	timestamp, err := time.Parse(time.RFC3339, fmt.Sprint(line["timestamp"]))
+	if err != nil || !timestamp.Equal(time.Unix(1577836800, 0)) {
+		t.Errorf("timestamp = %v, want 2020-01-01T00:00:00Z", line["timestamp"])
+	}
+	if line["id.resp_p"] != float64(443) {
+		t.Errorf("id.resp_p = %v, want 443", line["id.resp_p"])
+	}
+	if line["duration"] != 0.25 {
+		t.Errorf("duration = %v, want 0.25", line["duration"])
+	}
+	if line["local_orig"] != true {
+		t.Errorf("local_orig = %v, want true", line["local_orig"])
+	}
+	if line["id.orig_h"] != "10.0.0.1" || line["proto"] != "tcp" {
+		t.Errorf("line = %v", line)
+	}
+
+	eventually(t, func() bool {
+		sent, acknowledged, _ := counts.counts()
+		return sent > 0 && acknowledged == sent
+	}, "frames not acknowledged")
+
+	// the health is reported once connected
+	eventually(t, func() bool {
+		status := b.status()
+		return status != nil && len(status.Files) == 1 && status.Version == appVersion
+	}, "status report missing conn.log")
+}
+
+func TestClientSkipsInvalidLines(t *testing.T) {
+	b := newMockBackend(t)
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, logConn), connLine(22))
+	// JSON logs are validated instead of parsed
+	err := os.WriteFile(filepath.Join(dir, logDNS), []byte("{\"query\":\"example.com\"}\nnot json\n{\"query\":\"example.org\"}\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// files not whitelisted are not sent
+	writeLog(t, filepath.Join(dir, "capture_loss.log"), connLine(8080))
+	startClient(t, b, dir, Hooks{})
+
+	lines := b.lines(3, testTimeout)
+	queries := 0
+	for _, line := range lines {
+		if line["query"] != nil {
+			queries++
+		}
+		if line["id.resp_p"] == float64(8080) {
+			t.Error("sent a file not whitelisted")
+		}
+	}
+	if queries != 2 {
+		t.Errorf("sent %d DNS queries, want 2", queries)
+	}
+}
+
+func TestClientFollowsRotation(t *testing.T) {
+	b := newMockBackend(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, logConn)
+	writeLog(t, path, connLine(1), connLine(2), connLine(3))
+	startClient(t, b, dir, Hooks{})
+	b.lines(3, testTimeout)
+
+	// Zeek renames the log and starts a new one
+	err := os.Rename(path, filepath.Join(dir, "conn.2020-01-01-00-00-00.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLog(t, path, connLine(4))
+	lines := b.lines(1, testTimeout)
+	if lines[0]["id.resp_p"] != float64(4) {
+		t.Errorf("sent %v after rotation, want port 4", lines[0])
+	}
+}
+
+func TestClientReconnects(t *testing.T) {
+	b := newMockBackend(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, logConn)
+	writeLog(t, path, connLine(1))
+	startClient(t, b, dir, Hooks{})
+	b.lines(1, testTimeout)
+
+	b.drop()
+	eventually(t, func() bool {
+		return b.connections() >= 2
+	}, "client did not reconnect")
+	writeLog(t, path, connLine(2))
+	lines := b.lines(1, testTimeout)
+	if lines[0]["id.resp_p"] != float64(2) {
+		t.Errorf("sent %v after reconnecting, want port 2", lines[0])
+	}
+}
+
+func TestClientAwaitsApproval(t *testing.T) {
+	b := newMockBackend(t)
+	b.approval = make(chan struct{})
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, logConn), connLine(1))
+	startClient(t, b, dir, Hooks{})
+
+	// a client awaiting approval reconnects when the connection drops
+	eventually(t, func() bool {
+		return b.connections() >= 1
+	}, "client did not connect")
+	time.Sleep(50 * time.Millisecond)
+	b.drop()
+	eventually(t, func() bool {
+		return b.connections() >= 2
+	}, "client did not reconnect while awaiting approval")
+
+	select {
+	case b.approval <- struct{}{}:
+	case <-time.After(testTimeout):
+		t.Fatal("client not awaiting approval")
+	}
+	b.lines(1, testTimeout)
+}
+
+func TestClientStopSavesDatabase(t *testing.T) {
+	b := newMockBackend(t)
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, logConn), connLine(1), connLine(2))
+	counts := &hookCounts{}
+	client, database := startClient(t, b, dir, counts.hooks())
+	b.lines(2, testTimeout)
+
+	err := client.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Start(context.Background()); err != errStarted {
+		t.Errorf("Start after Stop = %v, want errStarted", err)
+	}
+	db, err := dbLoad(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(db.Files) != 1 || db.Files[0].Lines != int64(len(connHeader)+2) {
+		t.Errorf("database files = %+v, want conn.log with every line read", db.Files)
+	}
+	if db.AssetID == "" || db.ServerKey == "" {
+		t.Error("database missing the asset ID or pinned backend key")
+	}
+	sent, acknowledged, failed := counts.counts()
+	if sent != acknowledged+failed {
+		t.Errorf("sent %d frames, %d acknowledged and %d failed", sent, acknowledged, failed)
+	}
+}
@@ -10,10 +10,14 @@ import (
 
 // database is a small database used for tracking file progress.
 type database struct {
-	Files   []file // Files is a list of files
-	Next    int    // Next indicates the index of the next file to scan
-	AssetID string
-	Key     string
+	Files       []file // Files is a list of files
+	Next        int    // Next indicates the index of the next file to scan
+	AssetID     string
+	Key         string
+	CertKey     string // CertKey is the PEM encoded private key of the client certificate
+	Cert        string // Cert is the PEM encoded client certificate issued by the backend
+	IdentityKey string // IdentityKey is the base64 X25519 private key identifying the client
+	ServerKey   string // ServerKey is the base64 X25519 static public key of the backend, pinned on first connection
 }
 
 // file is a file and it's progress.
@@ -28,7 +32,11 @@ type file struct {
 func (db *database) commit(s *state) error {
 	db.AssetID = s.AssetID
 	db.Key = s.EncryptionKey
-	file, err := os.Create(dbFileName)
+	db.CertKey = s.CertKey
+	db.Cert = s.Certificate
+	db.IdentityKey = s.IdentityKey
+	db.ServerKey = s.ServerKey
+	file, err := os.Create(s.Database)
 	if err != nil {
 		return err
 	}
@@ -37,11 +45,11 @@ func (db *database) commit(s *state) error {
 	return encoder.Encode(db)
 }
 
-// dbLoad loads the database. It will return an error if the database cannot be
-// loaded.
-func dbLoad() (*database, error) {
+// dbLoad loads the database at the path. It will return an error if the
+// database cannot be loaded.
+func dbLoad(path string) (*database, error) {
 	var db *database
-	file, err := os.Open(dbFileName)
+	file, err := os.Open(path)
 	if err != nil {
 		return db, err
 	}
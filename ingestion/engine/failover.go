@@ -0,0 +1,120 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// failoverAfter is the number of consecutive failed connections before
+	// switching to the next backend endpoint
+	failoverAfter = 2
+	// stableAfter is how long a connection must last to reset the backoff
+	stableAfter = time.Minute
+)
+
+// endpoint is a backend endpoint and its health.
+type endpoint struct {
+	url      string    // url is the WebSocket URL of the backend
+	failures int       // failures is the number of consecutive failed connections
+	up       time.Time // up is when a connection last succeeded, zero if never
+}
+
+// failover selects the backend endpoint to connect to and the delay before
+// reconnecting. The client stays on an endpoint while it is healthy, and
+// switches after failoverAfter consecutive failures to the endpoint that was
+// last up, or the next one listed.
+type failover struct {
+	endpoints []*endpoint // endpoints are the backend endpoints in the order given
+	current   int         // current is the index of the endpoint in use
+	failures  int         // failures is the number of reconnections since the last stable connection
+}
+
+// newFailover returns the failover between the comma separated endpoints.
+func newFailover(hostnames string) *failover {
+	f := &failover{}
+	for _, url := range strings.Split(hostnames, ",") {
+		url = strings.TrimSpace(url)
+		if url != "" {
+			f.endpoints = append(f.endpoints, &endpoint{url: url})
+		}
+	}
+	return f
+}
+
+// endpoint returns the URL of the endpoint to connect to.
+func (f *failover) endpoint() string {
+	return f.endpoints[f.current].url
+}
+
+// result records the outcome of the connection to the current endpoint, from
+// when it succeeded or zero if it failed.
+func (f *failover) result(connected time.Time) {
+	current := f.endpoints[f.current]
+	if !connected.IsZero() {
+		current.failures = 0
+		current.up = connected
+		if time.Since(connected) >= stableAfter {
+			f.failures = 0
+		} else {
+			// the connection dropped soon after succeeding, keep backing off
+			f.failures++
+		}
+		return
+	}
+	current.failures++
+	f.failures++
+	if current.failures < failoverAfter || len(f.endpoints) == 1 {
+		return
+	}
+	// prefer the endpoint up most recently, then the next one listed
+	next := (f.current + 1) % len(f.endpoints)
+	for i, e := range f.endpoints {
+		if i != f.current && e.up.After(f.endpoints[next].up) {
+			next = i
+		}
+	}
+	current.failures = 0
+	f.current = next
+}
+
+// backoff returns the delay before reconnecting, doubling from base with each
+// reconnection up to max. The delay is randomized between half and all of it,
+// so that sensors do not reconnect at once after a backend restart.
+func (f *failover) backoff(base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < f.failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	if delay < 2 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// logEvent logs the event with key value pairs, quoting values with spaces,
+// for example "[CanIDS] event=reconnect endpoint=wss://backend/websocket/".
+func logEvent(event string, pairs ...interface{}) {
+	out := []string{"event=" + event}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		value := ""
+		if pairs[i+1] != nil {
+			value = fmt.Sprint(pairs[i+1])
+		}
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		out = append(out, fmt.Sprint(pairs[i])+"="+value)
+	}
+	log.Println("[CanIDS]", strings.Join(out, " "))
+}
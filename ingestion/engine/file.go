@@ -32,9 +32,7 @@ func processRegularFile(s *state, filePath string, fileName string, db *database
 		Lines: 0,
 		Size:  0,
 	}
-	// conn.log dns.log http.log notice.log sip.log ssl.log stats.log weird.log telemetry.log capture_loss.log
-	whitelist := []string{"conn.log", "dns.log", "http.log", "sip.log", "ssl.log", "stats.log", "weird.log", "telemetry.log"}
-	if !slices.Contains(whitelist, fileName) {
+	if !slices.Contains(s.Whitelist, fileName) {
 		if s.Debug {
 			log.Println("[CanIDS DEBUG]", "Ignoring non-whitelisted file", abs)
 		}
@@ -0,0 +1,83 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import "sync"
+
+const (
+	// minChunkSize is the smallest number of lines sent in a frame
+	minChunkSize = 10
+	// maxChunkSize is the largest number of lines sent in a frame, unless
+	// lowered by a configuration profile
+	maxChunkSize = 1000
+	// chunkStep is how many lines the chunk size grows by while the backend
+	// keeps up
+	chunkStep = 10
+	// creditLow is the number of remaining credits below which the backend is
+	// considered to fall behind
+	creditLow = 8
+)
+
+// flowControl holds the data frame credits granted by the backend. One credit
+// is used per data frame, and the backend grants credits back once frames are
+// indexed.
+type flowControl struct {
+	mutex   sync.Mutex    // mutex guards credits
+	credits int           // credits are the data frames that may still be sent
+	granted chan struct{} // granted signals that credits were granted
+}
+
+// newFlowControl returns the flow control of a new connection, without
+// credits until the backend grants them.
+func newFlowControl() *flowControl {
+	return &flowControl{
+		granted: make(chan struct{}, 1),
+	}
+}
+
+// grant adds the credits granted by the backend.
+func (f *flowControl) grant(credits int) {
+	f.mutex.Lock()
+	f.credits += credits
+	f.mutex.Unlock()
+	select {
+	case f.granted <- struct{}{}:
+	default:
+	}
+}
+
+// available returns the number of credits left.
+func (f *flowControl) available() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.credits
+}
+
+// use consumes the credit of a data frame.
+func (f *flowControl) use() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.credits--
+}
+
+// adaptChunkSize adjusts the number of lines per frame to the backend, growing
+// it while credits are plentiful and halving it when the client had to wait
+// for credits.
+func adaptChunkSize(s *state, stalled bool) {
+	s.DatabaseMutex.Lock()
+	defer s.DatabaseMutex.Unlock()
+	if stalled {
+		s.FileChunkSize /= 2
+		if s.FileChunkSize < minChunkSize {
+			s.FileChunkSize = minChunkSize
+		}
+		return
+	}
+	if s.Flow.available() > creditLow && s.FileChunkSize < s.MaxChunkSize {
+		s.FileChunkSize += chunkStep
+		if s.FileChunkSize > s.MaxChunkSize {
+			s.FileChunkSize = s.MaxChunkSize
+		}
+	}
+}
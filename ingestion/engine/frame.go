@@ -16,8 +16,10 @@ type Header struct {
 	MsgTimestamp time.Time `json:"msg_timestamp,omitempty"` // Message timestamp
 	ErrorMsg     string    `json:"error_msg,omitempty"`     // Request error message(s) (use with NACK)
 	Session      string    `json:"session,omitempty"`       // Connection session UUID
-	MsgType      int       `json:"type,omitempty"`          // Message type: 0 - data, 1 - pong
+	MsgType      int       `json:"type,omitempty"`          // Message type: 0 - data, 1 - pong, 2 - status, 3 - profile acknowledgement
 	Encrypted    bool      `json:"encrypted,omitempty"`     // Whether the payload is encrypted (true) or not (false)
+	Seq          uint64    `json:"seq,omitempty"`           // Data frame sequence number, increasing within the session
+	Epoch        uint32    `json:"epoch,omitempty"`         // Key epoch of the encrypted payload
 }
 
 type UploadRequest struct {
@@ -25,6 +27,8 @@ type UploadRequest struct {
 	AssetId  string   `json:"asset_id,omitempty"`  // Asset identifier
 	FileName string   `json:"file_name,omitempty"` // Name of file payload is from
 	Payload  [][]byte `json:"payload,omitempty"`   // Multiple JSON byte lines from Zeek
+	Status   *Status  `json:"status,omitempty"`    // For status frames, the health report of the client
+	Version  int      `json:"version,omitempty"`   // For profile acknowledgements, the profile version applied or rejected with ErrorMsg
 }
 
 // generateFrame state and local database file. It will attempt to read
@@ -32,7 +36,7 @@ type UploadRequest struct {
 // a payload entry. If the line is not valid, it will be ignored. It
 // also updates the provided file, updating how much if the file was read. It
 // will return complete frame or an error.
-func generateFrame(s *state, f *file, baseName string, key []byte) (*UploadRequest, error) {
+func generateFrame(s *state, f *file, baseName string) (*UploadRequest, error) {
 	// open file
 	fs, err := os.Open(f.Path)
 	if err != nil {
@@ -104,17 +108,11 @@ func generateFrame(s *state, f *file, baseName string, key []byte) (*UploadReque
 			payload, err := parseLine(line, h)
 			// no error parsing, append to chunks
 			if err == nil {
-				if s.Encryption {
-					payload, err = Encrypt(payload, key)
-					if err != nil {
-						log.Println("Error encrypting payload line: ", err)
-						continue
-					}
-				}
 				chunks = append(chunks, payload)
 			} else {
-				// print error message
+				// print error message, count for status frames
 				log.Println(err)
+				s.Health.parseError(f.Path)
 			}
 		}
 		// valid update count of lines read and bytes read
@@ -142,6 +140,25 @@ func generateFrame(s *state, f *file, baseName string, key []byte) (*UploadReque
 	return frame, nil
 }
 
+// sealFrame numbers the data frame and encrypts the payload with the session
+// key if encryption is enabled. Frames are sealed when sent, so that spooled
+// frames are numbered in the session sending them. It will return an error if
+// the payload cannot be encrypted.
+func sealFrame(s *state, frame *UploadRequest) error {
+	seq, epoch, key := s.Cipher.next()
+	if s.Encryption {
+		payload, err := seal(key, s.AssetID, frame.FileName, seq, epoch, frame.Payload)
+		if err != nil {
+			return err
+		}
+		frame.Payload = payload
+	}
+	frame.Header.Encrypted = s.Encryption
+	frame.Header.Seq = seq
+	frame.Header.Epoch = epoch
+	return nil
+}
+
 func generatePongFrame(s *state) *UploadRequest {
 	chunks := [][]byte{}
 	frame := &UploadRequest{
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// statusInterval is how often a status frame is sent to the backend
+const statusInterval = 30 * time.Second
+
+// Status is the health report of the client sent in status frames.
+type Status struct {
+	Version string       `json:"version"` // Version is the client version
+	Sensor  string       `json:"sensor"`  // Sensor is the name of the sensor, empty for a single unnamed path
+	Tags    []string     `json:"tags"`    // Tags are the tags of the sensor
+	Uptime  int64        `json:"uptime"`  // Uptime is how long the client is running in seconds
+	Files   []FileStatus `json:"files"`   // Files are the tracked log files
+}
+
+// FileStatus is the progress of a tracked log file.
+type FileStatus struct {
+	Path        string `json:"path"`        // Path is the location of the file
+	Size        int64  `json:"size"`        // Size is the current size of the file in bytes
+	Offset      int64  `json:"offset"`      // Offset is the number of bytes read and sent
+	Lines       int64  `json:"lines"`       // Lines is the number of lines read and sent
+	LagBytes    int64  `json:"lagBytes"`    // LagBytes is the number of bytes not yet sent
+	LagSeconds  int64  `json:"lagSeconds"`  // LagSeconds is how long the file has had unsent data
+	ParseErrors int64  `json:"parseErrors"` // ParseErrors is the number of lines that failed to parse
+	Modified    string `json:"modified"`    // Modified is when the file was last written
+}
+
+// health tracks the client health across reconnections.
+type health struct {
+	mutex       sync.Mutex           // mutex guards the maps
+	started     time.Time            // started is when the client started
+	parseErrors map[string]int64     // parseErrors are the lines that failed to parse by path
+	caughtUp    map[string]time.Time // caughtUp is when each file last had no unsent data
+}
+
+// newHealth returns the health tracker of a client starting now.
+func newHealth() *health {
+	return &health{
+		started:     time.Now(),
+		parseErrors: map[string]int64{},
+		caughtUp:    map[string]time.Time{},
+	}
+}
+
+// parseError counts a line of the file that failed to parse.
+func (h *health) parseError(path string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.parseErrors[path]++
+}
+
+// status returns the health report of the files in the local database.
+func (h *health) status(s *state, db *database) *Status {
+	s.DatabaseMutex.Lock()
+	files := append([]file{}, db.Files...)
+	s.DatabaseMutex.Unlock()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	now := time.Now()
+	out := &Status{
+		Version: appVersion,
+		Sensor:  s.Sensor,
+		Tags:    s.Tags,
+		Uptime:  int64(now.Sub(h.started).Seconds()),
+		Files:   []FileStatus{},
+	}
+	tracked := map[string]bool{}
+	for _, f := range files {
+		info, err := os.Stat(f.Path)
+		if err != nil {
+			// removed from the database on the next scan
+			continue
+		}
+		tracked[f.Path] = true
+		status := FileStatus{
+			Path:        f.Path,
+			Size:        info.Size(),
+			Offset:      f.Size,
+			Lines:       f.Lines,
+			ParseErrors: h.parseErrors[f.Path],
+			Modified:    info.ModTime().UTC().Format(time.RFC3339),
+		}
+		status.LagBytes = status.Size - status.Offset
+		if status.LagBytes <= 0 {
+			status.LagBytes = 0
+			h.caughtUp[f.Path] = now
+		} else if since, ok := h.caughtUp[f.Path]; ok {
+			status.LagSeconds = int64(now.Sub(since).Seconds())
+		} else {
+			// behind since the client started or the file was found
+			status.LagSeconds = int64(now.Sub(info.ModTime()).Seconds())
+		}
+		out.Files = append(out.Files, status)
+	}
+	// forget files no longer tracked
+	for path := range h.caughtUp {
+		if !tracked[path] {
+			delete(h.caughtUp, path)
+		}
+	}
+	for path := range h.parseErrors {
+		if !tracked[path] {
+			delete(h.parseErrors, path)
+		}
+	}
+	return out
+}
+
+// generateStatusFrame returns a status frame with the current health report.
+func generateStatusFrame(s *state, db *database) *UploadRequest {
+	return &UploadRequest{
+		Header: Header{
+			MsgUuid:      uuid.New().String(),
+			MsgTimestamp: time.Now(),
+			Session:      s.Session,
+			MsgType:      2,
+		},
+		AssetId: s.AssetID,
+		Status:  s.Health.status(s, db),
+	}
+}
+
+// statusLoop sends a status frame when connected and every statusInterval
+// until the session ends. The scanner may block while waiting for new log
+// entries, so status frames are sent independently of data frames.
+func statusLoop(sess *session) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		// connection failures end the session
+		if sess.send(generateStatusFrame(sess.s, sess.db), nil) != nil {
+			return
+		}
+		select {
+		case <-sess.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
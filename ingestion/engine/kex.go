@@ -0,0 +1,284 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// kexProtocol identifies the key agreement in the transcript, it must match
+	// the backend
+	kexProtocol = "canids-ingest-kex-v1"
+	// rekeyInterval is how often the session key is ratcheted
+	rekeyInterval = 15 * time.Minute
+	// rekeyFrames is the number of frames after which the session key is
+	// ratcheted
+	rekeyFrames = 1 << 16
+)
+
+// KeyExchange is the key agreement message, sent with message type 5.
+type KeyExchange struct {
+	Ephemeral string `json:"ephemeral,omitempty"` // Base64 X25519 ephemeral public key
+	Static    string `json:"static,omitempty"`    // Base64 X25519 static public key of the backend
+	PSK       bool   `json:"psk,omitempty"`       // Whether the legacy shared key is mixed in
+	Confirm   string `json:"confirm,omitempty"`   // Base64 key confirmation
+	Encrypt   bool   `json:"encrypt,omitempty"`   // Whether the client must encrypt payloads
+}
+
+// cipherSession is the payload key and frame counters of a connection.
+type cipherSession struct {
+	key     []byte    // key is the payload key of the current epoch
+	epoch   uint32    // epoch is the current key epoch
+	seq     uint64    // seq is the sequence number of the last frame
+	frames  int       // frames is the number of frames sent in the current epoch
+	rekeyed time.Time // rekeyed is when the current epoch started
+}
+
+// CreateIdentityKey creates and returns a base64 encoded X25519 private key
+// identifying the client to the backend.
+func CreateIdentityKey() (string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// identityKey returns the identity key of the client.
+func identityKey(s *state) (*ecdh.PrivateKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(s.IdentityKey)
+	if err != nil {
+		return nil, errBadIdentityKey
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, errBadIdentityKey
+	}
+	return key, nil
+}
+
+// identityFingerprint returns the fingerprint of the identity public key, shown
+// to administrators approving the client.
+func identityFingerprint(s *state) string {
+	key, err := identityKey(s)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(key.PublicKey().Bytes())
+	out := make([]string, 16)
+	for i := range out {
+		out[i] = hex.EncodeToString(sum[i : i+1])
+	}
+	return strings.Join(out, ":")
+}
+
+// clientExchange performs the authenticated key agreement with the backend. The
+// static key of the backend is pinned on the first connection, a different key
+// aborts the connection. It returns the cipher session of the connection.
+func clientExchange(s *state, db *database, sess *session) (*cipherSession, error) {
+	identity, err := identityKey(s)
+	if err != nil {
+		return nil, err
+	}
+
+	hello, err := sess.receive(s.ReplyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if hello.MsgType != 5 || hello.Exchange == nil {
+		return nil, errKeyExchange
+	}
+	serverEphemeral, err := publicKey(hello.Exchange.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	serverStatic, err := publicKey(hello.Exchange.Static)
+	if err != nil {
+		return nil, err
+	}
+	err = pinServerKey(s, db, hello.Exchange.Static)
+	if err != nil {
+		return nil, err
+	}
+
+	// clients approved before identity keys were pinned prove the shared key
+	var psk []byte
+	if hello.Exchange.PSK {
+		psk, err = base64.StdEncoding.DecodeString(s.EncryptionKey)
+		if err != nil || len(psk) == 0 {
+			return nil, errBadKey
+		}
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ee, err := ephemeral.ECDH(serverEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	es, err := identity.ECDH(serverEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	se, err := ephemeral.ECDH(serverStatic)
+	if err != nil {
+		return nil, err
+	}
+
+	// transcript of the public values, HKDF-SHA256 extract with it as salt
+	h := sha256.New()
+	h.Write([]byte(kexProtocol))
+	h.Write([]byte{0})
+	h.Write([]byte(s.AssetID))
+	h.Write([]byte{0})
+	for _, key := range []*ecdh.PublicKey{identity.PublicKey(), serverEphemeral, serverStatic, ephemeral.PublicKey()} {
+		h.Write(key.Bytes())
+	}
+	transcript := h.Sum(nil)
+	ikm := append(append(append(append([]byte{}, ee...), es...), se...), psk...)
+	prk := mac(transcript, ikm)
+
+	reply := Message{
+		MsgType: 5,
+		Exchange: &KeyExchange{
+			Ephemeral: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+			Confirm:   base64.StdEncoding.EncodeToString(mac(expand(prk, "client confirm"), transcript)),
+		},
+	}
+	err = sess.send(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	done, err := sess.receive(s.ReplyTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if done.MsgType != 5 || done.Exchange == nil {
+		return nil, errKeyExchange
+	}
+	confirm, err := base64.StdEncoding.DecodeString(done.Exchange.Confirm)
+	if err != nil {
+		return nil, errKeyExchange
+	}
+	flag := byte(0)
+	if done.Exchange.Encrypt {
+		flag = 1
+	}
+	if !hmac.Equal(confirm, mac(expand(prk, "server confirm"), append(transcript, flag))) {
+		return nil, errKeyConfirm
+	}
+	s.MustEncrypt = done.Exchange.Encrypt
+	if done.Exchange.Encrypt && !s.Encryption {
+		log.Println("[CanIDS] backend requires encrypted payloads, enabling encryption")
+		s.Encryption = true
+	}
+
+	return &cipherSession{key: expand(prk, "data"), rekeyed: time.Now()}, nil
+}
+
+// publicKey parses the base64 encoded X25519 public key.
+func publicKey(encoded string) (*ecdh.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errKeyExchange
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, errKeyExchange
+	}
+	return key, nil
+}
+
+// pinServerKey compares the static key of the backend with the pinned key, or
+// pins it in the local database if no key is pinned yet.
+func pinServerKey(s *state, db *database, static string) error {
+	s.DatabaseMutex.Lock()
+	defer s.DatabaseMutex.Unlock()
+	if s.ServerKey != "" {
+		if s.ServerKey != static {
+			return errServerKey
+		}
+		return nil
+	}
+	s.ServerKey = static
+	log.Println("[CanIDS] pinned backend key")
+	return db.commit(s)
+}
+
+// next returns the sequence number, key epoch and payload key of the next data
+// frame. The payload key is ratcheted every rekeyFrames frames or
+// rekeyInterval.
+func (c *cipherSession) next() (uint64, uint32, []byte) {
+	if c.frames >= rekeyFrames || time.Since(c.rekeyed) >= rekeyInterval {
+		c.key = expand(c.key, "rekey")
+		c.epoch++
+		c.frames = 0
+		c.rekeyed = time.Now()
+	}
+	c.seq++
+	c.frames++
+	return c.seq, c.epoch, c.key
+}
+
+// seal encrypts the payload entries of a frame with AES-256-GCM, binding the
+// sequence number, key epoch, entry index, asset ID and file name.
+func seal(key []byte, assetID string, fileName string, seq uint64, epoch uint32, entries [][]byte) ([][]byte, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(c)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(entries))
+	for i, entry := range entries {
+		nonce := make([]byte, gcm.NonceSize())
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, gcm.Seal(nonce, nonce, entry, additionalData(assetID, fileName, seq, epoch, i)))
+	}
+	return out, nil
+}
+
+// additionalData returns the authenticated data of a payload entry, it must
+// match the backend.
+func additionalData(assetID string, fileName string, seq uint64, epoch uint32, index int) []byte {
+	out := make([]byte, 16, 16+len(assetID)+1+len(fileName))
+	binary.BigEndian.PutUint64(out[0:], seq)
+	binary.BigEndian.PutUint32(out[8:], epoch)
+	binary.BigEndian.PutUint32(out[12:], uint32(index))
+	out = append(out, assetID...)
+	out = append(out, 0)
+	return append(out, fileName...)
+}
+
+// mac returns the HMAC-SHA256 of data.
+func mac(key []byte, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// expand returns the first HKDF-SHA256 expand block for the label.
+func expand(prk []byte, label string) []byte {
+	return mac(prk, append([]byte(label), 1))
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+// defaultWhitelist are the log files sent until the backend pushes a profile
+var defaultWhitelist = []string{"conn.log", "dns.log", "http.log", "sip.log", "ssl.log", "stats.log", "weird.log", "telemetry.log"}
+
+var errBadProfile = errors.New("[CanIDS] error: invalid configuration profile")
+
+// Profile is the configuration of the client pushed by the backend. It
+// replaces the command line flags until the client is restarted.
+type Profile struct {
+	Version   int      `json:"version"`   // Version is the version of the profile
+	Scan      string   `json:"scan"`      // Scan is how often to scan for new log files
+	Delay     string   `json:"delay"`     // Delay is the delay before reconnecting
+	Encrypt   bool     `json:"encrypt"`   // Encrypt is whether log entries are encrypted
+	ChunkSize int      `json:"chunkSize"` // ChunkSize is the largest number of lines sent in a frame
+	Whitelist []string `json:"whitelist"` // Whitelist are the names of the log files sent
+}
+
+// configure sets the state from the profile. It returns errBadProfile and
+// leaves the state unchanged if the profile is invalid.
+func configure(s *state, p *Profile) error {
+	scan, err := time.ParseDuration(p.Scan)
+	if err != nil || scan < time.Second {
+		return errBadProfile
+	}
+	delay, err := time.ParseDuration(p.Delay)
+	if err != nil || delay < time.Second {
+		return errBadProfile
+	}
+	if p.ChunkSize < minChunkSize || p.ChunkSize > maxChunkSize || len(p.Whitelist) == 0 {
+		return errBadProfile
+	}
+	s.FileScan = scan
+	s.RetryDelay = delay
+	// encryption required by the backend can not be disabled
+	s.Encryption = p.Encrypt || s.MustEncrypt
+	s.MaxChunkSize = p.ChunkSize
+	if s.FileChunkSize > s.MaxChunkSize {
+		s.FileChunkSize = s.MaxChunkSize
+	}
+	s.Whitelist = p.Whitelist
+	s.Profile = p
+	return nil
+}
+
+// applyProfile applies the profile pushed by the backend, stops sending files
+// no longer whitelisted and acknowledges the profile.
+func applyProfile(sess *session, p *Profile) {
+	s, db := sess.s, sess.db
+	s.DatabaseMutex.Lock()
+	err := configure(s, p)
+	if err == nil {
+		files := []file{}
+		for _, f := range db.Files {
+			if slices.Contains(s.Whitelist, filepath.Base(f.Path)) {
+				files = append(files, f)
+			}
+		}
+		db.Files = files
+		err = db.commit(s)
+	}
+	s.DatabaseMutex.Unlock()
+
+	if err != nil {
+		log.Println("[CanIDS] failed to apply configuration profile version", p.Version, err)
+	} else {
+		log.Println("[CanIDS] applied configuration profile version", p.Version)
+	}
+
+	// a profile pushed as the connection drops is pushed again on reconnect
+	sess.send(generateProfileFrame(s, p.Version, err), nil)
+}
+
+// generateProfileFrame returns the acknowledgement of the profile version,
+// with the error if it was rejected.
+func generateProfileFrame(s *state, version int, err error) *UploadRequest {
+	frame := &UploadRequest{
+		Header: Header{
+			MsgUuid:      uuid.New().String(),
+			MsgTimestamp: time.Now(),
+			Session:      s.Session,
+			MsgType:      3,
+		},
+		AssetId: s.AssetID,
+		Version: version,
+	}
+	if err != nil {
+		frame.Header.ErrorMsg = err.Error()
+	}
+	return frame
+}
@@ -20,7 +20,7 @@ func syncScanner(s *state) (*database, error) {
 	defer s.DatabaseMutex.Unlock()
 
 	// check if database exists, create if doesn't exist
-	db, err := dbLoad()
+	db, err := dbLoad(s.Database)
 	if err != nil {
 		if s.Debug {
 			log.Println("[CanIDS DEBUG] local database does not exist, creating new database")
@@ -29,17 +29,6 @@ func syncScanner(s *state) (*database, error) {
 		// create new entry
 		db = &database{}
 
-		// Generate new encryption key
-		key, err := CreateKey()
-		if err != nil {
-			db.AssetID = ""
-			db.Key = ""
-			return db, err
-		}
-
-		db.Key = key
-		s.EncryptionKey = key
-
 		// Generate new assetID
 		assetID, err := CreateAssetID()
 		if err != nil {
@@ -49,7 +38,6 @@ func syncScanner(s *state) (*database, error) {
 		}
 
 		log.Println(assetID)
-		log.Println(key)
 		db.AssetID = assetID
 		s.AssetID = assetID
 
@@ -59,11 +47,37 @@ func syncScanner(s *state) (*database, error) {
 		}
 		s.EncryptionKey = db.Key
 		s.AssetID = db.AssetID
+		s.CertKey = db.CertKey
+		s.Certificate = db.Cert
+		s.IdentityKey = db.IdentityKey
+		s.ServerKey = db.ServerKey
 		// clear broken entries
 		db.clean()
 	}
 
-	log.Printf("[CanIDS] info: s.FilePath %s, s.FileMode %s", s.FilePath, s.FileMode)
+	// Generate client certificate key, also for databases created before
+	// client certificates were issued
+	if db.CertKey == "" {
+		certKey, err := CreateCertKey()
+		if err != nil {
+			return db, err
+		}
+		db.CertKey = certKey
+		s.CertKey = certKey
+	}
+
+	// Generate identity key, also for databases created before identity keys
+	// were pinned
+	if db.IdentityKey == "" {
+		identityKey, err := CreateIdentityKey()
+		if err != nil {
+			return db, err
+		}
+		db.IdentityKey = identityKey
+		s.IdentityKey = identityKey
+	}
+
+	log.Printf("[CanIDS] info: s.FilePath %s, s.FileMode %d", s.FilePath, s.FileMode)
 
 	switch s.FileMode {
 	case fileRegular:
@@ -89,12 +103,13 @@ func syncScanner(s *state) (*database, error) {
 }
 
 // scannerGetFrame will generate the next frame to be sent over Websockets. If a
-// frame cannot be generated, the scanner will sleep until a frame is available.
-func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error) {
+// frame cannot be generated, the scanner will sleep until a frame is available
+// or abort is closed.
+func scannerGetFrame(s *state, db *database, abort <-chan struct{}) (*UploadRequest, error) {
 	s.DatabaseMutex.Lock()
 
 	select {
-	case <-s.ScannerAbort:
+	case <-abort:
 		s.DatabaseMutex.Unlock()
 		// signalled to abort
 		return nil, nil
@@ -108,7 +123,7 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 		}
 		s.DatabaseMutex.Unlock()
 		time.Sleep(scannerSleep)
-		return scannerGetFrame(s, db, key)
+		return scannerGetFrame(s, db, abort)
 	}
 
 	// check if there is at least one file that has been modified
@@ -129,7 +144,7 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 			if err != nil {
 				return nil, errSavingDatabase
 			}
-			return scannerGetFrame(s, db, key)
+			return scannerGetFrame(s, db, abort)
 		}
 		// check if file has gotten smaller (file rotation)
 		if info.Size() < file.Size {
@@ -144,7 +159,7 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 			if err != nil {
 				return nil, errSavingDatabase
 			}
-			return scannerGetFrame(s, db, key)
+			return scannerGetFrame(s, db, abort)
 		}
 		// file exists, see if file has been modified
 		if info.Size() != file.Size {
@@ -159,7 +174,7 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 		}
 		s.DatabaseMutex.Unlock()
 		time.Sleep(scannerSleep)
-		return scannerGetFrame(s, db, key)
+		return scannerGetFrame(s, db, abort)
 	}
 
 	// ensure local database is valid (sync)
@@ -171,9 +186,11 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 		if err != nil {
 			return nil, err
 		}
+		s.DatabaseMutex.Lock()
 		db.Next = 0 // start at zero for synchronization
 		db.Files = new.Files
-		return scannerGetFrame(s, db, key)
+		s.DatabaseMutex.Unlock()
+		return scannerGetFrame(s, db, abort)
 	}
 
 	// get current file info
@@ -197,7 +214,7 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 		if err != nil {
 			return nil, errSavingDatabase
 		}
-		return scannerGetFrame(s, db, key)
+		return scannerGetFrame(s, db, abort)
 	}
 
 	// if file size hasn't changed, nothing to do, get next frame
@@ -215,11 +232,11 @@ func scannerGetFrame(s *state, db *database, key []byte) (*UploadRequest, error)
 			return nil, errSavingDatabase
 		}
 		// get next frame
-		return scannerGetFrame(s, db, key)
+		return scannerGetFrame(s, db, abort)
 	}
 
 	// generate frame (updated provided file)
-	frame, frameErr := generateFrame(s, &file, info.Name(), key)
+	frame, frameErr := generateFrame(s, &file, info.Name())
 
 	// sync modified file with database and commit
 	db.Files[db.Next] = file
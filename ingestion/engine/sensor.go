@@ -0,0 +1,91 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sensorName matches the name of a sensor, used in file names
+var sensorName = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// sensor is a file or directory of Zeek logs sent as its own asset. Each sensor
+// has its own asset identity, local database and spool, and its own connection
+// to the backend.
+type sensor struct {
+	name     string   // name identifies the sensor locally, empty for a single unnamed path
+	path     string   // path is the file or directory of Zeek logs
+	tags     []string // tags are reported to the backend with the client health
+	database string   // database is the path of the local database
+	spoolDir string   // spoolDir is the directory of the spool
+}
+
+// parseSensors returns the sensors of the command line arguments, each a path
+// optionally preceded by a name, such as "eth0=/zeek/eth0". An existing path
+// containing "=" is not split, and any path can be named to avoid ambiguity,
+// such as "eth0=/zeek/a=b". Tags are given as "name=tag,tag". A single unnamed
+// path keeps the local database in the working directory, so that existing
+// clients keep their identity. Other sensors are named after their directory
+// if no name is given.
+func parseSensors(args []string, tags []string, dataDir string, spoolDir string) ([]*sensor, error) {
+	if len(args) == 0 {
+		return nil, errNoPath
+	}
+	sensors := []*sensor{}
+	names := map[string]*sensor{}
+	for _, arg := range args {
+		sn := &sensor{path: arg}
+		if name, path, ok := strings.Cut(arg, "="); ok && sensorName.MatchString(name) && !exists(arg) {
+			sn.name, sn.path = name, path
+		} else if len(args) > 1 {
+			sn.name = filepath.Base(filepath.Clean(arg))
+		}
+		if sn.path == "" {
+			return nil, errNoPath
+		}
+		if len(args) > 1 || sn.name != "" {
+			if !sensorName.MatchString(sn.name) || names[sn.name] != nil {
+				return nil, errSensorName
+			}
+		}
+
+		sn.database = dbFileName
+		sn.spoolDir = spoolDir
+		if sn.name != "" {
+			sn.database = filepath.Join(dataDir, strings.TrimSuffix(dbFileName, ".db")+"-"+sn.name+".db")
+			sn.spoolDir = filepath.Join(spoolDir, sn.name)
+		}
+		names[sn.name] = sn
+		sensors = append(sensors, sn)
+	}
+
+	for _, tag := range tags {
+		name, list := "", tag
+		if i := strings.Index(tag, "="); i >= 0 {
+			name, list = tag[:i], tag[i+1:]
+		} else if len(sensors) == 1 {
+			// a single sensor may be tagged without its name
+			name = sensors[0].name
+		}
+		sn := names[name]
+		if sn == nil {
+			return nil, errSensorTags
+		}
+		for _, t := range strings.Split(list, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				sn.tags = append(sn.tags, t)
+			}
+		}
+	}
+	return sensors, nil
+}
+
+// exists returns if the file or directory exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
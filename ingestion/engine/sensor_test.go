@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSensors(t *testing.T) {
+	dataDir, spoolDir := "/data", "/spool"
+	// an existing directory with "=" in its name
+	equals := filepath.Join(t.TempDir(), "zeek=logs")
+	err := os.Mkdir(equals, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name    string
+		args    []string
+		tags    []string
+		sensors []sensor
+		err     error
+	}{
+		{
+			name: "single unnamed path keeps the database in the working directory",
+			args: []string{"/zeek/logs"},
+			tags: []string{"dmz, production"},
+			sensors: []sensor{
+				{path: "/zeek/logs", tags: []string{"dmz", "production"}, database: dbFileName, spoolDir: "/spool"},
+			},
+		},
+		{
+			name: "single named path",
+			args: []string{"eth0=/zeek/eth0"},
+			tags: []string{"eth0=dmz"},
+			sensors: []sensor{
+				{name: "eth0", path: "/zeek/eth0", tags: []string{"dmz"}, database: "/data/.canids-ingestion-v1.0.0-eth0.db", spoolDir: "/spool/eth0"},
+			},
+		},
+		{
+			name: "several paths are named after their directory",
+			args: []string{"/zeek/eth0/", "vlan10=/zeek/vlan"},
+			tags: []string{"vlan10=internal", "eth0=dmz"},
+			sensors: []sensor{
+				{name: "eth0", path: "/zeek/eth0/", tags: []string{"dmz"}, database: "/data/.canids-ingestion-v1.0.0-eth0.db", spoolDir: "/spool/eth0"},
+				{name: "vlan10", path: "/zeek/vlan", tags: []string{"internal"}, database: "/data/.canids-ingestion-v1.0.0-vlan10.db", spoolDir: "/spool/vlan10"},
+			},
+		},
+		{
+			name: "existing path containing = is not split",
+			args: []string{equals},
+			sensors: []sensor{
+				{path: equals, database: dbFileName, spoolDir: "/spool"},
+			},
+		},
+		{
+			name: "named path containing =",
+			args: []string{"eth0=" + equals},
+			sensors: []sensor{
+				{name: "eth0", path: equals, database: "/data/.canids-ingestion-v1.0.0-eth0.db", spoolDir: "/spool/eth0"},
+			},
+		},
+		{
+			name: "prefix that is not a sensor name is part of the path",
+			args: []string{"./eth0=x"},
+			sensors: []sensor{
+				{path: "./eth0=x", database: dbFileName, spoolDir: "/spool"},
+			},
+		},
+		{
+			name: "no path",
+			err:  errNoPath,
+		},
+		{
+			name: "empty path",
+			args: []string{"eth0="},
+			err:  errNoPath,
+		},
+		{
+			name: "duplicate name",
+			args: []string{"eth0=/zeek/a", "eth0=/zeek/b"},
+			err:  errSensorName,
+		},
+		{
+			name: "duplicate directory name",
+			args: []string{"/a/zeek", "/b/zeek"},
+			err:  errSensorName,
+		},
+		{
+			name: "unnamed path among several with an invalid directory name",
+			args: []string{equals, "/zeek/eth0"},
+			err:  errSensorName,
+		},
+		{
+			name: "tags of an unknown sensor",
+			args: []string{"eth0=/zeek/eth0"},
+			tags: []string{"eth1=dmz"},
+			err:  errSensorTags,
+		},
+		{
+			name: "unnamed tags with several sensors",
+			args: []string{"eth0=/zeek/eth0", "eth1=/zeek/eth1"},
+			tags: []string{"dmz"},
+			err:  errSensorTags,
+		},
+	} {
+		sensors, err := parseSensors(c.args, c.tags, dataDir, spoolDir)
+		if err != c.err {
+			t.Errorf("%s: expected error %v, got %v", c.name, c.err, err)
+			continue
+		}
+		got := []sensor{}
+		for _, sn := range sensors {
+			got = append(got, *sn)
+		}
+		if c.err == nil && !reflect.DeepEqual(got, c.sensors) {
+			t.Errorf("%s: expected %+v, got %+v", c.name, c.sensors, got)
+		}
+	}
+}
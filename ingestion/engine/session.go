@@ -0,0 +1,287 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+)
+
+const (
+	// writeTimeout is how long to wait for a frame to be written
+	writeTimeout = 5 * time.Second
+	// outgoingSize is the number of frames waiting to be written
+	outgoingSize = 16
+)
+
+// outgoing is a frame waiting to be written by the writer.
+type outgoing struct {
+	message interface{}    // message is the frame or handshake message
+	frame   *UploadRequest // frame is the message if it is a data frame, tracked until acknowledged
+	sent    func()         // sent is called once the message is written, if set
+	acked   func()         // acked is called once the backend acknowledged the data frame, if set
+}
+
+// session is a single connection to the backend. The reader goroutine
+// dispatches the messages of the backend and the writer goroutine writes every
+// frame, so nothing is written concurrently. The session is cancelled when the
+// connection fails or the client shuts down, which stops every goroutine of the
+// session before the next connection is made.
+type session struct {
+	s        *state
+	db       *database
+	conn     *websocket.Conn
+	shutdown context.Context    // shutdown is cancelled when the client shuts down
+	ctx      context.Context    // ctx is cancelled when the session ends
+	cancel   context.CancelFunc // cancel ends the session
+	replies  chan *Message      // replies are the handshake and approval messages of the backend
+	out      chan *outgoing     // out are the frames to write, in order
+	writer   sync.WaitGroup     // writer waits for the writer goroutine
+	workers  sync.WaitGroup     // workers waits for every other goroutine of the session
+	mutex    sync.Mutex         // mutex guards err, inflight and window
+	err      error              // err is why the session ended
+	inflight []*outgoing        // inflight are the data frames written and not yet acknowledged
+	window   bool               // window indicates the initial credits were granted
+}
+
+// newSession starts the reader and writer of the connection. The session ends
+// when shutdown is cancelled.
+func newSession(shutdown context.Context, s *state, db *database, conn *websocket.Conn) *session {
+	ctx, cancel := context.WithCancel(shutdown)
+	sess := &session{
+		s:        s,
+		db:       db,
+		conn:     conn,
+		shutdown: shutdown,
+		ctx:      ctx,
+		cancel:   cancel,
+		replies:  make(chan *Message, 4),
+		out:      make(chan *outgoing, outgoingSize),
+	}
+	// data frames are only sent with credits granted by the backend
+	s.Flow = newFlowControl()
+
+	sess.writer.Add(1)
+	go sess.write()
+	sess.spawn(sess.read)
+	// wake the scanner when the session ends, it may be waiting for log lines
+	abort := s.ScannerAbort
+	sess.spawn(func() {
+		<-sess.ctx.Done()
+		close(abort)
+	})
+	return sess
+}
+
+// spawn runs the function in a goroutine of the session, waited for when the
+// session is closed. The function must return once the session ends.
+func (sess *session) spawn(f func()) {
+	sess.workers.Add(1)
+	go func() {
+		defer sess.workers.Done()
+		f()
+	}()
+}
+
+// fail ends the session with the error, keeping the first error.
+func (sess *session) fail(err error) {
+	sess.mutex.Lock()
+	if sess.err == nil {
+		sess.err = err
+	}
+	sess.mutex.Unlock()
+	sess.cancel()
+}
+
+// error returns why the session ended, or nil if it has not.
+func (sess *session) error() error {
+	sess.mutex.Lock()
+	defer sess.mutex.Unlock()
+	if sess.err == nil {
+		return sess.ctx.Err()
+	}
+	return sess.err
+}
+
+// close ends the session and waits for its goroutines. Frames already queued
+// are written first, so that a client shutting down does not lose them. Data
+// frames not acknowledged are reported to the Failed hook.
+func (sess *session) close() {
+	sess.cancel()
+	sess.writer.Wait()
+	if sess.shutdown.Err() != nil {
+		sess.conn.Close(websocket.StatusNormalClosure, "client shutting down")
+	} else {
+		sess.conn.Close(websocket.StatusInternalError, "WebSocket closed")
+	}
+	sess.workers.Wait()
+
+	err := sess.error()
+	for _, o := range sess.inflight {
+		sess.s.Hooks.failed(o.frame, err)
+	}
+	for {
+		select {
+		case o := <-sess.out:
+			if o.frame != nil {
+				sess.s.Hooks.failed(o.frame, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// send queues the message to be written, calling sent once it is written if
+// not nil. It returns an error if the session ended.
+func (sess *session) send(message interface{}, sent func()) error {
+	return sess.queue(&outgoing{message: message, sent: sent})
+}
+
+// sendFrame queues the data frame to be written, calling acked once the backend
+// acknowledged it if not nil. It returns an error if the session ended.
+func (sess *session) sendFrame(frame *UploadRequest, acked func()) error {
+	return sess.queue(&outgoing{message: frame, frame: frame, acked: acked})
+}
+
+// queue queues the message to be written by the writer.
+func (sess *session) queue(o *outgoing) error {
+	select {
+	case sess.out <- o:
+		return nil
+	case <-sess.ctx.Done():
+		return sess.error()
+	}
+}
+
+// acknowledge reports the data frames indexed by the backend, one per credit
+// granted. The first grant is the initial window and acknowledges no frame.
+func (sess *session) acknowledge(credits int) {
+	sess.mutex.Lock()
+	if !sess.window {
+		sess.window = true
+		credits = 0
+	}
+	if credits > len(sess.inflight) {
+		credits = len(sess.inflight)
+	}
+	acknowledged := sess.inflight[:credits]
+	sess.inflight = sess.inflight[credits:]
+	sess.mutex.Unlock()
+	for _, o := range acknowledged {
+		sess.s.Hooks.acknowledged(o.frame)
+		if o.acked != nil {
+			o.acked()
+		}
+	}
+}
+
+// receive returns the next handshake message of the backend. It waits at most
+// the timeout, or until the session ends if the timeout is zero.
+func (sess *session) receive(timeout time.Duration) (*Message, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case msg := <-sess.replies:
+		return msg, nil
+	case <-sess.ctx.Done():
+		return nil, sess.error()
+	case <-expired:
+		return nil, context.DeadlineExceeded
+	}
+}
+
+// read dispatches the messages of the backend until the connection fails or
+// is closed.
+func (sess *session) read() {
+	for {
+		var msg Message
+		err := wsjson.Read(context.Background(), sess.conn, &msg)
+		if err != nil {
+			if sess.ctx.Err() == nil {
+				log.Println("[CanIDS] failed to read from WebSocket", err)
+			}
+			sess.fail(errConnectionLost)
+			return
+		}
+
+		switch msg.MsgType {
+		case 1:
+			sess.send(generatePongFrame(sess.s), nil)
+		case 2, 3, 4, 5:
+			select {
+			case sess.replies <- &msg:
+			case <-sess.ctx.Done():
+				return
+			}
+		case 6:
+			sess.acknowledge(msg.Credits)
+			sess.s.Flow.grant(msg.Credits)
+		case 7:
+			if msg.Profile != nil {
+				applyProfile(sess, msg.Profile)
+			}
+		}
+	}
+}
+
+// write writes the queued frames until the session ends, then the frames still
+// queued unless the connection failed.
+func (sess *session) write() {
+	defer sess.writer.Done()
+	for {
+		select {
+		case o := <-sess.out:
+			if !sess.writeFrame(o) {
+				return
+			}
+		case <-sess.ctx.Done():
+			for {
+				select {
+				case o := <-sess.out:
+					if !sess.writeFrame(o) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeFrame writes the queued frame. It ends the session and returns false
+// if the write failed.
+func (sess *session) writeFrame(o *outgoing) bool {
+	if o.frame != nil {
+		// tracked before writing, the backend may acknowledge it at once
+		sess.mutex.Lock()
+		sess.inflight = append(sess.inflight, o)
+		sess.mutex.Unlock()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	err := wsjson.Write(ctx, sess.conn, o.message)
+	cancel()
+	if err != nil {
+		log.Println("[CanIDS] failed to send frame over WebSocket", err)
+		sess.fail(err)
+		return false
+	}
+	if o.frame != nil {
+		sess.s.Hooks.sent(o.frame)
+	}
+	if o.sent != nil {
+		o.sent()
+	}
+	return true
+}
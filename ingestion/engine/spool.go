@@ -0,0 +1,325 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// spoolPrefix and spoolSuffix surround the sequence number of a segment
+	spoolPrefix = "spool-"
+	spoolSuffix = ".json.gz"
+	// spoolSegmentSize is the largest compressed size of a segment, the
+	// smallest amount dropped when the spool overflows, and at most a quarter
+	// of the spool
+	spoolSegmentSize = 8 << 20
+
+	// overflowDrop drops the oldest segments when the spool is full
+	overflowDrop = "drop-oldest"
+	// overflowPause stops reading log files when the spool is full, leaving
+	// the lines in the log files
+	overflowPause = "pause"
+)
+
+var errOverflow = errors.New("[CanIDS] error: spool overflow policy must be drop-oldest or pause")
+
+// spool holds the frames read while the backend is unreachable, in gzip
+// compressed segments of JSON frames. Segments are written while disconnected
+// and drained in order after reconnecting. A segment is deleted once the
+// backend acknowledged all its frames.
+type spool struct {
+	mutex   sync.Mutex       // mutex guards the spool
+	dir     string           // dir is the directory of the segments
+	max     int64            // max is the largest compressed size of the spool in bytes
+	segment int64            // segment is the largest compressed size of a segment in bytes
+	pause   bool             // pause indicates the overflow policy is overflowPause
+	next    int64            // next is the sequence number of the next segment
+	file    *os.File         // file is the segment being written, nil if none
+	path    string           // path is the path of file
+	writer  *gzip.Writer     // writer compresses to file
+	encoder *json.Encoder    // encoder writes frames to writer
+	drained string           // drained is the path of the segment being drained
+	pending []*UploadRequest // pending are the frames of the drained segment not yet sent
+	unacked map[string]int   // unacked are the frames not yet acknowledged by segment, for the segments read
+}
+
+// openSpool returns the spool in the directory, creating it if needed.
+func openSpool(dir string, max int64, overflow string) (*spool, error) {
+	if overflow != overflowDrop && overflow != overflowPause {
+		return nil, errOverflow
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	sp := &spool{
+		dir:     dir,
+		max:     max,
+		segment: spoolSegmentSize,
+		pause:   overflow == overflowPause,
+		unacked: map[string]int{},
+	}
+	if sp.segment > max/4 {
+		sp.segment = max / 4
+	}
+	segments, err := sp.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		last := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(segments[len(segments)-1]), spoolPrefix), spoolSuffix)
+		fmt.Sscan(last, &sp.next)
+		sp.next++
+	}
+	return sp, nil
+}
+
+// segments returns the paths of the segments, oldest first.
+func (sp *spool) segments() ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(sp.dir, spoolPrefix+"*"+spoolSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// size returns the compressed size of the spool in bytes.
+func (sp *spool) size() int64 {
+	segments, _ := sp.segments()
+	total := int64(0)
+	for _, path := range segments {
+		info, err := os.Stat(path)
+		if err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// full returns if the spool can not hold more frames under the pause policy.
+func (sp *spool) full() bool {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	return sp.pause && sp.size() >= sp.max
+}
+
+// append adds the frame to the segment being written. Under the drop-oldest
+// policy, the oldest segments are deleted to stay within the size limit.
+func (sp *spool) append(frame *UploadRequest) error {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if sp.file != nil {
+		info, err := sp.file.Stat()
+		if err == nil && info.Size() >= sp.segment {
+			sp.closeSegment()
+		}
+	}
+	if sp.file == nil {
+		if !sp.pause {
+			sp.dropOldest()
+		}
+		path := filepath.Join(sp.dir, fmt.Sprintf("%s%020d%s", spoolPrefix, sp.next, spoolSuffix))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		sp.next++
+		sp.file, sp.path = file, path
+		sp.writer = gzip.NewWriter(file)
+		sp.encoder = json.NewEncoder(sp.writer)
+	}
+	err := sp.encoder.Encode(frame)
+	if err != nil {
+		return err
+	}
+	// flush so that the frame survives a crash
+	return sp.writer.Flush()
+}
+
+// dropOldest deletes the oldest segments until a new segment fits within the
+// size limit. It must be called with the mutex held.
+func (sp *spool) dropOldest() {
+	segments, _ := sp.segments()
+	for i := 0; i < len(segments) && sp.size()+sp.segment > sp.max; i++ {
+		log.Println("[CanIDS] warning: spool full, dropping", segments[i])
+		os.Remove(segments[i])
+		delete(sp.unacked, segments[i])
+		if segments[i] == sp.drained {
+			sp.drained, sp.pending = "", nil
+		}
+	}
+}
+
+// closeSegment completes the segment being written. It must be called with the
+// mutex held.
+func (sp *spool) closeSegment() {
+	if sp.file == nil {
+		return
+	}
+	sp.writer.Close()
+	sp.file.Close()
+	sp.file, sp.path, sp.writer, sp.encoder = nil, "", nil, nil
+}
+
+// close completes the segment being written, before the client exits.
+func (sp *spool) close() {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.closeSegment()
+}
+
+// take returns the oldest frame not yet sent and the segment holding it, or nil
+// if every frame was sent. The segment being written is only completed and
+// drained once it is the last one. A segment cut short by a crash is read up
+// to the last complete frame.
+func (sp *spool) take() (*UploadRequest, string) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	for len(sp.pending) == 0 {
+		sp.drained = ""
+		segments, _ := sp.segments()
+		for _, path := range segments {
+			if _, read := sp.unacked[path]; !read && path != sp.path {
+				sp.drained = path
+				break
+			}
+		}
+		if sp.drained == "" {
+			if sp.file == nil {
+				return nil, ""
+			}
+			sp.drained = sp.path
+			sp.closeSegment()
+		}
+		sp.pending = readSegment(sp.drained)
+		if len(sp.pending) == 0 {
+			// empty or unreadable segment
+			os.Remove(sp.drained)
+			continue
+		}
+		sp.unacked[sp.drained] = len(sp.pending)
+	}
+	frame := sp.pending[0]
+	sp.pending = sp.pending[1:]
+	return frame, sp.drained
+}
+
+// acknowledged records that the backend indexed a frame of the segment. The
+// segment is deleted once all its frames are acknowledged.
+func (sp *spool) acknowledged(segment string) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	n, ok := sp.unacked[segment]
+	if !ok {
+		// dropped, or sent again after a disconnection
+		return
+	}
+	if n > 1 {
+		sp.unacked[segment] = n - 1
+		return
+	}
+	delete(sp.unacked, segment)
+	os.Remove(segment)
+}
+
+// rewind sends the frames not acknowledged again, after the connection ended.
+// Acknowledged frames of a segment not fully acknowledged are sent again too.
+func (sp *spool) rewind() {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.drained, sp.pending = "", nil
+	sp.unacked = map[string]int{}
+}
+
+// readSegment returns the frames of the segment.
+func readSegment(path string) []*UploadRequest {
+	frames := []*UploadRequest{}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("[CanIDS] failed to read spool segment", path, err)
+		return frames
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		log.Println("[CanIDS] failed to read spool segment", path, err)
+		return frames
+	}
+	decoder := json.NewDecoder(reader)
+	for {
+		var frame UploadRequest
+		err := decoder.Decode(&frame)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println("[CanIDS] spool segment truncated", path, err)
+			break
+		}
+		frames = append(frames, &frame)
+	}
+	return frames
+}
+
+// spoolFor reads unsent log lines into the spool for the duration, instead of
+// leaving them in log files Zeek may rotate away while the backend is
+// unreachable. It returns early if the client shuts down.
+func spoolFor(shutdown context.Context, s *state, db *database, d time.Duration) {
+	ctx, cancel := context.WithTimeout(shutdown, d)
+	defer cancel()
+	// wake the scanner once the duration is over, sessions wait on ScannerAbort
+	abort := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		close(abort)
+	}()
+
+	// pick up log files created since the last scan
+	new, err := syncScanner(s)
+	if err != nil {
+		log.Println("[CanIDS] local database error:", err)
+		<-ctx.Done()
+		return
+	}
+	s.DatabaseMutex.Lock()
+	db.Next = new.Next
+	db.Files = new.Files
+	s.DatabaseMutex.Unlock()
+
+	for ctx.Err() == nil {
+		if s.Spool.full() {
+			log.Println("[CanIDS] warning: spool full, pausing until the backend is reachable")
+			<-ctx.Done()
+			return
+		}
+		frame, err := scannerGetFrame(s, db, abort)
+		if err != nil {
+			log.Println("[CanIDS] failed to generate frame", err)
+			<-ctx.Done()
+			return
+		}
+		if frame == nil {
+			// no new lines before the deadline
+			return
+		}
+		err = s.Spool.append(frame)
+		if err != nil {
+			log.Println("[CanIDS] failed to spool frame, lines are lost", err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2020 Computing Infrastructure Research Centre (CIRC), McMaster
+// University. All rights reserved.
+
+package engine
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// spoolFrame returns a frame of the file with an incompressible payload of the
+// size.
+func spoolFrame(t *testing.T, name string, size int) *UploadRequest {
+	t.Helper()
+	payload := make([]byte, size)
+	_, err := rand.Read(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UploadRequest{FileName: name, Payload: [][]byte{payload}}
+}
+
+// segmentCount returns the number of segments of the spool.
+func segmentCount(t *testing.T, sp *spool) int {
+	t.Helper()
+	segments, err := sp.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(segments)
+}
+
+func TestSpoolAppendTake(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 1<<20, overflowDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = sp.append(spoolFrame(t, fmt.Sprint("f", i), 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments := []string{}
+	for i := 0; i < 3; i++ {
+		frame, segment := sp.take()
+		if frame == nil || frame.FileName != fmt.Sprint("f", i) {
+			t.Fatalf("take %d: unexpected frame %+v", i, frame)
+		}
+		segments = append(segments, segment)
+	}
+	if frame, _ := sp.take(); frame != nil {
+		t.Fatalf("expected empty spool, got %s", frame.FileName)
+	}
+
+	// the segment is kept until every frame is acknowledged
+	sp.acknowledged(segments[0])
+	sp.acknowledged(segments[1])
+	if segmentCount(t, sp) != 1 {
+		t.Fatal("segment deleted before its frames were acknowledged")
+	}
+	sp.acknowledged(segments[2])
+	if segmentCount(t, sp) != 0 {
+		t.Fatal("segment not deleted once its frames were acknowledged")
+	}
+}
+
+func TestSpoolRewind(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), 1<<20, overflowDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err = sp.append(spoolFrame(t, fmt.Sprint("f", i), 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	frame, _ := sp.take()
+	if frame.FileName != "f0" {
+		t.Fatalf("expected f0, got %s", frame.FileName)
+	}
+
+	// the connection ended before the backend acknowledged the frame
+	sp.rewind()
+	for i := 0; i < 2; i++ {
+		frame, segment := sp.take()
+		if frame == nil || frame.FileName != fmt.Sprint("f", i) {
+			t.Fatalf("take %d after rewind: unexpected frame %+v", i, frame)
+		}
+		sp.acknowledged(segment)
+	}
+	if segmentCount(t, sp) != 0 {
+		t.Fatal("segment not deleted once its frames were acknowledged")
+	}
+}
+
+func TestSpoolDropOldest(t *testing.T) {
+	// segments of 1 KB, each frame fills a segment
+	sp, err := openSpool(t.TempDir(), 4<<10, overflowDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err = sp.append(spoolFrame(t, fmt.Sprint("f", i), 1<<10))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	sp.close()
+	if size := sp.size(); size > sp.max+sp.segment {
+		t.Fatalf("spool of %d bytes exceeds the limit of %d", size, sp.max)
+	}
+
+	// the newest frames are kept, in order
+	names := []string{}
+	for frame, _ := sp.take(); frame != nil; frame, _ = sp.take() {
+		names = append(names, frame.FileName)
+	}
+	if len(names) == 0 || len(names) == 10 || names[len(names)-1] != "f9" {
+		t.Fatalf("expected the oldest frames to be dropped, got %v", names)
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i] <= names[i-1] {
+			t.Fatalf("frames out of order: %v", names)
+		}
+	}
+
+	// the pause policy keeps the oldest frames and reports the spool full
+	sp, err = openSpool(t.TempDir(), 4<<10, overflowPause)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10 && !sp.full(); i++ {
+		err = sp.append(spoolFrame(t, fmt.Sprint("f", i), 1<<10))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !sp.full() {
+		t.Fatal("spool not full under the pause policy")
+	}
+	if frame, _ := sp.take(); frame == nil || frame.FileName != "f0" {
+		t.Fatalf("expected the oldest frame to be kept, got %+v", frame)
+	}
+}
+
+func TestSpoolTruncated(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := openSpool(dir, 1<<20, overflowDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = sp.append(spoolFrame(t, fmt.Sprint("f", i), 64))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the client crashed while writing the last frame
+	path := sp.path
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(path, info.Size()-16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sp, err = openSpool(dir, 1<<20, overflowDrop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for frame, _ := sp.take(); frame != nil; frame, _ = sp.take() {
+		names = append(names, frame.FileName)
+	}
+	if len(names) != 2 || names[0] != "f0" || names[1] != "f1" {
+		t.Fatalf("expected the complete frames f0 and f1, got %v", names)
+	}
+
+	// new segments follow the truncated one
+	err = sp.append(spoolFrame(t, "f3", 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp.path <= path {
+		t.Fatalf("segment %s written before %s", sp.path, path)
+	}
+}
@@ -13,10 +13,6 @@ const (
 	// local database filename
 	dbFileName = ".canids-ingestion-v1.0.0.db"
 
-	// scannerSleep indicates how long to sleep for if there is no new frames to
-	// generate (used to avoid busy wait and heavy I/O activity)
-	scannerSleep = 5 * time.Second
-
 	logConn     = "conn.log"
 	logDHCP     = "dhcp.log"
 	logDNS      = "dns.log"
@@ -42,9 +38,14 @@ const (
 	logNotice   = "notice.log"
 )
 
+// scannerSleep indicates how long to sleep for if there is no new frames to
+// generate (used to avoid busy wait and heavy I/O activity)
+var scannerSleep = 5 * time.Second
+
 var (
 	errNoPath         = errors.New("[CanIDS] error: must provide path of file or directory containing Zeek log(s)")
-	errMultiplePaths  = errors.New("[CanIDS] error: must provide single path of file or directory containing Zeek log(s)")
+	errSensorName     = errors.New("[CanIDS] error: sensor names must be unique, only alphanumeric characters, dashes and underscores")
+	errSensorTags     = errors.New("[CanIDS] error: tags must be given as sensor=tag,tag for a sensor path")
 	errNotFound       = errors.New("[CanIDS] error: provided file or directory not found or insufficient permissions")
 	errReadingFile    = errors.New("[CanIDS] error: failed to read file system, please check permissions")
 	errSavingDatabase = errors.New("[CanIDS] error: failed to save local database, please check permissions")
@@ -56,6 +57,13 @@ var (
 	errBadTSV         = errors.New("[CanIDS] error: malformed TSV")
 	errBadKey         = errors.New("[CanIDS] error: must provide valid encryption key")
 	errNoSuccess      = errors.New("Success message not received")
+	errBadCertKey     = errors.New("[CanIDS] error: invalid client certificate key in local database")
+	errBadCA          = errors.New("[CanIDS] error: must provide valid PEM encoded CA certificate")
+	errBadIdentityKey = errors.New("[CanIDS] error: invalid identity key in local database")
+	errKeyExchange    = errors.New("[CanIDS] error: invalid key exchange message")
+	errKeyConfirm     = errors.New("[CanIDS] error: backend key confirmation failed")
+	errServerKey      = errors.New("[CanIDS] error: backend key does not match pinned key, remove the local database to trust the new key")
+	errConnectionLost = errors.New("[CanIDS] error: connection to backend lost")
 )
 
 // fileMode indicates if a single regular file or directory was passed
@@ -71,18 +79,37 @@ const (
 
 // state represents client state.
 type state struct {
-	AssetID       string        // AssetID identifies the data in the database
-	NetworkMutex  *sync.Mutex   // NetworkMutex is for preventing concurrent writing to websocket
-	DatabaseMutex *sync.Mutex   // DatabaseMutex is for preventing concurrent operations to local database
-	Session       string        // Session is the session identifier
-	PollingAbort  chan struct{} // PollingAbort is for signalling the file system polling loop to terminate
-	ScannerAbort  chan struct{} // ScannerAbort is for signalling the recursive scanner to terminate
-	Debug         bool          // Debug indicates if debugging logging should be used
-	RetryDelay    time.Duration // RetryDelay is delay before attempting reconnect
-	FilePath      string        // FilePath is the file or directory to upload form
-	FileMode      fileMode      // FileMode indicates type of file mode being used (regular file or directory provided)
-	FileScan      time.Duration // FileScan indicates how often to scan for new files on the file system
-	FileChunkSize int           // FileChunkSize indicates number of lines to send in frame
-	EncryptionKey string        // Encryption key is the key used to encrypt the connection to the backend
-	Encryption    bool          // Whether the payload data is encrypted before transmission
+	AssetID       string         // AssetID identifies the data in the database
+	DatabaseMutex *sync.Mutex    // DatabaseMutex is for preventing concurrent operations to local database
+	Session       string         // Session is the session identifier
+	ScannerAbort  chan struct{}  // ScannerAbort is for signalling the recursive scanner to terminate
+	Debug         bool           // Debug indicates if debugging logging should be used
+	RetryDelay    time.Duration  // RetryDelay is delay before attempting reconnect
+	Sensor        string         // Sensor is the name of the sensor, empty for a single unnamed path
+	Tags          []string       // Tags are the tags of the sensor reported to the backend
+	Database      string         // Database is the path of the local database of the sensor
+	FilePath      string         // FilePath is the file or directory to upload form
+	FileMode      fileMode       // FileMode indicates type of file mode being used (regular file or directory provided)
+	FileScan      time.Duration  // FileScan indicates how often to scan for new files on the file system
+	FileChunkSize int            // FileChunkSize indicates number of lines to send in frame
+	MaxChunkSize  int            // MaxChunkSize is the largest number of lines to send in frame
+	Whitelist     []string       // Whitelist are the names of the log files to send
+	Profile       *Profile       // Profile is the configuration profile applied, nil if none was pushed
+	EncryptionKey string         // EncryptionKey is the legacy shared key, proven once by clients approved before identity keys
+	Encryption    bool           // Whether the payload data is encrypted before transmission
+	MustEncrypt   bool           // MustEncrypt is whether the backend requires encrypted payloads
+	CAFile        string         // CAFile is the CA certificate used to verify the backend, system roots if empty
+	CertKey       string         // CertKey is the PEM encoded private key of the client certificate
+	Certificate   string         // Certificate is the PEM encoded client certificate, empty until issued by the backend
+	IdentityKey   string         // IdentityKey is the base64 X25519 private key identifying the client to the backend
+	ServerKey     string         // ServerKey is the base64 X25519 static public key of the backend, pinned on first connection
+	Cipher        *cipherSession // Cipher is the payload key and frame counters of the connection
+	Health        *health        // Health tracks the file progress and parse errors reported in status frames
+	Flow          *flowControl   // Flow holds the data frame credits granted by the backend
+	Hooks         *Hooks         // Hooks are called as data frames are sent and acknowledged
+	Spool         *spool         // Spool holds the frames read while the backend is unreachable, nil if disabled
+	Connected     time.Time      // Connected is when the connection to the backend succeeded, zero if it did not
+	Stage         string         // Stage is the connection stage reached, logged when reconnecting
+	DialTimeout   time.Duration  // DialTimeout is how long to wait for the backend to accept the connection
+	ReplyTimeout  time.Duration  // ReplyTimeout is how long to wait for each handshake message
 }
@@ -2,13 +2,9 @@ package engine
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
-	"io"
 	"log"
 	"net"
 	"net/http"
@@ -16,33 +12,27 @@ import (
 	"time"
 
 	"nhooyr.io/websocket"
-	"nhooyr.io/websocket/wsjson"
 )
 
 type Message struct {
-	MsgType int    `json:"type,omitempty"` // Message type: 0 - Misc, 1 - Ping, 2 - connection success, 3 - Wait on approval, 4 - Approved
-	Msg     string `json:"msg,omitempty"`
-}
-
-type MessageChannels struct {
-	pingQueue     chan *Message
-	approvedQueue chan *Message
-	goAwayQueue   chan int
+	MsgType  int          `json:"type,omitempty"`     // Message type: 0 - Misc, 1 - Ping, 2 - connection success, 3 - Wait on approval, 4 - Approved, 5 - Key exchange, 6 - Flow credits, 7 - Profile
+	Msg      string       `json:"msg,omitempty"`      // For approved and connection success, the issued client certificate if any
+	Exchange *KeyExchange `json:"exchange,omitempty"` // For key exchange, the key agreement values
+	Credits  int          `json:"credits,omitempty"`  // For flow credits, the number of additional data frames that may be sent
+	Profile  *Profile     `json:"profile,omitempty"`  // For profile, the configuration to apply
 }
 
 type Authorization struct {
-	Key     string `json:"key"`
-	AssetID string `json:"assetId"`
-	Address string `json:"address"`
-}
-
-var queues = &MessageChannels{
-	pingQueue:     make(chan *Message, 10000),
-	approvedQueue: make(chan *Message, 1000),
-	goAwayQueue:   make(chan int, 1000),
+	AssetID     string `json:"assetId"`
+	Address     string `json:"address"`
+	IdentityKey string `json:"identityKey"`   // Base64 X25519 identity public key, pinned by the backend at approval
+	CSR         string `json:"csr,omitempty"` // PEM encoded certificate signing request, sent when a certificate is needed
 }
 
-func ConnectWebsocketServer(s *state, db *database, endpoint string) error {
+// ConnectWebsocketServer connects to the backend endpoint and sends log entries
+// until the connection fails or shutdown is cancelled. Every goroutine of the
+// connection has stopped when it returns.
+func ConnectWebsocketServer(shutdown context.Context, s *state, db *database, endpoint string) error {
 	// Attempt connection to server
 
 	log.Printf("[CanIDS] attempting connection to %s\n", endpoint)
@@ -66,167 +56,163 @@ func ConnectWebsocketServer(s *state, db *database, endpoint string) error {
 		address = strings.Join(addressesStr, " ")
 	}
 
+	identity, err := identityKey(s)
+	if err != nil {
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
+		return err
+	}
+
 	auth := Authorization{
-		Key:     s.EncryptionKey,
-		AssetID: s.AssetID,
-		Address: address,
+		AssetID:     s.AssetID,
+		Address:     address,
+		IdentityKey: base64.StdEncoding.EncodeToString(identity.PublicKey().Bytes()),
+	}
+
+	// request a client certificate if none is valid
+	if needsCertificate(s) {
+		auth.CSR, err = createCSR(s)
+		if err != nil {
+			log.Printf("[CanIDS] failed to create certificate request. %s\n", err)
+		}
+	}
+
+	// verify the backend and present the client certificate over TLS
+	config, err := tlsConfig(s)
+	if err != nil {
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
+		return err
+	}
+	dialOptions.HTTPClient = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: config},
 	}
 
 	jsonbytes, err := json.Marshal(auth)
 	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
 		return err
 	}
 
 	dialOptions.HTTPHeader.Set("Authorization", base64.StdEncoding.EncodeToString(jsonbytes))
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*1)
+	s.Stage = "dial"
+	ctx, cancel := context.WithTimeout(shutdown, s.DialTimeout)
 	conn, _, err := websocket.Dial(ctx, endpoint, &dialOptions)
 	cancel()
 	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
 		return err
 	}
-	// Defer closure for client exit
-	defer conn.Close(websocket.StatusInternalError, "WebSocket closed")
+	// Close the connection and stop its goroutines on exit
+	sess := newSession(shutdown, s, db, conn)
+	defer sess.close()
 
 	// Get status message for whether found in elasticsearch or not
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
-	var msg Message
-	err = wsjson.Read(ctx, conn, &msg)
+	s.Stage = "handshake"
+	msg, err := sess.receive(s.ReplyTimeout)
 	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
 		return err
 	}
-	cancel()
 
 	if msg.MsgType == 3 {
 
-		go wsReader(s, conn)
+		s.Stage = "approval"
 
-		// Waiting process...
-		for {
-			approved := false
-			var frame *UploadRequest
-			select {
-			case <-queues.pingQueue:
-				frame = generatePongFrame(s)
-			case <-queues.approvedQueue:
-				log.Printf("Approved")
-				approved = true
-			}
-			if approved {
-				queues.goAwayQueue <- 0
-				break
-			}
-			ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
-			// Send frame to WebSocket server
-			err = wsjson.Write(ctx, conn, frame)
+		// Waiting process, pings are answered by the reader
+		for msg.MsgType != 4 {
+			msg, err = sess.receive(0)
 			if err != nil {
-				log.Println("[CanIDS] failed to send frame over WebSocket", err)
-				log.Println("[CanIDS] retrying in", s.RetryDelay)
-				conn.Close(websocket.StatusInternalError, "WebSocket closed")
-				cancel()
+				log.Printf("[CanIDS] connection closed while awaiting approval. %s\n", err)
 				return err
 			}
-			cancel()
 		}
+		storeCertificate(s, db, msg.Msg)
 	}
 	log.Println("Approved")
 
-	// Get random message for handshake
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
-	err = wsjson.Read(ctx, conn, &msg)
-	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
-		return err
-	}
-	cancel()
-
-	// Decode message
-	text, err := base64.StdEncoding.DecodeString(msg.Msg)
+	// Agree on the session keys, authenticating the backend by its pinned key
+	s.Stage = "key exchange"
+	cipher, err := clientExchange(s, db, sess)
 	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
 		return err
 	}
+	s.Cipher = cipher
 
-	// Decode encryption key
-	key, err := base64.StdEncoding.DecodeString(s.EncryptionKey)
+	msg, err = sess.receive(s.ReplyTimeout)
 	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
 		return err
 	}
 
-	// Encrypt received message
-	encrypted, err := Encrypt(text, key)
-	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
-		return err
-	}
-
-	// Encode and write message
-	encodedString := base64.StdEncoding.EncodeToString(encrypted)
-
-	msg.Msg = encodedString
-	msg.MsgType = 0
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
-	wsjson.Write(ctx, conn, msg)
-	cancel()
-
-	ctx, cancel = context.WithTimeout(context.Background(), time.Second*1)
-	err = wsjson.Read(ctx, conn, &msg)
-	if err != nil {
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
-		return err
-	}
-	cancel()
-
 	if msg.MsgType != 2 {
 		err = errNoSuccess
-		log.Printf("[CanIDS] failed to establish connection. %s. retrying in %s\n", err, s.RetryDelay)
+		log.Printf("[CanIDS] failed to establish connection. %s\n", err)
 		return err
 	}
 
 	//Success message
 
 	log.Println("Successful connection")
+	s.Stage = "stream"
+	s.Connected = time.Now()
+	storeCertificate(s, db, msg.Msg)
 
-	go wsReader(s, conn)
+	// Report the client health to the backend periodically
+	sess.spawn(func() { statusLoop(sess) })
 	// Start period poll of file system for new files and stale files
-	go fsPollingLoop(s, db)
+	sess.spawn(func() { fsPollingLoop(sess) })
 
 	// Start file scanner
+	stalled := false
 	for {
 
-		var frame *UploadRequest
-		select {
-		case <-queues.pingQueue:
-			frame = generatePongFrame(s)
-		default:
-			// Get next frame, generate JSON payload
-			frame, err = scannerGetFrame(s, db, key)
-			if err != nil {
-				log.Println("[CanIDS] failed to generate frame", err)
+		if s.Flow.available() == 0 {
+			// Wait for the backend to index frames and grant credits, sending
+			// smaller frames once it does
+			if !stalled {
+				adaptChunkSize(s, true)
+				stalled = true
+			}
+			select {
+			case <-s.Flow.granted:
 				continue
+			case <-sess.ctx.Done():
+				return sess.error()
 			}
 		}
 
-		if s.Encryption {
-			frame.Header.Encrypted = true
+		// Get next frame, spooled frames first, generate JSON payload
+		frame, segment, err := nextFrame(s, db)
+		if sess.ctx.Err() != nil {
+			// the scanner was woken because the session ended
+			return sess.error()
+		}
+		if err == nil {
+			err = sealFrame(s, frame)
+		}
+		if err != nil {
+			log.Println("[CanIDS] failed to generate frame", err)
+			if frame != nil {
+				s.Hooks.failed(frame, err)
+			}
+			continue
+		}
+		s.Flow.use()
+		if !stalled {
+			adaptChunkSize(s, false)
 		}
+		stalled = false
 
-		ctx, cancel = context.WithTimeout(context.Background(), time.Second*5)
 		// Send frame to WebSocket server
-		err = wsjson.Write(ctx, conn, frame)
+		var acked func()
+		if segment != "" {
+			acked = func() { s.Spool.acknowledged(segment) }
+		}
+		err = sess.sendFrame(frame, acked)
 		if err != nil {
-			log.Println("[CanIDS] failed to send frame over WebSocket", err)
-			log.Println("[CanIDS] retrying in", s.RetryDelay)
-			close(s.PollingAbort)
-			conn.Close(websocket.StatusInternalError, "WebSocket closed")
-			cancel()
 			return err
 		}
-		cancel()
 
 		//log.Printf("[CanIDS] successful frame sent")
 		// if s.Debug {
@@ -236,107 +222,57 @@ func ConnectWebsocketServer(s *state, db *database, endpoint string) error {
 	}
 }
 
+// nextFrame returns the oldest spooled frame, or the next frame read from the
+// log files once the spool is drained. It also returns the spool segment of a
+// spooled frame, deleted once the backend acknowledged its frames.
+func nextFrame(s *state, db *database) (*UploadRequest, string, error) {
+	if s.Spool != nil {
+		if spooled, segment := s.Spool.take(); spooled != nil {
+			return spooled, segment, nil
+		}
+	}
+	frame, err := scannerGetFrame(s, db, s.ScannerAbort)
+	return frame, "", err
+}
+
+// storeCertificate saves the client certificate sent by the backend, if any.
+// It is presented on the next connection.
+func storeCertificate(s *state, db *database, certificate string) {
+	if certificate == "" {
+		return
+	}
+	err := saveCertificate(s, db, certificate)
+	if err != nil {
+		log.Println("[CanIDS] failed to save client certificate", err)
+		return
+	}
+	log.Println("[CanIDS] client certificate issued")
+}
+
 // fsPollingLoop will perodically synchronize the local database for new/removed
-// files in the specified directory.
-func fsPollingLoop(s *state, db *database) {
+// files in the specified directory until the session ends.
+func fsPollingLoop(sess *session) {
+	s, db := sess.s, sess.db
 	for {
 		select {
-		case <-s.PollingAbort:
-			// received exit signal from event loop, terminate self
+		case <-sess.ctx.Done():
+			// the session ended, terminate self
 			return
-		default:
+		case <-time.After(s.FileScan):
 			// sync the scanner to retreive latest database
 			new, err := syncScanner(s)
 			if err != nil {
 				log.Println("[CanIDS] local database error:", err)
+				continue
 			}
+			s.DatabaseMutex.Lock()
 			db.Next = new.Next
 			db.Files = new.Files
-			time.Sleep(s.FileScan)
+			s.DatabaseMutex.Unlock()
 		}
 	}
 }
 
-func wsReader(s *state, conn *websocket.Conn) {
-	for {
-		select {
-		case x := <-queues.goAwayQueue:
-			if x == 0 {
-				log.Println("wsReader going away")
-				return
-			}
-		default:
-
-		}
-		var msg Message
-		err := wsjson.Read(context.Background(), conn, &msg)
-		if err != nil {
-			log.Println("Invalid message reived")
-			break
-		}
-
-		if msg.MsgType == 1 {
-			queues.pingQueue <- &msg
-		} else if msg.MsgType == 4 {
-			queues.approvedQueue <- &msg
-		}
-	}
-}
-
-func Encrypt(text []byte, key []byte) ([]byte, error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		log.Println("Failed to generate cipher")
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(c)
-	if err != nil {
-		log.Println("Failed to generate gcm")
-		return nil, err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
-	}
-
-	return gcm.Seal(nonce, nonce, text, nil), nil
-}
-
-func Decrypt(text []byte, key []byte) ([]byte, error) {
-	c, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(c)
-	if err != nil {
-		return nil, err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(text) < nonceSize {
-		return nil, errors.New("ciphertext too short")
-	}
-
-	nonce, text := text[:nonceSize], text[nonceSize:]
-	return gcm.Open(nil, nonce, text, nil)
-}
-
-// Creates and returns base64 encoded 32 byte encryption key
-func CreateKey() (string, error) {
-	key := make([]byte, 32)
-
-	_, err := rand.Read(key)
-	if err != nil {
-		log.Println("Failed to generate key ", err)
-		return "", err
-	}
-
-	return base64.StdEncoding.EncodeToString(key), nil
-}
-
 func CreateAssetID() (string, error) {
 	key := make([]byte, 8)
 	const chars = "abcdefghijklmnopqrstuvwxyz"